@@ -0,0 +1,82 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/cmd/evm/internal/debugger"
+	"github.com/ethereum/go-ethereum/cmd/evm/internal/t8ntool"
+	"github.com/urfave/cli/v2"
+)
+
+var DebugTxFlag = &cli.IntFlag{
+	Name:  "tx",
+	Usage: "index of the transaction to debug when replaying a state transition",
+}
+
+var debugCommand = &cli.Command{
+	Action: debugCmd,
+	Name:   "debug",
+	Usage:  "step through the execution of evm code",
+	Description: `The debug command executes EVM code like the run command, or replays a
+transaction of a state transition given by --input.alloc, --input.env and
+--input.txs, and steps through the recorded execution interactively.
+
+Breakpoints can be set on program counters and opcodes, and the execution can
+be stepped through forwards as well as backwards. Commands are read from stdin,
+type 'help' for the list of commands.`,
+	Flags: []cli.Flag{
+		t8ntool.InputAllocFlag,
+		t8ntool.InputEnvFlag,
+		t8ntool.InputTxsFlag,
+		t8ntool.ForknameFlag,
+		t8ntool.ChainIDFlag,
+		t8ntool.RewardFlag,
+		DebugTxFlag,
+	},
+}
+
+func debugCmd(ctx *cli.Context) error {
+	recorder := debugger.NewRecorder()
+
+	replay := ctx.IsSet(t8ntool.InputAllocFlag.Name) || ctx.IsSet(t8ntool.InputEnvFlag.Name) || ctx.IsSet(t8ntool.InputTxsFlag.Name)
+	if replay {
+		for _, flag := range []string{t8ntool.InputAllocFlag.Name, t8ntool.InputEnvFlag.Name, t8ntool.InputTxsFlag.Name} {
+			if ctx.String(flag) == "stdin" {
+				return fmt.Errorf("--%s can't be read from stdin, it is used for the debugger commands", flag)
+			}
+		}
+		if err := t8ntool.Replay(ctx, ctx.Int(DebugTxFlag.Name), recorder); err != nil {
+			return err
+		}
+	} else {
+		env, err := newRunEnv(ctx, recorder)
+		if err != nil {
+			return err
+		}
+		// Execution errors are captured by the recorder
+		env.exec()
+	}
+	if output, err := recorder.Output(); err != nil {
+		fmt.Printf("Execution failed after %d steps: %v\n", len(recorder.Steps()), err)
+	} else {
+		fmt.Printf("Execution returned 0x%x in %d steps\n", output, len(recorder.Steps()))
+	}
+	return debugger.New(recorder.Steps(), os.Stdout).Run(os.Stdin)
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+	"github.com/urfave/cli/v2"
+)
+
+// newGasProfiler creates the gas profiling tracer if a gas profile was requested,
+// or returns nil otherwise. The profile is accumulated over all executions.
+func newGasProfiler(ctx *cli.Context) (tracers.Tracer, error) {
+	if !ctx.IsSet(GasProfileFlag.Name) {
+		return nil, nil
+	}
+	if ctx.Bool(MachineFlag.Name) || ctx.Bool(DebugFlag.Name) {
+		return nil, fmt.Errorf("--%s can't be combined with --%s or --%s", GasProfileFlag.Name, MachineFlag.Name, DebugFlag.Name)
+	}
+	cfg, err := json.Marshal(map[string]string{"format": ctx.String(GasProfileFormatFlag.Name)})
+	if err != nil {
+		return nil, err
+	}
+	return tracers.DefaultDirectory.New("gasProfiler", new(tracers.Context), cfg)
+}
+
+// writeGasProfile writes the profile collected by the gas profiling tracer to
+// the path given by the user.
+func writeGasProfile(ctx *cli.Context, profiler tracers.Tracer) error {
+	res, err := profiler.GetResult()
+	if err != nil {
+		return err
+	}
+	var profile []byte
+	switch ctx.String(GasProfileFormatFlag.Name) {
+	case "pprof":
+		var blob hexutil.Bytes
+		if err := json.Unmarshal(res, &blob); err != nil {
+			return err
+		}
+		profile = blob
+	default:
+		var folded string
+		if err := json.Unmarshal(res, &folded); err != nil {
+			return err
+		}
+		profile = []byte(folded)
+	}
+	if err := os.WriteFile(ctx.String(GasProfileFlag.Name), profile, 0644); err != nil {
+		return fmt.Errorf("could not write gas profile: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+const helpText = `Commands:
+  step [n]          (s)   execute the next n instructions
+  back [n]          (b)   step back n instructions
+  continue          (c)   run forward until the next breakpoint
+  rcontinue         (rc)  run backwards until the previous breakpoint
+  goto <n>                jump to the n-th instruction
+  break <pc|opcode>       add a breakpoint on a pc or an opcode
+  delete [pc|opcode]      remove a breakpoint, or all of them
+  breakpoints             list the breakpoints
+  info              (i)   show the current instruction
+  stack                   show the stack, top first
+  memory                  show the memory
+  storage                 show the known storage of the current contract
+  returndata              show the return data of the last call
+  help              (h)   show this help
+  quit              (q)   exit the debugger
+`
+
+// Debugger steps through a recorded execution. As all the states are recorded,
+// it can move backwards as well as forwards.
+type Debugger struct {
+	steps    []Step
+	pos      int
+	pcBreaks map[uint64]struct{}
+	opBreaks map[vm.OpCode]struct{}
+	out      io.Writer
+}
+
+// New creates a debugger over the given steps, writing its output to out.
+func New(steps []Step, out io.Writer) *Debugger {
+	return &Debugger{
+		steps:    steps,
+		pcBreaks: make(map[uint64]struct{}),
+		opBreaks: make(map[vm.OpCode]struct{}),
+		out:      out,
+	}
+}
+
+// Run reads commands from in and executes them until the input ends or the
+// user quits.
+func (d *Debugger) Run(in io.Reader) error {
+	if len(d.steps) == 0 {
+		fmt.Fprintln(d.out, "No instructions were executed")
+		return nil
+	}
+	d.printStep()
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(d.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+		quit, err := d.Execute(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(d.out, "Error:", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Execute runs a single command, and reports whether the debugger should exit.
+func (d *Debugger) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "step", "s":
+		n, err := countArg(args)
+		if err != nil {
+			return false, err
+		}
+		d.move(d.pos + n)
+	case "back", "b":
+		n, err := countArg(args)
+		if err != nil {
+			return false, err
+		}
+		d.move(d.pos - n)
+	case "continue", "c":
+		d.move(d.findBreak(d.pos+1, 1))
+	case "rcontinue", "rc":
+		d.move(d.findBreak(d.pos-1, -1))
+	case "goto":
+		if len(args) != 1 {
+			return false, errors.New("usage: goto <n>")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, fmt.Errorf("invalid instruction index %q", args[0])
+		}
+		d.move(n)
+	case "break":
+		if len(args) != 1 {
+			return false, errors.New("usage: break <pc|opcode>")
+		}
+		return false, d.setBreak(args[0], true)
+	case "delete":
+		if len(args) == 0 {
+			d.pcBreaks = make(map[uint64]struct{})
+			d.opBreaks = make(map[vm.OpCode]struct{})
+			return false, nil
+		}
+		return false, d.setBreak(args[0], false)
+	case "breakpoints":
+		d.printBreaks()
+	case "info", "i":
+		d.printStep()
+	case "stack":
+		d.printStack()
+	case "memory":
+		d.printData(d.steps[d.pos].Memory())
+	case "storage":
+		d.printStorage()
+	case "returndata":
+		d.printData(d.steps[d.pos].ReturnData)
+	case "help", "h":
+		fmt.Fprint(d.out, helpText)
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return false, nil
+}
+
+// move jumps to the given instruction, bounded by the recorded range.
+func (d *Debugger) move(pos int) {
+	switch {
+	case pos < 0:
+		pos = 0
+		fmt.Fprintln(d.out, "Start of execution")
+	case pos >= len(d.steps):
+		pos = len(d.steps) - 1
+		fmt.Fprintln(d.out, "End of execution")
+	}
+	d.pos = pos
+	d.printStep()
+}
+
+// findBreak returns the first instruction hitting a breakpoint, starting at pos
+// and moving in the given direction. If there is none, the position past the
+// end of the recording is returned.
+func (d *Debugger) findBreak(pos int, dir int) int {
+	for ; pos >= 0 && pos < len(d.steps); pos += dir {
+		if _, ok := d.pcBreaks[d.steps[pos].Pc]; ok {
+			return pos
+		}
+		if _, ok := d.opBreaks[d.steps[pos].Op]; ok {
+			return pos
+		}
+	}
+	return pos
+}
+
+// setBreak adds or removes a breakpoint. Numbers are program counters, anything
+// else an opcode name.
+func (d *Debugger) setBreak(arg string, set bool) error {
+	if pc, err := strconv.ParseUint(arg, 0, 64); err == nil {
+		if set {
+			d.pcBreaks[pc] = struct{}{}
+		} else {
+			delete(d.pcBreaks, pc)
+		}
+		return nil
+	}
+	name := strings.ToUpper(arg)
+	op := vm.StringToOp(name)
+	if op == vm.STOP && name != "STOP" {
+		return fmt.Errorf("invalid breakpoint %q, expected a pc or an opcode", arg)
+	}
+	if set {
+		d.opBreaks[op] = struct{}{}
+	} else {
+		delete(d.opBreaks, op)
+	}
+	return nil
+}
+
+func (d *Debugger) printBreaks() {
+	if len(d.pcBreaks) == 0 && len(d.opBreaks) == 0 {
+		fmt.Fprintln(d.out, "No breakpoints")
+		return
+	}
+	pcs := make([]uint64, 0, len(d.pcBreaks))
+	for pc := range d.pcBreaks {
+		pcs = append(pcs, pc)
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+	for _, pc := range pcs {
+		fmt.Fprintf(d.out, "pc %d\n", pc)
+	}
+	ops := make([]string, 0, len(d.opBreaks))
+	for op := range d.opBreaks {
+		ops = append(ops, op.String())
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		fmt.Fprintf(d.out, "op %s\n", op)
+	}
+}
+
+func (d *Debugger) printStep() {
+	step := d.steps[d.pos]
+	fmt.Fprintf(d.out, "[%d/%d] depth %d %s pc %d %s gas %d cost %d\n",
+		d.pos, len(d.steps)-1, step.Depth, step.Address.Hex(), step.Pc, step.Op, step.Gas, step.Cost)
+	if step.Err != nil {
+		fmt.Fprintln(d.out, "Failed:", step.Err)
+	}
+}
+
+func (d *Debugger) printStack() {
+	stack := d.steps[d.pos].Stack
+	if len(stack) == 0 {
+		fmt.Fprintln(d.out, "Empty stack")
+		return
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(d.out, "%4d: %s\n", len(stack)-1-i, stack[i].Hex())
+	}
+}
+
+// printData prints the data in rows of 32 bytes, prefixed by their offset.
+func (d *Debugger) printData(data []byte) {
+	if len(data) == 0 {
+		fmt.Fprintln(d.out, "Empty")
+		return
+	}
+	for offset := 0; offset < len(data); offset += 32 {
+		end := offset + 32
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(d.out, "%#06x: %x\n", offset, data[offset:end])
+	}
+}
+
+func (d *Debugger) printStorage() {
+	storage := d.steps[d.pos].Storage
+	if len(storage) == 0 {
+		fmt.Fprintln(d.out, "No storage accessed")
+		return
+	}
+	slots := make([]common.Hash, 0, len(storage))
+	for slot := range storage {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return bytes.Compare(slots[i][:], slots[j][:]) < 0 })
+	for _, slot := range slots {
+		fmt.Fprintf(d.out, "%s: %s\n", slot.Hex(), storage[slot].Hex())
+	}
+}
+
+// countArg parses the optional repetition count of a command.
+func countArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
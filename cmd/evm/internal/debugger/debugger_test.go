@@ -0,0 +1,154 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+)
+
+func record(t *testing.T, code []byte) *Recorder {
+	t.Helper()
+
+	recorder := NewRecorder()
+	_, _, err := runtime.Execute(code, nil, &runtime.Config{
+		GasLimit:  100000,
+		EVMConfig: vm.Config{Debug: true, Tracer: recorder},
+	})
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	return recorder
+}
+
+func TestRecorder(t *testing.T) {
+	// MSTORE(0, 42); SSTORE(0, 1); SLOAD(0); STOP
+	code := common.FromHex("602a60005260016000556000545000")
+	steps := record(t, code).Steps()
+	if len(steps) != 10 {
+		t.Fatalf("step count mismatch: have %d, want 10", len(steps))
+	}
+	sstore := steps[5]
+	if sstore.Op != vm.SSTORE || sstore.Pc != 9 || len(sstore.Stack) != 2 || sstore.Stack[1].Uint64() != 0 || sstore.Stack[0].Uint64() != 1 {
+		t.Fatalf("unexpected SSTORE step: %+v", sstore)
+	}
+	if len(sstore.Storage) != 0 {
+		t.Errorf("storage written before SSTORE: %v", sstore.Storage)
+	}
+	if have := steps[6].Storage[common.Hash{}]; have != common.BigToHash(common.Big1) {
+		t.Errorf("storage after SSTORE mismatch: have %x", have)
+	}
+	if mem := sstore.Memory(); len(mem) != 32 || mem[31] != 42 {
+		t.Errorf("memory mismatch: %x", mem)
+	}
+	if mem := steps[0].Memory(); len(mem) != 0 {
+		t.Errorf("memory before MSTORE: %x", mem)
+	}
+}
+
+// TestRecorderMemory checks that the memory recorded as diffs is reconstructed
+// correctly across full snapshots, and that unchanged memory isn't recorded again.
+func TestRecorderMemory(t *testing.T) {
+	// MSTORE8(i, i) for i in 0..99, then MSTORE(32, 0)
+	var code []byte
+	for i := 0; i < 100; i++ {
+		code = append(code, byte(vm.PUSH1), byte(i), byte(vm.DUP1), byte(vm.MSTORE8))
+	}
+	code = append(code, byte(vm.PUSH1), 0, byte(vm.PUSH1), 32, byte(vm.MSTORE), byte(vm.STOP))
+
+	var (
+		steps = record(t, code).Steps()
+		want  = make([]byte, 0, 128)
+	)
+	for i := 0; i < 100; i++ {
+		step := steps[3*i+2]
+		if mem := step.Memory(); !bytes.Equal(mem, want) {
+			t.Fatalf("memory before MSTORE8 %d mismatch:\nhave %x\nwant %x", i, mem, want)
+		}
+		if i > 0 && step.memory != steps[3*i].memory {
+			t.Errorf("unchanged memory recorded again at step %d", 3*i+2)
+		}
+		if i%32 == 0 {
+			want = append(want, make([]byte, 32)...)
+		}
+		want[i] = byte(i)
+	}
+	copy(want[32:64], make([]byte, 32))
+	if mem := steps[len(steps)-1].Memory(); !bytes.Equal(mem, want) {
+		t.Errorf("final memory mismatch:\nhave %x\nwant %x", mem, want)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	code := common.FromHex("602a60005260016000556000545000")
+	var (
+		out bytes.Buffer
+		d   = New(record(t, code).Steps(), &out)
+	)
+	for _, tt := range []struct {
+		cmd  string
+		want string
+	}{
+		{"step 2", "[2/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 4 MSTORE gas 99994 cost 6\n"},
+		{"stack", "   0: 0x0\n   1: 0x2a\n"},
+		{"back 5", "Start of execution\n[0/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 0 PUSH1 gas 100000 cost 3\n"},
+		{"break SLOAD", ""},
+		{"break 9", ""},
+		{"breakpoints", "pc 9\nop SLOAD\n"},
+		{"c", "[5/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 9 SSTORE gas 99982 cost 22100\n"},
+		{"storage", "No storage accessed\n"},
+		{"memory", "0x000000: 000000000000000000000000000000000000000000000000000000000000002a\n"},
+		{"c", "[7/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 12 SLOAD gas 77879 cost 100\n"},
+		{"storage", "0x0000000000000000000000000000000000000000000000000000000000000000: 0x0000000000000000000000000000000000000000000000000000000000000001\n"},
+		{"c", "End of execution\n[9/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 14 STOP gas 77777 cost 0\n"},
+		{"rc", "[7/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 12 SLOAD gas 77879 cost 100\n"},
+		{"delete 9", ""},
+		{"rc", "Start of execution\n[0/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 0 PUSH1 gas 100000 cost 3\n"},
+		{"goto 8", "[8/9] depth 1 0x000000000000000000000000636F6E7472616374 pc 13 POP gas 77779 cost 2\n"},
+		{"delete", ""},
+		{"breakpoints", "No breakpoints\n"},
+	} {
+		out.Reset()
+		if _, err := d.Execute(tt.cmd); err != nil {
+			t.Fatalf("command %q failed: %v", tt.cmd, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("command %q output mismatch:\nhave %q\nwant %q", tt.cmd, out.String(), tt.want)
+		}
+	}
+	for _, cmd := range []string{"break FOO", "step x", "goto", "nonsense"} {
+		if _, err := d.Execute(cmd); err == nil {
+			t.Errorf("command %q didn't fail", cmd)
+		}
+	}
+	if quit, _ := d.Execute("quit"); !quit {
+		t.Errorf("quit didn't exit")
+	}
+	// Commands read from the input end on quit
+	out.Reset()
+	if err := New(record(t, code).Steps(), &out).Run(strings.NewReader("s\nq\ns\n")); err != nil {
+		t.Fatalf("debugger failed: %v", err)
+	}
+	if have := strings.Count(out.String(), "> "); have != 2 {
+		t.Errorf("prompt count mismatch: have %d, want 2\n%s", have, out.String())
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// Package debugger implements a step-through debugger over a recorded EVM
+// execution.
+package debugger
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// memoryCheckpoint is the number of steps after which the full memory of a call
+// frame is recorded instead of a diff, bounding the cost of reconstructing it.
+const memoryCheckpoint = 64
+
+// Storage is the known storage of a contract. Snapshots are never modified, a
+// change creates a new snapshot.
+type Storage map[common.Hash]common.Hash
+
+// Step is the state of the EVM before the execution of an instruction.
+type Step struct {
+	Pc         uint64
+	Op         vm.OpCode
+	Gas        uint64
+	Cost       uint64
+	Depth      int
+	Address    common.Address // Address whose storage is accessed
+	Stack      []uint256.Int
+	ReturnData []byte
+	Storage    Storage // Slots of Address read or written so far
+	Err        error   // Error the instruction failed with
+
+	memory *memoryDiff
+}
+
+// Memory returns the memory of the call frame before the instruction.
+func (s *Step) Memory() []byte {
+	return s.memory.memory()
+}
+
+// memoryDiff is the memory of a call frame at a step, recorded as the bytes which
+// changed since the previous step of the frame. Steps which don't change the
+// memory share the diff of the previous one. Every memoryCheckpoint diffs, the
+// full memory is recorded instead.
+type memoryDiff struct {
+	prev   *memoryDiff // Memory at the previous change, nil for a full snapshot
+	diffs  int         // Number of diffs since the last full snapshot
+	size   int         // Size of the memory
+	offset int         // Offset of the changed bytes
+	data   []byte      // Changed bytes
+}
+
+// memory reconstructs the full memory.
+func (m *memoryDiff) memory() []byte {
+	if m == nil {
+		return nil
+	}
+	if m.prev == nil {
+		return common.CopyBytes(m.data)
+	}
+	mem := m.prev.memory()
+	mem = append(mem, make([]byte, m.size-len(mem))...)
+	copy(mem[m.offset:], m.data)
+	return mem
+}
+
+// frameMemory tracks the memory of an open call frame.
+type frameMemory struct {
+	last *memoryDiff // Recording of the memory at the last step
+	data []byte      // Memory at the last step
+}
+
+// record returns the recording of the given memory of the frame. Memory only
+// ever grows within a frame.
+func (f *frameMemory) record(mem []byte) *memoryDiff {
+	if f.last != nil && bytes.Equal(f.data, mem) {
+		return f.last
+	}
+	if f.last == nil || f.last.diffs+1 >= memoryCheckpoint {
+		f.data = append(f.data[:0], mem...)
+		f.last = &memoryDiff{size: len(mem), data: common.CopyBytes(mem)}
+		return f.last
+	}
+	// Find the range of changed bytes, including the expansion
+	lo, hi := 0, len(mem)
+	for lo < len(f.data) && f.data[lo] == mem[lo] {
+		lo++
+	}
+	if len(mem) == len(f.data) {
+		for hi > lo && f.data[hi-1] == mem[hi-1] {
+			hi--
+		}
+	}
+	f.data = append(f.data, mem[len(f.data):]...)
+	copy(f.data[lo:hi], mem[lo:hi])
+
+	f.last = &memoryDiff{prev: f.last, diffs: f.last.diffs + 1, size: len(mem), offset: lo, data: common.CopyBytes(mem[lo:hi])}
+	return f.last
+}
+
+// Recorder is an EVM logger which records the state of every executed
+// instruction, so the execution can be inspected in any order afterwards.
+type Recorder struct {
+	env     *vm.EVM
+	steps   []Step
+	storage map[common.Address]Storage   // Current storage snapshot per contract
+	frames  []map[common.Address]Storage // Storage snapshots at the start of the open calls
+	memory  []frameMemory                // Memory of the open calls by depth
+	output  []byte
+	err     error
+}
+
+// NewRecorder creates an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{storage: make(map[common.Address]Storage)}
+}
+
+// Steps returns the recorded instructions.
+func (r *Recorder) Steps() []Step {
+	return r.steps
+}
+
+// Output returns the return value and the error of the execution.
+func (r *Recorder) Output() ([]byte, error) {
+	return r.output, r.err
+}
+
+func (r *Recorder) CaptureTxStart(gasLimit uint64) {}
+
+func (r *Recorder) CaptureTxEnd(restGas uint64) {}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (r *Recorder) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	r.env = env
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (r *Recorder) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	r.output = common.CopyBytes(output)
+	r.err = err
+}
+
+// CaptureState records the state before the execution of an instruction.
+func (r *Recorder) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	var (
+		addr    = scope.Contract.Address()
+		stack   = scope.Stack.Data()
+		storage = r.storage[addr]
+	)
+	// A deeper step is the first one of a call, a shallower one follows the
+	// return from a call.
+	if depth > len(r.memory) {
+		r.memory = append(r.memory, frameMemory{})
+	}
+	r.memory = r.memory[:depth]
+
+	// Reads reveal the value the slot had all along
+	if op == vm.SLOAD && len(stack) >= 1 {
+		slot := common.Hash(stack[len(stack)-1].Bytes32())
+		if _, ok := storage[slot]; !ok {
+			storage = storage.with(slot, r.env.StateDB.GetState(addr, slot))
+			r.storage[addr] = storage
+		}
+	}
+	r.steps = append(r.steps, Step{
+		Pc:         pc,
+		Op:         op,
+		Gas:        gas,
+		Cost:       cost,
+		Depth:      depth,
+		Address:    addr,
+		Stack:      append([]uint256.Int{}, stack...),
+		memory:     r.memory[depth-1].record(scope.Memory.Data()),
+		ReturnData: common.CopyBytes(rData),
+		Storage:    storage,
+		Err:        err,
+	})
+	// Writes are visible from the next instruction on
+	if op == vm.SSTORE && len(stack) >= 2 && err == nil {
+		slot, value := common.Hash(stack[len(stack)-1].Bytes32()), common.Hash(stack[len(stack)-2].Bytes32())
+		r.storage[addr] = storage.with(slot, value)
+	}
+}
+
+// CaptureFault marks the last recorded instruction as failed.
+func (r *Recorder) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	if len(r.steps) > 0 {
+		r.steps[len(r.steps)-1].Err = err
+	}
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (r *Recorder) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	saved := make(map[common.Address]Storage, len(r.storage))
+	for addr, storage := range r.storage {
+		saved[addr] = storage
+	}
+	r.frames = append(r.frames, saved)
+}
+
+// CaptureExit discards the storage writes of failed calls.
+func (r *Recorder) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if len(r.frames) == 0 {
+		return
+	}
+	saved := r.frames[len(r.frames)-1]
+	r.frames = r.frames[:len(r.frames)-1]
+	if err != nil {
+		r.storage = saved
+	}
+}
+
+// with returns a copy of the storage with the given slot set.
+func (s Storage) with(slot, value common.Hash) Storage {
+	cpy := make(Storage, len(s)+1)
+	for k, v := range s {
+		cpy[k] = v
+	}
+	cpy[slot] = value
+	return cpy
+}
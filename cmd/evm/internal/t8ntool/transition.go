@@ -142,11 +142,67 @@ func Transition(ctx *cli.Context) error {
 			return nil, nil
 		}
 	}
+	input, err := loadInput(ctx)
+	if err != nil {
+		return err
+	}
+	input.vmConfig.Tracer, input.vmConfig.Debug = tracer, tracer != nil
+
+	// Run the test and aggregate the result
+	s, result, err := input.prestate.Apply(input.vmConfig, input.chainConfig, input.txs, ctx.Int64(RewardFlag.Name), getTracer)
+	if err != nil {
+		return err
+	}
+	body, _ := rlp.EncodeToBytes(input.txs)
+	// Dump the excution result
+	collector := make(Alloc)
+	s.DumpToCollector(collector, nil)
+	return dispatchOutput(ctx, baseDir, result, collector, body)
+}
+
+// Replay applies the state transition given by the input flags like Transition
+// does, but traces only the transaction at txIndex with the given tracer and
+// doesn't write any output. Rejected transactions don't count towards the index.
+func Replay(ctx *cli.Context, txIndex int, tracer vm.EVMLogger) error {
+	input, err := loadInput(ctx)
+	if err != nil {
+		return err
+	}
+	var traced bool
+	getTracer := func(i int, txHash common.Hash) (vm.EVMLogger, error) {
+		if i != txIndex {
+			return nil, nil
+		}
+		traced = true
+		return tracer, nil
+	}
+	if _, _, err := input.prestate.Apply(input.vmConfig, input.chainConfig, input.txs, ctx.Int64(RewardFlag.Name), getTracer); err != nil {
+		return err
+	}
+	if !traced {
+		return fmt.Errorf("transaction %d was not executed", txIndex)
+	}
+	return nil
+}
+
+// transitionInput is a state transition to apply, as given by the input flags.
+type transitionInput struct {
+	prestate    *Prestate
+	txs         types.Transactions
+	chainConfig *params.ChainConfig
+	vmConfig    vm.Config
+}
+
+// loadInput reads the alloc, env and transactions of a state transition from
+// the files or stdin as given by the input flags, and validates the environment
+// against the chain configuration.
+func loadInput(ctx *cli.Context) (*transitionInput, error) {
 	// We need to load three things: alloc, env and transactions. May be either in
 	// stdin input or in files.
 	// Check if anything needs to be read from stdin
 	var (
-		prestate Prestate
+		err      error
+		prestate = new(Prestate)
 		txs      types.Transactions // txs to apply
 		allocStr = ctx.String(InputAllocFlag.Name)
 
@@ -158,12 +214,12 @@ func Transition(ctx *cli.Context) error {
 	if allocStr == stdinSelector || envStr == stdinSelector || txStr == stdinSelector {
 		decoder := json.NewDecoder(os.Stdin)
 		if err := decoder.Decode(inputData); err != nil {
-			return NewError(ErrorJson, fmt.Errorf("failed unmarshaling stdin: %v", err))
+			return nil, NewError(ErrorJson, fmt.Errorf("failed unmarshaling stdin: %v", err))
 		}
 	}
 	if allocStr != stdinSelector {
 		if err := readFile(allocStr, "alloc", &inputData.Alloc); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	prestate.Pre = inputData.Alloc
@@ -172,20 +228,17 @@ func Transition(ctx *cli.Context) error {
 	if envStr != stdinSelector {
 		var env stEnv
 		if err := readFile(envStr, "env", &env); err != nil {
-			return err
+			return nil, err
 		}
 		inputData.Env = &env
 	}
 	prestate.Env = *inputData.Env
 
-	vmConfig := vm.Config{
-		Tracer: tracer,
-		Debug:  (tracer != nil),
-	}
+	var vmConfig vm.Config
 	// Construct the chainconfig
 	var chainConfig *params.ChainConfig
 	if cConf, extraEips, err := tests.GetChainConfig(ctx.String(ForknameFlag.Name)); err != nil {
-		return NewError(ErrorConfig, fmt.Errorf("failed constructing chain configuration: %v", err))
+		return nil, NewError(ErrorConfig, fmt.Errorf("failed constructing chain configuration: %v", err))
 	} else {
 		chainConfig = cConf
 		vmConfig.ExtraEips = extraEips
@@ -197,18 +250,18 @@ func Transition(ctx *cli.Context) error {
 	if txStr != stdinSelector {
 		inFile, err := os.Open(txStr)
 		if err != nil {
-			return NewError(ErrorIO, fmt.Errorf("failed reading txs file: %v", err))
+			return nil, NewError(ErrorIO, fmt.Errorf("failed reading txs file: %v", err))
 		}
 		defer inFile.Close()
 		decoder := json.NewDecoder(inFile)
 		if strings.HasSuffix(txStr, ".rlp") {
 			var body hexutil.Bytes
 			if err := decoder.Decode(&body); err != nil {
-				return err
+				return nil, err
 			}
 			var txs types.Transactions
 			if err := rlp.DecodeBytes(body, &txs); err != nil {
-				return err
+				return nil, err
 			}
 			for _, tx := range txs {
 				txsWithKeys = append(txsWithKeys, &txWithKey{
@@ -218,7 +271,7 @@ func Transition(ctx *cli.Context) error {
 			}
 		} else {
 			if err := decoder.Decode(&txsWithKeys); err != nil {
-				return NewError(ErrorJson, fmt.Errorf("failed unmarshaling txs-file: %v", err))
+				return nil, NewError(ErrorJson, fmt.Errorf("failed unmarshaling txs-file: %v", err))
 			}
 		}
 	} else {
@@ -227,7 +280,7 @@ func Transition(ctx *cli.Context) error {
 			body := common.FromHex(inputData.TxRlp)
 			var txs types.Transactions
 			if err := rlp.DecodeBytes(body, &txs); err != nil {
-				return err
+				return nil, err
 			}
 			for _, tx := range txs {
 				txsWithKeys = append(txsWithKeys, &txWithKey{
@@ -244,7 +297,7 @@ func Transition(ctx *cli.Context) error {
 	signer := types.LatestSignerForChainID(chainConfig.ChainID)
 
 	if txs, err = signUnsignedTransactions(txsWithKeys, signer); err != nil {
-		return NewError(ErrorJson, fmt.Errorf("failed signing transactions: %v", err))
+		return nil, NewError(ErrorJson, fmt.Errorf("failed signing transactions: %v", err))
 	}
 	// Sanity check, to not `panic` in state_transition
 	if chainConfig.IsLondon(big.NewInt(int64(prestate.Env.Number))) {
@@ -259,11 +312,11 @@ func Transition(ctx *cli.Context) error {
 			}
 			prestate.Env.BaseFee = misc.CalcBaseFee(chainConfig, parent)
 		} else {
-			return NewError(ErrorConfig, errors.New("EIP-1559 config but missing 'currentBaseFee' in env section"))
+			return nil, NewError(ErrorConfig, errors.New("EIP-1559 config but missing 'currentBaseFee' in env section"))
 		}
 	}
 	if chainConfig.IsShanghai(prestate.Env.Number) && prestate.Env.Withdrawals == nil {
-		return NewError(ErrorConfig, errors.New("Shanghai config but missing 'withdrawals' in env section"))
+		return nil, NewError(ErrorConfig, errors.New("Shanghai config but missing 'withdrawals' in env section"))
 	}
 	isMerged := chainConfig.TerminalTotalDifficulty != nil && chainConfig.TerminalTotalDifficulty.BitLen() == 0
 	env := prestate.Env
@@ -273,9 +326,9 @@ func Transition(ctx *cli.Context) error {
 		// - difficulty must be zero
 		switch {
 		case env.Random == nil:
-			return NewError(ErrorConfig, errors.New("post-merge requires currentRandom to be defined in env"))
+			return nil, NewError(ErrorConfig, errors.New("post-merge requires currentRandom to be defined in env"))
 		case env.Difficulty != nil && env.Difficulty.BitLen() != 0:
-			return NewError(ErrorConfig, errors.New("post-merge difficulty must be zero (or omitted) in env"))
+			return nil, NewError(ErrorConfig, errors.New("post-merge difficulty must be zero (or omitted) in env"))
 		}
 		prestate.Env.Difficulty = nil
 	} else if env.Difficulty == nil {
@@ -283,26 +336,17 @@ func Transition(ctx *cli.Context) error {
 		// If difficulty was not provided by caller, we need to calculate it.
 		switch {
 		case env.ParentDifficulty == nil:
-			return NewError(ErrorConfig, errors.New("currentDifficulty was not provided, and cannot be calculated due to missing parentDifficulty"))
+			return nil, NewError(ErrorConfig, errors.New("currentDifficulty was not provided, and cannot be calculated due to missing parentDifficulty"))
 		case env.Number == 0:
-			return NewError(ErrorConfig, errors.New("currentDifficulty needs to be provided for block number 0"))
+			return nil, NewError(ErrorConfig, errors.New("currentDifficulty needs to be provided for block number 0"))
 		case env.Timestamp <= env.ParentTimestamp:
-			return NewError(ErrorConfig, fmt.Errorf("currentDifficulty cannot be calculated -- currentTime (%d) needs to be after parent time (%d)",
+			return nil, NewError(ErrorConfig, fmt.Errorf("currentDifficulty cannot be calculated -- currentTime (%d) needs to be after parent time (%d)",
 				env.Timestamp, env.ParentTimestamp))
 		}
 		prestate.Env.Difficulty = calcDifficulty(chainConfig, env.Number, env.Timestamp,
 			env.ParentTimestamp, env.ParentDifficulty, env.ParentUncleHash)
 	}
-	// Run the test and aggregate the result
-	s, result, err := prestate.Apply(vmConfig, chainConfig, txs, ctx.Int64(RewardFlag.Name), getTracer)
-	if err != nil {
-		return err
-	}
-	body, _ := rlp.EncodeToBytes(txs)
-	// Dump the excution result
-	collector := make(Alloc)
-	s.DumpToCollector(collector, nil)
-	return dispatchOutput(ctx, baseDir, result, collector, body)
+	return &transitionInput{prestate: prestate, txs: txs, chainConfig: chainConfig, vmConfig: vmConfig}, nil
 }
 
 // txWithKey is a helper-struct, to allow us to use the types.Transaction along with
@@ -40,6 +40,15 @@ var (
 		Name:  "cpuprofile",
 		Usage: "creates a CPU profile at the given path",
 	}
+	GasProfileFlag = &cli.StringFlag{
+		Name:  "gasprofile",
+		Usage: "creates a gas profile of the executed code at the given path",
+	}
+	GasProfileFormatFlag = &cli.StringFlag{
+		Name:  "gasprofile.format",
+		Usage: "format of the gas profile, either 'folded' (flamegraph) or 'pprof'",
+		Value: "folded",
+	}
 	StatDumpFlag = &cli.BoolFlag{
 		Name:  "statdump",
 		Usage: "displays stack and heap memory information",
@@ -204,6 +213,8 @@ func init() {
 		InputFileFlag,
 		MemProfileFlag,
 		CPUProfileFlag,
+		GasProfileFlag,
+		GasProfileFormatFlag,
 		StatDumpFlag,
 		GenesisFlag,
 		MachineFlag,
@@ -218,6 +229,7 @@ func init() {
 		compileCommand,
 		disasmCommand,
 		runCommand,
+		debugCommand,
 		blockTestCommand,
 		stateTestCommand,
 		stateTransitionCommand,
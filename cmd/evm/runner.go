@@ -118,13 +118,8 @@ func runCmd(ctx *cli.Context) error {
 	}
 
 	var (
-		tracer        vm.EVMLogger
-		debugLogger   *logger.StructLogger
-		statedb       *state.StateDB
-		chainConfig   *params.ChainConfig
-		sender        = common.BytesToAddress([]byte("sender"))
-		receiver      = common.BytesToAddress([]byte("receiver"))
-		genesisConfig *core.Genesis
+		tracer      vm.EVMLogger
+		debugLogger *logger.StructLogger
 	)
 	if ctx.Bool(MachineFlag.Name) {
 		tracer = logger.NewJSONLogger(logconfig, os.Stdout)
@@ -134,6 +129,103 @@ func runCmd(ctx *cli.Context) error {
 	} else {
 		debugLogger = logger.NewStructLogger(logconfig)
 	}
+	profiler, err := newGasProfiler(ctx)
+	if err != nil {
+		return err
+	}
+	if profiler != nil {
+		tracer = profiler
+	}
+	env, err := newRunEnv(ctx, tracer)
+	if err != nil {
+		return err
+	}
+	statedb, initialGas := env.statedb, env.initialGas
+
+	if cpuProfilePath := ctx.String(CPUProfileFlag.Name); cpuProfilePath != "" {
+		f, err := os.Create(cpuProfilePath)
+		if err != nil {
+			fmt.Println("could not create CPU profile: ", err)
+			os.Exit(1)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Println("could not start CPU profile: ", err)
+			os.Exit(1)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	bench := ctx.Bool(BenchFlag.Name)
+	output, leftOverGas, stats, err := timedExec(bench, env.exec)
+
+	if ctx.Bool(DumpFlag.Name) {
+		statedb.Commit(true)
+		statedb.IntermediateRoot(true)
+		fmt.Println(string(statedb.Dump(nil)))
+	}
+
+	if memProfilePath := ctx.String(MemProfileFlag.Name); memProfilePath != "" {
+		f, err := os.Create(memProfilePath)
+		if err != nil {
+			fmt.Println("could not create memory profile: ", err)
+			os.Exit(1)
+		}
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Println("could not write memory profile: ", err)
+			os.Exit(1)
+		}
+		f.Close()
+	}
+
+	if profiler != nil {
+		if err := writeGasProfile(ctx, profiler); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Bool(DebugFlag.Name) {
+		if debugLogger != nil {
+			fmt.Fprintln(os.Stderr, "#### TRACE ####")
+			logger.WriteTrace(os.Stderr, debugLogger.StructLogs())
+		}
+		fmt.Fprintln(os.Stderr, "#### LOGS ####")
+		logger.WriteLogs(os.Stderr, statedb.Logs())
+	}
+
+	if bench || ctx.Bool(StatDumpFlag.Name) {
+		fmt.Fprintf(os.Stderr, `EVM gas used:    %d
+execution time:  %v
+allocations:     %d
+allocated bytes: %d
+`, initialGas-leftOverGas, stats.time, stats.allocs, stats.bytesAllocated)
+	}
+	if tracer == nil || tracer == profiler {
+		fmt.Printf("%#x\n", output)
+		if err != nil {
+			fmt.Printf(" error: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// runEnv is the execution environment of the run and debug commands, as
+// configured by the command line flags.
+type runEnv struct {
+	statedb    *state.StateDB
+	initialGas uint64
+	exec       func() ([]byte, uint64, error)
+}
+
+// newRunEnv sets up the state, the code and the input to execute.
+func newRunEnv(ctx *cli.Context, tracer vm.EVMLogger) (*runEnv, error) {
+	var (
+		statedb       *state.StateDB
+		chainConfig   *params.ChainConfig
+		sender        = common.BytesToAddress([]byte("sender"))
+		receiver      = common.BytesToAddress([]byte("receiver"))
+		genesisConfig *core.Genesis
+	)
 	if ctx.String(GenesisFlag.Name) != "" {
 		gen := readGenesis(ctx.String(GenesisFlag.Name))
 		genesisConfig = gen
@@ -190,11 +282,11 @@ func runCmd(ctx *cli.Context) error {
 		// EASM-file to compile
 		src, err := os.ReadFile(fn)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		bin, err := compiler.Compile(fn, src, false)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		code = common.Hex2Bytes(bin)
 	}
@@ -214,23 +306,10 @@ func runCmd(ctx *cli.Context) error {
 		BlockNumber: new(big.Int).SetUint64(genesisConfig.Number),
 		EVMConfig: vm.Config{
 			Tracer: tracer,
-			Debug:  ctx.Bool(DebugFlag.Name) || ctx.Bool(MachineFlag.Name),
+			Debug:  tracer != nil,
 		},
 	}
 
-	if cpuProfilePath := ctx.String(CPUProfileFlag.Name); cpuProfilePath != "" {
-		f, err := os.Create(cpuProfilePath)
-		if err != nil {
-			fmt.Println("could not create CPU profile: ", err)
-			os.Exit(1)
-		}
-		if err := pprof.StartCPUProfile(f); err != nil {
-			fmt.Println("could not start CPU profile: ", err)
-			os.Exit(1)
-		}
-		defer pprof.StopCPUProfile()
-	}
-
 	if chainConfig != nil {
 		runtimeConfig.ChainConfig = chainConfig
 	} else {
@@ -270,50 +349,5 @@ func runCmd(ctx *cli.Context) error {
 		}
 	}
 
-	bench := ctx.Bool(BenchFlag.Name)
-	output, leftOverGas, stats, err := timedExec(bench, execFunc)
-
-	if ctx.Bool(DumpFlag.Name) {
-		statedb.Commit(true)
-		statedb.IntermediateRoot(true)
-		fmt.Println(string(statedb.Dump(nil)))
-	}
-
-	if memProfilePath := ctx.String(MemProfileFlag.Name); memProfilePath != "" {
-		f, err := os.Create(memProfilePath)
-		if err != nil {
-			fmt.Println("could not create memory profile: ", err)
-			os.Exit(1)
-		}
-		if err := pprof.WriteHeapProfile(f); err != nil {
-			fmt.Println("could not write memory profile: ", err)
-			os.Exit(1)
-		}
-		f.Close()
-	}
-
-	if ctx.Bool(DebugFlag.Name) {
-		if debugLogger != nil {
-			fmt.Fprintln(os.Stderr, "#### TRACE ####")
-			logger.WriteTrace(os.Stderr, debugLogger.StructLogs())
-		}
-		fmt.Fprintln(os.Stderr, "#### LOGS ####")
-		logger.WriteLogs(os.Stderr, statedb.Logs())
-	}
-
-	if bench || ctx.Bool(StatDumpFlag.Name) {
-		fmt.Fprintf(os.Stderr, `EVM gas used:    %d
-execution time:  %v
-allocations:     %d
-allocated bytes: %d
-`, initialGas-leftOverGas, stats.time, stats.allocs, stats.bytesAllocated)
-	}
-	if tracer == nil {
-		fmt.Printf("%#x\n", output)
-		if err != nil {
-			fmt.Printf(" error: %v\n", err)
-		}
-	}
-
-	return nil
+	return &runEnv{statedb: statedb, initialGas: initialGas, exec: execFunc}, nil
 }
@@ -80,6 +80,13 @@ func stateTestCmd(ctx *cli.Context) error {
 	default:
 		debugger = logger.NewStructLogger(config)
 	}
+	profiler, err := newGasProfiler(ctx)
+	if err != nil {
+		return err
+	}
+	if profiler != nil {
+		tracer = profiler
+	}
 	// Load the test content from the input file
 	src, err := os.ReadFile(ctx.Args().First())
 	if err != nil {
@@ -92,7 +99,7 @@ func stateTestCmd(ctx *cli.Context) error {
 	// Iterate over all the tests, run them and aggregate the results
 	cfg := vm.Config{
 		Tracer: tracer,
-		Debug:  ctx.Bool(DebugFlag.Name) || ctx.Bool(MachineFlag.Name),
+		Debug:  ctx.Bool(DebugFlag.Name) || ctx.Bool(MachineFlag.Name) || profiler != nil,
 	}
 	results := make([]StatetestResult, 0, len(tests))
 	for key, test := range tests {
@@ -128,6 +135,11 @@ func stateTestCmd(ctx *cli.Context) error {
 			}
 		}
 	}
+	if profiler != nil {
+		if err := writeGasProfile(ctx, profiler); err != nil {
+			return err
+		}
+	}
 	out, _ := json.MarshalIndent(results, "", "  ")
 	fmt.Println(string(out))
 	return nil
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/internal/flags"
 	"github.com/ethereum/go-ethereum/log"
@@ -117,6 +118,64 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	importHistoryCommand = &cli.Command{
+		Action:    importHistory,
+		Name:      "import-history",
+		Usage:     "Import an Era archive",
+		ArgsUsage: "<dir>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.TxLookupLimitFlag,
+			utils.HistoryRootsFlag,
+		},
+			utils.DatabasePathFlags,
+			utils.NetworkFlags,
+		),
+		Description: `
+The import-history command will import blocks and their corresponding receipts
+from Era1 archives. Every archive is checked against the checksums listed in the
+checksums.txt file of the directory, and its blocks, receipts and total
+difficulties are verified against the accumulator root of the archive. The root
+has to match the trusted one of the archive's epoch, listed in the file given by
+--history.roots.
+
+History is imported on top of the local chain, skipping the archives it already
+contains, so an interrupted import can be resumed.`,
+	}
+	exportHistoryCommand = &cli.Command{
+		Action:    exportHistory,
+		Name:      "export-history",
+		Usage:     "Export blockchain history to Era archives",
+		ArgsUsage: "<dir> <first> <last>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.EraStepFlag,
+		},
+			utils.DatabasePathFlags,
+			utils.NetworkFlags,
+		),
+		Description: `
+The export-history command will export blocks, their receipts and total
+difficulties to Era1 archives in the given directory, along with a checksums.txt
+file listing their sha256 checksums. Only pre-merge history can be exported.`,
+	}
+	backfillTracesCommand = &cli.Command{
+		Action:    backfillTraces,
+		Name:      "backfill-traces",
+		Usage:     "Store the traces of already imported blocks",
+		ArgsUsage: "<first> <last>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.CacheFlag,
+			utils.TraceStoreFlag,
+		},
+			utils.DatabasePathFlags,
+			utils.NetworkFlags,
+		),
+		Description: `
+The backfill-traces command runs the native tracers given by --tracestore on all
+transactions of the blocks in the given range, and stores their results just as
+if the blocks had been imported with trace storage enabled. Every block is
+executed on top of the state of its parent, so this requires an archive node
+unless the range is recent.`,
 	}
 	importPreimagesCommand = &cli.Command{
 		Action:    importPreimages,
@@ -362,6 +421,119 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+func importHistory(ctx *cli.Context) error {
+	if ctx.Args().Len() != 1 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	if !ctx.IsSet(utils.HistoryRootsFlag.Name) {
+		utils.Fatalf("The --%s flag is required", utils.HistoryRootsFlag.Name)
+	}
+	roots, err := utils.ReadHistoryRoots(ctx.String(utils.HistoryRootsFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to read accumulator roots: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+
+	var (
+		start   = time.Now()
+		dir     = ctx.Args().Get(0)
+		network = historyNetwork(ctx)
+	)
+	if err := utils.ImportHistory(chain, dir, network, roots); err != nil {
+		return err
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
+// backfillTraces stores the traces of the blocks in a range.
+func backfillTraces(ctx *cli.Context) error {
+	if ctx.Args().Len() != 2 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+	if !ctx.IsSet(utils.TraceStoreFlag.Name) {
+		utils.Fatalf("The --%s flag is required", utils.TraceStoreFlag.Name)
+	}
+	first, ferr := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	last, lerr := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Backfill error in parsing parameters: block number not an integer\n")
+	}
+	if first > last {
+		utils.Fatalf("Backfill error: first block %d after last block %d\n", first, last)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, false)
+	defer db.Close()
+
+	logger, err := tracers.NewStoreLogger(db, utils.SplitAndTrim(ctx.String(utils.TraceStoreFlag.Name)), 0)
+	if err != nil {
+		utils.Fatalf("Failed to set up trace storage: %v", err)
+	}
+	start := time.Now()
+	if err := utils.BackfillTraces(chain, logger, first, last); err != nil {
+		return err
+	}
+	fmt.Printf("Backfill done in %v\n", time.Since(start))
+	return nil
+}
+
+// exportHistory exports chain history in Era archives at a specified
+// directory.
+func exportHistory(ctx *cli.Context) error {
+	if ctx.Args().Len() != 3 {
+		utils.Fatalf("usage: %s", ctx.Command.ArgsUsage)
+	}
+
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, _ := utils.MakeChain(ctx, stack, true)
+	start := time.Now()
+
+	var (
+		dir         = ctx.Args().Get(0)
+		first, ferr = strconv.ParseInt(ctx.Args().Get(1), 10, 64)
+		last, lerr  = strconv.ParseInt(ctx.Args().Get(2), 10, 64)
+	)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+	}
+	if first < 0 || last < 0 {
+		utils.Fatalf("Export error: block number must be greater than 0\n")
+	}
+	if head := chain.CurrentSnapBlock(); uint64(last) > head.Number.Uint64() {
+		utils.Fatalf("Export error: block number %d larger than head block %d\n", uint64(last), head.Number.Uint64())
+	}
+	err := utils.ExportHistory(chain, dir, historyNetwork(ctx), uint64(first), uint64(last), ctx.Uint64(utils.EraStepFlag.Name))
+	if err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+// historyNetwork returns the network name Era archives are tagged with,
+// derived from the selected network preset.
+func historyNetwork(ctx *cli.Context) string {
+	switch {
+	case ctx.Bool(utils.GoerliFlag.Name):
+		return "goerli"
+	case ctx.Bool(utils.RinkebyFlag.Name):
+		return "rinkeby"
+	case ctx.Bool(utils.SepoliaFlag.Name):
+		return "sepolia"
+	default:
+		return "mainnet"
+	}
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if ctx.Args().Len() < 1 {
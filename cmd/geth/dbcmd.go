@@ -18,6 +18,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -69,6 +70,11 @@ Remove blockchain and state databases`,
 			dbExportCmd,
 			dbMetadataCmd,
 			dbCheckStateContentCmd,
+			dbBackupCmd,
+			dbRestoreCmd,
+			dbReindexTxsCmd,
+			dbCompressAncientsCmd,
+			dbVerifyAncientsCmd,
 		},
 	}
 	dbInspectCmd = &cli.Command{
@@ -193,6 +199,82 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		}, utils.NetworkFlags, utils.DatabasePathFlags),
 		Description: "Shows metadata about the chain status.",
 	}
+	dbBackupCmd = &cli.Command{
+		Action:    dbBackup,
+		Name:      "backup",
+		Usage:     "Create a consistent backup of the chain database",
+		ArgsUsage: "<backup directory>",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command creates a backup of the chain database in the given directory,
+which must either not exist or be empty. The key-value store is checkpointed, hard
+linking its files where the database engine supports it, the ancient store is copied
+up to its synced item count, and a manifest describing the backup is written.
+
+To back up the database of a running node, pass its IPC endpoint with --remotedb
+or call the admin_backupDatabase RPC method: the backup is then written by the node
+itself, pausing block freezing until it's done.`,
+	}
+	dbRestoreCmd = &cli.Command{
+		Action:    dbRestore,
+		Name:      "restore",
+		Usage:     "Restore the chain database from a backup",
+		ArgsUsage: "<backup directory>",
+		Flags:     flags.Merge(utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command validates a backup created by 'geth db backup' against its
+manifest, and copies it into the chain database directories, which must either not
+exist or be empty.`,
+	}
+	dbReindexTxsCmd = &cli.Command{
+		Action: dbReindexTxs,
+		Name:   "reindex-txs",
+		Usage:  "Rebuild the transaction indices with the configured indexing modes",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+			utils.TxLookupLimitFlag,
+			utils.TxIndexAddressesFlag,
+			utils.TxIndexSendersFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command drops the existing transaction indices and rebuilds them for
+the blocks within --txlookuplimit from the head, maintaining the indices selected by
+--txindex.addresses and --txindex.senders. The blocks are read from the key-value
+store and the ancient store in parallel. If interrupted, the indexing of the older
+blocks is resumed by the node on its next start, but the sender index is only served
+once the command is run to completion.`,
+	}
+	dbCompressAncientsCmd = &cli.Command{
+		Action: dbCompressAncients,
+		Name:   "compress-ancients",
+		Usage:  "Rewrite the ancient chain data with the configured compression and checksums",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command rewrites the compressed tables of the ancient store with the
+compression set by --datadir.ancient.compression. With zstd, a dictionary is trained
+on the recent items of every table first. New ancient data is compressed with zstd
+without a migration too, starting once enough items are frozen to train on.
+
+With --datadir.ancient.checksums, all tables are rewritten with the checksums of
+their items, which are verified on every read and by 'geth db verify-ancients'.
+
+The tables are rewritten into a temporary directory next to the ancient store, so
+the free disk space must exceed the size of the largest table. Tables pruned by
+--history.cutoff can't be migrated.`,
+	}
+	dbVerifyAncientsCmd = &cli.Command{
+		Action: dbVerifyAncients,
+		Name:   "verify-ancients",
+		Usage:  "Verify the integrity of the ancient chain data",
+		Flags: flags.Merge([]cli.Flag{
+			utils.SyncModeFlag,
+		}, utils.NetworkFlags, utils.DatabasePathFlags),
+		Description: `This command reads every item of the ancient store and reports the corrupted
+ones: items not matching their checksum, in tables created or migrated with
+--datadir.ancient.checksums, and items failing to decompress. The corrupted items
+are recorded in the database, the bodies and receipts among them can be refetched
+from the network with admin.repairAncients() on the running node.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -713,3 +795,170 @@ func showMetaData(ctx *cli.Context) error {
 	table.Render()
 	return nil
 }
+
+func dbBackup(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	var (
+		dir      = ctx.Args().Get(0)
+		manifest *rawdb.BackupManifest
+		err      error
+	)
+	if ctx.IsSet(utils.RemoteDBFlag.Name) {
+		// Ask the remote node to back up its database on its own file system
+		client, err := utils.DialRPCWithHeaders(ctx.String(utils.RemoteDBFlag.Name), ctx.StringSlice(utils.HttpHeaderFlag.Name))
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		manifest = new(rawdb.BackupManifest)
+		if err := client.Call(manifest, "admin_backupDatabase", dir); err != nil {
+			return err
+		}
+	} else {
+		stack, _ := makeConfigNode(ctx)
+		defer stack.Close()
+
+		db := utils.MakeChainDatabase(ctx, stack, false)
+		defer db.Close()
+
+		if manifest, err = rawdb.Backup(db, dir); err != nil {
+			return err
+		}
+	}
+	log.Info("Database backup created", "dir", dir, "ancients", manifest.Ancients, "files", len(manifest.Files))
+	return nil
+}
+
+func dbRestore(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	var (
+		start     = time.Now()
+		chaindata = stack.ResolvePath("chaindata")
+		ancient   = stack.ResolveAncient("chaindata", ctx.String(utils.AncientFlag.Name))
+	)
+	manifest, err := rawdb.RestoreBackup(ctx.Args().Get(0), chaindata, ancient, stack.Config().AncientRemote)
+	if err != nil {
+		return err
+	}
+	log.Info("Database restored", "chaindata", chaindata, "ancient", ancient, "ancients", manifest.Ancients, "created", manifest.Created, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func dbReindexTxs(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	chainConfig := rawdb.ReadChainConfig(db, rawdb.ReadCanonicalHash(db, 0))
+	if chainConfig == nil {
+		return errors.New("chain config not found")
+	}
+	headHash := rawdb.ReadHeadBlockHash(db)
+	head := rawdb.ReadHeaderNumber(db, headHash)
+	if head == nil {
+		return errors.New("head block not found")
+	}
+	config := &rawdb.TxIndexConfig{
+		Senders: ctx.Bool(utils.TxIndexSendersFlag.Name),
+	}
+	if addrs := utils.MakeTxIndexAddresses(ctx); len(addrs) > 0 {
+		config.Addresses = make(map[common.Address]struct{}, len(addrs))
+		for _, addr := range addrs {
+			config.Addresses[addr] = struct{}{}
+		}
+	}
+	// Index the blocks within the lookup limit, skipping the pruned history
+	from, err := db.Tail()
+	if err != nil {
+		from = 0
+	}
+	if limit := ctx.Uint64(utils.TxLookupLimitFlag.Name); limit != 0 && *head >= limit && *head-limit+1 > from {
+		from = *head - limit + 1
+	}
+	start := time.Now()
+	rawdb.WriteTxIndexStale(db)
+	if err := rawdb.DeleteTxIndices(db); err != nil {
+		return err
+	}
+	log.Info("Deleted transaction indices", "elapsed", common.PrettyDuration(time.Since(start)))
+
+	var (
+		interrupt = make(chan os.Signal, 1)
+		stop      = make(chan struct{})
+	)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	defer close(interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			log.Info("Interrupted during transaction reindexing, stopping at next batch")
+		}
+		close(stop)
+	}()
+	rawdb.WriteTxIndexConfig(db, config)
+	rawdb.IndexTransactionsWithConfig(db, from, *head+1, stop, chainConfig, config)
+
+	if tail := rawdb.ReadTxIndexTail(db); tail == nil || *tail > from {
+		return errors.New("transaction reindexing interrupted")
+	}
+	rawdb.DeleteTxIndexStale(db)
+	log.Info("Reindexed transactions", "from", from, "head", *head, "senders", config.Senders, "addresses", len(config.Addresses), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func dbCompressAncients(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	kinds := []string{rawdb.ChainFreezerHeaderTable, rawdb.ChainFreezerBodiesTable, rawdb.ChainFreezerReceiptTable}
+	if ctx.Bool(utils.AncientChecksumsFlag.Name) {
+		kinds = append(kinds, rawdb.ChainFreezerHashTable, rawdb.ChainFreezerDifficultyTable)
+	}
+	for _, kind := range kinds {
+		start := time.Now()
+		if err := db.MigrateTable(kind, func(item []byte) ([]byte, error) { return item, nil }); err != nil {
+			return fmt.Errorf("failed to recompress %s: %w", kind, err)
+		}
+		size, err := db.AncientSize(kind)
+		if err != nil {
+			return err
+		}
+		log.Info("Recompressed ancient table", "table", kind, "size", common.StorageSize(size), "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+func dbVerifyAncients(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	corrupted, err := rawdb.VerifyAncients(db)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteCorruptedAncients(db, corrupted)
+	if len(corrupted) == 0 {
+		fmt.Println("No corrupted ancient items found")
+		return nil
+	}
+	for _, item := range corrupted {
+		fmt.Printf("%-10s %10d  %v\n", item.Kind, item.Number, item.Err)
+	}
+	return fmt.Errorf("found %d corrupted ancient items", len(corrupted))
+}
@@ -21,7 +21,10 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
 )
 
 var customGenesisTests = []struct {
@@ -180,7 +183,7 @@ func TestCustomBackend(t *testing.T) {
 		},
 		{ // Reject invalid backend choice
 			initArgs:   []string{"--db.engine", "mssql"},
-			initExpect: `Fatal: Invalid choice for db.engine 'mssql', allowed 'leveldb' or 'pebble'`,
+			initExpect: fmt.Sprintf("Fatal: Invalid choice for db.engine 'mssql', allowed %s", strings.Join(ethdb.Backends(), ", ")),
 			// Since the init fails, this will return the (default) mainnet genesis
 			// block nonce
 			execExpect: `0x0000000000000042`,
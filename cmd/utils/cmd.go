@@ -20,24 +20,30 @@ package utils
 import (
 	"bufio"
 	"compress/gzip"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/internal/debug"
+	"github.com/ethereum/go-ethereum/internal/era"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -287,6 +293,315 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
+// ImportHistory imports Era1 files containing historical block information,
+// continuing from the head of the local chain. Every archive is checked against
+// the checksum list of the directory, and its contents verified against its
+// accumulator root, which must match the trusted one of its epoch in roots,
+// before being inserted. Archives already imported are skipped.
+func ImportHistory(chain *core.BlockChain, dir string, network string, roots []common.Hash) error {
+	entries, err := era.ReadDir(dir, network)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	checksums, err := readList(filepath.Join(dir, "checksums.txt"))
+	if err != nil {
+		return fmt.Errorf("unable to read checksums.txt: %w", err)
+	}
+	if len(checksums) != len(entries) {
+		return fmt.Errorf("mismatch between checksums (%d) and era1 files (%d)", len(checksums), len(entries))
+	}
+	var (
+		start    = time.Now()
+		reported = time.Now()
+		imported = 0
+	)
+	for i, filename := range entries {
+		err := func() error {
+			f, err := os.Open(filepath.Join(dir, filename))
+			if err != nil {
+				return fmt.Errorf("unable to open era: %w", err)
+			}
+			defer f.Close()
+
+			e, err := era.From(f)
+			if err != nil {
+				return fmt.Errorf("error opening era: %w", err)
+			}
+			// Skip the archive if the local chain already contains all of its
+			// blocks, and ensure it doesn't leave a gap otherwise.
+			head := chain.CurrentSnapBlock().Number.Uint64()
+			if e.Start()+e.Count() <= head+1 {
+				log.Debug("Skipping imported Era file", "file", filename, "start", e.Start(), "count", e.Count())
+				return nil
+			}
+			if e.Start() > head+1 {
+				return fmt.Errorf("archive starts at block %d, beyond the local head %d", e.Start(), head)
+			}
+			// Validate checksum.
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			h := sha256.New()
+			if _, err := io.Copy(h, f); err != nil {
+				return fmt.Errorf("unable to recalculate checksum: %w", err)
+			}
+			if have, want := common.BytesToHash(h.Sum(nil)).Hex(), checksums[i]; have != want {
+				return fmt.Errorf("checksum mismatch: have %s, want %s", have, want)
+			}
+			// Validate the contents against the accumulator root, which must
+			// match the trusted one of the epoch, and the one the archive is
+			// named after.
+			root, err := era.Verify(e)
+			if err != nil {
+				return fmt.Errorf("error verifying era: %w", err)
+			}
+			epoch, err := era.Epoch(filename)
+			if err != nil {
+				return err
+			}
+			if epoch >= len(roots) || roots[epoch] != root {
+				return fmt.Errorf("untrusted accumulator root %x of epoch %d", root, epoch)
+			}
+			if name := era.Filename(network, epoch, root); name != filename {
+				return fmt.Errorf("accumulator root mismatch: have %x, file named %s", root, filename)
+			}
+			// Ensure the archive extends the local chain.
+			td, err := e.InitialTD()
+			if err != nil {
+				return fmt.Errorf("error reading initial total difficulty: %w", err)
+			}
+			if e.Start() > 0 {
+				parent := chain.GetHeaderByNumber(e.Start() - 1)
+				if have := chain.GetTd(parent.Hash(), parent.Number.Uint64()); have == nil || have.Cmp(td) != 0 {
+					return fmt.Errorf("initial total difficulty mismatch: have %v, want %v", have, td)
+				}
+			}
+			it, err := era.NewIterator(e)
+			if err != nil {
+				return fmt.Errorf("error making era reader: %w", err)
+			}
+			var (
+				headers  []*types.Header
+				blocks   types.Blocks
+				receipts []types.Receipts
+			)
+			flush := func() error {
+				if len(blocks) == 0 {
+					return nil
+				}
+				if _, err := chain.InsertHeaderChain(headers, 100); err != nil {
+					return fmt.Errorf("error inserting headers %d-%d: %w", headers[0].Number, headers[len(headers)-1].Number, err)
+				}
+				if _, err := chain.InsertReceiptChain(blocks, receipts, math.MaxUint64); err != nil {
+					return fmt.Errorf("error inserting bodies %d-%d: %w", blocks[0].Number(), blocks[len(blocks)-1].Number(), err)
+				}
+				imported += len(blocks)
+				headers, blocks, receipts = headers[:0], blocks[:0], receipts[:0]
+
+				if time.Since(reported) >= 8*time.Second {
+					log.Info("Importing Era files", "head", it.Number(), "imported", imported, "elapsed", common.PrettyDuration(time.Since(start)))
+					reported = time.Now()
+				}
+				return nil
+			}
+			for it.Next() {
+				block, err := it.Block()
+				if err != nil {
+					return fmt.Errorf("error reading block %d: %w", it.Number(), err)
+				}
+				// Blocks the local chain already contains must match it
+				if block.NumberU64() <= head {
+					if want := chain.GetCanonicalHash(block.NumberU64()); block.Hash() != want {
+						return fmt.Errorf("block %d mismatch: have %x, want %x", block.NumberU64(), block.Hash(), want)
+					}
+					continue
+				}
+				r, err := it.Receipts()
+				if err != nil {
+					return fmt.Errorf("error reading receipts %d: %w", it.Number(), err)
+				}
+				headers = append(headers, block.Header())
+				blocks = append(blocks, block)
+				receipts = append(receipts, r)
+				if len(blocks) == importBatchSize {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+			if err := it.Error(); err != nil {
+				return err
+			}
+			return flush()
+		}()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	log.Info("Imported Era files", "files", len(entries), "blocks", imported, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// ExportHistory exports blockchain history into the specified directory,
+// following the Era1 format. Each archive holds step blocks, and is named
+// after its network, epoch and accumulator root. The sha256 checksums of all
+// archives are listed in checksums.txt.
+func ExportHistory(bc *core.BlockChain, dir string, network string, first, last, step uint64) error {
+	log.Info("Exporting blockchain history", "dir", dir)
+	if head := bc.CurrentBlock().Number.Uint64(); head < last {
+		log.Warn("Last block beyond head, setting last = head", "head", head, "last", last)
+		last = head
+	}
+	if step == 0 || step > uint64(era.MaxEra1Size) {
+		return fmt.Errorf("invalid step size %d, must be in range [1, %d]", step, era.MaxEra1Size)
+	}
+	if first%step != 0 {
+		return fmt.Errorf("first block %d not aligned to step size %d", first, step)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+	var (
+		start     = time.Now()
+		reported  = time.Now()
+		checksums []string
+	)
+	for i := first; i <= last; i += step {
+		err := func() error {
+			filename := filepath.Join(dir, era.Filename(network, int(i/step), common.Hash{}))
+			f, err := os.Create(filename)
+			if err != nil {
+				return fmt.Errorf("could not create era file: %w", err)
+			}
+			defer f.Close()
+
+			w := era.NewBuilder(f)
+			for j := uint64(0); j < step && j <= last-i; j++ {
+				var (
+					n     = i + j
+					block = bc.GetBlockByNumber(n)
+				)
+				if block == nil {
+					return fmt.Errorf("export failed on #%d: not found", n)
+				}
+				if n > 0 && block.Difficulty().BitLen() == 0 {
+					return fmt.Errorf("export failed on #%d: post-merge blocks are not supported", n)
+				}
+				receipts := bc.GetReceiptsByHash(block.Hash())
+				if receipts == nil {
+					return fmt.Errorf("export failed on #%d: receipts not found", n)
+				}
+				td := bc.GetTd(block.Hash(), block.NumberU64())
+				if td == nil {
+					return fmt.Errorf("export failed on #%d: total difficulty not found", n)
+				}
+				if err := w.Add(block, receipts, td); err != nil {
+					return err
+				}
+			}
+			root, err := w.Finalize()
+			if err != nil {
+				return fmt.Errorf("export failed to finalize %d: %w", i/step, err)
+			}
+			// Set correct filename with root.
+			if err := os.Rename(filename, filepath.Join(dir, era.Filename(network, int(i/step), root))); err != nil {
+				return err
+			}
+			// Compute checksum of entire Era1.
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			h := sha256.New()
+			if _, err := io.Copy(h, f); err != nil {
+				return fmt.Errorf("unable to calculate checksum: %w", err)
+			}
+			checksums = append(checksums, common.BytesToHash(h.Sum(nil)).Hex())
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+		if time.Since(reported) >= 8*time.Second {
+			log.Info("Exporting blocks", "exported", i, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "checksums.txt"), []byte(strings.Join(checksums, "\n")), os.ModePerm); err != nil {
+		return err
+	}
+	log.Info("Exported blockchain to", "dir", dir)
+	return nil
+}
+
+// BackfillTraces runs the tracers of the store logger on all transactions of the
+// blocks in the interval [first, last] and stores their results. Every block is
+// executed on top of the state of its parent, so unless the parent states are
+// still around, as in an archive node, the backfill fails.
+func BackfillTraces(chain *core.BlockChain, logger *tracers.StoreLogger, first, last uint64) error {
+	log.Info("Backfilling transaction traces", "first", first, "last", last)
+	if head := chain.CurrentBlock().Number.Uint64(); head < last {
+		log.Warn("Last block beyond head, setting last = head", "head", head, "last", last)
+		last = head
+	}
+	if first == 0 {
+		first = 1 // genesis has no transactions to trace
+	}
+	var (
+		start    = time.Now()
+		reported = time.Now()
+	)
+	for n := first; n <= last; n++ {
+		block := chain.GetBlockByNumber(n)
+		if block == nil {
+			return fmt.Errorf("backfill failed on #%d: not found", n)
+		}
+		parent := chain.GetHeader(block.ParentHash(), n-1)
+		if parent == nil {
+			return fmt.Errorf("backfill failed on #%d: parent not found", n)
+		}
+		statedb, err := chain.StateAt(parent.Root)
+		if err != nil {
+			return fmt.Errorf("backfill failed on #%d: parent state unavailable: %w", n, err)
+		}
+		if err := tracers.BackfillBlock(chain, chain.Config(), block, parent, statedb, logger); err != nil {
+			return fmt.Errorf("backfill failed on #%d: %w", n, err)
+		}
+		if time.Since(reported) >= 8*time.Second {
+			log.Info("Backfilling transaction traces", "number", n, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	log.Info("Backfilled transaction traces", "blocks", last-first+1, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// ReadHistoryRoots reads the trusted accumulator roots of Era1 archives from a
+// file listing them one per line, in the order of their epochs.
+func ReadHistoryRoots(filename string) ([]common.Hash, error) {
+	lines, err := readList(filename)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]common.Hash, len(lines))
+	for i, line := range lines {
+		root, err := hexutil.Decode(strings.TrimSpace(line))
+		if err != nil || len(root) != common.HashLength {
+			return nil, fmt.Errorf("invalid accumulator root of epoch %d: %q", i, line)
+		}
+		roots[i] = common.BytesToHash(root)
+	}
+	return roots, nil
+}
+
+// readList reads the newline separated list of entries in the given file.
+func readList(filename string) ([]string, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n"), nil
+}
+
 // ImportPreimages imports a batch of exported hash preimages into the database.
 // It's a part of the deprecated functionality, should be removed in the future.
 func ImportPreimages(db ethdb.Database, fn string) error {
@@ -22,6 +22,7 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
@@ -53,10 +54,14 @@ import (
 	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/eth/tracers/parity"
 	"github.com/ethereum/go-ethereum/ethdb"
+	_ "github.com/ethereum/go-ethereum/ethdb/boltdb" // Register the boltdb backend
 	"github.com/ethereum/go-ethereum/ethdb/remotedb"
+	"github.com/ethereum/go-ethereum/ethdb/s3"
 	"github.com/ethereum/go-ethereum/ethstats"
 	"github.com/ethereum/go-ethereum/graphql"
+	"github.com/ethereum/go-ethereum/internal/era"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/internal/flags"
 	"github.com/ethereum/go-ethereum/les"
@@ -101,7 +106,7 @@ var (
 	}
 	DBEngineFlag = &cli.StringFlag{
 		Name:     "db.engine",
-		Usage:    "Backing database implementation to use ('leveldb' or 'pebble')",
+		Usage:    "Backing database implementation to use (" + strings.Join(ethdb.Backends(), ", ") + ")",
 		Value:    "leveldb",
 		Category: flags.EthCategory,
 	}
@@ -110,6 +115,38 @@ var (
 		Usage:    "Root directory for ancient data (default = inside chaindata)",
 		Category: flags.EthCategory,
 	}
+	AncientRemoteFlag = &cli.StringFlag{
+		Name:     "datadir.ancient.remote",
+		Usage:    "S3-compatible bucket URL (scheme://host/bucket/prefix) to offload sealed ancient data into, credentials are read from the AWS_* environment variables",
+		Category: flags.EthCategory,
+	}
+	AncientRemoteCacheFlag = &cli.IntFlag{
+		Name:     "datadir.ancient.remote.cache",
+		Usage:    "Number of most recent sealed ancient data files per table to keep locally",
+		Value:    2,
+		Category: flags.EthCategory,
+	}
+	AncientCompressionFlag = &cli.StringFlag{
+		Name:     "datadir.ancient.compression",
+		Usage:    `Compression of new ancient data ("snappy" or "zstd" with dictionaries trained per table)`,
+		Value:    rawdb.AncientCompressionSnappy,
+		Category: flags.EthCategory,
+	}
+	AncientChecksumsFlag = &cli.BoolFlag{
+		Name:     "datadir.ancient.checksums",
+		Usage:    "Store checksums of the items in newly created ancient tables to detect corruption",
+		Category: flags.EthCategory,
+	}
+	DBSizeTrackingFlag = &cli.BoolFlag{
+		Name:     "db.sizetracking",
+		Usage:    "Maintain live size counters of the chain database categories (adds a read to snapshot and metadata writes)",
+		Category: flags.EthCategory,
+	}
+	DBSizeRescanFlag = &cli.DurationFlag{
+		Name:     "db.sizetracking.rescan",
+		Usage:    "Interval of walking the chain database to correct the drift of the live size counters (0 = never)",
+		Category: flags.EthCategory,
+	}
 	MinFreeDiskSpaceFlag = &flags.DirectoryFlag{
 		Name:     "datadir.minfreedisk",
 		Usage:    "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -226,6 +263,16 @@ var (
 		Usage: "Max number of elements (0 = no limit)",
 		Value: 0,
 	}
+	EraStepFlag = &cli.Uint64Flag{
+		Name:  "era.step",
+		Usage: "Number of blocks per Era archive",
+		Value: uint64(era.MaxEra1Size),
+	}
+	HistoryRootsFlag = &cli.PathFlag{
+		Name:      "history.roots",
+		Usage:     "File listing the trusted accumulator roots of the Era archives, one per line by epoch",
+		TakesFile: true,
+	}
 
 	defaultSyncMode = ethconfig.Defaults.SyncMode
 	SyncModeFlag    = &flags.TextMarshalerFlag{
@@ -252,6 +299,21 @@ var (
 		Value:    ethconfig.Defaults.TxLookupLimit,
 		Category: flags.EthCategory,
 	}
+	HistoryCutoffFlag = &cli.Uint64Flag{
+		Name:     "history.cutoff",
+		Usage:    "Block number below which ancient block bodies and receipts are pruned, headers are kept (0 = keep entire history)",
+		Category: flags.EthCategory,
+	}
+	TxIndexAddressesFlag = &cli.StringFlag{
+		Name:     "txindex.addresses",
+		Usage:    "Comma separated accounts to index the sent and received transactions of (default = index all transactions)",
+		Category: flags.EthCategory,
+	}
+	TxIndexSendersFlag = &cli.BoolFlag{
+		Name:     "txindex.senders",
+		Usage:    "Maintain an index of the transactions sent by each account",
+		Category: flags.EthCategory,
+	}
 	LightKDFFlag = &cli.BoolFlag{
 		Name:     "lightkdf",
 		Usage:    "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -602,6 +664,26 @@ var (
 		Usage:    "Record information useful for VM and contract debugging",
 		Category: flags.VMCategory,
 	}
+	VMTraceFlag = &cli.StringFlag{
+		Name:     "vmtrace",
+		Usage:    "Name of a live tracer which is run during block import (costly)",
+		Category: flags.VMCategory,
+	}
+	VMTraceJsonConfigFlag = &cli.StringFlag{
+		Name:     "vmtrace.jsonconfig",
+		Usage:    "Live tracer configuration (JSON)",
+		Category: flags.VMCategory,
+	}
+	TraceStoreFlag = &cli.StringFlag{
+		Name:     "tracestore",
+		Usage:    "Comma separated list of native tracers whose results are stored for imported blocks (e.g. callTracer,flatCallTracer), can't be combined with --vmtrace",
+		Category: flags.VMCategory,
+	}
+	TraceStoreRetentionFlag = &cli.Uint64Flag{
+		Name:     "tracestore.retention",
+		Usage:    "Number of recent blocks whose stored traces are kept (0 = entire chain)",
+		Category: flags.VMCategory,
+	}
 
 	// API options.
 	RPCGlobalGasCapFlag = &cli.Uint64Flag{
@@ -622,6 +704,12 @@ var (
 		Value:    ethconfig.Defaults.RPCTxFeeCap,
 		Category: flags.APICategory,
 	}
+	RPCTraceFilterRangeFlag = &cli.Uint64Flag{
+		Name:     "rpc.tracefilterrange",
+		Usage:    "Sets the maximum number of blocks trace_filter may span (0 = no limit)",
+		Value:    ethconfig.Defaults.RPCTraceFilterRange,
+		Category: flags.APICategory,
+	}
 	// Authenticated RPC HTTP settings
 	AuthListenFlag = &cli.StringFlag{
 		Name:     "authrpc.addr",
@@ -776,6 +864,29 @@ var (
 		Value:    "",
 		Category: flags.APICategory,
 	}
+	H2CEnabledFlag = &cli.BoolFlag{
+		Name:     "h2c",
+		Usage:    "Enable the RPC server carrying connections over cleartext HTTP/2 streams (uses --http.corsdomain and --http.vhosts)",
+		Category: flags.APICategory,
+	}
+	H2CListenAddrFlag = &cli.StringFlag{
+		Name:     "h2c.addr",
+		Usage:    "HTTP/2 stream RPC server listening interface",
+		Value:    node.DefaultH2CHost,
+		Category: flags.APICategory,
+	}
+	H2CPortFlag = &cli.IntFlag{
+		Name:     "h2c.port",
+		Usage:    "HTTP/2 stream RPC server listening port",
+		Value:    node.DefaultH2CPort,
+		Category: flags.APICategory,
+	}
+	H2CApiFlag = &cli.StringFlag{
+		Name:     "h2c.api",
+		Usage:    "API's offered over the HTTP/2 stream RPC interface",
+		Value:    "",
+		Category: flags.APICategory,
+	}
 	ExecFlag = &cli.StringFlag{
 		Name:     "exec",
 		Usage:    "Execute JavaScript statement",
@@ -1016,17 +1127,18 @@ var (
 	DatabasePathFlags = []cli.Flag{
 		DataDirFlag,
 		AncientFlag,
+		AncientRemoteFlag,
+		AncientRemoteCacheFlag,
+		AncientCompressionFlag,
+		AncientChecksumsFlag,
+		DBSizeTrackingFlag,
+		DBSizeRescanFlag,
+		DBEngineFlag,
 		RemoteDBFlag,
 		HttpHeaderFlag,
 	}
 )
 
-func init() {
-	if rawdb.PebbleEnabled {
-		DatabasePathFlags = append(DatabasePathFlags, DBEngineFlag)
-	}
-}
-
 // MakeDataDir retrieves the currently requested data directory, terminating
 // if none (or the empty string) is specified. If the node is starting a testnet,
 // then a subdirectory of the specified datadir will be used.
@@ -1259,6 +1371,23 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setH2C creates the HTTP/2 stream RPC listener interface string from the set
+// command line flags, returning empty if the endpoint is disabled.
+func setH2C(ctx *cli.Context, cfg *node.Config) {
+	if ctx.Bool(H2CEnabledFlag.Name) && cfg.H2CHost == "" {
+		cfg.H2CHost = "127.0.0.1"
+		if ctx.IsSet(H2CListenAddrFlag.Name) {
+			cfg.H2CHost = ctx.String(H2CListenAddrFlag.Name)
+		}
+	}
+	if ctx.IsSet(H2CPortFlag.Name) {
+		cfg.H2CPort = ctx.Int(H2CPortFlag.Name)
+	}
+	if ctx.IsSet(H2CApiFlag.Name) {
+		cfg.H2CModules = SplitAndTrim(ctx.String(H2CApiFlag.Name))
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -1473,6 +1602,7 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setGraphQL(ctx, cfg)
 	setWS(ctx, cfg)
+	setH2C(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	SetDataDir(ctx, cfg)
 	setSmartCard(ctx, cfg)
@@ -1509,12 +1639,38 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	}
 	if ctx.IsSet(DBEngineFlag.Name) {
 		dbEngine := ctx.String(DBEngineFlag.Name)
-		if dbEngine != "leveldb" && dbEngine != "pebble" {
-			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", dbEngine)
+		if _, ok := ethdb.LookupBackend(dbEngine); !ok {
+			Fatalf("Invalid choice for db.engine '%s', allowed %s", dbEngine, strings.Join(ethdb.Backends(), ", "))
 		}
 		log.Info(fmt.Sprintf("Using %s as db engine", dbEngine))
 		cfg.DBEngine = dbEngine
 	}
+	if ctx.IsSet(AncientRemoteFlag.Name) {
+		config, err := s3.ParseURL(ctx.String(AncientRemoteFlag.Name))
+		if err != nil {
+			Fatalf("Invalid --%s: %v", AncientRemoteFlag.Name, err)
+		}
+		store, err := s3.New(s3.ConfigFromEnv(config))
+		if err != nil {
+			Fatalf("Failed to create remote ancient store: %v", err)
+		}
+		cfg.AncientRemote = &rawdb.FreezerRemote{
+			Store: store,
+			Cache: ctx.Int(AncientRemoteCacheFlag.Name),
+		}
+	}
+	if ctx.IsSet(DBSizeTrackingFlag.Name) {
+		cfg.DatabaseSizeTracking = ctx.Bool(DBSizeTrackingFlag.Name)
+	}
+	if ctx.IsSet(DBSizeRescanFlag.Name) {
+		cfg.DatabaseSizeRescan = ctx.Duration(DBSizeRescanFlag.Name)
+	}
+	if ctx.IsSet(AncientCompressionFlag.Name) {
+		cfg.AncientCompression = ctx.String(AncientCompressionFlag.Name)
+	}
+	if ctx.IsSet(AncientChecksumsFlag.Name) {
+		cfg.AncientChecksums = ctx.Bool(AncientChecksumsFlag.Name)
+	}
 }
 
 func setSmartCard(ctx *cli.Context, cfg *node.Config) {
@@ -1744,6 +1900,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	CheckExclusive(ctx, MainnetFlag, DeveloperFlag, RinkebyFlag, GoerliFlag, SepoliaFlag, Eip4844Flag)
 	CheckExclusive(ctx, LightServeFlag, SyncModeFlag, "light")
 	CheckExclusive(ctx, DeveloperFlag, ExternalSignerFlag) // Can't use both ephemeral unlocked and external signer
+	CheckExclusive(ctx, VMTraceFlag, TraceStoreFlag)       // Both take the place of the live tracer
 	if ctx.String(GCModeFlag.Name) == "archive" && ctx.Uint64(TxLookupLimitFlag.Name) != 0 {
 		ctx.Set(TxLookupLimitFlag.Name, "0")
 		log.Warn("Disable transaction unindexing for archive node")
@@ -1751,6 +1908,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.IsSet(LightServeFlag.Name) && ctx.Uint64(TxLookupLimitFlag.Name) != 0 {
 		log.Warn("LES server cannot serve old transaction status and cannot connect below les/4 protocol version if transaction lookup index is limited")
 	}
+	if ctx.IsSet(LightServeFlag.Name) && ctx.Uint64(HistoryCutoffFlag.Name) != 0 {
+		log.Warn("LES server cannot serve the block bodies and receipts of pruned chain history")
+	}
 	setEtherbase(ctx, cfg)
 	setGPO(ctx, &cfg.GPO, ctx.String(SyncModeFlag.Name) == "light")
 	setTxPool(ctx, &cfg.TxPool)
@@ -1811,6 +1971,15 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.IsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.Uint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.IsSet(HistoryCutoffFlag.Name) {
+		cfg.HistoryCutoff = ctx.Uint64(HistoryCutoffFlag.Name)
+	}
+	if ctx.IsSet(TxIndexAddressesFlag.Name) {
+		cfg.TxIndexAddresses = MakeTxIndexAddresses(ctx)
+	}
+	if ctx.IsSet(TxIndexSendersFlag.Name) {
+		cfg.TxIndexSenders = ctx.Bool(TxIndexSendersFlag.Name)
+	}
 	if ctx.IsSet(CacheFlag.Name) || ctx.IsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.Int(CacheFlag.Name) * ctx.Int(CacheTrieFlag.Name) / 100
 	}
@@ -1845,6 +2014,16 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.Bool(VMEnableDebugFlag.Name)
 	}
+	if ctx.IsSet(VMTraceFlag.Name) {
+		cfg.VMTrace = ctx.String(VMTraceFlag.Name)
+		cfg.VMTraceJsonConfig = ctx.String(VMTraceJsonConfigFlag.Name)
+	}
+	if ctx.IsSet(TraceStoreFlag.Name) {
+		cfg.StoredTracers = SplitAndTrim(ctx.String(TraceStoreFlag.Name))
+	}
+	if ctx.IsSet(TraceStoreRetentionFlag.Name) {
+		cfg.StoredTracesRetention = ctx.Uint64(TraceStoreRetentionFlag.Name)
+	}
 
 	if ctx.IsSet(RPCGlobalGasCapFlag.Name) {
 		cfg.RPCGasCap = ctx.Uint64(RPCGlobalGasCapFlag.Name)
@@ -1860,6 +2039,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.IsSet(RPCGlobalTxFeeCapFlag.Name) {
 		cfg.RPCTxFeeCap = ctx.Float64(RPCGlobalTxFeeCapFlag.Name)
 	}
+	if ctx.IsSet(RPCTraceFilterRangeFlag.Name) {
+		cfg.RPCTraceFilterRange = ctx.Uint64(RPCTraceFilterRangeFlag.Name)
+	}
 	if ctx.IsSet(NoDiscoverFlag.Name) {
 		cfg.EthDiscoveryURLs, cfg.SnapDiscoveryURLs = []string{}, []string{}
 	} else if ctx.IsSet(DNSDiscoveryFlag.Name) {
@@ -2033,6 +2215,7 @@ func RegisterEthService(stack *node.Node, cfg *ethconfig.Config) (ethapi.Backend
 		Fatalf("Failed to register the Engine API service: %v", err)
 	}
 	stack.RegisterAPIs(tracers.APIs(backend.APIBackend))
+	stack.RegisterAPIs(parity.APIs(backend.APIBackend, cfg.RPCTraceFilterRange))
 	return backend.APIBackend, backend
 }
 
@@ -2160,6 +2343,19 @@ func SplitTagsFlag(tagsFlag string) map[string]string {
 	return tagsMap
 }
 
+// MakeTxIndexAddresses parses the accounts to restrict the transaction indexing
+// to, and will hard crash on invalid addresses.
+func MakeTxIndexAddresses(ctx *cli.Context) []common.Address {
+	var addrs []common.Address
+	for _, account := range SplitAndTrim(ctx.String(TxIndexAddressesFlag.Name)) {
+		if !common.IsHexAddress(account) {
+			Fatalf("Invalid account in --%s: %s", TxIndexAddressesFlag.Name, account)
+		}
+		addrs = append(addrs, common.HexToAddress(account))
+	}
+	return addrs
+}
+
 // MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
 func MakeChainDatabase(ctx *cli.Context, stack *node.Node, readonly bool) ethdb.Database {
 	var (
@@ -2287,6 +2483,27 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readonly bool) (*core.BlockCh
 		cache.TrieDirtyLimit = ctx.Int(CacheFlag.Name) * ctx.Int(CacheGCFlag.Name) / 100
 	}
 	vmcfg := vm.Config{EnablePreimageRecording: ctx.Bool(VMEnableDebugFlag.Name)}
+	if ctx.IsSet(VMTraceFlag.Name) {
+		var config json.RawMessage
+		if ctx.IsSet(VMTraceJsonConfigFlag.Name) {
+			config = json.RawMessage(ctx.String(VMTraceJsonConfigFlag.Name))
+		}
+		tracer, err := tracers.LiveDirectory.New(ctx.String(VMTraceFlag.Name), config)
+		if err != nil {
+			Fatalf("Failed to create tracer %q: %v", ctx.String(VMTraceFlag.Name), err)
+		}
+		vmcfg.Tracer = tracer
+	}
+	if ctx.IsSet(TraceStoreFlag.Name) {
+		if vmcfg.Tracer != nil {
+			Fatalf("Flags --%s and --%s can't be used at the same time", VMTraceFlag.Name, TraceStoreFlag.Name)
+		}
+		logger, err := tracers.NewStoreLogger(chainDb, SplitAndTrim(ctx.String(TraceStoreFlag.Name)), ctx.Uint64(TraceStoreRetentionFlag.Name))
+		if err != nil {
+			Fatalf("Failed to set up trace storage: %v", err)
+		}
+		vmcfg.Tracer = logger
+	}
 
 	// Disable transaction indexing/unindexing by default.
 	chain, err := core.NewBlockChain(chainDb, cache, gspec, nil, engine, vmcfg, nil, nil)
@@ -0,0 +1,227 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	count uint64 = 128
+	step  uint64 = 16
+)
+
+func TestHistoryImportAndExport(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		genesis = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{address: {Balance: big.NewInt(1000000000000000000)}},
+		}
+		signer = types.LatestSigner(genesis.Config)
+	)
+
+	// Generate chain.
+	db, blocks, _ := core.GenerateChainWithGenesis(genesis, ethash.NewFaker(), int(count), func(i int, g *core.BlockGen) {
+		if i == 0 {
+			return
+		}
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   genesis.Config.ChainID,
+			Nonce:     uint64(i - 1),
+			GasTipCap: common.Big0,
+			GasFeeCap: g.PrevBlock(0).BaseFee(),
+			Gas:       50000,
+			To:        &common.Address{0xaa},
+			Value:     big.NewInt(int64(i)),
+			Data:      nil,
+		})
+		if err != nil {
+			t.Fatalf("error creating tx: %v", err)
+		}
+		g.AddTx(tx)
+	})
+
+	// Initialize BlockChain.
+	chain, err := core.NewBlockChain(db, nil, genesis, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to initialize chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("error insterting chain: %v", err)
+	}
+
+	// Make temp directory for era files.
+	dir := t.TempDir()
+
+	// Export history to temp directory.
+	if err := ExportHistory(chain, dir, "mainnet", 0, count, step); err != nil {
+		t.Fatalf("error exporting history: %v", err)
+	}
+
+	// Read checksums.
+	b, err := os.ReadFile(filepath.Join(dir, "checksums.txt"))
+	if err != nil {
+		t.Fatalf("failed to read checksums: %v", err)
+	}
+	checksums := strings.Split(string(b), "\n")
+
+	// Verify each Era.
+	var roots []common.Hash
+	entries, _ := era.ReadDir(dir, "mainnet")
+	if want := int(count/step) + 1; len(entries) != want || len(checksums) != want {
+		t.Fatalf("archive count mismatch: have %d archives and %d checksums, want %d", len(entries), len(checksums), want)
+	}
+	for i, filename := range entries {
+		e, err := era.Open(filepath.Join(dir, filename))
+		if err != nil {
+			t.Fatalf("error opening era file: %v", err)
+		}
+		root, err := era.Verify(e)
+		if err != nil {
+			t.Fatalf("error verifying era %d: %v", i, err)
+		}
+		roots = append(roots, root)
+		if want := era.Filename("mainnet", i, root); want != filename {
+			t.Fatalf("filename mismatch: have %s, want %s", filename, want)
+		}
+		it, err := era.NewIterator(e)
+		if err != nil {
+			t.Fatalf("error making era reader: %v", err)
+		}
+		for j := 0; it.Next(); j++ {
+			n := uint64(i)*step + uint64(j)
+			if err := it.Error(); err != nil {
+				t.Fatalf("error reading block %d: %v", n, err)
+			}
+			block, receipts, err := it.BlockAndReceipts()
+			if err != nil {
+				t.Fatalf("error reading block %d: %v", n, err)
+			}
+			if want := chain.GetBlockByNumber(n); want.Hash() != block.Hash() {
+				t.Fatalf("block %d hash mismatch: have %x, want %x", n, block.Hash(), want.Hash())
+			}
+			if have, want := types.DeriveSha(receipts, trie.NewStackTrie(nil)), block.ReceiptHash(); have != want {
+				t.Fatalf("block %d receipt root mismatch: have %x, want %x", n, have, want)
+			}
+		}
+		e.Close()
+	}
+
+	// Now import Era.
+	imported := newHistoryChain(t, genesis)
+	if err := ImportHistory(imported, dir, "mainnet", roots); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	if have, want := imported.CurrentSnapBlock().Hash(), chain.CurrentBlock().Hash(); have != want {
+		t.Fatalf("imported chain does not match expected, have (%d, %s) want (%d, %s)", imported.CurrentSnapBlock().Number, have, chain.CurrentBlock().Number, want)
+	}
+	for n := uint64(1); n <= count; n++ {
+		want := chain.GetBlockByNumber(n)
+		if have := imported.GetBlockByNumber(n); have == nil || have.Hash() != want.Hash() {
+			t.Fatalf("imported block %d mismatch", n)
+		}
+		if have := imported.GetReceiptsByHash(want.Hash()); len(have) != len(want.Transactions()) {
+			t.Fatalf("imported receipts %d mismatch: have %d, want %d", n, len(have), len(want.Transactions()))
+		}
+	}
+	// Importing again skips the archives already imported.
+	if err := ImportHistory(imported, dir, "mainnet", roots); err != nil {
+		t.Fatalf("failed to reimport chain: %v", err)
+	}
+	// Importing archives in two parts continues from the local head.
+	var (
+		first  = t.TempDir()
+		second = t.TempDir()
+		split  = 2
+	)
+	for i, filename := range entries {
+		part := first
+		if i >= split {
+			part = second
+		}
+		if err := os.Link(filepath.Join(dir, filename), filepath.Join(part, filename)); err != nil {
+			t.Fatalf("failed to link archive: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(first, "checksums.txt"), []byte(strings.Join(checksums[:split], "\n")), os.ModePerm)
+	os.WriteFile(filepath.Join(second, "checksums.txt"), []byte(strings.Join(checksums[split:], "\n")), os.ModePerm)
+
+	resumed := newHistoryChain(t, genesis)
+	if err := ImportHistory(resumed, second, "mainnet", roots); err == nil {
+		t.Fatalf("expected error importing archives beyond the local head")
+	}
+	if err := ImportHistory(resumed, first, "mainnet", roots); err != nil {
+		t.Fatalf("failed to import first part: %v", err)
+	}
+	if have, want := resumed.CurrentSnapBlock().Number.Uint64(), uint64(split)*step-1; have != want {
+		t.Fatalf("head mismatch after first part: have %d, want %d", have, want)
+	}
+	if err := ImportHistory(resumed, second, "mainnet", roots); err != nil {
+		t.Fatalf("failed to import second part: %v", err)
+	}
+	if have, want := resumed.CurrentSnapBlock().Hash(), chain.CurrentBlock().Hash(); have != want {
+		t.Fatalf("resumed chain does not match expected, have %x, want %x", have, want)
+	}
+	// Importing archives not matching the trusted roots must fail.
+	untrusted := append([]common.Hash{}, roots...)
+	untrusted[1] = common.Hash{}
+	if err := ImportHistory(newHistoryChain(t, genesis), dir, "mainnet", untrusted); err == nil || !strings.Contains(err.Error(), "untrusted accumulator root") {
+		t.Fatalf("expected untrusted root error, got %v", err)
+	}
+	// Importing archives not matching their checksums must fail.
+	checksums[1] = common.Hash{}.Hex()
+	if err := os.WriteFile(filepath.Join(dir, "checksums.txt"), []byte(strings.Join(checksums, "\n")), os.ModePerm); err != nil {
+		t.Fatalf("failed to write checksums: %v", err)
+	}
+	if err := ImportHistory(newHistoryChain(t, genesis), dir, "mainnet", roots); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+// newHistoryChain creates a chain holding only the genesis to import history into.
+func newHistoryChain(t *testing.T, genesis *core.Genesis) *core.BlockChain {
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("unable to initialize chain: %v", err)
+	}
+	return chain
+}
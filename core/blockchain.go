@@ -139,6 +139,9 @@ type CacheConfig struct {
 
 	SnapshotNoBuild bool // Whether the background generation is allowed
 	SnapshotWait    bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
+
+	HistoryCutoff uint64              // Block number below which ancient bodies and receipts are pruned (0 = keep all)
+	TxIndex       rawdb.TxIndexConfig // Transaction indexing modes besides the txlookuplimit
 }
 
 // defaultCacheConfig are the default caching values if none are specified by the
@@ -192,9 +195,18 @@ type BlockChain struct {
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
 	blockProcFeed event.Feed
+	finalizedFeed event.Feed
+	safeFeed      event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
+	// Finalized and safe block events are delivered by markLoop, so that slow
+	// subscribers can't hold up SetFinalized and SetSafe.
+	markLock     sync.Mutex
+	pendingFinal *types.Header // finalized block not yet sent to the feed
+	pendingSafe  *types.Header // safe block not yet sent to the feed
+	markSignal   chan struct{}
+
 	// This mutex synchronizes chain write operations.
 	// Readers don't need to take it, they can just read the database.
 	chainmu *syncx.ClosableMutex
@@ -224,6 +236,7 @@ type BlockChain struct {
 	processor  Processor // Block transaction processor interface
 	forker     *ForkChoice
 	vmConfig   vm.Config
+	logger     BlockchainLogger // Live chain tracer, invoked during block import
 }
 
 // NewBlockChain returns a fully initialised block chain using information
@@ -243,6 +256,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	// Setup the genesis block, commit the provided genesis specification
 	// to database if the genesis block is not present yet, or load the
 	// stored one from database.
+	freshGenesis := rawdb.ReadCanonicalHash(db, 0) == (common.Hash{})
 	chainConfig, genesisHash, genesisErr := SetupGenesisBlockWithOverride(db, triedb, genesis, overrides)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -263,6 +277,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		flushInterval: int64(cacheConfig.TrieTimeLimit),
 		triegc:        prque.New[int64, common.Hash](nil),
 		quit:          make(chan struct{}),
+		markSignal:    make(chan struct{}, 1),
 		chainmu:       syncx.NewClosableMutex(),
 		bodyCache:     lru.NewCache[common.Hash, *types.Body](bodyCacheLimit),
 		bodyRLPCache:  lru.NewCache[common.Hash, rlp.RawValue](bodyCacheLimit),
@@ -273,6 +288,13 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		engine:        engine,
 		vmConfig:      vmConfig,
 	}
+	// A chain logger is only invoked during block import, so it's kept apart from
+	// the configuration used for all other executions.
+	if logger, ok := vmConfig.Tracer.(BlockchainLogger); ok {
+		bc.logger = logger
+		bc.vmConfig.Tracer = nil
+		bc.vmConfig.Debug = false
+	}
 	bc.forker = NewForkChoice(bc, shouldPreserve)
 	bc.stateCache = state.NewDatabaseWithNodeDB(bc.db, bc.triedb)
 	bc.validator = NewBlockValidator(chainConfig, bc, engine)
@@ -288,6 +310,13 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	if bc.genesisBlock == nil {
 		return nil, ErrNoGenesis
 	}
+	if bc.logger != nil && freshGenesis {
+		alloc := DefaultGenesisBlock().Alloc
+		if genesis != nil {
+			alloc = genesis.Alloc
+		}
+		bc.logger.OnGenesisBlock(bc.genesisBlock, alloc)
+	}
 
 	bc.currentBlock.Store(nil)
 	bc.currentSnapBlock.Store(nil)
@@ -410,6 +439,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	bc.wg.Add(1)
 	go bc.updateFutureBlocks()
 
+	// Start delivering finalized and safe block events.
+	bc.wg.Add(1)
+	go bc.markLoop()
+
 	// If periodic cache journal is required, spin it up.
 	if bc.cacheConfig.TrieCleanRejournal > 0 {
 		if bc.cacheConfig.TrieCleanRejournal < time.Minute {
@@ -432,6 +465,23 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		}
 		rawdb.WriteChainConfig(db, genesisHash, chainConfig)
 	}
+	// Prune the chain history if required, before the tx indexer starts.
+	if bc.cacheConfig.HistoryCutoff > 0 {
+		bc.pruneHistory()
+
+		bc.wg.Add(1)
+		go bc.maintainHistory()
+	}
+	// Record the transaction indexing modes, the indices maintained with others
+	// are only rebuilt by an explicit reindexing. Until then, they are flagged
+	// stale, unless there are no indexed blocks yet.
+	if stored := rawdb.ReadTxIndexConfig(db); !stored.Equal(&bc.cacheConfig.TxIndex) {
+		if bc.CurrentBlock().Number.Uint64() > 0 || bc.CurrentSnapBlock().Number.Uint64() > 0 {
+			log.Warn("Transaction indexing mode changed, run 'geth db reindex-txs' to rebuild the existing indices")
+			rawdb.WriteTxIndexStale(db)
+		}
+		rawdb.WriteTxIndexConfig(db, &bc.cacheConfig.TxIndex)
+	}
 	// Start tx indexer/unindexer if required.
 	if txLookupLimit != nil {
 		bc.txLookupLimit = *txLookupLimit
@@ -579,10 +629,16 @@ func (bc *BlockChain) SetHeadWithTimestamp(timestamp uint64) error {
 
 // SetFinalized sets the finalized block.
 func (bc *BlockChain) SetFinalized(header *types.Header) {
-	bc.currentFinalBlock.Store(header)
+	prev := bc.currentFinalBlock.Swap(header)
 	if header != nil {
 		rawdb.WriteFinalizedBlockHash(bc.db, header.Hash())
 		headFinalizedBlockGauge.Update(int64(header.Number.Uint64()))
+		if prev == nil || prev.Hash() != header.Hash() {
+			bc.markLock.Lock()
+			bc.pendingFinal = header
+			bc.markLock.Unlock()
+			bc.signalMark()
+		}
 	} else {
 		rawdb.WriteFinalizedBlockHash(bc.db, common.Hash{})
 		headFinalizedBlockGauge.Update(0)
@@ -591,14 +647,54 @@ func (bc *BlockChain) SetFinalized(header *types.Header) {
 
 // SetSafe sets the safe block.
 func (bc *BlockChain) SetSafe(header *types.Header) {
-	bc.currentSafeBlock.Store(header)
+	prev := bc.currentSafeBlock.Swap(header)
 	if header != nil {
 		headSafeBlockGauge.Update(int64(header.Number.Uint64()))
+		if prev == nil || prev.Hash() != header.Hash() {
+			bc.markLock.Lock()
+			bc.pendingSafe = header
+			bc.markLock.Unlock()
+			bc.signalMark()
+		}
 	} else {
 		headSafeBlockGauge.Update(0)
 	}
 }
 
+// signalMark notifies markLoop of a new finalized or safe block.
+func (bc *BlockChain) signalMark() {
+	select {
+	case bc.markSignal <- struct{}{}:
+	default:
+	}
+}
+
+// markLoop sends the finalized and safe block events. If the marks move again
+// before an event is delivered, only the latest one is sent: subscribers receive
+// the marks in order, but not necessarily every one of them.
+func (bc *BlockChain) markLoop() {
+	defer bc.wg.Done()
+
+	for {
+		select {
+		case <-bc.markSignal:
+			bc.markLock.Lock()
+			final, safe := bc.pendingFinal, bc.pendingSafe
+			bc.pendingFinal, bc.pendingSafe = nil, nil
+			bc.markLock.Unlock()
+
+			if final != nil {
+				bc.finalizedFeed.Send(FinalizedBlockEvent{Header: final})
+			}
+			if safe != nil {
+				bc.safeFeed.Send(SafeBlockEvent{Header: safe})
+			}
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
 // setHeadBeyondRoot rewinds the local chain to a new head with the extra condition
 // that the rewind must pass the specified state root. This method is meant to be
 // used when rewinding with snapshots enabled to ensure that we go back further than
@@ -892,7 +988,7 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	rawdb.WriteHeadHeaderHash(batch, block.Hash())
 	rawdb.WriteHeadFastBlockHash(batch, block.Hash())
 	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
-	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	bc.writeTxIndexEntries(batch, block)
 	rawdb.WriteHeadBlockHash(batch, block.Hash())
 
 	// Flush the whole batch into the disk, exit the node if failed
@@ -1144,9 +1240,9 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 		var batch = bc.db.NewBatch()
 		for i, block := range blockChain {
 			if bc.txLookupLimit == 0 || ancientLimit <= bc.txLookupLimit || block.NumberU64() >= ancientLimit-bc.txLookupLimit {
-				rawdb.WriteTxLookupEntriesByBlock(batch, block)
+				bc.writeTxIndexEntries(batch, block)
 			} else if rawdb.ReadTxIndexTail(bc.db) != nil {
-				rawdb.WriteTxLookupEntriesByBlock(batch, block)
+				bc.writeTxIndexEntries(batch, block)
 			}
 			stats.processed++
 
@@ -1229,7 +1325,7 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			// Write all the data out into the database
 			rawdb.WriteBody(batch, block.Hash(), block.NumberU64(), block.Body())
 			rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receiptChain[i])
-			rawdb.WriteTxLookupEntriesByBlock(batch, block) // Always write tx indices for live blocks, we assume they are needed
+			bc.writeTxIndexEntries(batch, block) // Always write tx indices for live blocks, we assume they are needed
 
 			// Write everything belongs to the blocks into the database. So that
 			// we can ensure all components of body is completed(body, receipts,
@@ -1753,10 +1849,22 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		}
 
 		// Process block using the parent state as reference point
+		vmConfig := bc.vmConfig
+		if bc.logger != nil {
+			td := new(big.Int).Set(block.Difficulty())
+			if ptd := bc.GetTd(block.ParentHash(), block.NumberU64()-1); ptd != nil {
+				td.Add(td, ptd)
+			}
+			bc.logger.OnBlockStart(block, td, bc.CurrentFinalBlock(), bc.CurrentSafeBlock())
+			statedb.SetLogger(bc.logger)
+			vmConfig.Tracer = bc.logger
+			vmConfig.Debug = true
+		}
 		substart := time.Now()
-		receipts, logs, usedGas, err := bc.processor.Process(block, parent.ExcessDataGas, statedb, bc.vmConfig)
+		receipts, logs, usedGas, err := bc.processor.Process(block, parent.ExcessDataGas, statedb, vmConfig)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
+			bc.logBlockEnd(err)
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
 		}
@@ -1778,6 +1886,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 		substart = time.Now()
 		if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
 			bc.reportBlock(block, receipts, err)
+			bc.logBlockEnd(err)
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
 		}
@@ -1798,6 +1907,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 			status, err = bc.writeBlockAndSetHead(block, receipts, logs, statedb, false)
 		}
 		atomic.StoreUint32(&followupInterrupt, 1)
+		bc.logBlockEnd(err)
 		if err != nil {
 			return it.index, err
 		}
@@ -1871,6 +1981,14 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals, setHead bool)
 	return it.index, err
 }
 
+// logBlockEnd notifies the chain logger, if any, that processing of the current
+// block has finished.
+func (bc *BlockChain) logBlockEnd(err error) {
+	if bc.logger != nil {
+		bc.logger.OnBlockEnd(err)
+	}
+}
+
 // insertSideChain is called when an import batch hits upon a pruned ancestor
 // error, which happens when a sidechain with a sufficiently old fork-block is
 // found.
@@ -2155,6 +2273,17 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Block) error {
 		// rewind the canonical chain to a lower point.
 		log.Error("Impossible reorg, please file an issue", "oldnum", oldBlock.Number(), "oldhash", oldBlock.Hash(), "oldblocks", len(oldChain), "newnum", newBlock.Number(), "newhash", newBlock.Hash(), "newblocks", len(newChain))
 	}
+	// The sender index is keyed by the position of the transactions instead of
+	// their hashes, so drop the entries of the old chain before indexing the new.
+	if bc.cacheConfig.TxIndex.Senders && len(oldChain) > 0 {
+		batch := bc.db.NewBatch()
+		for _, block := range oldChain {
+			rawdb.DeleteTxSenderEntriesByBlock(batch, block, types.MakeSigner(bc.chainConfig, block.Number(), block.Time()))
+		}
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to delete stale transaction sender indexes", "err", err)
+		}
+	}
 	// Insert the new chain(except the head block(reverse order)),
 	// taking care of the proper incremental order.
 	for i := len(newChain) - 1; i >= 1; i-- {
@@ -2359,7 +2488,7 @@ func (bc *BlockChain) indexBlocks(tail *uint64, head uint64, done chan struct{})
 		if bc.txLookupLimit != 0 && head >= bc.txLookupLimit {
 			from = head - bc.txLookupLimit + 1
 		}
-		rawdb.IndexTransactions(bc.db, from, head+1, bc.quit)
+		bc.indexTransactions(from, head+1)
 		return
 	}
 	// The tail flag is existent, but the whole chain is required to be indexed.
@@ -2372,18 +2501,43 @@ func (bc *BlockChain) indexBlocks(tail *uint64, head uint64, done chan struct{})
 			if end > head+1 {
 				end = head + 1
 			}
-			rawdb.IndexTransactions(bc.db, 0, end, bc.quit)
+			bc.indexTransactions(0, end)
 		}
 		return
 	}
 	// Update the transaction index to the new chain state
 	if head-bc.txLookupLimit+1 < *tail {
 		// Reindex a part of missing indices and rewind index tail to HEAD-limit
-		rawdb.IndexTransactions(bc.db, head-bc.txLookupLimit+1, *tail, bc.quit)
+		bc.indexTransactions(head-bc.txLookupLimit+1, *tail)
 	} else {
-		// Unindex a part of stale indices and forward index tail to HEAD-limit
-		rawdb.UnindexTransactions(bc.db, *tail, head-bc.txLookupLimit+1, bc.quit)
+		// Unindex a part of stale indices and forward index tail to HEAD-limit.
+		// The indices of pruned blocks can't be located, skip them.
+		from := *tail
+		if pruned := bc.HistoryPruningCutoff(); from < pruned {
+			from = pruned
+		}
+		if from < head-bc.txLookupLimit+1 {
+			rawdb.UnindexTransactionsWithConfig(bc.db, from, head-bc.txLookupLimit+1, bc.quit, bc.chainConfig, &bc.cacheConfig.TxIndex)
+		}
+	}
+}
+
+// indexTransactions indexes the transactions of the blocks in the range
+// [from, to), skipping the blocks whose bodies have been pruned.
+func (bc *BlockChain) indexTransactions(from, to uint64) {
+	if pruned := bc.HistoryPruningCutoff(); from < pruned {
+		from = pruned
 	}
+	if from >= to {
+		return
+	}
+	rawdb.IndexTransactionsWithConfig(bc.db, from, to, bc.quit, bc.chainConfig, &bc.cacheConfig.TxIndex)
+}
+
+// writeTxIndexEntries stores the configured transaction indices of a block.
+func (bc *BlockChain) writeTxIndexEntries(db ethdb.KeyValueWriter, block *types.Block) {
+	signer := types.MakeSigner(bc.chainConfig, block.Number(), block.Time())
+	rawdb.WriteTxIndexEntriesByBlock(db, block, signer, &bc.cacheConfig.TxIndex)
 }
 
 // maintainTxIndex is responsible for the construction and deletion of the
@@ -2429,6 +2583,51 @@ func (bc *BlockChain) maintainTxIndex() {
 	}
 }
 
+// historyPruneInterval is the interval at which the ancient store is checked
+// for new blocks to prune, matching the cadence of the chain freezer.
+const historyPruneInterval = time.Minute
+
+// maintainHistory is responsible for pruning the bodies and receipts of the
+// blocks below the configured history cutoff as they are moved into the
+// ancient store. The headers are retained for the entire chain.
+func (bc *BlockChain) maintainHistory() {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			bc.pruneHistory()
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// pruneHistory drops the ancient bodies and receipts below the history cutoff.
+// Only frozen blocks can be pruned, the rest is done once they are frozen.
+func (bc *BlockChain) pruneHistory() {
+	frozen, err := bc.db.Ancients()
+	if err != nil {
+		return // No ancient store, nothing to prune
+	}
+	target := bc.cacheConfig.HistoryCutoff
+	if target > frozen {
+		target = frozen
+	}
+	if target <= bc.HistoryPruningCutoff() {
+		return
+	}
+	start := time.Now()
+	if err := bc.db.TruncateTail(target); err != nil {
+		log.Error("Failed to prune chain history", "cutoff", target, "err", err)
+		return
+	}
+	log.Info("Pruned chain history", "cutoff", target, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
 	rawdb.WriteBadBlock(bc.db, block)
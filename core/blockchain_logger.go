@@ -0,0 +1,50 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// BlockchainLogger is used to trace the whole chain while blocks are imported. If
+// the tracer given in the vm.Config of a BlockChain implements this interface, it
+// is invoked for every processed block, and is not used for anything else.
+//
+// For each block, OnBlockStart is followed by the execution of the transactions
+// in block order, each enclosed in CaptureTxStart and CaptureTxEnd. System-level
+// changes such as block rewards and withdrawals are reported through the state
+// hooks after the last transaction. Processing ends with OnBlockEnd, whose error
+// is non-nil if the block was rejected. Hooks are not called for blocks which are
+// already known and skip execution.
+type BlockchainLogger interface {
+	vm.EVMLogger
+	tracing.StateLogger
+	tracing.GasLogger
+
+	// OnBlockStart is called before a block is processed. The total difficulty
+	// includes the block.
+	OnBlockStart(block *types.Block, td *big.Int, finalized, safe *types.Header)
+	// OnBlockEnd is called after a block has been processed.
+	OnBlockEnd(err error)
+	// OnGenesisBlock is called when the genesis block is written to an empty
+	// database.
+	OnGenesisBlock(genesis *types.Block, alloc GenesisAlloc)
+}
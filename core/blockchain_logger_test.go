@@ -0,0 +1,135 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// recordingChainLogger records the chain level events it receives.
+type recordingChainLogger struct {
+	events []string
+}
+
+func (l *recordingChainLogger) record(format string, args ...interface{}) {
+	l.events = append(l.events, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingChainLogger) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+func (l *recordingChainLogger) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+func (l *recordingChainLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+func (l *recordingChainLogger) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (l *recordingChainLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+func (l *recordingChainLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (l *recordingChainLogger) CaptureTxStart(gasLimit uint64) { l.record("txstart %d", gasLimit) }
+func (l *recordingChainLogger) CaptureTxEnd(restGas uint64)    { l.record("txend %d", restGas) }
+
+func (l *recordingChainLogger) OnBlockStart(block *types.Block, td *big.Int, finalized, safe *types.Header) {
+	l.record("blockstart %d td=%d", block.NumberU64(), td)
+}
+func (l *recordingChainLogger) OnBlockEnd(err error) { l.record("blockend %v", err) }
+func (l *recordingChainLogger) OnGenesisBlock(genesis *types.Block, alloc GenesisAlloc) {
+	l.record("genesis %d accounts", len(alloc))
+}
+func (l *recordingChainLogger) OnBalanceChange(addr common.Address, prev, new *big.Int, reason tracing.BalanceChangeReason) {
+	l.record("balance %x %d->%d reason=%d", addr[:1], prev, new, reason)
+}
+func (l *recordingChainLogger) OnNonceChange(addr common.Address, prev, new uint64) {
+	l.record("nonce %x %d->%d", addr[:1], prev, new)
+}
+func (l *recordingChainLogger) OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+	l.record("code %x", addr[:1])
+}
+func (l *recordingChainLogger) OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+	l.record("storage %x", addr[:1])
+}
+func (l *recordingChainLogger) OnLog(log *types.Log) { l.record("log %x", log.Address[:1]) }
+func (l *recordingChainLogger) OnGasChange(old, new uint64, reason tracing.GasChangeReason) {
+	l.record("gas %d->%d reason=%d", old, new, reason)
+}
+
+func TestBlockchainLogger(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		receiver = common.Address{0xbb}
+		coinbase = common.Address{0xcc}
+		gspec    = &Genesis{
+			Config: params.AllEthashProtocolChanges,
+			Alloc:  GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+		}
+		signer = types.LatestSigner(gspec.Config)
+		logger = new(recordingChainLogger)
+	)
+	_, blocks, _ := GenerateChainWithGenesis(gspec, ethash.NewFaker(), 1, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(coinbase)
+		tx, _ := types.SignTx(types.NewTransaction(0, receiver, big.NewInt(1000), params.TxGas, gen.BaseFee(), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, ethash.NewFaker(), vm.Config{Tracer: logger}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if cfg := chain.GetVMConfig(); cfg.Tracer != nil || cfg.Debug {
+		t.Fatal("chain logger leaked into the regular vm config")
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	var (
+		baseFee = blocks[0].BaseFee()
+		gasCost = new(big.Int).Mul(baseFee, big.NewInt(int64(params.TxGas)))
+		balance = new(big.Int).Sub(big.NewInt(params.Ether), gasCost)
+		reward  = new(big.Int).Set(ethash.ConstantinopleBlockReward)
+	)
+	want := []string{
+		"genesis 1 accounts",
+		fmt.Sprintf("blockstart 1 td=%d", new(big.Int).Add(gspec.ToBlock().Difficulty(), blocks[0].Difficulty())),
+		fmt.Sprintf("balance %x %d->%d reason=%d", sender[:1], big.NewInt(params.Ether), balance, tracing.BalanceDecreaseGasBuy),
+		"txstart 21000",
+		fmt.Sprintf("gas 0->21000 reason=%d", tracing.GasChangeTxInitialBalance),
+		fmt.Sprintf("gas 21000->0 reason=%d", tracing.GasChangeTxIntrinsicGas),
+		fmt.Sprintf("nonce %x 0->1", sender[:1]),
+		fmt.Sprintf("balance %x %d->%d reason=%d", sender[:1], balance, new(big.Int).Sub(balance, big.NewInt(1000)), tracing.BalanceChangeTransfer),
+		fmt.Sprintf("balance %x 0->1000 reason=%d", receiver[:1], tracing.BalanceChangeTransfer),
+		"txend 0",
+		fmt.Sprintf("balance %x 0->%d reason=%d", coinbase[:1], reward, tracing.BalanceIncreaseRewardMineBlock),
+		"blockend <nil>",
+	}
+	if !reflect.DeepEqual(logger.events, want) {
+		t.Fatalf("wrong events:\nhave %q\nwant %q", logger.events, want)
+	}
+}
@@ -266,6 +266,16 @@ func (bc *BlockChain) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLook
 	return lookup
 }
 
+// HistoryPruningCutoff returns the number of the first block whose body and
+// receipts are still available, the ones before it having been pruned.
+func (bc *BlockChain) HistoryPruningCutoff() uint64 {
+	tail, err := bc.db.Tail()
+	if err != nil {
+		return 0
+	}
+	return tail
+}
+
 // GetTd retrieves a block's total difficulty in the canonical chain from the
 // database by hash and number, caching it if found.
 func (bc *BlockChain) GetTd(hash common.Hash, number uint64) *big.Int {
@@ -406,6 +416,18 @@ func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
 }
 
+// SubscribeFinalizedBlockEvent registers a subscription of FinalizedBlockEvent.
+// An event is sent whenever the finalized block changes.
+func (bc *BlockChain) SubscribeFinalizedBlockEvent(ch chan<- FinalizedBlockEvent) event.Subscription {
+	return bc.scope.Track(bc.finalizedFeed.Subscribe(ch))
+}
+
+// SubscribeSafeBlockEvent registers a subscription of SafeBlockEvent.
+// An event is sent whenever the safe block changes.
+func (bc *BlockChain) SubscribeSafeBlockEvent(ch chan<- SafeBlockEvent) event.Subscription {
+	return bc.scope.Track(bc.safeFeed.Subscribe(ch))
+}
+
 // SubscribeBlockProcessingEvent registers a subscription of bool where true means
 // block processing has started while false means it has stopped.
 func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscription {
@@ -2625,6 +2625,108 @@ func TestTransactionIndices(t *testing.T) {
 	}
 }
 
+// Tests that the bodies and receipts of ancient blocks below the history cutoff
+// are pruned, while their headers and the rest of the chain are retained.
+func TestHistoryPruning(t *testing.T) {
+	// Configure and generate a sample block chain
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(100000000000000000)
+		gspec   = &Genesis{
+			Config:  params.TestChainConfig,
+			Alloc:   GenesisAlloc{address: {Balance: funds}},
+			BaseFee: big.NewInt(params.InitialBaseFee),
+		}
+		signer = types.LatestSigner(gspec.Config)
+	)
+	_, blocks, receipts := GenerateChainWithGenesis(gspec, ethash.NewFaker(), 128, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, block.header.BaseFee, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	defer ancientDb.Close()
+
+	rawdb.WriteAncientBlocks(ancientDb, append([]*types.Block{gspec.ToBlock()}, blocks...), append([]types.Receipts{{}}, receipts...), big.NewInt(0))
+
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.HistoryCutoff = 64
+	chain, err := NewBlockChain(ancientDb, &cacheConfig, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if cutoff := chain.HistoryPruningCutoff(); cutoff != 64 {
+		t.Fatalf("history cutoff mismatch: have %d, want %d", cutoff, 64)
+	}
+	for i := uint64(1); i <= 128; i++ {
+		header := chain.GetHeaderByNumber(i)
+		if header == nil {
+			t.Fatalf("header %d missing", i)
+		}
+		block := chain.GetBlockByNumber(i)
+		receipts := chain.GetReceiptsByHash(header.Hash())
+		if i < 64 {
+			if block != nil {
+				t.Fatalf("block %d not pruned", i)
+			}
+			if receipts != nil {
+				t.Fatalf("receipts of block %d not pruned", i)
+			}
+			continue
+		}
+		if block == nil {
+			t.Fatalf("block %d missing", i)
+		}
+		if len(receipts) != 1 {
+			t.Fatalf("receipts of block %d missing", i)
+		}
+	}
+}
+
+// Tests that changing the transaction indexing modes flags the existing indices
+// stale, but not the indices of a fresh chain.
+func TestTxIndexConfigChange(t *testing.T) {
+	var (
+		gspec        = &Genesis{Config: params.TestChainConfig, BaseFee: big.NewInt(params.InitialBaseFee)}
+		_, blocks, _ = GenerateChainWithGenesis(gspec, ethash.NewFaker(), 4, nil)
+		db           = rawdb.NewMemoryDatabase()
+		senders      = &CacheConfig{TrieCleanLimit: 256, TrieDirtyLimit: 256, TrieTimeLimit: 5 * time.Minute, SnapshotLimit: 256, SnapshotWait: true, TxIndex: rawdb.TxIndexConfig{Senders: true}}
+	)
+	// Start a fresh chain with the sender index enabled
+	chain, err := NewBlockChain(db, senders, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if rawdb.ReadTxIndexStale(db) {
+		t.Fatal("fresh chain indices flagged stale")
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+
+	// Restart with the default indexing modes
+	chain, err = NewBlockChain(db, nil, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	chain.Stop()
+	if !rawdb.ReadTxIndexStale(db) {
+		t.Fatal("indices not flagged stale after indexing mode change")
+	}
+	if config := rawdb.ReadTxIndexConfig(db); !config.Equal(nil) {
+		t.Fatalf("stored index config mismatch: have %+v", config)
+	}
+}
+
 func TestSkipStaleTxIndicesInSnapSync(t *testing.T) {
 	// Configure and generate a sample block chain
 	var (
@@ -4438,3 +4540,57 @@ func TestEIP3651(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// Tests that updates of the finalized and safe blocks are announced, but only when
+// the marked block actually changes.
+func TestFinalizedSafeEvents(t *testing.T) {
+	gspec := &Genesis{Config: params.TestChainConfig, BaseFee: big.NewInt(params.InitialBaseFee)}
+	_, blocks, _ := GenerateChainWithGenesis(gspec, ethash.NewFaker(), 2, func(i int, gen *BlockGen) {})
+
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	var (
+		finalCh = make(chan FinalizedBlockEvent, 4)
+		safeCh  = make(chan SafeBlockEvent, 4)
+	)
+	defer chain.SubscribeFinalizedBlockEvent(finalCh).Unsubscribe()
+	defer chain.SubscribeSafeBlockEvent(safeCh).Unsubscribe()
+
+	chain.SetFinalized(blocks[0].Header())
+	chain.SetFinalized(blocks[0].Header())
+	chain.SetFinalized(blocks[1].Header())
+	chain.SetFinalized(nil)
+	chain.SetSafe(blocks[1].Header())
+
+	// Events are delivered in order, but marks superseded before their event was
+	// sent may be skipped. Repeated marks must not be sent again.
+	var last *types.Header
+	for last == nil || last.Hash() != blocks[1].Hash() {
+		select {
+		case ev := <-finalCh:
+			if last != nil && ev.Header.Number.Cmp(last.Number) <= 0 {
+				t.Fatalf("finalized block event #%d after #%d", ev.Header.Number, last.Number)
+			}
+			last = ev.Header
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing finalized block event")
+		}
+	}
+	select {
+	case ev := <-safeCh:
+		if ev.Header.Hash() != blocks[1].Hash() {
+			t.Fatalf("wrong safe block event: have #%d", ev.Header.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing safe block event")
+	}
+	select {
+	case ev := <-finalCh:
+		t.Fatalf("unexpected finalized block event #%d", ev.Header.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
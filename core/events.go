@@ -41,3 +41,9 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// FinalizedBlockEvent is posted when the finalized block is updated.
+type FinalizedBlockEvent struct{ Header *types.Header }
+
+// SafeBlockEvent is posted when the safe block is updated.
+type SafeBlockEvent struct{ Header *types.Header }
@@ -18,7 +18,9 @@ package rawdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -93,6 +95,301 @@ func DeleteTxLookupEntries(db ethdb.KeyValueWriter, hashes []common.Hash) {
 	}
 }
 
+// TxIndexConfig configures the transaction indexing modes besides the range of
+// indexed blocks, which is set by the txlookuplimit.
+type TxIndexConfig struct {
+	// Addresses, if non-empty, restricts the hash based lookup entries to the
+	// transactions sent from or to one of the addresses.
+	Addresses map[common.Address]struct{}
+
+	// Senders enables indexing the transactions by sender address.
+	Senders bool
+}
+
+// needSenders reports whether maintaining the configured indices requires the
+// senders of the transactions.
+func (c *TxIndexConfig) needSenders() bool {
+	return c != nil && (len(c.Addresses) > 0 || c.Senders)
+}
+
+// hashIndexed reports whether the hash based lookup entry of a transaction is
+// maintained. The sender is nil if it couldn't be recovered.
+func (c *TxIndexConfig) hashIndexed(from *common.Address, to *common.Address) bool {
+	if c == nil || len(c.Addresses) == 0 {
+		return true
+	}
+	if from != nil {
+		if _, ok := c.Addresses[*from]; ok {
+			return true
+		}
+	}
+	if to != nil {
+		if _, ok := c.Addresses[*to]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal reports whether the two configurations maintain the same indices. A
+// nil configuration is equal to the default one, indexing all transactions by
+// hash only.
+func (c *TxIndexConfig) Equal(other *TxIndexConfig) bool {
+	if c == nil {
+		c = new(TxIndexConfig)
+	}
+	if other == nil {
+		other = new(TxIndexConfig)
+	}
+	if c.Senders != other.Senders || len(c.Addresses) != len(other.Addresses) {
+		return false
+	}
+	for addr := range c.Addresses {
+		if _, ok := other.Addresses[addr]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// storedTxIndexConfig is the RLP encoding of a TxIndexConfig.
+type storedTxIndexConfig struct {
+	Addresses []common.Address
+	Senders   bool
+}
+
+// ReadTxIndexConfig retrieves the transaction indexing modes the indices were
+// last maintained with, or nil if they were never configured.
+func ReadTxIndexConfig(db ethdb.KeyValueReader) *TxIndexConfig {
+	data, _ := db.Get(txIndexConfigKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var stored storedTxIndexConfig
+	if err := rlp.DecodeBytes(data, &stored); err != nil {
+		log.Error("Invalid transaction index config RLP", "err", err)
+		return nil
+	}
+	config := &TxIndexConfig{Senders: stored.Senders}
+	if len(stored.Addresses) > 0 {
+		config.Addresses = make(map[common.Address]struct{}, len(stored.Addresses))
+		for _, addr := range stored.Addresses {
+			config.Addresses[addr] = struct{}{}
+		}
+	}
+	return config
+}
+
+// WriteTxIndexConfig stores the transaction indexing modes the indices are
+// maintained with.
+func WriteTxIndexConfig(db ethdb.KeyValueWriter, config *TxIndexConfig) {
+	var stored storedTxIndexConfig
+	if config != nil {
+		stored.Senders = config.Senders
+		for addr := range config.Addresses {
+			stored.Addresses = append(stored.Addresses, addr)
+		}
+		sort.Slice(stored.Addresses, func(i, j int) bool {
+			return bytes.Compare(stored.Addresses[i][:], stored.Addresses[j][:]) < 0
+		})
+	}
+	data, err := rlp.EncodeToBytes(&stored)
+	if err != nil {
+		log.Crit("Failed to encode transaction index config", "err", err)
+	}
+	if err := db.Put(txIndexConfigKey, data); err != nil {
+		log.Crit("Failed to store transaction index config", "err", err)
+	}
+}
+
+// ReadTxIndexStale retrieves whether the transaction indices were built with
+// other indexing modes than the configured ones, and need to be rebuilt.
+func ReadTxIndexStale(db ethdb.KeyValueReader) bool {
+	ok, _ := db.Has(txIndexStaleKey)
+	return ok
+}
+
+// WriteTxIndexStale flags the transaction indices as built with other indexing
+// modes than the configured ones.
+func WriteTxIndexStale(db ethdb.KeyValueWriter) {
+	if err := db.Put(txIndexStaleKey, []byte{1}); err != nil {
+		log.Crit("Failed to store the stale transaction index flag", "err", err)
+	}
+}
+
+// DeleteTxIndexStale clears the stale flag once the transaction indices were
+// rebuilt with the configured indexing modes.
+func DeleteTxIndexStale(db ethdb.KeyValueWriter) {
+	if err := db.Delete(txIndexStaleKey); err != nil {
+		log.Crit("Failed to delete the stale transaction index flag", "err", err)
+	}
+}
+
+// TxSenderEntry is the position of a transaction in the canonical chain, as
+// recorded in the sender index.
+type TxSenderEntry struct {
+	BlockNumber uint64
+	Index       uint64
+	Hash        common.Hash
+}
+
+// ReadTxSenderEntries retrieves at most limit entries of the sender index of
+// an account, in the order of their position in the chain, starting at the
+// given block. The entries of the blocks reorged out of the canonical chain
+// may linger in the index, so the callers must verify them.
+func ReadTxSenderEntries(db ethdb.Iteratee, sender common.Address, from uint64, limit int) []TxSenderEntry {
+	prefix := append(append([]byte{}, txSenderPrefix...), sender.Bytes()...)
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	var entries []TxSenderEntry
+	for len(entries) < limit && it.Next() {
+		key := it.Key()
+		if len(key) != len(prefix)+8+4 || len(it.Value()) != common.HashLength {
+			continue
+		}
+		entries = append(entries, TxSenderEntry{
+			BlockNumber: binary.BigEndian.Uint64(key[len(prefix):]),
+			Index:       uint64(binary.BigEndian.Uint32(key[len(prefix)+8:])),
+			Hash:        common.BytesToHash(it.Value()),
+		})
+	}
+	return entries
+}
+
+// writeTxSenderEntry stores the position of a transaction in the sender index.
+func writeTxSenderEntry(db ethdb.KeyValueWriter, sender common.Address, number uint64, index int, hash common.Hash) {
+	if err := db.Put(txSenderKey(sender, number, index), hash.Bytes()); err != nil {
+		log.Crit("Failed to store transaction sender entry", "err", err)
+	}
+}
+
+// deleteTxSenderEntry removes the position of a transaction from the sender index.
+func deleteTxSenderEntry(db ethdb.KeyValueWriter, sender common.Address, number uint64, index int) {
+	if err := db.Delete(txSenderKey(sender, number, index)); err != nil {
+		log.Crit("Failed to delete transaction sender entry", "err", err)
+	}
+}
+
+// writeTxIndexEntries stores the configured indices of the transactions of a
+// block. The senders and recipients must be set if the config requires them,
+// the transactions whose sender couldn't be recovered are left out of the
+// sender index.
+func writeTxIndexEntries(db ethdb.KeyValueWriter, block *blockTxHashes, config *TxIndexConfig) {
+	if !config.needSenders() {
+		WriteTxLookupEntries(db, block.number, block.hashes)
+		return
+	}
+	numberBytes := new(big.Int).SetUint64(block.number).Bytes()
+	for i, hash := range block.hashes {
+		if config.hashIndexed(block.senders[i], block.recipients[i]) {
+			writeTxLookupEntry(db, hash, numberBytes)
+		}
+		if config.Senders && block.senders[i] != nil {
+			writeTxSenderEntry(db, *block.senders[i], block.number, i, hash)
+		}
+	}
+}
+
+// deleteTxIndexEntries removes the configured indices of the transactions of a
+// block. The senders must be set if the sender index is enabled.
+func deleteTxIndexEntries(db ethdb.KeyValueWriter, block *blockTxHashes, config *TxIndexConfig) {
+	DeleteTxLookupEntries(db, block.hashes)
+	if config != nil && config.Senders {
+		for i, sender := range block.senders {
+			if sender != nil {
+				deleteTxSenderEntry(db, *sender, block.number, i)
+			}
+		}
+	}
+}
+
+// newBlockTxHashes collects the transaction hashes of a block, along with the
+// senders and recipients if the config requires them.
+func newBlockTxHashes(number uint64, txs types.Transactions, signer types.Signer, config *TxIndexConfig) *blockTxHashes {
+	block := &blockTxHashes{number: number, hashes: make([]common.Hash, len(txs))}
+	for i, tx := range txs {
+		block.hashes[i] = tx.Hash()
+	}
+	if !config.needSenders() {
+		return block
+	}
+	block.senders = make([]*common.Address, len(txs))
+	block.recipients = make([]*common.Address, len(txs))
+	for i, tx := range txs {
+		block.recipients[i] = tx.To()
+
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			log.Error("Failed to recover transaction sender", "number", number, "hash", block.hashes[i], "err", err)
+			continue
+		}
+		block.senders[i] = &sender
+	}
+	return block
+}
+
+// WriteTxIndexEntriesByBlock stores the configured indices of the transactions
+// of a block. The signer is only used if the config requires the senders.
+func WriteTxIndexEntriesByBlock(db ethdb.KeyValueWriter, block *types.Block, signer types.Signer, config *TxIndexConfig) {
+	if !config.needSenders() {
+		WriteTxLookupEntriesByBlock(db, block)
+		return
+	}
+	writeTxIndexEntries(db, newBlockTxHashes(block.NumberU64(), block.Transactions(), signer, config), config)
+}
+
+// DeleteTxSenderEntriesByBlock removes the sender index entries of the
+// transactions of a block.
+func DeleteTxSenderEntriesByBlock(db ethdb.KeyValueWriter, block *types.Block, signer types.Signer) {
+	for i, tx := range block.Transactions() {
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		deleteTxSenderEntry(db, sender, block.NumberU64(), i)
+	}
+}
+
+// DeleteTxIndices removes all the hash based lookup and sender index entries,
+// along with the index tail, in preparation for reindexing the transactions.
+func DeleteTxIndices(db ethdb.KeyValueStore) error {
+	for _, prefix := range []struct {
+		prefix []byte
+		length int
+	}{
+		{txLookupPrefix, len(txLookupPrefix) + common.HashLength},
+		{txSenderPrefix, len(txSenderPrefix) + common.AddressLength + 8 + 4},
+	} {
+		it := db.NewIterator(prefix.prefix, nil)
+		batch := db.NewBatch()
+		for it.Next() {
+			if len(it.Key()) != prefix.length {
+				continue
+			}
+			if err := batch.Delete(it.Key()); err != nil {
+				it.Release()
+				return err
+			}
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					it.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+	return db.Delete(txIndexTailKey)
+}
+
 // ReadTransaction retrieves a specific transaction from the database, along with
 // its added positional metadata.
 func ReadTransaction(db ethdb.Reader, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64) {
@@ -187,3 +187,36 @@ func WriteTransitionStatus(db ethdb.KeyValueWriter, data []byte) {
 		log.Crit("Failed to store the eth2 transition status", "err", err)
 	}
 }
+
+// ReadCorruptedAncients retrieves the ancient items found corrupted by the last
+// verification, which are still to be repaired.
+func ReadCorruptedAncients(db ethdb.KeyValueReader) []CorruptedAncient {
+	data, _ := db.Get(corruptedAncientsKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var items []CorruptedAncient
+	if err := rlp.DecodeBytes(data, &items); err != nil {
+		log.Error("Invalid corrupted ancients list", "err", err)
+		return nil
+	}
+	return items
+}
+
+// WriteCorruptedAncients stores the ancient items still to be repaired, deleting
+// the list if it's empty.
+func WriteCorruptedAncients(db ethdb.KeyValueWriter, items []CorruptedAncient) {
+	if len(items) == 0 {
+		if err := db.Delete(corruptedAncientsKey); err != nil {
+			log.Crit("Failed to delete the corrupted ancients list", "err", err)
+		}
+		return
+	}
+	data, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		log.Crit("Failed to encode the corrupted ancients list", "err", err)
+	}
+	if err := db.Put(corruptedAncientsKey, data); err != nil {
+		log.Crit("Failed to store the corrupted ancients list", "err", err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ReadTxTrace retrieves the stored result of running the named tracer on the
+// transaction at the given index of a block.
+func ReadTxTrace(db ethdb.KeyValueReader, blockHash common.Hash, index int, tracer string) []byte {
+	data, _ := db.Get(txTraceKey(blockHash, index, tracer))
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+// WriteTxTrace stores the result of running the named tracer on the transaction
+// at the given index of a block.
+func WriteTxTrace(db ethdb.KeyValueWriter, blockHash common.Hash, index int, tracer string, trace []byte) {
+	if err := db.Put(txTraceKey(blockHash, index, tracer), trace); err != nil {
+		log.Crit("Failed to store transaction trace", "err", err)
+	}
+}
+
+// DeleteBlockTraces removes the stored results of all tracers for all
+// transactions of a block.
+func DeleteBlockTraces(db ethdb.KeyValueStore, blockHash common.Hash) {
+	it := db.NewIterator(txTraceBlockPrefix(blockHash), nil)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		if err := batch.Delete(it.Key()); err != nil {
+			log.Crit("Failed to delete transaction trace", "err", err)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to delete transaction traces", "err", err)
+	}
+}
+
+// ReadTxTraceTail retrieves the number of the oldest block whose stored traces
+// may not have been pruned yet.
+func ReadTxTraceTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(txTraceTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteTxTraceTail stores the number of the oldest block whose stored traces
+// may not have been pruned yet.
+func WriteTxTraceTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(txTraceTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the transaction trace tail", "err", err)
+	}
+}
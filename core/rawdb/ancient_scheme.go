@@ -34,14 +34,45 @@ const (
 	ChainFreezerDifficultyTable = "diffs"
 )
 
-// chainFreezerNoSnappy configures whether compression is disabled for the ancient-tables.
-// Hashes and difficulties don't compress well.
-var chainFreezerNoSnappy = map[string]bool{
-	ChainFreezerHeaderTable:     false,
-	ChainFreezerHashTable:       true,
-	ChainFreezerBodiesTable:     false,
-	ChainFreezerReceiptTable:    false,
-	ChainFreezerDifficultyTable: true,
+// chainFreezerTableConfigs configures the settings for tables in the chain freezer.
+// Hashes and difficulties don't compress well. Only block bodies and receipts
+// can be pruned, so that headers are retained for the entire chain.
+var chainFreezerTableConfigs = map[string]freezerTableConfig{
+	ChainFreezerHeaderTable:     {noSnappy: false, prunable: false},
+	ChainFreezerHashTable:       {noSnappy: true, prunable: false},
+	ChainFreezerBodiesTable:     {noSnappy: false, prunable: true},
+	ChainFreezerReceiptTable:    {noSnappy: false, prunable: true},
+	ChainFreezerDifficultyTable: {noSnappy: true, prunable: false},
+}
+
+// freezerTableConfig contains the settings for a freezer table.
+type freezerTableConfig struct {
+	noSnappy  bool // disables item compression
+	zstd      bool // switches compression to zstd with a trained dictionary
+	checksums bool // stores the checksums of the items in new tables
+	prunable  bool // true for tables that can be pruned by TruncateTail
+}
+
+// zstdTableConfigs returns a copy of the given table configs, with the zstd
+// compression enabled for the compressed tables.
+func zstdTableConfigs(tables map[string]freezerTableConfig) map[string]freezerTableConfig {
+	configs := make(map[string]freezerTableConfig, len(tables))
+	for name, config := range tables {
+		config.zstd = !config.noSnappy
+		configs[name] = config
+	}
+	return configs
+}
+
+// checksumTableConfigs returns a copy of the given table configs, with the
+// checksums of the items enabled for newly created tables.
+func checksumTableConfigs(tables map[string]freezerTableConfig) map[string]freezerTableConfig {
+	configs := make(map[string]freezerTableConfig, len(tables))
+	for name, config := range tables {
+		config.checksums = true
+		configs[name] = config
+	}
+	return configs
 }
 
 // The list of identifiers of ancient stores.
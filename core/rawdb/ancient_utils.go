@@ -18,9 +18,12 @@ package rawdb
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
 )
 
 type tableSize struct {
@@ -34,6 +37,8 @@ type freezerInfo struct {
 	head  uint64      // The number of last stored item in the freezer
 	tail  uint64      // The number of first stored item in the freezer
 	sizes []tableSize // The storage size per table
+
+	compressions []tableCompression // The compression of the compressed tables, if inspectable
 }
 
 // count returns the number of stored items in the freezer.
@@ -60,7 +65,7 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 			// with the key-value store, inspect the chain store directly.
 			info := freezerInfo{name: freezer}
 			// Retrieve storage size of every contained table.
-			for table := range chainFreezerNoSnappy {
+			for table := range chainFreezerTableConfigs {
 				size, err := db.AncientSize(table)
 				if err != nil {
 					return nil, err
@@ -80,6 +85,15 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 				return nil, err
 			}
 			info.tail = tail
+
+			// Measure the compression on the table files, which are only
+			// available if the freezer is stored locally.
+			if datadir, err := db.AncientDatadir(); err == nil && datadir != "" {
+				info.compressions, err = inspectCompression(resolveChainFreezerDir(datadir), chainFreezerTableConfigs)
+				if err != nil {
+					log.Warn("Failed to inspect ancient compression", "err", err)
+				}
+			}
 			infos = append(infos, info)
 
 		default:
@@ -89,6 +103,33 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 	return infos, nil
 }
 
+// inspectCompression measures the compression of the compressed tables of the
+// freezer in the given directory.
+func inspectCompression(path string, tables map[string]freezerTableConfig) ([]tableCompression, error) {
+	var names []string
+	for name, config := range tables {
+		if !config.noSnappy {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var infos []tableCompression
+	for _, name := range names {
+		table, err := newFreezerTable(path, name, false, true)
+		if err != nil {
+			return nil, err
+		}
+		info, err := table.compression()
+		table.Close()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 // InspectFreezerTable dumps out the index of a specific freezer table. The passed
 // ancient indicates the path of root ancient directory where the chain freezer can
 // be opened. Start and end specify the range for dumping out indexes.
@@ -96,15 +137,15 @@ func inspectFreezers(db ethdb.Database) ([]freezerInfo, error) {
 func InspectFreezerTable(ancient string, freezerName string, tableName string, start, end int64) error {
 	var (
 		path   string
-		tables map[string]bool
+		tables map[string]freezerTableConfig
 	)
 	switch freezerName {
 	case chainFreezerName:
-		path, tables = resolveChainFreezerDir(ancient), chainFreezerNoSnappy
+		path, tables = resolveChainFreezerDir(ancient), chainFreezerTableConfigs
 	default:
 		return fmt.Errorf("unknown freezer, supported ones: %v", freezers)
 	}
-	noSnappy, exist := tables[tableName]
+	config, exist := tables[tableName]
 	if !exist {
 		var names []string
 		for name := range tables {
@@ -112,10 +153,78 @@ func InspectFreezerTable(ancient string, freezerName string, tableName string, s
 		}
 		return fmt.Errorf("unknown table, supported ones: %v", names)
 	}
-	table, err := newFreezerTable(path, tableName, noSnappy, true)
+	table, err := newFreezerTable(path, tableName, config.noSnappy, true)
 	if err != nil {
 		return err
 	}
 	table.dumpIndexStdout(start, end)
 	return nil
 }
+
+// CorruptedAncient is an item of the chain freezer failing verification.
+type CorruptedAncient struct {
+	Kind   string // Table of the item
+	Number uint64 // Number of the item
+	Err    error  `rlp:"-"` // Reason of the failure, not persisted
+}
+
+const (
+	verifyBatchItems = 1024        // Number of items read at once during verification
+	verifyBatchBytes = 1024 * 1024 // Maximum size of the items read at once
+)
+
+// VerifyAncients reads every stored item of the chain freezer, returning the
+// ones that can't be retrieved: items not matching their checksum, if the tables
+// store them, or failing to decompress.
+func VerifyAncients(db ethdb.AncientReader) ([]CorruptedAncient, error) {
+	ancients, err := db.Ancients()
+	if err != nil {
+		return nil, err
+	}
+	tail, err := db.Tail()
+	if err != nil {
+		return nil, err
+	}
+	var kinds []string
+	for kind := range chainFreezerTableConfigs {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var (
+		corrupted []CorruptedAncient
+		start     = time.Now()
+		logged    = time.Now()
+	)
+	for _, kind := range kinds {
+		var from uint64
+		if chainFreezerTableConfigs[kind].prunable {
+			from = tail
+		}
+		for i := from; i < ancients; {
+			count := ancients - i
+			if count > verifyBatchItems {
+				count = verifyBatchItems
+			}
+			items, err := db.AncientRange(kind, i, count, verifyBatchBytes)
+			if err == nil {
+				i += uint64(len(items))
+			} else {
+				// Some items of the batch are unreadable, check them one by one
+				for n := i; n < i+count; n++ {
+					if _, err := db.Ancient(kind, n); err != nil {
+						log.Warn("Corrupted ancient item", "kind", kind, "number", n, "err", err)
+						corrupted = append(corrupted, CorruptedAncient{Kind: kind, Number: n, Err: err})
+					}
+				}
+				i += count
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Verifying ancient items", "kind", kind, "number", i, "total", ancients, "corrupted", len(corrupted), "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+	}
+	log.Info("Verified ancient items", "items", ancients-tail, "corrupted", len(corrupted), "elapsed", common.PrettyDuration(time.Since(start)))
+	return corrupted, nil
+}
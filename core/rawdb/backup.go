@@ -0,0 +1,464 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// backupVersion is the version of the backup layout and manifest format.
+	backupVersion = 1
+
+	// BackupManifestName is the name of the manifest file within a backup.
+	BackupManifestName = "backup.json"
+
+	// BackupChainDataDir and BackupAncientDir are the names of the directories
+	// holding the key-value store and the ancient store within a backup.
+	BackupChainDataDir = "chaindata"
+	BackupAncientDir   = "ancient"
+)
+
+// BackupFile describes a file of the chain freezer included in a backup.
+type BackupFile struct {
+	Name   string `json:"name"`             // File name within the chain freezer directory
+	Size   int64  `json:"size"`             // Size of the file in bytes
+	Remote bool   `json:"remote,omitempty"` // Whether the file is only available in the remote store
+}
+
+// BackupManifest describes the content of a database backup.
+type BackupManifest struct {
+	Version  int          `json:"version"`
+	Created  time.Time    `json:"created"`
+	Ancients uint64       `json:"ancients"` // Number of items in the ancient store
+	Tail     uint64       `json:"tail"`     // Number of the first item in the ancient store
+	Files    []BackupFile `json:"files"`
+}
+
+// Backupper is implemented by the databases supporting on-line backups.
+type Backupper interface {
+	// Backup creates a consistent copy of the database in the given directory,
+	// which must either not exist or be empty.
+	Backup(dir string) (*BackupManifest, error)
+}
+
+// Backup creates a consistent copy of a live database in the given directory.
+// The key-value store is checkpointed into the chaindata folder, the chain
+// freezer is copied up to its synced item count into the ancient folder and a
+// manifest describing the copy is written alongside.
+func Backup(db ethdb.Database, dir string) (*BackupManifest, error) {
+	b, ok := db.(Backupper)
+	if !ok {
+		return nil, errors.New("database does not support backups")
+	}
+	return b.Backup(dir)
+}
+
+// Checkpoint implements ethdb.Checkpointer, forwarding to the key-value store.
+func (db *nofreezedb) Checkpoint(dir string) error {
+	cp, ok := db.KeyValueStore.(ethdb.Checkpointer)
+	if !ok {
+		return errNotSupported
+	}
+	return cp.Checkpoint(dir)
+}
+
+// Backup implements Backupper, pausing the chain freezer while the key-value
+// store and the ancient store are being copied.
+func (frdb *freezerdb) Backup(dir string) (*BackupManifest, error) {
+	kvdb, ok := frdb.KeyValueStore.(ethdb.Checkpointer)
+	if !ok {
+		return nil, errors.New("key-value store does not support checkpoints")
+	}
+	freezer, ok := frdb.AncientStore.(*chainFreezer)
+	if !ok {
+		return nil, errors.New("ancient store does not support backups")
+	}
+	return freezer.backup(kvdb, dir)
+}
+
+// backup copies the key-value store and the chain freezer into the given
+// directory. The key-value store is checkpointed first, without blocking the
+// freezer: items frozen in the meantime are still present in the checkpoint, as
+// they're only deleted from the key-value store after being frozen. Afterwards
+// freezing and any other ancient store modification is blocked while the heads
+// of the tables are copied, and their sealed data files linked.
+func (f *chainFreezer) backup(kvdb ethdb.Checkpointer, dir string) (*BackupManifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if entries, err := os.ReadDir(dir); err != nil {
+		return nil, err
+	} else if len(entries) > 0 {
+		return nil, fmt.Errorf("backup directory %s is not empty", dir)
+	}
+	f.writeLock.RLock()
+	truncations := f.truncations
+	f.writeLock.RUnlock()
+
+	start := time.Now()
+	if err := kvdb.Checkpoint(filepath.Join(dir, BackupChainDataDir)); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint key-value store: %w", err)
+	}
+	log.Info("Checkpointed key-value store", "elapsed", common.PrettyDuration(time.Since(start)))
+
+	ancient := filepath.Join(dir, BackupAncientDir, chainFreezerName)
+	if err := os.MkdirAll(ancient, 0755); err != nil {
+		return nil, err
+	}
+	manifest, pending, err := f.backupTables(ancient, truncations)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Created = start.UTC()
+
+	// Copy the sealed data files which couldn't be linked. They aren't modified
+	// anymore, so the freezer doesn't need to be paused.
+	for _, file := range pending {
+		err := copyFileRange(file.src, filepath.Join(ancient, file.name), file.size)
+		file.src.Close()
+		if err != nil {
+			for _, file := range pending {
+				file.src.Close()
+			}
+			return nil, err
+		}
+	}
+	blob, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, BackupManifestName), blob, 0644); err != nil {
+		return nil, err
+	}
+	log.Info("Created database backup", "dir", dir, "ancients", manifest.Ancients, "elapsed", common.PrettyDuration(time.Since(start)))
+	return manifest, nil
+}
+
+// backupFile is a sealed data file which couldn't be linked into a backup, and
+// is to be copied once the freezer is running again.
+type backupFile struct {
+	src  *os.File
+	name string
+	size int64
+}
+
+// backupTables pauses the freezer and copies the current state of the tables
+// into the given directory. It fails if the head of the ancient store was
+// truncated since the given truncation count was taken, as the key-value store
+// checkpoint might not continue where the ancient items end anymore.
+func (f *chainFreezer) backupTables(dir string, truncations uint64) (*BackupManifest, []backupFile, error) {
+	f.pauseLock.Lock()
+	defer f.pauseLock.Unlock()
+
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	if f.truncations != truncations {
+		return nil, nil, errors.New("ancient store truncated during backup")
+	}
+	if err := f.Sync(); err != nil {
+		return nil, nil, err
+	}
+	manifest := &BackupManifest{
+		Version:  backupVersion,
+		Ancients: atomic.LoadUint64(&f.frozen),
+		Tail:     atomic.LoadUint64(&f.tail),
+	}
+	names := make([]string, 0, len(f.tables))
+	for name := range f.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pending []backupFile
+	for _, name := range names {
+		files, copies, err := f.tables[name].backup(dir)
+		pending = append(pending, copies...)
+		if err != nil {
+			for _, file := range pending {
+				file.src.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to copy ancient table %s: %w", name, err)
+		}
+		manifest.Files = append(manifest.Files, files...)
+	}
+	return manifest, pending, nil
+}
+
+// backup copies the index, the metadata and the head data file of the table
+// into the given directory, and hard links its sealed data files. The sealed
+// files which can't be linked, e.g. because the directory is on a different
+// file system, are returned opened to be copied later. Data files which are
+// only available in the remote store are recorded but not copied. The caller
+// must ensure that the table isn't modified concurrently.
+func (t *freezerTable) backup(dir string) ([]BackupFile, []backupFile, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil || t.head == nil || t.meta == nil {
+		return nil, nil, errClosed
+	}
+	var (
+		files   []BackupFile
+		pending []backupFile
+	)
+	for _, f := range []*os.File{t.index, t.meta} {
+		stat, err := f.Stat()
+		if err != nil {
+			return nil, pending, err
+		}
+		name := filepath.Base(f.Name())
+		if err := copyFileRange(f, filepath.Join(dir, name), stat.Size()); err != nil {
+			return nil, pending, err
+		}
+		files = append(files, BackupFile{Name: name, Size: stat.Size()})
+	}
+	for num := t.tailId; num <= t.headId; num++ {
+		name := t.fileName(num)
+		switch f := t.files[num].(type) {
+		case nil:
+			return nil, pending, fmt.Errorf("missing data file %s", name)
+
+		case *remoteFile:
+			size, err := f.store.Stat(name)
+			if err != nil {
+				return nil, pending, err
+			}
+			files = append(files, BackupFile{Name: name, Size: size, Remote: true})
+
+		default:
+			if num == t.headId {
+				if err := copyFileRange(f, filepath.Join(dir, name), t.headBytes); err != nil {
+					return nil, pending, err
+				}
+				files = append(files, BackupFile{Name: name, Size: t.headBytes})
+				continue
+			}
+			stat, err := f.(*os.File).Stat()
+			if err != nil {
+				return nil, pending, err
+			}
+			if err := os.Link(f.Name(), filepath.Join(dir, name)); err != nil {
+				src, err := os.Open(f.Name())
+				if err != nil {
+					return nil, pending, err
+				}
+				pending = append(pending, backupFile{src: src, name: name, size: stat.Size()})
+			}
+			files = append(files, BackupFile{Name: name, Size: stat.Size()})
+		}
+	}
+	return files, pending, nil
+}
+
+// unshareFile replaces a local data file by a copy of its first size bytes, so
+// that hard links of the file made by backups aren't affected by modifications.
+// Files only available in the remote store are fetched into a new file anyway.
+// It assumes that the write-lock is held by the caller and the file is closed.
+func (t *freezerTable) unshareFile(num uint32, size int64) error {
+	path := filepath.Join(t.path, t.fileName(num))
+	src, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	err = copyFileRange(src, tmp, size)
+	src.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyFileRange copies the first size bytes of src into a new file at path.
+func copyFileRange(src io.ReaderAt, path string, size int64) error {
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, io.NewSectionReader(src, 0, size)); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// ReadBackupManifest reads the manifest of the backup in the given directory.
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	blob, err := os.ReadFile(filepath.Join(dir, BackupManifestName))
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(BackupManifest)
+	if err := json.Unmarshal(blob, manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// VerifyBackup checks that the backup in the given directory is complete and
+// consistent: all files listed in the manifest are present with the recorded
+// sizes, and the backed up database opens with the expected ancient items and
+// a retrievable head block. The remote store is needed if any ancient files
+// were offloaded when the backup was taken.
+func VerifyBackup(dir string, remote *FreezerRemote) (*BackupManifest, error) {
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	ancient := filepath.Join(dir, BackupAncientDir, chainFreezerName)
+	for _, file := range manifest.Files {
+		var size int64
+		if file.Remote {
+			if remote == nil {
+				return nil, fmt.Errorf("ancient file %s is stored remotely, but no remote store is configured", file.Name)
+			}
+			if size, err = remote.Store.Stat(file.Name); err != nil {
+				return nil, err
+			}
+		} else {
+			stat, err := os.Stat(filepath.Join(ancient, file.Name))
+			if err != nil {
+				return nil, err
+			}
+			size = stat.Size()
+		}
+		if size != file.Size {
+			return nil, fmt.Errorf("ancient file %s size mismatch: have %d, want %d", file.Name, size, file.Size)
+		}
+	}
+	db, err := Open(OpenOptions{
+		Directory:         filepath.Join(dir, BackupChainDataDir),
+		AncientsDirectory: filepath.Join(dir, BackupAncientDir),
+		ReadOnly:          true,
+		AncientRemote:     remote,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if frozen, err := db.Ancients(); err != nil {
+		return nil, err
+	} else if frozen != manifest.Ancients {
+		return nil, fmt.Errorf("ancient item count mismatch: have %d, want %d", frozen, manifest.Ancients)
+	}
+	if tail, err := db.Tail(); err != nil {
+		return nil, err
+	} else if tail != manifest.Tail {
+		return nil, fmt.Errorf("ancient tail mismatch: have %d, want %d", tail, manifest.Tail)
+	}
+	hash := ReadHeadBlockHash(db)
+	if hash == (common.Hash{}) {
+		return nil, errors.New("head block hash missing")
+	}
+	number := ReadHeaderNumber(db, hash)
+	if number == nil {
+		return nil, fmt.Errorf("head block number missing, hash %x", hash)
+	}
+	if ReadCanonicalHash(db, *number) != hash {
+		return nil, fmt.Errorf("head block %d is not canonical", *number)
+	}
+	if ReadHeader(db, hash, *number) == nil {
+		return nil, fmt.Errorf("head block header %d missing", *number)
+	}
+	return manifest, nil
+}
+
+// RestoreBackup verifies the backup in the given directory and copies it into
+// the key-value store and ancient directories of a node, which must either not
+// exist or be empty.
+func RestoreBackup(dir string, chaindata string, ancient string, remote *FreezerRemote) (*BackupManifest, error) {
+	manifest, err := VerifyBackup(dir, remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+	for _, path := range []string{chaindata, ancient} {
+		entries, err := os.ReadDir(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		// The ancient directory is within chaindata by default
+		for _, entry := range entries {
+			if filepath.Join(path, entry.Name()) != filepath.Clean(ancient) {
+				return nil, fmt.Errorf("target directory %s is not empty", path)
+			}
+		}
+	}
+	if err := copyDir(filepath.Join(dir, BackupChainDataDir), chaindata); err != nil {
+		return nil, err
+	}
+	if err := copyDir(filepath.Join(dir, BackupAncientDir), ancient); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// copyDir recursively copies the content of the src directory into dst.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return copyFileRange(f, target, stat.Size())
+	})
+}
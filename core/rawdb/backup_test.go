@@ -0,0 +1,190 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Tests that a live database can be backed up, and that the backup can be
+// validated and restored.
+func TestBackupRestore(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		backup   = filepath.Join(dir, "backup")
+		blocks   = makeTestBlocks(20, 1)
+		receipts = makeTestReceipts(20, 1)
+	)
+	db, err := Open(OpenOptions{
+		Directory:         filepath.Join(dir, "chaindata"),
+		AncientsDirectory: filepath.Join(dir, "chaindata", "ancient"),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Store the first half of the chain in the freezer, the rest in the
+	// key-value store.
+	if _, err := WriteAncientBlocks(db, blocks[:10], receipts[:10], big.NewInt(100)); err != nil {
+		t.Fatalf("failed to write ancient blocks: %v", err)
+	}
+	WriteCanonicalHash(db, blocks[0].Hash(), 0)
+	for i := 10; i < len(blocks); i++ {
+		WriteBlock(db, blocks[i])
+		WriteReceipts(db, blocks[i].Hash(), uint64(i), receipts[i])
+		WriteTd(db, blocks[i].Hash(), uint64(i), big.NewInt(100))
+		WriteCanonicalHash(db, blocks[i].Hash(), uint64(i))
+	}
+	WriteHeadBlockHash(db, blocks[19].Hash())
+
+	manifest, err := Backup(db, backup)
+	if err != nil {
+		t.Fatalf("failed to back up database: %v", err)
+	}
+	if manifest.Ancients != 10 {
+		t.Fatalf("ancient count mismatch: have %d, want %d", manifest.Ancients, 10)
+	}
+	if _, err := Backup(db, backup); err == nil {
+		t.Fatal("backup into non-empty directory succeeded")
+	}
+	// Changes after the backup must not be part of it
+	WriteHeadBlockHash(db, blocks[15].Hash())
+
+	if _, err := VerifyBackup(backup, nil); err != nil {
+		t.Fatalf("failed to verify backup: %v", err)
+	}
+	restored := filepath.Join(dir, "restored")
+	if _, err := RestoreBackup(backup, restored, filepath.Join(restored, "ancient"), nil); err != nil {
+		t.Fatalf("failed to restore backup: %v", err)
+	}
+	if _, err := RestoreBackup(backup, restored, filepath.Join(restored, "ancient"), nil); err == nil {
+		t.Fatal("restore into non-empty directory succeeded")
+	}
+	rdb, err := Open(OpenOptions{
+		Directory:         restored,
+		AncientsDirectory: filepath.Join(restored, "ancient"),
+		ReadOnly:          true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open restored database: %v", err)
+	}
+	defer rdb.Close()
+
+	if frozen, _ := rdb.Ancients(); frozen != 10 {
+		t.Fatalf("restored ancient count mismatch: have %d, want %d", frozen, 10)
+	}
+	if head := ReadHeadBlockHash(rdb); head != blocks[19].Hash() {
+		t.Fatalf("restored head mismatch: have %x, want %x", head, blocks[19].Hash())
+	}
+	for i, block := range blocks {
+		if have := ReadBlock(rdb, block.Hash(), uint64(i)); have == nil || have.Hash() != block.Hash() {
+			t.Fatalf("restored block %d missing", i)
+		}
+	}
+	// Corrupt the backup and ensure it's rejected
+	path := filepath.Join(backup, BackupAncientDir, chainFreezerName, "headers.0000.cdat")
+	if err := os.Truncate(path, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBackup(backup, nil); err == nil {
+		t.Fatal("corrupted backup verified")
+	}
+}
+
+// Tests that databases without a persistent key-value store can't be backed up.
+func TestBackupUnsupported(t *testing.T) {
+	if _, err := Backup(NewMemoryDatabase(), t.TempDir()); err == nil {
+		t.Fatal("memory database backup succeeded")
+	}
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), t.TempDir(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := Backup(db, t.TempDir()); err == nil {
+		t.Fatal("memory database with freezer backup succeeded")
+	}
+}
+
+// Tests that the sealed data files of a table are hard linked into a backup, and
+// that truncating the live table back into them leaves the backup intact.
+func TestBackupTableLinks(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		backup = t.TempDir()
+	)
+	f, err := newTable(dir, "test", metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 50, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 5 items of 20 bytes are split into 2 per data file: files 0 and 1 are
+	// sealed, file 2 is the head
+	writeChunks(t, f, 5, 20)
+
+	files, pending, err := f.backup(backup)
+	if err != nil {
+		t.Fatalf("failed to back up table: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("sealed files not linked: %d", len(pending))
+	}
+	if len(files) != 5 {
+		t.Fatalf("backup file count mismatch: have %d, want %d", len(files), 5)
+	}
+	for num := uint32(0); num <= 2; num++ {
+		live, err := os.Stat(filepath.Join(dir, f.fileName(num)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		copied, err := os.Stat(filepath.Join(backup, f.fileName(num)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked := os.SameFile(live, copied); linked != (num < 2) {
+			t.Errorf("data file %d link mismatch: have %v, want %v", num, linked, num < 2)
+		}
+	}
+	// Truncate back into the first sealed file and overwrite its last item
+	if err := f.truncateHead(1); err != nil {
+		t.Fatalf("failed to truncate head: %v", err)
+	}
+	batch := f.newBatch()
+	if err := batch.AppendRaw(1, getChunk(20, 0xff)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if err := batch.commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	copied, err := os.ReadFile(filepath.Join(backup, f.fileName(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(getChunk(20, 0), getChunk(20, 1)...); !bytes.Equal(copied, want) {
+		t.Fatalf("backed up data file modified: have %x, want %x", copied, want)
+	}
+}
@@ -52,11 +52,17 @@ type chainFreezer struct {
 	quit    chan struct{}
 	wg      sync.WaitGroup
 	trigger chan chan struct{} // Manual blocking freeze trigger, test determinism
+
+	// pauseLock is held by the background thread while it moves a batch of
+	// blocks, so that backups can pause freezing and see a consistent state of
+	// the key-value store and the freezer.
+	pauseLock sync.Mutex
 }
 
-// newChainFreezer initializes the freezer for ancient chain data.
-func newChainFreezer(datadir string, namespace string, readonly bool) (*chainFreezer, error) {
-	freezer, err := NewChainFreezer(datadir, namespace, readonly)
+// newChainFreezer initializes the freezer for ancient chain data with the given
+// table settings.
+func newChainFreezer(datadir string, namespace string, readonly bool, tables map[string]freezerTableConfig, remote *FreezerRemote) (*chainFreezer, error) {
+	freezer, err := NewRemoteFreezer(datadir, namespace, readonly, freezerTableSize, tables, remote)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +156,7 @@ func (f *chainFreezer) freeze(db ethdb.KeyValueStore) {
 		}
 
 		// Seems we have data ready to be frozen, process in usable batches
+		f.pauseLock.Lock()
 		var (
 			start    = time.Now()
 			first, _ = f.Ancients()
@@ -160,6 +167,7 @@ func (f *chainFreezer) freeze(db ethdb.KeyValueStore) {
 		}
 		ancients, err := f.freezeRange(nfdb, first, limit)
 		if err != nil {
+			f.pauseLock.Unlock()
 			log.Error("Error in block freeze operation", "err", err)
 			backoff = true
 			continue
@@ -235,6 +243,7 @@ func (f *chainFreezer) freeze(db ethdb.KeyValueStore) {
 				log.Crit("Failed to delete dangling side blocks", "err", err)
 			}
 		}
+		f.pauseLock.Unlock()
 
 		// Log something friendly for the user
 		context := []interface{}{
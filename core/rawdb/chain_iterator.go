@@ -17,6 +17,7 @@
 package rawdb
 
 import (
+	"math/big"
 	"runtime"
 	"sync/atomic"
 	"time"
@@ -26,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -84,18 +86,22 @@ func InitDatabaseFromFreezer(db ethdb.Database) {
 }
 
 type blockTxHashes struct {
-	number uint64
-	hashes []common.Hash
+	number     uint64
+	hashes     []common.Hash
+	senders    []*common.Address // Only set if required by the index config, nil if unrecoverable
+	recipients []*common.Address // Only set if required by the index config
 }
 
 // iterateTransactions iterates over all transactions in the (canon) block
-// number(s) given, and yields the hashes on a channel. If there is a signal
-// received from interrupt channel, the iteration will be aborted and result
-// channel will be closed.
-func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool, interrupt chan struct{}) chan *blockTxHashes {
+// number(s) given, and yields the hashes on a channel. If the index config
+// requires the senders of the transactions, they are recovered in parallel
+// using the chain config. If there is a signal received from interrupt channel,
+// the iteration will be aborted and result channel will be closed.
+func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool, interrupt chan struct{}, chainConfig *params.ChainConfig, config *TxIndexConfig) chan *blockTxHashes {
 	// One thread sequentially reads data from db
 	type numberRlp struct {
 		number uint64
+		time   uint64 // Only set if the senders are required
 		rlp    rlp.RawValue
 	}
 	if to == from {
@@ -117,10 +123,18 @@ func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool
 		}
 		defer close(rlpCh)
 		for n != end {
-			data := ReadCanonicalBodyRLP(db, n)
+			var (
+				data = ReadCanonicalBodyRLP(db, n)
+				time uint64
+			)
+			if config.needSenders() {
+				if header := ReadHeader(db, ReadCanonicalHash(db, n), n); header != nil {
+					time = header.Time
+				}
+			}
 			// Feed the block to the aggregator, or abort on interrupt
 			select {
-			case rlpCh <- &numberRlp{n, data}:
+			case rlpCh <- &numberRlp{n, time, data}:
 			case <-interrupt:
 				return
 			}
@@ -146,14 +160,11 @@ func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool
 				log.Warn("Failed to decode block body", "block", data.number, "error", err)
 				return
 			}
-			var hashes []common.Hash
-			for _, tx := range body.Transactions {
-				hashes = append(hashes, tx.Hash())
-			}
-			result := &blockTxHashes{
-				hashes: hashes,
-				number: data.number,
+			var signer types.Signer
+			if config.needSenders() {
+				signer = types.MakeSigner(chainConfig, new(big.Int).SetUint64(data.number), data.time)
 			}
+			result := newBlockTxHashes(data.number, body.Transactions, signer, config)
 			// Feed the block to the aggregator, or abort on interrupt
 			select {
 			case hashesCh <- result:
@@ -177,13 +188,13 @@ func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool
 //
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
-func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
+func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool, chainConfig *params.ChainConfig, config *TxIndexConfig) {
 	// short circuit for invalid range
 	if from >= to {
 		return
 	}
 	var (
-		hashesCh = iterateTransactions(db, from, to, true, interrupt)
+		hashesCh = iterateTransactions(db, from, to, true, interrupt, chainConfig, config)
 		batch    = db.NewBatch()
 		start    = time.Now()
 		logged   = start.Add(-7 * time.Second)
@@ -212,7 +223,7 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 			// Next block available, pop it off and index it
 			delivery := queue.PopItem()
 			lastNum = delivery.number
-			WriteTxLookupEntries(batch, delivery.number, delivery.hashes)
+			writeTxIndexEntries(batch, delivery, config)
 			blocks++
 			txs += len(delivery.hashes)
 			// If enough data was accumulated in memory or we're at the last block, dump to disk
@@ -257,25 +268,37 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
 func IndexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) {
-	indexTransactions(db, from, to, interrupt, nil)
+	indexTransactions(db, from, to, interrupt, nil, nil, nil)
+}
+
+// IndexTransactionsWithConfig creates the transaction indices of the specified
+// block range as set by the index config, recovering the senders using the
+// chain config if needed. The from is included while to is excluded.
+func IndexTransactionsWithConfig(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, chainConfig *params.ChainConfig, config *TxIndexConfig) {
+	indexTransactions(db, from, to, interrupt, nil, chainConfig, config)
 }
 
 // indexTransactionsForTesting is the internal debug version with an additional hook.
 func indexTransactionsForTesting(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
-	indexTransactions(db, from, to, interrupt, hook)
+	indexTransactions(db, from, to, interrupt, hook, nil, nil)
 }
 
 // unindexTransactions removes txlookup indices of the specified block range.
 //
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
-func unindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
+func unindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool, chainConfig *params.ChainConfig, config *TxIndexConfig) {
 	// short circuit for invalid range
 	if from >= to {
 		return
 	}
+	// Only the sender index needs the senders to be removed, the hash lookups
+	// are removed regardless of the address filter
+	if config != nil && !config.Senders {
+		config = nil
+	}
 	var (
-		hashesCh = iterateTransactions(db, from, to, false, interrupt)
+		hashesCh = iterateTransactions(db, from, to, false, interrupt, chainConfig, config)
 		batch    = db.NewBatch()
 		start    = time.Now()
 		logged   = start.Add(-7 * time.Second)
@@ -301,7 +324,7 @@ func unindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt ch
 			}
 			delivery := queue.PopItem()
 			nextNum = delivery.number + 1
-			DeleteTxLookupEntries(batch, delivery.hashes)
+			deleteTxIndexEntries(batch, delivery, config)
 			txs += len(delivery.hashes)
 			blocks++
 
@@ -345,10 +368,17 @@ func unindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt ch
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
 func UnindexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}) {
-	unindexTransactions(db, from, to, interrupt, nil)
+	unindexTransactions(db, from, to, interrupt, nil, nil, nil)
+}
+
+// UnindexTransactionsWithConfig removes the transaction indices of the specified
+// block range as set by the index config, recovering the senders using the
+// chain config if needed. The from is included while to is excluded.
+func UnindexTransactionsWithConfig(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, chainConfig *params.ChainConfig, config *TxIndexConfig) {
+	unindexTransactions(db, from, to, interrupt, nil, chainConfig, config)
 }
 
 // unindexTransactionsForTesting is the internal debug version with an additional hook.
 func unindexTransactionsForTesting(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
-	unindexTransactions(db, from, to, interrupt, hook)
+	unindexTransactions(db, from, to, interrupt, hook, nil, nil)
 }
@@ -17,6 +17,7 @@
 package rawdb
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"reflect"
 	"sort"
@@ -25,6 +26,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 func TestChainIterator(t *testing.T) {
@@ -80,7 +83,7 @@ func TestChainIterator(t *testing.T) {
 	}
 	for i, c := range cases {
 		var numbers []int
-		hashCh := iterateTransactions(chainDb, c.from, c.to, c.reverse, nil)
+		hashCh := iterateTransactions(chainDb, c.from, c.to, c.reverse, nil, nil, nil)
 		if hashCh != nil {
 			for h := range hashCh {
 				numbers = append(numbers, int(h.number))
@@ -206,3 +209,158 @@ func TestIndexTransactions(t *testing.T) {
 	verify(8, 11, true, 8)
 	verify(0, 8, false, 8)
 }
+
+// Tests that the address filter and the sender index are maintained as set by
+// the index config.
+func TestIndexTransactionsWithConfig(t *testing.T) {
+	var (
+		chainDb = NewMemoryDatabase()
+		config  = params.TestChainConfig
+		signer  = types.LatestSigner(config)
+		keys    = make([]*ecdsa.PrivateKey, 3)
+		addrs   = make([]common.Address, 3)
+		txs     []*types.Transaction
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(0)}, nil, nil, nil, newHasher())
+	WriteBlock(chainDb, block)
+	WriteCanonicalHash(chainDb, block.Hash(), block.NumberU64())
+
+	// Block i contains a transaction from account i%3 to account (i+1)%3
+	for i := 1; i <= 9; i++ {
+		to := addrs[(i+1)%3]
+		tx := types.MustSignNewTx(keys[i%3], signer, &types.DynamicFeeTx{
+			ChainID:   config.ChainID,
+			Nonce:     uint64(i),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       21000,
+			To:        &to,
+		})
+		txs = append(txs, tx)
+		block = types.NewBlock(&types.Header{Number: big.NewInt(int64(i))}, []*types.Transaction{tx}, nil, nil, newHasher())
+		WriteBlock(chainDb, block)
+		WriteCanonicalHash(chainDb, block.Hash(), block.NumberU64())
+	}
+	// Index the transactions touching account 0, and all senders
+	txconfig := &TxIndexConfig{
+		Addresses: map[common.Address]struct{}{addrs[0]: {}},
+		Senders:   true,
+	}
+	IndexTransactionsWithConfig(chainDb, 0, 10, nil, config, txconfig)
+
+	for i, tx := range txs {
+		number := uint64(i + 1)
+		indexed := ReadTxLookupEntry(chainDb, tx.Hash()) != nil
+		if want := number%3 != 1; indexed != want {
+			t.Errorf("tx %d: hash index mismatch: have %v, want %v", number, indexed, want)
+		}
+	}
+	for i, addr := range addrs {
+		entries := ReadTxSenderEntries(chainDb, addr, 0, 10)
+		if len(entries) != 3 {
+			t.Fatalf("account %d: sender entry count mismatch: have %d, want %d", i, len(entries), 3)
+		}
+		for j, entry := range entries {
+			number := uint64(3*j + i)
+			if i == 0 {
+				number += 3
+			}
+			if entry.BlockNumber != number || entry.Index != 0 || entry.Hash != txs[number-1].Hash() {
+				t.Errorf("account %d: entry %d mismatch: have %+v, want block %d", i, j, entry, number)
+			}
+		}
+	}
+	// Check that the entries can be paginated
+	if entries := ReadTxSenderEntries(chainDb, addrs[1], 2, 1); len(entries) != 1 || entries[0].BlockNumber != 4 {
+		t.Fatalf("paginated sender entries mismatch: have %+v", entries)
+	}
+	// Unindex part of the chain, the sender entries must be removed too
+	UnindexTransactionsWithConfig(chainDb, 0, 5, nil, config, txconfig)
+	for i, addr := range addrs {
+		for _, entry := range ReadTxSenderEntries(chainDb, addr, 0, 10) {
+			if entry.BlockNumber < 5 {
+				t.Errorf("account %d: unindexed sender entry of block %d remained", i, entry.BlockNumber)
+			}
+		}
+	}
+	for i, tx := range txs[:4] {
+		if ReadTxLookupEntry(chainDb, tx.Hash()) != nil {
+			t.Errorf("tx %d: unindexed hash lookup remained", i+1)
+		}
+	}
+}
+
+// Tests that transactions whose sender can't be recovered are left out of the
+// sender index, instead of being attributed to the zero address.
+func TestIndexTransactionsUnrecoverableSender(t *testing.T) {
+	var (
+		chainDb = NewMemoryDatabase()
+		config  = params.TestChainConfig
+		key, _  = crypto.GenerateKey()
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	block := types.NewBlock(&types.Header{Number: big.NewInt(0)}, nil, nil, nil, newHasher())
+	WriteBlock(chainDb, block)
+	WriteCanonicalHash(chainDb, block.Hash(), block.NumberU64())
+
+	// Sign the transaction for another chain, failing the sender recovery
+	otherID := new(big.Int).Add(config.ChainID, common.Big1)
+	tx := types.MustSignNewTx(key, types.LatestSignerForChainID(otherID), &types.DynamicFeeTx{
+		ChainID:   otherID,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &addr,
+	})
+	block = types.NewBlock(&types.Header{Number: big.NewInt(1)}, []*types.Transaction{tx}, nil, nil, newHasher())
+	WriteBlock(chainDb, block)
+	WriteCanonicalHash(chainDb, block.Hash(), block.NumberU64())
+
+	IndexTransactionsWithConfig(chainDb, 0, 2, nil, config, &TxIndexConfig{Senders: true})
+	if ReadTxLookupEntry(chainDb, tx.Hash()) == nil {
+		t.Fatal("hash lookup of transaction with unrecoverable sender missing")
+	}
+	for _, sender := range []common.Address{{}, addr} {
+		if entries := ReadTxSenderEntries(chainDb, sender, 0, 10); len(entries) != 0 {
+			t.Fatalf("sender entries of %x present: %+v", sender, entries)
+		}
+	}
+}
+
+// Tests that the index config survives a database roundtrip.
+func TestTxIndexConfigStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+	if config := ReadTxIndexConfig(db); config != nil {
+		t.Fatalf("non-existent config returned: %+v", config)
+	}
+	if !(*TxIndexConfig)(nil).Equal(&TxIndexConfig{}) {
+		t.Fatal("nil config not equal to default")
+	}
+	config := &TxIndexConfig{
+		Addresses: map[common.Address]struct{}{{1}: {}, {2}: {}},
+		Senders:   true,
+	}
+	WriteTxIndexConfig(db, config)
+	if stored := ReadTxIndexConfig(db); !stored.Equal(config) {
+		t.Fatalf("stored config mismatch: have %+v, want %+v", stored, config)
+	}
+	if config.Equal(&TxIndexConfig{Senders: true}) {
+		t.Fatal("configs with different addresses equal")
+	}
+	// Check that the stale flag is maintained
+	if ReadTxIndexStale(db) {
+		t.Fatal("indices stale without flagging")
+	}
+	WriteTxIndexStale(db)
+	if !ReadTxIndexStale(db) {
+		t.Fatal("stale flag missing")
+	}
+	DeleteTxIndexStale(db)
+	if ReadTxIndexStale(db) {
+		t.Fatal("stale flag not cleared")
+	}
+}
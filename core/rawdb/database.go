@@ -22,7 +22,6 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -160,6 +159,11 @@ func (db *nofreezedb) MigrateTable(kind string, convert convertLegacyFn) error {
 	return errNotSupported
 }
 
+// RepairAncient returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) RepairAncient(kind string, number uint64, item []byte) error {
+	return errNotSupported
+}
+
 // AncientDatadir returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) AncientDatadir() (string, error) {
 	return "", errNotSupported
@@ -199,8 +203,22 @@ func resolveChainFreezerDir(ancient string) string {
 // storage. The passed ancient indicates the path of root ancient directory
 // where the chain freezer can be opened.
 func NewDatabaseWithFreezer(db ethdb.KeyValueStore, ancient string, namespace string, readonly bool) (ethdb.Database, error) {
+	return NewDatabaseWithRemoteFreezer(db, ancient, namespace, readonly, nil)
+}
+
+// NewDatabaseWithRemoteFreezer creates a high level database on top of a given
+// key-value data store with a freezer, which keeps its sealed data files in the
+// given remote store instead of the local ancient directory. A nil remote
+// results in a local-only freezer, same as NewDatabaseWithFreezer.
+func NewDatabaseWithRemoteFreezer(db ethdb.KeyValueStore, ancient string, namespace string, readonly bool, remote *FreezerRemote) (ethdb.Database, error) {
+	return newDatabaseWithFreezer(db, ancient, namespace, readonly, chainFreezerTableConfigs, remote)
+}
+
+// newDatabaseWithFreezer creates a high level database on top of a given
+// key-value data store with a freezer using the given table settings.
+func newDatabaseWithFreezer(db ethdb.KeyValueStore, ancient string, namespace string, readonly bool, tables map[string]freezerTableConfig, remote *FreezerRemote) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newChainFreezer(resolveChainFreezerDir(ancient), namespace, readonly)
+	frdb, err := newChainFreezer(resolveChainFreezerDir(ancient), namespace, readonly, tables, remote)
 	if err != nil {
 		printChainMetadata(db)
 		return nil, err
@@ -327,59 +345,68 @@ const (
 	dbLeveldb = "leveldb"
 )
 
-// hasPreexistingDb checks the given data directory whether a database is already
-// instantiated at that location, and if so, returns the type of database (or the
-// empty string).
-func hasPreexistingDb(path string) string {
-	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
-		return "" // No pre-existing db
-	}
-	if matches, err := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 || err != nil {
-		if err != nil {
-			panic(err) // only possible if the pattern is malformed
-		}
-		return dbPebble
-	}
-	return dbLeveldb
-}
-
 // OpenOptions contains the options to apply when opening a database.
 // OBS: If AncientsDirectory is empty, it indicates that no freezer is to be used.
 type OpenOptions struct {
-	Type              string // "leveldb" | "pebble"
+	Type              string // "leveldb" | "pebble" | "boltdb" | any other registered ethdb.Backend
 	Directory         string // the datadir
 	AncientsDirectory string // the ancients-dir
 	Namespace         string // the namespace for database relevant metrics
 	Cache             int    // the capacity(in megabytes) of the data caching
 	Handles           int    // number of files to be open simultaneously
 	ReadOnly          bool
+	AncientRemote     *FreezerRemote // the remote store for sealed ancient data, if any
+	SizeTracking      bool           // maintain live size counters of the data categories
+	SizeRescan        time.Duration  // interval of walking the database to correct the size counters, 0 = never
+
+	// AncientCompression is the compression of the new ancient items, either
+	// "snappy" (default) or "zstd". Tables switched to zstd keep using it.
+	AncientCompression string
+
+	// AncientChecksums enables storing the checksums of the ancient items in
+	// newly created freezer tables, existing tables keep their format.
+	AncientChecksums bool
 }
 
-// openKeyValueDatabase opens a disk-based key-value database, e.g. leveldb or pebble.
+// openKeyValueDatabase opens a disk-based key-value database of one of the
+// backends registered in ethdb, e.g. leveldb or pebble.
 //
 //	                      type == null          type != null
 //	                   +----------------------------------------
 //	db is non-existent |  leveldb default  |  specified type
 //	db is existent     |  from db          |  specified type (if compatible)
-func openKeyValueDatabase(o OpenOptions) (ethdb.Database, error) {
-	existingDb := hasPreexistingDb(o.Directory)
+func openKeyValueDatabase(o OpenOptions) (ethdb.KeyValueStore, error) {
+	existingDb := ethdb.DetectBackend(o.Directory)
 	if len(existingDb) != 0 && len(o.Type) != 0 && o.Type != existingDb {
 		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in specified data directory", o.Type, existingDb)
 	}
-	if o.Type == dbPebble || existingDb == dbPebble {
-		if PebbleEnabled {
-			log.Info("Using pebble as the backing database")
-			return NewPebbleDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
-		} else {
+	// Use leveldb as default if there's no explicit choice nor pre-existing db
+	kind := o.Type
+	if len(kind) == 0 {
+		kind = existingDb
+	}
+	if len(kind) == 0 {
+		kind = dbLeveldb
+	}
+	backend, ok := ethdb.LookupBackend(kind)
+	if !ok {
+		if kind == dbPebble && !PebbleEnabled {
 			return nil, errors.New("db.engine 'pebble' not supported on this platform")
 		}
+		return nil, fmt.Errorf("unknown db.engine %v", kind)
 	}
-	if len(o.Type) != 0 && o.Type != dbLeveldb {
-		return nil, fmt.Errorf("unknown db.engine %v", o.Type)
+	log.Info(fmt.Sprintf("Using %s as the backing database", kind))
+	db, err := backend.Open(ethdb.BackendConfig{
+		Directory: o.Directory,
+		Cache:     o.Cache,
+		Handles:   o.Handles,
+		Namespace: o.Namespace,
+		ReadOnly:  o.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
 	}
-	log.Info("Using leveldb as the backing database")
-	// Use leveldb, either as default (no explicit choice), or pre-existing, or chosen explicitly
-	return NewLevelDBDatabase(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	return db, nil
 }
 
 // Open opens both a disk-based key-value database such as leveldb or pebble, but also
@@ -388,14 +415,28 @@ func openKeyValueDatabase(o OpenOptions) (ethdb.Database, error) {
 // The passed o.AncientDir indicates the path of root ancient directory where
 // the chain freezer can be opened.
 func Open(o OpenOptions) (ethdb.Database, error) {
+	tables := chainFreezerTableConfigs
+	switch o.AncientCompression {
+	case "", AncientCompressionSnappy:
+	case AncientCompressionZstd:
+		tables = zstdTableConfigs(chainFreezerTableConfigs)
+	default:
+		return nil, fmt.Errorf("unknown ancient compression %q, supported ones: %v", o.AncientCompression, []string{AncientCompressionSnappy, AncientCompressionZstd})
+	}
+	if o.AncientChecksums {
+		tables = checksumTableConfigs(tables)
+	}
 	kvdb, err := openKeyValueDatabase(o)
 	if err != nil {
 		return nil, err
 	}
+	if o.SizeTracking && !o.ReadOnly {
+		kvdb = newSizeTracker(kvdb, o.Namespace, o.SizeRescan)
+	}
 	if len(o.AncientsDirectory) == 0 {
-		return kvdb, nil
+		return NewDatabase(kvdb), nil
 	}
-	frdb, err := NewDatabaseWithFreezer(kvdb, o.AncientsDirectory, o.Namespace, o.ReadOnly)
+	frdb, err := newDatabaseWithFreezer(kvdb, o.AncientsDirectory, o.Namespace, o.ReadOnly, tables, o.AncientRemote)
 	if err != nil {
 		kvdb.Close()
 		return nil, err
@@ -433,6 +474,130 @@ func (s *stat) Count() string {
 	return s.count.String()
 }
 
+// dbCategory is a category of the data stored in the key-value store.
+type dbCategory int
+
+const (
+	headersCategory dbCategory = iota
+	bodiesCategory
+	receiptsCategory
+	tdsCategory
+	numHashPairingsCategory
+	hashNumPairingsCategory
+	txLookupsCategory
+	txSendersCategory
+	txTracesCategory
+	bloomBitsCategory
+	codesCategory
+	triesCategory
+	preimagesCategory
+	accountSnapsCategory
+	storageSnapsCategory
+	beaconHeadersCategory
+	cliqueSnapsCategory
+	metadataCategory
+	chtTrieNodesCategory
+	bloomTrieNodesCategory
+	unaccountedCategory
+
+	numDBCategories
+)
+
+// dbCategories contains the display and metric names of the data categories.
+var dbCategories = [numDBCategories]struct {
+	database string // Display name of the database holding the category
+	name     string // Display name of the category
+	metric   string // Name of the category in metrics
+}{
+	headersCategory:         {"Key-Value store", "Headers", "headers"},
+	bodiesCategory:          {"Key-Value store", "Bodies", "bodies"},
+	receiptsCategory:        {"Key-Value store", "Receipt lists", "receipts"},
+	tdsCategory:             {"Key-Value store", "Difficulties", "difficulties"},
+	numHashPairingsCategory: {"Key-Value store", "Block number->hash", "numberhash"},
+	hashNumPairingsCategory: {"Key-Value store", "Block hash->number", "hashnumber"},
+	txLookupsCategory:       {"Key-Value store", "Transaction index", "txlookup"},
+	txSendersCategory:       {"Key-Value store", "Transaction sender index", "txsenders"},
+	txTracesCategory:        {"Key-Value store", "Transaction traces", "txtraces"},
+	bloomBitsCategory:       {"Key-Value store", "Bloombit index", "bloombits"},
+	codesCategory:           {"Key-Value store", "Contract codes", "codes"},
+	triesCategory:           {"Key-Value store", "Trie nodes", "tries"},
+	preimagesCategory:       {"Key-Value store", "Trie preimages", "preimages"},
+	accountSnapsCategory:    {"Key-Value store", "Account snapshot", "snapshot/accounts"},
+	storageSnapsCategory:    {"Key-Value store", "Storage snapshot", "snapshot/storage"},
+	beaconHeadersCategory:   {"Key-Value store", "Beacon sync headers", "skeleton"},
+	cliqueSnapsCategory:     {"Key-Value store", "Clique snapshots", "clique"},
+	metadataCategory:        {"Key-Value store", "Singleton metadata", "metadata"},
+	chtTrieNodesCategory:    {"Light client", "CHT trie nodes", "cht"},
+	bloomTrieNodesCategory:  {"Light client", "Bloom trie nodes", "bloomtrie"},
+	unaccountedCategory:     {"Key-Value store", "Unaccounted", "unaccounted"},
+}
+
+// categorizeKey returns the data category of a key-value store entry.
+func categorizeKey(key []byte) dbCategory {
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
+		return headersCategory
+	case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
+		return bodiesCategory
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
+		return receiptsCategory
+	case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix):
+		return tdsCategory
+	case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix):
+		return numHashPairingsCategory
+	case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
+		return hashNumPairingsCategory
+	case len(key) == common.HashLength:
+		return triesCategory
+	case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
+		return codesCategory
+	case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
+		return txLookupsCategory
+	case bytes.HasPrefix(key, txSenderPrefix) && len(key) == (len(txSenderPrefix)+common.AddressLength+8+4):
+		return txSendersCategory
+	case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
+		return accountSnapsCategory
+	case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
+		return storageSnapsCategory
+	case bytes.HasPrefix(key, txTracePrefix) && len(key) > (len(txTracePrefix)+common.HashLength+4):
+		return txTracesCategory
+	case bytes.HasPrefix(key, PreimagePrefix) && len(key) == (len(PreimagePrefix)+common.HashLength):
+		return preimagesCategory
+	case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
+		return metadataCategory
+	case bytes.HasPrefix(key, genesisPrefix) && len(key) == (len(genesisPrefix)+common.HashLength):
+		return metadataCategory
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
+		return bloomBitsCategory
+	case bytes.HasPrefix(key, BloomBitsIndexPrefix):
+		return bloomBitsCategory
+	case bytes.HasPrefix(key, skeletonHeaderPrefix) && len(key) == (len(skeletonHeaderPrefix)+8):
+		return beaconHeadersCategory
+	case bytes.HasPrefix(key, CliqueSnapshotPrefix) && len(key) == 7+common.HashLength:
+		return cliqueSnapsCategory
+	case bytes.HasPrefix(key, ChtTablePrefix) ||
+		bytes.HasPrefix(key, ChtIndexTablePrefix) ||
+		bytes.HasPrefix(key, ChtPrefix): // Canonical hash trie
+		return chtTrieNodesCategory
+	case bytes.HasPrefix(key, BloomTrieTablePrefix) ||
+		bytes.HasPrefix(key, BloomTrieIndexPrefix) ||
+		bytes.HasPrefix(key, BloomTriePrefix): // Bloomtrie sub
+		return bloomTrieNodesCategory
+	}
+	for _, meta := range [][]byte{
+		databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, headFinalizedBlockKey,
+		lastPivotKey, fastTrieProgressKey, snapshotDisabledKey, SnapshotRootKey, snapshotJournalKey,
+		snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, txIndexConfigKey, txIndexStaleKey, txTraceTailKey, fastTxLookupLimitKey,
+		uncleanShutdownKey, badBlockKey, transitionStatusKey, skeletonSyncStatusKey, databaseSizesKey,
+		corruptedAncientsKey,
+	} {
+		if bytes.Equal(key, meta) {
+			return metadataCategory
+		}
+	}
+	return unaccountedCategory
+}
+
 // InspectDatabase traverses the entire database and checks the size
 // of all different categories of data.
 func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
@@ -444,30 +609,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		start  = time.Now()
 		logged = time.Now()
 
-		// Key-value store statistics
-		headers         stat
-		bodies          stat
-		receipts        stat
-		tds             stat
-		numHashPairings stat
-		hashNumPairings stat
-		tries           stat
-		codes           stat
-		txLookups       stat
-		accountSnaps    stat
-		storageSnaps    stat
-		preimages       stat
-		bloomBits       stat
-		beaconHeaders   stat
-		cliqueSnaps     stat
-
-		// Les statistic
-		chtTrieNodes   stat
-		bloomTrieNodes stat
-
-		// Meta- and unaccounted data
-		metadata    stat
-		unaccounted stat
+		// Key-value store statistics by category
+		categories [numDBCategories]stat
 
 		// Totals
 		total common.StorageSize
@@ -479,69 +622,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			size = common.StorageSize(len(key) + len(it.Value()))
 		)
 		total += size
-		switch {
-		case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
-			headers.Add(size)
-		case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
-			bodies.Add(size)
-		case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
-			receipts.Add(size)
-		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix):
-			tds.Add(size)
-		case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix):
-			numHashPairings.Add(size)
-		case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
-			hashNumPairings.Add(size)
-		case len(key) == common.HashLength:
-			tries.Add(size)
-		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
-			codes.Add(size)
-		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
-			txLookups.Add(size)
-		case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
-			accountSnaps.Add(size)
-		case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
-			storageSnaps.Add(size)
-		case bytes.HasPrefix(key, PreimagePrefix) && len(key) == (len(PreimagePrefix)+common.HashLength):
-			preimages.Add(size)
-		case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
-			metadata.Add(size)
-		case bytes.HasPrefix(key, genesisPrefix) && len(key) == (len(genesisPrefix)+common.HashLength):
-			metadata.Add(size)
-		case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
-			bloomBits.Add(size)
-		case bytes.HasPrefix(key, BloomBitsIndexPrefix):
-			bloomBits.Add(size)
-		case bytes.HasPrefix(key, skeletonHeaderPrefix) && len(key) == (len(skeletonHeaderPrefix)+8):
-			beaconHeaders.Add(size)
-		case bytes.HasPrefix(key, CliqueSnapshotPrefix) && len(key) == 7+common.HashLength:
-			cliqueSnaps.Add(size)
-		case bytes.HasPrefix(key, ChtTablePrefix) ||
-			bytes.HasPrefix(key, ChtIndexTablePrefix) ||
-			bytes.HasPrefix(key, ChtPrefix): // Canonical hash trie
-			chtTrieNodes.Add(size)
-		case bytes.HasPrefix(key, BloomTrieTablePrefix) ||
-			bytes.HasPrefix(key, BloomTrieIndexPrefix) ||
-			bytes.HasPrefix(key, BloomTriePrefix): // Bloomtrie sub
-			bloomTrieNodes.Add(size)
-		default:
-			var accounted bool
-			for _, meta := range [][]byte{
-				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, headFinalizedBlockKey,
-				lastPivotKey, fastTrieProgressKey, snapshotDisabledKey, SnapshotRootKey, snapshotJournalKey,
-				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey, transitionStatusKey, skeletonSyncStatusKey,
-			} {
-				if bytes.Equal(key, meta) {
-					metadata.Add(size)
-					accounted = true
-					break
-				}
-			}
-			if !accounted {
-				unaccounted.Add(size)
-			}
-		}
+		categories[categorizeKey(key)].Add(size)
+
 		count++
 		if count%1000 == 0 && time.Since(logged) > 8*time.Second {
 			log.Info("Inspecting database", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
@@ -549,25 +631,10 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		}
 	}
 	// Display the database statistic of key-value store.
-	stats := [][]string{
-		{"Key-Value store", "Headers", headers.Size(), headers.Count()},
-		{"Key-Value store", "Bodies", bodies.Size(), bodies.Count()},
-		{"Key-Value store", "Receipt lists", receipts.Size(), receipts.Count()},
-		{"Key-Value store", "Difficulties", tds.Size(), tds.Count()},
-		{"Key-Value store", "Block number->hash", numHashPairings.Size(), numHashPairings.Count()},
-		{"Key-Value store", "Block hash->number", hashNumPairings.Size(), hashNumPairings.Count()},
-		{"Key-Value store", "Transaction index", txLookups.Size(), txLookups.Count()},
-		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
-		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
-		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
-		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
-		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
-		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
-		{"Key-Value store", "Beacon sync headers", beaconHeaders.Size(), beaconHeaders.Count()},
-		{"Key-Value store", "Clique snapshots", cliqueSnaps.Size(), cliqueSnaps.Count()},
-		{"Key-Value store", "Singleton metadata", metadata.Size(), metadata.Count()},
-		{"Light client", "CHT trie nodes", chtTrieNodes.Size(), chtTrieNodes.Count()},
-		{"Light client", "Bloom trie nodes", bloomTrieNodes.Size(), bloomTrieNodes.Count()},
+	var stats [][]string
+	for category := dbCategory(0); category < unaccountedCategory; category++ {
+		info := dbCategories[category]
+		stats = append(stats, []string{info.database, info.name, categories[category].Size(), categories[category].Count()})
 	}
 	// Inspect all registered append-only file store then.
 	ancients, err := inspectFreezers(db)
@@ -591,7 +658,26 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 	table.AppendBulk(stats)
 	table.Render()
 
-	if unaccounted.size > 0 {
+	// Display the compression achieved on the recent items of the ancient tables.
+	var compressions [][]string
+	for _, ancient := range ancients {
+		for _, info := range ancient.compressions {
+			compressions = append(compressions, []string{
+				fmt.Sprintf("Ancient store (%s)", strings.Title(ancient.name)),
+				strings.Title(info.name),
+				info.mode,
+				fmt.Sprintf("%.2fx", info.ratio),
+			})
+		}
+	}
+	if len(compressions) > 0 {
+		table = tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Database", "Category", "Compression", "Ratio"})
+		table.AppendBulk(compressions)
+		table.Render()
+	}
+
+	if unaccounted := categories[unaccountedCategory]; unaccounted.size > 0 {
 		log.Error("Database contains unaccounted data", "size", unaccounted.size, "count", unaccounted.count)
 	}
 	return nil
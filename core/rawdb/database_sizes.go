@@ -0,0 +1,521 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// sizeTrackerMeterInterval is the frequency of updating the size gauges.
+	sizeTrackerMeterInterval = 10 * time.Second
+
+	// sizeTrackerPersistInterval is the frequency of persisting the counters,
+	// limiting the drift after a crash until they are seeded again.
+	sizeTrackerPersistInterval = 5 * time.Minute
+)
+
+// overwrittenCategories are the data categories whose entries are routinely
+// overwritten or deleted in place. The previous values of their entries are
+// looked up when writing, so that the counters don't drift.
+var overwrittenCategories = [numDBCategories]bool{
+	accountSnapsCategory: true,
+	storageSnapsCategory: true,
+	metadataCategory:     true,
+}
+
+var errSizeTrackingDisabled = errors.New("database size tracking not enabled")
+
+// DatabaseSize is the number of entries and their total size in bytes within a
+// category of the database.
+type DatabaseSize struct {
+	Database string `json:"database"`
+	Category string `json:"category"`
+	Items    uint64 `json:"items"`
+	Size     uint64 `json:"size"`
+}
+
+// DatabaseSizes is the breakdown of the database size by data category, the
+// same as reported by InspectDatabase, but maintained while the node runs.
+type DatabaseSizes struct {
+	// Seeded is set if the key-value store counters were seeded by a full walk
+	// of the database. Otherwise, a walk is in progress and the counters only
+	// cover the changes since the last (possibly unclean) shutdown. Either way,
+	// the changes since the last walk are approximated from the written data.
+	Seeded     bool           `json:"seeded"`
+	Categories []DatabaseSize `json:"categories"`
+}
+
+// SizeReporter is implemented by the databases maintaining live size counters.
+type SizeReporter interface {
+	// DatabaseSizes returns the current size counters of the database.
+	DatabaseSizes() (*DatabaseSizes, error)
+}
+
+// ReadDatabaseSizes returns the live size counters of a database, if size
+// tracking was enabled when opening it.
+func ReadDatabaseSizes(db ethdb.KeyValueStore) (*DatabaseSizes, error) {
+	r, ok := db.(SizeReporter)
+	if !ok {
+		return nil, errSizeTrackingDisabled
+	}
+	return r.DatabaseSizes()
+}
+
+// DatabaseSizes implements SizeReporter, forwarding to the key-value store.
+func (db *nofreezedb) DatabaseSizes() (*DatabaseSizes, error) {
+	return ReadDatabaseSizes(db.KeyValueStore)
+}
+
+// DatabaseSizes implements SizeReporter, extending the key-value store counters
+// with the sizes of the ancient tables.
+func (frdb *freezerdb) DatabaseSizes() (*DatabaseSizes, error) {
+	sizes, err := ReadDatabaseSizes(frdb.KeyValueStore)
+	if err != nil {
+		return nil, err
+	}
+	ancients, err := frdb.Ancients()
+	if err != nil {
+		return nil, err
+	}
+	tail, err := frdb.Tail()
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0, len(chainFreezerTableConfigs))
+	for table := range chainFreezerTableConfigs {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		size, err := frdb.AncientSize(table)
+		if err != nil {
+			return nil, err
+		}
+		items := ancients
+		if chainFreezerTableConfigs[table].prunable {
+			items -= tail
+		}
+		sizes.Categories = append(sizes.Categories, DatabaseSize{
+			Database: "Ancient store (" + strings.Title(chainFreezerName) + ")",
+			Category: strings.Title(table),
+			Items:    items,
+			Size:     size,
+		})
+	}
+	return sizes, nil
+}
+
+// categorySize is the number of entries and their total size within a data
+// category. The values may be negative while accumulating changes.
+type categorySize struct {
+	Items int64
+	Size  int64
+}
+
+// storedSizesLength is the length of the persisted counters: a flag byte
+// followed by the item count and the size of every category.
+const storedSizesLength = 1 + 16*int(numDBCategories)
+
+const (
+	storedSizesClean  = 1 << iota // Whether the counters were persisted on a clean shutdown
+	storedSizesSeeded             // Whether the counters were seeded by a full database walk
+)
+
+// sizeTracker is a key-value store wrapper maintaining the number and the total
+// size of the entries in each data category, so that the breakdown produced by
+// InspectDatabase is available without iterating the database.
+//
+// Writes to the categories known to be overwritten look up the previous values
+// of the entries. All others are accounted for by the written bytes alone:
+// every put counts as a new entry and every deletion removes an entry of the
+// key's size. Their rare overwrites and deletions thus make the counters drift,
+// which can be corrected by periodically walking the database again.
+type sizeTracker struct {
+	ethdb.KeyValueStore
+	rescan time.Duration // Interval of walking the database again, 0 if never
+
+	base   [numDBCategories]categorySize // Counters at the last seeding or load
+	delta  [numDBCategories]categorySize // Changes applied since
+	seeded bool                          // Whether the base was seeded by a full walk
+	lock   sync.Mutex                    // Lock protecting the counters
+
+	// seedLock is held for reading while applying writes, and for writing while
+	// starting a database walk, so that every write is either visible to the
+	// walk or accounted for in the deltas.
+	seedLock sync.RWMutex
+
+	itemGauges [numDBCategories]metrics.Gauge
+	sizeGauges [numDBCategories]metrics.Gauge
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newSizeTracker wraps a key-value store with live size accounting. The
+// persisted counters are loaded, and if they are missing or weren't persisted
+// on a clean shutdown, the database is walked in the background to seed them.
+// If rescan is non-zero, the database is walked again at that interval.
+func newSizeTracker(db ethdb.KeyValueStore, namespace string, rescan time.Duration) *sizeTracker {
+	t := &sizeTracker{
+		KeyValueStore: db,
+		rescan:        rescan,
+		quit:          make(chan struct{}),
+	}
+	for category := range dbCategories {
+		prefix := namespace + "category/" + dbCategories[category].metric
+		t.itemGauges[category] = metrics.NewRegisteredGauge(prefix+"/items", nil)
+		t.sizeGauges[category] = metrics.NewRegisteredGauge(prefix+"/size", nil)
+	}
+	// Load the persisted counters, ignoring them if the categories changed
+	seed := true
+	if blob, err := db.Get(databaseSizesKey); err == nil && len(blob) == storedSizesLength {
+		for category := range t.base {
+			t.base[category] = categorySize{
+				Items: int64(binary.BigEndian.Uint64(blob[1+16*category:])),
+				Size:  int64(binary.BigEndian.Uint64(blob[9+16*category:])),
+			}
+		}
+		t.seeded = blob[0]&storedSizesClean != 0 && blob[0]&storedSizesSeeded != 0
+		seed = !t.seeded
+	}
+	// Mark the counters unclean until the tracker is closed
+	t.persist(false)
+
+	t.wg.Add(1)
+	go t.loop(seed)
+	return t
+}
+
+// loop seeds the counters if needed, and periodically updates the gauges,
+// persists the counters and, if enabled, walks the database again to correct
+// their drift until the tracker is closed.
+func (t *sizeTracker) loop(seed bool) {
+	defer t.wg.Done()
+
+	if seed {
+		t.seed()
+	}
+	meter := time.NewTicker(sizeTrackerMeterInterval)
+	defer meter.Stop()
+	persist := time.NewTicker(sizeTrackerPersistInterval)
+	defer persist.Stop()
+	var rescan <-chan time.Time
+	if t.rescan > 0 {
+		ticker := time.NewTicker(t.rescan)
+		defer ticker.Stop()
+		rescan = ticker.C
+	}
+	for {
+		t.meter()
+		select {
+		case <-meter.C:
+		case <-persist.C:
+			t.persist(false)
+		case <-rescan:
+			t.seed()
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+// seed walks the entire database, replacing the base counters with the result.
+// The changes made during the walk are accumulated in the deltas.
+func (t *sizeTracker) seed() {
+	start := time.Now()
+	log.Info("Seeding database size counters")
+
+	t.seedLock.Lock()
+	it := t.KeyValueStore.NewIterator(nil, nil)
+	t.lock.Lock()
+	t.delta = [numDBCategories]categorySize{}
+	t.lock.Unlock()
+	t.seedLock.Unlock()
+
+	defer it.Release()
+
+	var (
+		base   [numDBCategories]categorySize
+		count  int
+		logged = time.Now()
+	)
+	for it.Next() {
+		size := &base[categorizeKey(it.Key())]
+		size.Items++
+		size.Size += int64(len(it.Key()) + len(it.Value()))
+
+		if count++; count%10000 == 0 {
+			select {
+			case <-t.quit:
+				log.Info("Database size counter seeding aborted")
+				return
+			default:
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Seeding database size counters", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		log.Error("Failed to seed database size counters", "err", err)
+		return
+	}
+	t.lock.Lock()
+	t.base, t.seeded = base, true
+	t.lock.Unlock()
+
+	log.Info("Seeded database size counters", "count", count, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// counters returns the current counters of all categories.
+func (t *sizeTracker) counters() ([numDBCategories]categorySize, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var sizes [numDBCategories]categorySize
+	for category := range sizes {
+		sizes[category] = categorySize{
+			Items: t.base[category].Items + t.delta[category].Items,
+			Size:  t.base[category].Size + t.delta[category].Size,
+		}
+		// Deletions and concurrent writes during seeding may push the counters
+		// below zero
+		if sizes[category].Items < 0 {
+			sizes[category].Items = 0
+		}
+		if sizes[category].Size < 0 {
+			sizes[category].Size = 0
+		}
+	}
+	return sizes, t.seeded
+}
+
+// meter updates the size gauges.
+func (t *sizeTracker) meter() {
+	sizes, _ := t.counters()
+	for category, size := range sizes {
+		t.itemGauges[category].Update(size.Items)
+		t.sizeGauges[category].Update(size.Size)
+	}
+}
+
+// persist stores the current counters in the database. The stored counters
+// themselves are not accounted for, as they are overwritten in place.
+func (t *sizeTracker) persist(clean bool) {
+	sizes, seeded := t.counters()
+	blob := make([]byte, storedSizesLength)
+	if clean {
+		blob[0] |= storedSizesClean
+	}
+	if seeded {
+		blob[0] |= storedSizesSeeded
+	}
+	for category, size := range sizes {
+		binary.BigEndian.PutUint64(blob[1+16*category:], uint64(size.Items))
+		binary.BigEndian.PutUint64(blob[9+16*category:], uint64(size.Size))
+	}
+	if err := t.KeyValueStore.Put(databaseSizesKey, blob); err != nil {
+		log.Warn("Failed to store database size counters", "err", err)
+	}
+}
+
+// apply adds the accumulated changes of a write operation to the counters.
+func (t *sizeTracker) apply(d *sizeDelta) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for category, change := range d.changes {
+		t.delta[category].Items += change.Items
+		t.delta[category].Size += change.Size
+	}
+}
+
+// DatabaseSizes implements SizeReporter.
+func (t *sizeTracker) DatabaseSizes() (*DatabaseSizes, error) {
+	counters, seeded := t.counters()
+
+	sizes := &DatabaseSizes{Seeded: seeded}
+	for category, size := range counters {
+		sizes.Categories = append(sizes.Categories, DatabaseSize{
+			Database: dbCategories[category].database,
+			Category: dbCategories[category].name,
+			Items:    uint64(size.Items),
+			Size:     uint64(size.Size),
+		})
+	}
+	return sizes, nil
+}
+
+// Put inserts the given value into the key-value store.
+func (t *sizeTracker) Put(key []byte, value []byte) error {
+	t.seedLock.RLock()
+	defer t.seedLock.RUnlock()
+
+	d := newSizeDelta(t.KeyValueStore)
+	d.Put(key, value)
+	if err := t.KeyValueStore.Put(key, value); err != nil {
+		return err
+	}
+	t.apply(d)
+	return nil
+}
+
+// Delete removes the key from the key-value store.
+func (t *sizeTracker) Delete(key []byte) error {
+	t.seedLock.RLock()
+	defer t.seedLock.RUnlock()
+
+	d := newSizeDelta(t.KeyValueStore)
+	d.Delete(key)
+	if err := t.KeyValueStore.Delete(key); err != nil {
+		return err
+	}
+	t.apply(d)
+	return nil
+}
+
+// NewBatch creates a write-only batch, accounting for its changes when written.
+func (t *sizeTracker) NewBatch() ethdb.Batch {
+	return &sizeTrackingBatch{Batch: t.KeyValueStore.NewBatch(), tracker: t}
+}
+
+// NewBatchWithSize creates a write-only batch with pre-allocated buffer,
+// accounting for its changes when written.
+func (t *sizeTracker) NewBatchWithSize(size int) ethdb.Batch {
+	return &sizeTrackingBatch{Batch: t.KeyValueStore.NewBatchWithSize(size), tracker: t}
+}
+
+// Checkpoint implements ethdb.Checkpointer, forwarding to the key-value store.
+func (t *sizeTracker) Checkpoint(dir string) error {
+	cp, ok := t.KeyValueStore.(ethdb.Checkpointer)
+	if !ok {
+		return errNotSupported
+	}
+	return cp.Checkpoint(dir)
+}
+
+// Close persists the counters and closes the key-value store.
+func (t *sizeTracker) Close() error {
+	select {
+	case <-t.quit:
+		return t.KeyValueStore.Close()
+	default:
+		close(t.quit)
+	}
+	t.wg.Wait()
+
+	t.persist(true)
+	return t.KeyValueStore.Close()
+}
+
+// sizeTrackingBatch is a batch accounting for its changes in the size tracker
+// when written.
+type sizeTrackingBatch struct {
+	ethdb.Batch
+	tracker *sizeTracker
+}
+
+// Write flushes any accumulated data to disk.
+func (b *sizeTrackingBatch) Write() error {
+	b.tracker.seedLock.RLock()
+	defer b.tracker.seedLock.RUnlock()
+
+	d := newSizeDelta(b.tracker.KeyValueStore)
+	if err := b.Batch.Replay(d); err != nil {
+		return err
+	}
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	b.tracker.apply(d)
+	return nil
+}
+
+// sizeDelta is a key-value writer accumulating the size changes caused by a
+// sequence of write operations, without applying them. The changes are exact
+// for the overwritten categories, and approximate for all others.
+type sizeDelta struct {
+	db      ethdb.KeyValueReader // Store holding the previous values of the entries
+	changes [numDBCategories]categorySize
+	written map[string]int // Value sizes of the looked up entries written so far, -1 if deleted
+}
+
+func newSizeDelta(db ethdb.KeyValueReader) *sizeDelta {
+	return &sizeDelta{db: db, written: make(map[string]int)}
+}
+
+// previous returns the value size of an entry prior to the write, and whether
+// it exists. Writes earlier in the sequence take precedence over the store.
+func (d *sizeDelta) previous(key []byte) (int, bool) {
+	if size, ok := d.written[string(key)]; ok {
+		return size, size >= 0
+	}
+	value, err := d.db.Get(key)
+	if err != nil {
+		return 0, false
+	}
+	return len(value), true
+}
+
+// Put accounts for inserting the given value. It's counted as a new entry
+// unless the key is in an overwritten category and already exists.
+func (d *sizeDelta) Put(key []byte, value []byte) error {
+	category := categorizeKey(key)
+	change := &d.changes[category]
+	if overwrittenCategories[category] {
+		if size, ok := d.previous(key); ok {
+			change.Size += int64(len(value) - size)
+			d.written[string(key)] = len(value)
+			return nil
+		}
+		d.written[string(key)] = len(value)
+	}
+	change.Items++
+	change.Size += int64(len(key) + len(value))
+	return nil
+}
+
+// Delete accounts for removing an entry. If the key is not in an overwritten
+// category, the entry is assumed to exist and only its key size is known.
+func (d *sizeDelta) Delete(key []byte) error {
+	category := categorizeKey(key)
+	change := &d.changes[category]
+	if overwrittenCategories[category] {
+		size, ok := d.previous(key)
+		d.written[string(key)] = -1
+		if ok {
+			change.Items--
+			change.Size -= int64(len(key) + size)
+		}
+		return nil
+	}
+	change.Items--
+	change.Size -= int64(len(key))
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// walkSizes iterates the entire database and computes the size counters.
+func walkSizes(db ethdb.KeyValueStore) [numDBCategories]categorySize {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+
+	var sizes [numDBCategories]categorySize
+	for it.Next() {
+		sizes[categorizeKey(it.Key())].Items++
+		sizes[categorizeKey(it.Key())].Size += int64(len(it.Key()) + len(it.Value()))
+	}
+	return sizes
+}
+
+// waitSeeded waits until the size tracker finishes seeding its counters.
+func waitSeeded(t *testing.T, tracker *sizeTracker) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, seeded := tracker.counters(); seeded {
+			return
+		}
+	}
+	t.Fatal("size counters not seeded")
+}
+
+// checkSizes compares the counters of the size tracker with a database walk.
+func checkSizes(t *testing.T, tracker *sizeTracker) {
+	t.Helper()
+	have, _ := tracker.counters()
+	if want := walkSizes(tracker.KeyValueStore); have != want {
+		t.Fatalf("size counter mismatch:\nhave %v\nwant %v", have, want)
+	}
+}
+
+// Tests that the size tracker seeds its counters from the existing content,
+// keeps them up to date through insertions, and corrects the drift caused by
+// overwrites and deletions when walking the database again.
+func TestSizeTracker(t *testing.T) {
+	db, err := NewLevelDBDatabase(t.TempDir(), 0, 0, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Fill the database with some pre-existing data
+	for i := byte(0); i < 10; i++ {
+		WriteCode(db, common.Hash{i}, []byte{1, 2, 3, i})
+		WriteHeaderNumber(db, common.Hash{i}, uint64(i))
+	}
+	tracker := newSizeTracker(db, "", 0)
+	waitSeeded(t, tracker)
+	checkSizes(t, tracker)
+
+	// Insert new entries, both directly and through a batch
+	WriteCode(tracker, common.Hash{10}, []byte{10})
+	batch := tracker.NewBatch()
+	WriteCode(batch, common.Hash{11}, []byte{11, 11, 11})
+	WriteTxLookupEntries(batch, 1, []common.Hash{{1}, {2}})
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	checkSizes(t, tracker)
+
+	// Overwrite and delete entries, the counters are only approximate
+	WriteCode(tracker, common.Hash{0}, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	DeleteHeaderNumber(tracker, common.Hash{1})
+	DeleteHeaderNumber(tracker, common.Hash{100})
+
+	batch = tracker.NewBatch()
+	WriteCode(batch, common.Hash{11}, []byte{11})
+	DeleteCode(batch, common.Hash{2})
+	DeleteHeaderNumber(batch, common.Hash{3})
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if have, _ := tracker.counters(); have == walkSizes(tracker.KeyValueStore) {
+		t.Fatal("approximate size counters unexpectedly exact")
+	}
+	// Walk the database again, correcting the drift
+	tracker.seed()
+	checkSizes(t, tracker)
+
+	sizes, err := ReadDatabaseSizes(NewDatabase(tracker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sizes.Seeded {
+		t.Fatal("size counters not seeded")
+	}
+	for _, size := range sizes.Categories {
+		if size.Category == dbCategories[codesCategory].name && size.Items != 11 {
+			t.Fatalf("code count mismatch: have %d, want %d", size.Items, 11)
+		}
+	}
+	if _, err := ReadDatabaseSizes(db); err != errSizeTrackingDisabled {
+		t.Fatalf("untracked database error mismatch: have %v, want %v", err, errSizeTrackingDisabled)
+	}
+}
+
+// Tests that overwrites and deletions of the entries in the categories known to
+// be overwritten keep the counters exact, also within a single batch.
+func TestSizeTrackerOverwrites(t *testing.T) {
+	db, err := NewLevelDBDatabase(t.TempDir(), 0, 0, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newSizeTracker(db, "", 0)
+	defer tracker.Close()
+	waitSeeded(t, tracker)
+
+	for i := byte(0); i < 10; i++ {
+		WriteAccountSnapshot(tracker, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(tracker, common.Hash{i}, common.Hash{i}, []byte{i})
+	}
+	WriteSnapshotRoot(tracker, common.Hash{1})
+	checkSizes(t, tracker)
+
+	// Overwrite and delete entries directly
+	WriteAccountSnapshot(tracker, common.Hash{0}, []byte{1, 2, 3, 4})
+	WriteSnapshotRoot(tracker, common.Hash{2})
+	DeleteStorageSnapshot(tracker, common.Hash{1}, common.Hash{1})
+	DeleteStorageSnapshot(tracker, common.Hash{100}, common.Hash{100})
+	checkSizes(t, tracker)
+
+	// Overwrite, delete and recreate entries repeatedly within a batch
+	batch := tracker.NewBatch()
+	WriteAccountSnapshot(batch, common.Hash{2}, []byte{1, 2})
+	WriteAccountSnapshot(batch, common.Hash{2}, []byte{1, 2, 3, 4, 5, 6})
+	DeleteAccountSnapshot(batch, common.Hash{3})
+	WriteAccountSnapshot(batch, common.Hash{3}, []byte{3, 3})
+	WriteAccountSnapshot(batch, common.Hash{10}, []byte{10})
+	DeleteAccountSnapshot(batch, common.Hash{10})
+	DeleteAccountSnapshot(batch, common.Hash{10})
+	DeleteSnapshotRoot(batch)
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	checkSizes(t, tracker)
+}
+
+// Tests that the size counters are persisted on shutdown, and loaded again
+// without walking the database.
+func TestSizeTrackerPersistence(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewLevelDBDatabase(dir, 0, 0, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := newSizeTracker(db, "", 0)
+	waitSeeded(t, tracker)
+	for i := byte(0); i < 10; i++ {
+		WriteCode(tracker, common.Hash{i}, []byte{i})
+	}
+	want, _ := tracker.counters()
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Reopen the database, counters must be loaded without seeding
+	db, err = NewLevelDBDatabase(dir, 0, 0, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker = newSizeTracker(db, "", 0)
+	defer tracker.Close()
+
+	have, seeded := tracker.counters()
+	if !seeded {
+		t.Fatal("loaded size counters not seeded")
+	}
+	if have[codesCategory] != want[codesCategory] {
+		t.Fatalf("loaded code counters mismatch: have %v, want %v", have[codesCategory], want[codesCategory])
+	}
+	checkSizes(t, tracker)
+
+	// The stored counters must be marked unclean while the database is open
+	blob, err := db.Get(databaseSizesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob[0]&storedSizesClean != 0 {
+		t.Fatal("stored size counters clean while open")
+	}
+}
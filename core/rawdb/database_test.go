@@ -15,3 +15,52 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	_ "github.com/ethereum/go-ethereum/ethdb/boltdb" // Register the boltdb backend
+)
+
+// Tests that the backend of a pre-existing database is detected when reopening
+// it, and that conflicting engine choices are rejected.
+func TestOpenDetectsBackend(t *testing.T) {
+	for _, kind := range ethdb.Backends() {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(OpenOptions{Type: kind, Directory: dir})
+			if err != nil {
+				t.Fatalf("failed to create database: %v", err)
+			}
+			WriteCanonicalHash(db, common.Hash{1}, 1)
+			db.Close()
+
+			if have := ethdb.DetectBackend(dir); have != kind {
+				t.Fatalf("detected backend mismatch: have %q, want %q", have, kind)
+			}
+			db, err = Open(OpenOptions{Directory: dir})
+			if err != nil {
+				t.Fatalf("failed to reopen database: %v", err)
+			}
+			if hash := ReadCanonicalHash(db, 1); hash != (common.Hash{1}) {
+				t.Fatalf("canonical hash mismatch: have %x, want %x", hash, common.Hash{1})
+			}
+			db.Close()
+
+			for _, other := range ethdb.Backends() {
+				if other == kind {
+					continue
+				}
+				if db, err := Open(OpenOptions{Type: other, Directory: dir}); err == nil {
+					db.Close()
+					t.Fatalf("opened %s database as %s", kind, other)
+				}
+			}
+		})
+	}
+	if _, err := Open(OpenOptions{Type: "nonexistent", Directory: t.TempDir()}); err == nil {
+		t.Fatal("opened database with unknown engine")
+	}
+}
@@ -66,31 +66,40 @@ type Freezer struct {
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	frozen uint64 // Number of blocks already frozen
-	tail   uint64 // Number of the first stored item in the freezer
+	tail   uint64 // Number of the first stored item in the prunable tables
 
 	// This lock synchronizes writers and the truncate operation, as well as
 	// the "atomic" (batched) read operations.
-	writeLock  sync.RWMutex
-	writeBatch *freezerBatch
+	writeLock   sync.RWMutex
+	writeBatch  *freezerBatch
+	truncations uint64 // Number of head truncations, protected by writeLock
 
 	readonly     bool
-	tables       map[string]*freezerTable // Data tables for storing everything
-	instanceLock *flock.Flock             // File-system lock to prevent double opens
+	tables       map[string]*freezerTable      // Data tables for storing everything
+	configs      map[string]freezerTableConfig // Settings of the tables, e.g. tail truncations
+	instanceLock *flock.Flock                  // File-system lock to prevent double opens
 	closeOnce    sync.Once
 }
 
 // NewChainFreezer is a small utility method around NewFreezer that sets the
 // default parameters for the chain storage.
 func NewChainFreezer(datadir string, namespace string, readonly bool) (*Freezer, error) {
-	return NewFreezer(datadir, namespace, readonly, freezerTableSize, chainFreezerNoSnappy)
+	return NewFreezer(datadir, namespace, readonly, freezerTableSize, chainFreezerTableConfigs)
 }
 
 // NewFreezer creates a freezer instance for maintaining immutable ordered
 // data according to the given parameters.
 //
-// The 'tables' argument defines the data tables. If the value of a map
-// entry is true, snappy compression is disabled for the table.
-func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]bool) (*Freezer, error) {
+// The 'tables' argument defines the data tables along with their settings:
+// whether snappy compression is disabled, whether zstd compression is used
+// instead, and whether the table is pruned by tail truncations.
+func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]freezerTableConfig) (*Freezer, error) {
+	return NewRemoteFreezer(datadir, namespace, readonly, maxTableSize, tables, nil)
+}
+
+// NewRemoteFreezer creates a freezer instance like NewFreezer, but keeps the
+// sealed data files of its tables in a remote store if one is configured.
+func NewRemoteFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]freezerTableConfig, remote *FreezerRemote) (*Freezer, error) {
 	// Create the initial freezer object
 	var (
 		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
@@ -120,12 +129,13 @@ func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize ui
 	freezer := &Freezer{
 		readonly:     readonly,
 		tables:       make(map[string]*freezerTable),
+		configs:      tables,
 		instanceLock: lock,
 	}
 
 	// Create the tables.
-	for name, disableSnappy := range tables {
-		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, maxTableSize, disableSnappy, readonly)
+	for name, config := range tables {
+		table, err := newRemoteTable(datadir, name, readMeter, writeMeter, sizeGauge, maxTableSize, config, readonly, remote)
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
@@ -155,7 +165,11 @@ func NewFreezer(datadir string, namespace string, readonly bool, maxTableSize ui
 	// Create the write batch.
 	freezer.writeBatch = newFreezerBatch(freezer)
 
-	log.Info("Opened ancient database", "database", datadir, "readonly", readonly)
+	if remote != nil {
+		log.Info("Opened ancient database", "database", datadir, "readonly", readonly, "remote", true, "cache", remote.Cache)
+	} else {
+		log.Info("Opened ancient database", "database", datadir, "readonly", readonly)
+	}
 	return freezer, nil
 }
 
@@ -215,7 +229,8 @@ func (f *Freezer) Ancients() (uint64, error) {
 	return atomic.LoadUint64(&f.frozen), nil
 }
 
-// Tail returns the number of first stored item in the freezer.
+// Tail returns the number of first stored item in the prunable tables of the
+// freezer. The items of the other tables are always retained from zero.
 func (f *Freezer) Tail() (uint64, error) {
 	return atomic.LoadUint64(&f.tail), nil
 }
@@ -273,6 +288,12 @@ func (f *Freezer) ModifyAncients(fn func(ethdb.AncientWriteOp) error) (writeSize
 		return 0, err
 	}
 	atomic.StoreUint64(&f.frozen, item)
+
+	// Train the dictionaries of the tables configured for zstd compression
+	// once they contain enough items, switching over once trained.
+	for _, table := range f.tables {
+		table.maybeTrainDict()
+	}
 	return writeSize, nil
 }
 
@@ -287,6 +308,7 @@ func (f *Freezer) TruncateHead(items uint64) error {
 	if atomic.LoadUint64(&f.frozen) <= items {
 		return nil
 	}
+	f.truncations++
 	for _, table := range f.tables {
 		if err := table.truncateHead(items); err != nil {
 			return err
@@ -296,7 +318,8 @@ func (f *Freezer) TruncateHead(items uint64) error {
 	return nil
 }
 
-// TruncateTail discards any recent data below the provided threshold number.
+// TruncateTail discards any recent data below the provided threshold number
+// from the prunable tables.
 func (f *Freezer) TruncateTail(tail uint64) error {
 	if f.readonly {
 		return errReadOnly
@@ -307,7 +330,10 @@ func (f *Freezer) TruncateTail(tail uint64) error {
 	if atomic.LoadUint64(&f.tail) >= tail {
 		return nil
 	}
-	for _, table := range f.tables {
+	for kind, table := range f.tables {
+		if !f.configs[kind].prunable {
+			continue
+		}
 		if err := table.truncateTail(tail); err != nil {
 			return err
 		}
@@ -330,31 +356,45 @@ func (f *Freezer) Sync() error {
 	return nil
 }
 
-// validate checks that every table has the same boundary.
+// validate checks that every table has the same head boundary, and that the
+// prunable tables have the same tail boundary while the others have none.
 // Used instead of `repair` in readonly mode.
 func (f *Freezer) validate() error {
 	if len(f.tables) == 0 {
 		return nil
 	}
 	var (
-		head uint64
-		tail uint64
-		name string
+		head     uint64
+		tail     uint64
+		name     string
+		tailName string
 	)
 	// Hack to get boundary of any table
 	for kind, table := range f.tables {
 		head = atomic.LoadUint64(&table.items)
-		tail = atomic.LoadUint64(&table.itemHidden)
 		name = kind
 		break
 	}
+	for kind, table := range f.tables {
+		if f.configs[kind].prunable {
+			tail = atomic.LoadUint64(&table.itemHidden)
+			tailName = kind
+			break
+		}
+	}
 	// Now check every table against those boundaries.
 	for kind, table := range f.tables {
 		if head != atomic.LoadUint64(&table.items) {
 			return fmt.Errorf("freezer tables %s and %s have differing head: %d != %d", kind, name, atomic.LoadUint64(&table.items), head)
 		}
+		if !f.configs[kind].prunable {
+			if hidden := atomic.LoadUint64(&table.itemHidden); hidden != 0 {
+				return fmt.Errorf("non-prunable freezer table %s has tail: %d", kind, hidden)
+			}
+			continue
+		}
 		if tail != atomic.LoadUint64(&table.itemHidden) {
-			return fmt.Errorf("freezer tables %s and %s have differing tail: %d != %d", kind, name, atomic.LoadUint64(&table.itemHidden), tail)
+			return fmt.Errorf("freezer tables %s and %s have differing tail: %d != %d", kind, tailName, atomic.LoadUint64(&table.itemHidden), tail)
 		}
 	}
 	atomic.StoreUint64(&f.frozen, head)
@@ -362,26 +402,36 @@ func (f *Freezer) validate() error {
 	return nil
 }
 
-// repair truncates all data tables to the same length.
+// repair truncates all data tables to the same length, and the prunable
+// tables to the same tail.
 func (f *Freezer) repair() error {
 	var (
 		head = uint64(math.MaxUint64)
 		tail = uint64(0)
 	)
-	for _, table := range f.tables {
+	for kind, table := range f.tables {
 		items := atomic.LoadUint64(&table.items)
 		if head > items {
 			head = items
 		}
 		hidden := atomic.LoadUint64(&table.itemHidden)
+		if !f.configs[kind].prunable {
+			if hidden != 0 {
+				return fmt.Errorf("non-prunable freezer table %s has tail: %d", kind, hidden)
+			}
+			continue
+		}
 		if hidden > tail {
 			tail = hidden
 		}
 	}
-	for _, table := range f.tables {
+	for kind, table := range f.tables {
 		if err := table.truncateHead(head); err != nil {
 			return err
 		}
+		if !f.configs[kind].prunable {
+			continue
+		}
 		if err := table.truncateTail(tail); err != nil {
 			return err
 		}
@@ -391,6 +441,24 @@ func (f *Freezer) repair() error {
 	return nil
 }
 
+// RepairAncient overwrites a corrupted item of the given kind with its original
+// content. If the content compresses to the stored size of the item, it's
+// written in place and must match the stored checksum if the table has them,
+// otherwise the rest of the item's data file is rewritten.
+func (f *Freezer) RepairAncient(kind string, number uint64, item []byte) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	table, ok := f.tables[kind]
+	if !ok {
+		return errUnknownTable
+	}
+	return table.repairItem(number, item)
+}
+
 // convertLegacyFn takes a raw freezer entry in an older format and
 // returns it in the new format.
 type convertLegacyFn = func([]byte) ([]byte, error)
@@ -443,10 +511,29 @@ func (f *Freezer) MigrateTable(kind string, convert convertLegacyFn) error {
 	// Set up new dir for the migrated table, the content of which
 	// we'll at the end move over to the ancients dir.
 	migrationPath := filepath.Join(ancientsPath, "migration")
-	newTable, err := newFreezerTable(migrationPath, kind, table.noCompression, false)
+	// The migrated table is created in the configured format, i.e. with the
+	// checksums of the items if they're enabled.
+	config := f.configs[kind]
+	newTable, err := newRemoteTable(migrationPath, kind, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, freezerTableSize, config, false, nil)
 	if err != nil {
 		return err
 	}
+	// Tables configured for zstd compression are migrated to it, with a
+	// dictionary trained on the legacy items. Items left by a previous attempt
+	// keep their compression.
+	if table.zstd && !table.noCompression && newTable.codec == nil {
+		samples, err := table.dictSamples()
+		if err != nil {
+			return err
+		}
+		dict, err := trainZstdDict(samples)
+		if err != nil {
+			return err
+		}
+		if err := newTable.setDict(dict, atomic.LoadUint64(&newTable.items)); err != nil {
+			return err
+		}
+	}
 	var (
 		batch  = newTable.newBatch()
 		out    []byte
@@ -478,6 +565,13 @@ func (f *Freezer) MigrateTable(kind string, convert convertLegacyFn) error {
 		return err
 	}
 	log.Info("Replacing old table files with migrated ones", "elapsed", common.PrettyDuration(time.Since(start)))
+	oldSize, err := table.size()
+	if err != nil {
+		return err
+	}
+	if err := table.Close(); err != nil {
+		return err
+	}
 	// Release and delete old table files. Note this won't
 	// delete the index file.
 	table.releaseFilesAfter(0, true)
@@ -500,5 +594,13 @@ func (f *Freezer) MigrateTable(kind string, convert convertLegacyFn) error {
 	if err := os.Remove(migrationPath); err != nil {
 		return err
 	}
+	// Reopen the migrated table, so that the freezer keeps working on it.
+	table.sizeGauge.Dec(int64(oldSize))
+	migrated, err := newRemoteTable(ancientsPath, kind, table.readMeter, table.writeMeter, table.sizeGauge, table.maxFileSize, config, false, table.remote)
+	if err != nil {
+		return err
+	}
+	f.tables[kind] = migrated
+	f.writeBatch = newFreezerBatch(f)
 	return nil
 }
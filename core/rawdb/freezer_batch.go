@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"fmt"
+	"hash/crc32"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common/math"
@@ -86,6 +87,7 @@ type freezerTableBatch struct {
 	t *freezerTable
 
 	sb          *snappyBuffer
+	zb          []byte // buffer of the zstd compressed item
 	encBuffer   writeBuffer
 	dataBuffer  []byte
 	indexBuffer []byte
@@ -124,11 +126,7 @@ func (batch *freezerTableBatch) Append(item uint64, data interface{}) error {
 	if err := rlp.Encode(&batch.encBuffer, data); err != nil {
 		return err
 	}
-	encItem := batch.encBuffer.data
-	if batch.sb != nil {
-		encItem = batch.sb.compress(encItem)
-	}
-	return batch.appendItem(encItem)
+	return batch.appendItem(batch.compress(item, batch.encBuffer.data))
 }
 
 // AppendRaw injects a binary blob at the end of the freezer table. The item number is a
@@ -139,11 +137,20 @@ func (batch *freezerTableBatch) AppendRaw(item uint64, blob []byte) error {
 		return fmt.Errorf("%w: have %d want %d", errOutOrderInsertion, item, batch.curItem)
 	}
 
-	encItem := blob
-	if batch.sb != nil {
-		encItem = batch.sb.compress(blob)
+	return batch.appendItem(batch.compress(item, blob))
+}
+
+// compress compresses an item with the algorithm the table uses for it: zstd
+// from the item the dictionary was trained at, snappy otherwise.
+func (batch *freezerTableBatch) compress(item uint64, data []byte) []byte {
+	if batch.sb == nil {
+		return data
 	}
-	return batch.appendItem(encItem)
+	if codec := batch.t.codec; codec != nil && item >= codec.from {
+		batch.zb = codec.compress(batch.zb[:0], data)
+		return batch.zb
+	}
+	return batch.sb.compress(data)
 }
 
 func (batch *freezerTableBatch) appendItem(data []byte) error {
@@ -167,7 +174,10 @@ func (batch *freezerTableBatch) appendItem(data []byte) error {
 
 	// Put index entry to buffer.
 	entry := indexEntry{filenum: batch.t.headId, offset: uint32(itemOffset + itemSize)}
-	batch.indexBuffer = entry.append(batch.indexBuffer)
+	if batch.t.checksums {
+		entry.checksum = crc32.Checksum(data, checksumTable)
+	}
+	batch.indexBuffer = batch.t.appendIndex(batch.indexBuffer, &entry)
 	batch.curItem++
 
 	return batch.maybeCommit()
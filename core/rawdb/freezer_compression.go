@@ -0,0 +1,311 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// freezerDictSize is the maximum size of the zstd dictionaries trained on
+	// the items of the freezer tables.
+	freezerDictSize = 110 * 1024
+
+	// freezerDictSampleItems is the maximum number of recent items the zstd
+	// dictionaries are trained on.
+	freezerDictSampleItems = 4096
+
+	// freezerDictSampleBytes caps the total size of the training samples.
+	freezerDictSampleBytes = 16 * 1024 * 1024
+
+	// freezerDictSampleLimit is the number of leading bytes of an item used
+	// as a training sample, the rest doesn't affect the dictionary anymore.
+	freezerDictSampleLimit = 64 * 1024
+
+	// freezerRatioSampleItems is the number of recent items the achieved
+	// compression ratio of a table is measured on.
+	freezerRatioSampleItems = 1024
+
+	// freezerSampleReadBytes is the size of the reads collecting the samples.
+	freezerSampleReadBytes = 1024 * 1024
+)
+
+// freezerDictMinItems is the number of items a table must contain before a zstd
+// dictionary is trained on them. Until then the items are snappy compressed.
+// It's a variable so that tests can lower it.
+var freezerDictMinItems uint64 = 1024
+
+// errNoDictSamples is returned if a zstd dictionary is to be trained on a table
+// without items.
+var errNoDictSamples = errors.New("no items to train dictionary on")
+
+// Compression algorithms of the freezer tables, as set in the OpenOptions.
+const (
+	AncientCompressionSnappy = "snappy" // Per-item snappy compression
+	AncientCompressionZstd   = "zstd"   // Per-item zstd compression with a dictionary trained per table
+)
+
+// zstdCodec compresses the items of a freezer table with zstd, using the
+// dictionary trained on the table. Both directions are safe for concurrent use.
+type zstdCodec struct {
+	from uint64 // Number of the first item compressed with zstd
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+}
+
+// newZstdCodec creates the zstd encoder and decoder with the given dictionary,
+// for the items starting at the given number.
+func newZstdCodec(dict []byte, from uint64) (*zstdCodec, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dict), zstd.WithEncoderLevel(zstd.SpeedBetterCompression), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dict), zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		enc.Close()
+		return nil, err
+	}
+	return &zstdCodec{from: from, enc: enc, dec: dec}, nil
+}
+
+// compress zstd-compresses the data, appending it to dst.
+func (c *zstdCodec) compress(dst, data []byte) []byte {
+	return c.enc.EncodeAll(data, dst)
+}
+
+// decompress decompresses a zstd compressed item.
+func (c *zstdCodec) decompress(item []byte) ([]byte, error) {
+	return c.dec.DecodeAll(item, nil)
+}
+
+// decompressedLen returns the size of a zstd compressed item once decompressed,
+// as recorded in its frame header.
+func (c *zstdCodec) decompressedLen(item []byte) int {
+	var header zstd.Header
+	if err := header.Decode(item); err != nil || !header.HasFCS {
+		return len(item)
+	}
+	return int(header.FrameContentSize)
+}
+
+// close releases the resources of the encoder and decoder.
+func (c *zstdCodec) close() {
+	c.enc.Close()
+	c.dec.Close()
+}
+
+// trainZstdDict trains a zstd dictionary on the given samples.
+func trainZstdDict(samples [][]byte) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, errNoDictSamples
+	}
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: freezerDictSize,
+		HashBytes:   6,
+		ZstdLevel:   zstd.SpeedBetterCompression,
+	})
+}
+
+// dictSamples collects the training samples for a zstd dictionary from the
+// most recent items of the table.
+func (t *freezerTable) dictSamples() ([][]byte, error) {
+	var (
+		items = atomic.LoadUint64(&t.items)
+		tail  = atomic.LoadUint64(&t.itemHidden)
+		start = tail
+		size  int
+	)
+	if items-tail > freezerDictSampleItems {
+		start = items - freezerDictSampleItems
+	}
+	var samples [][]byte
+	for i := start; i < items && size < freezerDictSampleBytes; {
+		data, err := t.RetrieveItems(i, items-i, freezerSampleReadBytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range data {
+			if len(item) > freezerDictSampleLimit {
+				item = item[:freezerDictSampleLimit]
+			}
+			samples = append(samples, item)
+			size += len(item)
+		}
+		i += uint64(len(data))
+	}
+	return samples, nil
+}
+
+// setDict switches the compression of the items starting at the given number
+// to zstd with the given dictionary, persisting it in the table metadata.
+func (t *freezerTable) setDict(dict []byte, from uint64) error {
+	codec, err := newZstdCodec(dict, from)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	meta := *t.metadata
+	meta.ZstdFrom, meta.ZstdDict = from, dict
+	if err := writeMetadata(t.meta, &meta); err != nil {
+		codec.close()
+		return err
+	}
+	if err := t.meta.Sync(); err != nil {
+		codec.close()
+		return err
+	}
+	if t.codec != nil {
+		t.codec.close()
+	}
+	t.metadata, t.codec = &meta, codec
+	return nil
+}
+
+// maybeTrainDict starts training the zstd dictionary of a table configured for
+// zstd compression in the background once it contains enough items. Once the
+// training finished, the items appended from the next call on are compressed
+// with the dictionary. The caller must hold the write lock of the freezer, so
+// that the switch happens at an item boundary.
+func (t *freezerTable) maybeTrainDict() {
+	if !t.zstd || t.noCompression || t.readonly || t.codec != nil || t.dictFailed {
+		return
+	}
+	items := atomic.LoadUint64(&t.items)
+	if t.dictResult != nil {
+		var dict []byte
+		select {
+		case dict = <-t.dictResult:
+		default:
+			return // Training still in progress, keep using snappy
+		}
+		t.dictResult = nil
+
+		// Training is only retried on the next start, keep using snappy
+		if dict == nil {
+			t.dictFailed = true
+			return
+		}
+		if err := t.setDict(dict, items); err != nil {
+			t.dictFailed = true
+			t.logger.Warn("Failed to switch to compression dictionary", "err", err)
+			return
+		}
+		t.logger.Info("Switched to zstd compression", "from", items)
+		return
+	}
+	if items-atomic.LoadUint64(&t.itemHidden) < freezerDictMinItems {
+		return
+	}
+	t.dictResult = make(chan []byte, 1)
+	t.dictWg.Add(1)
+	go t.trainDict(t.dictResult)
+}
+
+// trainDict trains a zstd dictionary on the most recent items of the table,
+// delivering it on the result channel, or nil if the training failed.
+func (t *freezerTable) trainDict(result chan []byte) {
+	defer t.dictWg.Done()
+
+	start := time.Now()
+	samples, err := t.dictSamples()
+	if err != nil {
+		t.logger.Warn("Failed to collect compression dictionary samples", "err", err)
+		result <- nil
+		return
+	}
+	dict, err := trainZstdDict(samples)
+	if err != nil {
+		t.logger.Warn("Failed to train compression dictionary", "err", err)
+		result <- nil
+		return
+	}
+	t.logger.Info("Trained compression dictionary", "samples", len(samples), "elapsed", common.PrettyDuration(time.Since(start)))
+	result <- dict
+}
+
+// tableCompression describes the compression of a freezer table.
+type tableCompression struct {
+	name  string  // Name of the table
+	mode  string  // Compression algorithm of the recent items
+	ratio float64 // Uncompressed to compressed size of the recent items
+}
+
+// compression measures the compression ratio achieved on the most recent items
+// of the table.
+func (t *freezerTable) compression() (tableCompression, error) {
+	info := tableCompression{name: t.name, mode: AncientCompressionSnappy, ratio: 1}
+	t.lock.RLock()
+	codec := t.codec
+	t.lock.RUnlock()
+
+	switch {
+	case t.noCompression:
+		info.mode = "none"
+	case codec != nil && codec.from > atomic.LoadUint64(&t.itemHidden):
+		info.mode = fmt.Sprintf("%s (from item %d)", AncientCompressionZstd, codec.from)
+	case codec != nil:
+		info.mode = AncientCompressionZstd
+	}
+	var (
+		items = atomic.LoadUint64(&t.items)
+		start = atomic.LoadUint64(&t.itemHidden)
+	)
+	if items-start > freezerRatioSampleItems {
+		start = items - freezerRatioSampleItems
+	}
+	if t.noCompression || start == items {
+		return info, nil
+	}
+	var compressed, decompressed int
+	for i := start; i < items; {
+		data, sizes, err := t.retrieveItems(i, items-i, freezerSampleReadBytes)
+		if err != nil {
+			return info, err
+		}
+		var offset int
+		for j, size := range sizes {
+			item := data[offset : offset+size]
+			offset += size
+
+			compressed += size
+			if codec != nil && i+uint64(j) >= codec.from {
+				decompressed += codec.decompressedLen(item)
+			} else {
+				n, err := snappy.DecodedLen(item)
+				if err != nil {
+					return info, err
+				}
+				decompressed += n
+			}
+		}
+		i += uint64(len(sizes))
+	}
+	if compressed > 0 {
+		info.ratio = float64(decompressed) / float64(compressed)
+	}
+	return info, nil
+}
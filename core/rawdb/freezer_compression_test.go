@@ -0,0 +1,161 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var zstdTestTableDef = map[string]freezerTableConfig{"test": {zstd: true, prunable: true}}
+
+// compressibleItem returns a test item resembling the structured, repetitive
+// content of the chain data.
+func compressibleItem(i int) []byte {
+	var buf bytes.Buffer
+	for j := 0; j < 8; j++ {
+		fmt.Fprintf(&buf, `{"status":"0x1","cumulativeGasUsed":"%#x","logs":[{"address":"0x%040x","topics":["0x%064x"]}]}`, i*21000+j, i%7, j)
+	}
+	return buf.Bytes()
+}
+
+// appendItems appends the test items in the given range to the freezer table.
+func appendItems(t *testing.T, f *Freezer, from, to int) {
+	t.Helper()
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := from; i < to; i++ {
+			if err := op.AppendRaw("test", uint64(i), compressibleItem(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("ModifyAncients failed:", err)
+	}
+}
+
+// checkItems verifies that the freezer table contains the test items in the
+// given range.
+func checkItems(t *testing.T, f *Freezer, from, to int) {
+	t.Helper()
+	items, err := f.AncientRange("test", uint64(from), uint64(to-from), 1024*1024)
+	if err != nil {
+		t.Fatal("AncientRange failed:", err)
+	}
+	if len(items) != to-from {
+		t.Fatalf("wrong number of items: have %d, want %d", len(items), to-from)
+	}
+	for i, item := range items {
+		if !bytes.Equal(item, compressibleItem(from+i)) {
+			t.Fatalf("item %d mismatch", from+i)
+		}
+	}
+}
+
+// Tests that a table configured for zstd trains the dictionary in the background
+// once it contains enough items, switching over on the next append after the
+// training finished, and that both the snappy and the zstd items survive a
+// restart.
+func TestFreezerZstdTraining(t *testing.T) {
+	defer func(n uint64) { freezerDictMinItems = n }(freezerDictMinItems)
+	freezerDictMinItems = 64
+
+	f, dir := newFreezerForTesting(t, zstdTestTableDef)
+
+	appendItems(t, f, 0, 50)
+	if f.tables["test"].codec != nil {
+		t.Fatal("dictionary trained with too few items")
+	}
+	appendItems(t, f, 50, 100)
+	if f.tables["test"].codec != nil {
+		t.Fatal("dictionary switched while training")
+	}
+	f.tables["test"].dictWg.Wait()
+	appendItems(t, f, 100, 120)
+	codec := f.tables["test"].codec
+	if codec == nil {
+		t.Fatal("dictionary not trained")
+	}
+	if codec.from != 120 {
+		t.Fatalf("wrong first zstd item: have %d, want %d", codec.from, 120)
+	}
+	appendItems(t, f, 120, 300)
+	checkItems(t, f, 0, 300)
+
+	info, err := f.tables["test"].compression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ratio <= 1 {
+		t.Fatalf("compression ratio too low: %f", info.ratio)
+	}
+	// Roll back below the switch, the re-appended items are snappy compressed
+	if err := f.TruncateHead(80); err != nil {
+		t.Fatal(err)
+	}
+	appendItems(t, f, 80, 150)
+	checkItems(t, f, 0, 150)
+	f.Close()
+
+	// Reopen the freezer, the dictionary must be loaded from the metadata
+	f, err = NewFreezer(dir, "", false, 2049, zstdTestTableDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if codec := f.tables["test"].codec; codec == nil || codec.from != 120 {
+		t.Fatal("dictionary not loaded")
+	}
+	checkItems(t, f, 0, 150)
+}
+
+// Tests that snappy compressed tables can be migrated to zstd, and that the
+// freezer keeps working on the migrated table.
+func TestFreezerMigrateZstd(t *testing.T) {
+	snappyTableDef := map[string]freezerTableConfig{"test": {prunable: true}}
+	f, dir := newFreezerForTesting(t, snappyTableDef)
+	appendItems(t, f, 0, 200)
+	f.Close()
+
+	f, err := NewFreezer(dir, "", false, 2049, zstdTestTableDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.MigrateTable("test", func(item []byte) ([]byte, error) { return item, nil }); err != nil {
+		t.Fatal("migration failed:", err)
+	}
+	if codec := f.tables["test"].codec; codec == nil || codec.from != 0 {
+		t.Fatal("table not migrated to zstd")
+	}
+	checkItems(t, f, 0, 200)
+	appendItems(t, f, 200, 250)
+	checkItems(t, f, 0, 250)
+	f.Close()
+
+	// Reopening with snappy must keep reading and writing with the dictionary
+	f, err = NewFreezer(dir, "", false, 2049, snappyTableDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	appendItems(t, f, 250, 260)
+	checkItems(t, f, 0, 260)
+}
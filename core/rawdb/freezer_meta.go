@@ -36,6 +36,19 @@ type freezerTableMeta struct {
 	// plus the number of items hidden in the table, so it should never
 	// be lower than the "actual tail".
 	VirtualTail uint64
+
+	// ZstdFrom is the number of the first item compressed with zstd using
+	// the dictionary, the items before it are snappy compressed. It's only
+	// meaningful if the dictionary is set.
+	ZstdFrom uint64 `rlp:"optional"`
+
+	// ZstdDict is the zstd dictionary trained on the items of the table.
+	// Tables without a dictionary are compressed with snappy.
+	ZstdDict []byte `rlp:"optional"`
+
+	// Checksums indicates whether the index entries of the table contain the
+	// checksums of the items. It's fixed when the table is created.
+	Checksums bool `rlp:"optional"`
 }
 
 // newMetadata initializes the metadata object with the given virtual tail.
@@ -46,6 +59,13 @@ func newMetadata(tail uint64) *freezerTableMeta {
 	}
 }
 
+// withTail returns a copy of the metadata with the given virtual tail.
+func (m *freezerTableMeta) withTail(tail uint64) *freezerTableMeta {
+	cpy := *m
+	cpy.VirtualTail = tail
+	return &cpy
+}
+
 // readMetadata reads the metadata of the freezer table from the
 // given metadata file.
 func readMetadata(file *os.File) (*freezerTableMeta, error) {
@@ -70,6 +90,24 @@ func writeMetadata(file *os.File, meta *freezerTableMeta) error {
 	return rlp.Encode(file, meta)
 }
 
+// storedChecksums reports whether the metadata in the given file marks the
+// index entries of the table to contain checksums. Legacy tables without
+// metadata don't have them.
+func storedChecksums(file *os.File) (bool, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if stat.Size() == 0 {
+		return false, nil
+	}
+	meta, err := readMetadata(file)
+	if err != nil {
+		return false, err
+	}
+	return meta.Checksums, nil
+}
+
 // loadMetadata loads the metadata from the given metadata file.
 // Initializes the metadata file with the given "actual tail" if
 // it's empty.
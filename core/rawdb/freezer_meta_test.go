@@ -17,8 +17,11 @@
 package rawdb
 
 import (
+	"bytes"
 	"os"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func TestReadWriteFreezerTableMeta(t *testing.T) {
@@ -58,3 +61,36 @@ func TestInitializeFreezerTableMeta(t *testing.T) {
 		t.Fatalf("Unexpected virtual tail field")
 	}
 }
+
+func TestFreezerTableMetaZstd(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "*")
+	if err != nil {
+		t.Fatalf("Failed to create file %v", err)
+	}
+	// Metadata written before the zstd support must still be readable
+	legacy := struct {
+		Version     uint16
+		VirtualTail uint64
+	}{freezerVersion, 100}
+	if err := rlp.Encode(f, &legacy); err != nil {
+		t.Fatalf("Failed to write legacy metadata %v", err)
+	}
+	meta, err := readMetadata(f)
+	if err != nil {
+		t.Fatalf("Failed to read legacy metadata %v", err)
+	}
+	if meta.VirtualTail != 100 || meta.ZstdDict != nil {
+		t.Fatalf("Unexpected legacy metadata %+v", meta)
+	}
+	meta.ZstdFrom, meta.ZstdDict = 200, []byte{1, 2, 3}
+	if err := writeMetadata(f, meta.withTail(150)); err != nil {
+		t.Fatalf("Failed to write metadata %v", err)
+	}
+	meta, err = readMetadata(f)
+	if err != nil {
+		t.Fatalf("Failed to read metadata %v", err)
+	}
+	if meta.VirtualTail != 150 || meta.ZstdFrom != 200 || !bytes.Equal(meta.ZstdDict, []byte{1, 2, 3}) {
+		t.Fatalf("Unexpected metadata %+v", meta)
+	}
+}
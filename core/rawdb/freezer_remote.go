@@ -0,0 +1,307 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RemoteStore is an object storage, such as an S3-compatible bucket, which the
+// sealed data files of the freezer tables can be offloaded to.
+type RemoteStore interface {
+	// Put uploads an object of the given size, replacing any existing one.
+	Put(key string, r io.Reader, size int64) error
+
+	// ReadAt reads len(p) bytes of the object starting at byte offset off.
+	ReadAt(key string, p []byte, off int64) (int, error)
+
+	// Stat returns the size of an object. If the object doesn't exist, the
+	// returned error wraps fs.ErrNotExist.
+	Stat(key string) (int64, error)
+
+	// Delete removes an object. Deleting a non-existent object is not an error.
+	Delete(key string) error
+}
+
+// FreezerRemote configures a freezer to keep its sealed data files in a remote
+// store. Only the index files, the head data files and the most recent sealed
+// data files are kept on the local disk.
+type FreezerRemote struct {
+	Store RemoteStore // Object store holding the sealed data files
+	Cache int         // Number of most recent sealed data files per table kept locally
+}
+
+// freezerFile is an opened data file of a freezer table, either a local file or
+// a sealed file served from the remote store.
+type freezerFile interface {
+	io.ReaderAt
+	io.Closer
+	Name() string
+}
+
+// remoteFile is a sealed data file of a freezer table which is only available
+// in the remote store.
+type remoteFile struct {
+	store RemoteStore
+	path  string // Local path the file would have on disk
+}
+
+// ReadAt implements io.ReaderAt, retrieving the requested range from the store.
+func (f *remoteFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.store.ReadAt(filepath.Base(f.path), p, off)
+}
+
+// Name returns the local path of the data file.
+func (f *remoteFile) Name() string { return f.path }
+
+// Close is a no-op, remote files hold no resources.
+func (f *remoteFile) Close() error { return nil }
+
+// openSealedFile opens a sealed data file for reading, serving it from the
+// remote store if it's not available locally. It assumes that the write-lock
+// is held by the caller.
+func (t *freezerTable) openSealedFile(num uint32) error {
+	if t.remote != nil {
+		if _, exist := t.files[num]; exist {
+			return nil
+		}
+		path := filepath.Join(t.path, t.fileName(num))
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if _, err := t.remote.Store.Stat(t.fileName(num)); err != nil {
+				return fmt.Errorf("missing data file %d: %w", num, err)
+			}
+			t.files[num] = &remoteFile{store: t.remote.Store, path: path}
+			return nil
+		}
+	}
+	_, err := t.openFile(num, openFreezerFileForReadOnly)
+	return err
+}
+
+// fetchFile downloads a data file from the remote store into the local path,
+// in order to make it writable again.
+func (t *freezerTable) fetchFile(path string) error {
+	name := filepath.Base(path)
+	size, err := t.remote.Store.Stat(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	r := io.NewSectionReader(readerAtFunc(func(p []byte, off int64) (int, error) {
+		return t.remote.Store.ReadAt(name, p, off)
+	}), 0, size)
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	t.logger.Info("Fetched data file from remote store", "file", name, "size", size)
+	return os.Rename(f.Name(), path)
+}
+
+// startOffloader launches the background uploader of the table, and queues the
+// sealed data files left over from an earlier run.
+func (t *freezerTable) startOffloader() {
+	if t.remote == nil || t.readonly {
+		return
+	}
+	t.offloadCh = make(chan chan struct{}, 1)
+	t.offloadQuit = make(chan struct{})
+	t.offloadWg.Add(1)
+	go t.offloadLoop()
+	t.queueOffload()
+}
+
+// stopOffloader terminates the background uploader, waiting for the running
+// upload to finish.
+func (t *freezerTable) stopOffloader() {
+	if t.offloadQuit == nil {
+		return
+	}
+	close(t.offloadQuit)
+	t.offloadWg.Wait()
+	t.offloadQuit = nil
+}
+
+// queueOffload notifies the background uploader about newly sealed data files.
+// It never blocks, a pending notification covers all files sealed until it's
+// processed.
+func (t *freezerTable) queueOffload() {
+	if t.offloadCh == nil {
+		return
+	}
+	select {
+	case t.offloadCh <- nil:
+	default:
+	}
+}
+
+// offloadLoop uploads the sealed data files whenever notified. Failures are not
+// fatal, the sealed files are still available locally and the upload is retried
+// with the next notification.
+func (t *freezerTable) offloadLoop() {
+	defer t.offloadWg.Done()
+
+	for {
+		select {
+		case done := <-t.offloadCh:
+			if err := t.offload(); err != nil {
+				t.logger.Warn("Failed to offload data files", "err", err)
+			}
+			// If we were doing a manual trigger, notify it
+			if done != nil {
+				close(done)
+			}
+		case <-t.offloadQuit:
+			return
+		}
+	}
+}
+
+// offload uploads the locally stored sealed data files which are missing from
+// the remote store, and replaces the ones beyond the local cache allowance with
+// their remote counterparts once their upload is confirmed. The uploads run
+// without holding the table lock.
+func (t *freezerTable) offload() error {
+	t.lock.RLock()
+	if t.index == nil {
+		t.lock.RUnlock()
+		return errClosed
+	}
+	var sealed []uint32
+	for num, f := range t.files {
+		if _, local := f.(*os.File); local && num < t.headId {
+			sealed = append(sealed, num)
+		}
+	}
+	sort.Slice(sealed, func(i, j int) bool { return sealed[i] < sealed[j] })
+	t.lock.RUnlock()
+
+	for _, num := range sealed {
+		select {
+		case <-t.offloadQuit:
+			return nil
+		default:
+		}
+		path := filepath.Join(t.path, t.fileName(num))
+		uploaded, err := t.uploadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // Truncated away in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		if err := t.releaseUploaded(num, uploaded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseUploaded drops the local copy of an uploaded data file if it's beyond
+// the cache allowance. If the file was modified or removed during the upload,
+// the uploaded object is stale and deleted instead, the current content of the
+// file is uploaded again once it's sealed.
+func (t *freezerTable) releaseUploaded(num uint32, uploaded os.FileInfo) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	name := t.fileName(num)
+	f, ok := t.files[num].(*os.File)
+	if ok && num < t.headId {
+		if stat, err := f.Stat(); err == nil && os.SameFile(stat, uploaded) && stat.Size() == uploaded.Size() && stat.ModTime().Equal(uploaded.ModTime()) {
+			if int(t.headId)-int(num) <= t.remote.Cache {
+				return nil
+			}
+			// Confirm the upload before dropping the only local copy
+			if size, err := t.remote.Store.Stat(name); err != nil || size != uploaded.Size() {
+				return fmt.Errorf("unconfirmed upload of %s: size %d, err %v", name, size, err)
+			}
+			f.Close()
+			if err := os.Remove(f.Name()); err != nil {
+				return err
+			}
+			t.files[num] = &remoteFile{store: t.remote.Store, path: f.Name()}
+			return nil
+		}
+	}
+	if _, remote := t.files[num].(*remoteFile); remote {
+		return nil // Evicted by an earlier run, the object is in use
+	}
+	t.logger.Debug("Data file changed during upload", "file", name)
+	return t.remote.Store.Delete(name)
+}
+
+// uploadFile pushes a local data file into the remote store, unless an object
+// of the same size is already present. It returns the state of the file which
+// was uploaded.
+func (t *freezerTable) uploadFile(path string) (os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	if size, err := t.remote.Store.Stat(name); err == nil && size == stat.Size() {
+		return stat, nil
+	}
+	if err := t.remote.Store.Put(name, f, stat.Size()); err != nil {
+		return nil, fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	t.logger.Info("Uploaded data file to remote store", "file", name, "size", stat.Size())
+	return stat, nil
+}
+
+// removeFile deletes a released data file, both locally and remotely.
+func (t *freezerTable) removeFile(f freezerFile) {
+	os.Remove(f.Name())
+	if t.remote != nil {
+		if err := t.remote.Store.Delete(filepath.Base(f.Name())); err != nil {
+			t.logger.Warn("Failed to delete remote data file", "file", filepath.Base(f.Name()), "err", err)
+		}
+	}
+}
+
+// readerAtFunc is an adapter to allow the use of ordinary functions as io.ReaderAt.
+type readerAtFunc func(p []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(p []byte, off int64) (int, error) { return f(p, off) }
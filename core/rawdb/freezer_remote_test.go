@@ -0,0 +1,331 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// memoryRemoteStore is an in-memory RemoteStore for testing.
+type memoryRemoteStore struct {
+	objects map[string][]byte
+	lock    sync.Mutex
+}
+
+func newMemoryRemoteStore() *memoryRemoteStore {
+	return &memoryRemoteStore{objects: make(map[string][]byte)}
+}
+
+func (s *memoryRemoteStore) Put(key string, r io.Reader, size int64) error {
+	blob, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(blob)) != size {
+		return fmt.Errorf("size mismatch: have %d, want %d", len(blob), size)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.objects[key] = blob
+	return nil
+}
+
+func (s *memoryRemoteStore) ReadAt(key string, p []byte, off int64) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	blob, ok := s.objects[key]
+	if !ok {
+		return 0, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	return bytes.NewReader(blob).ReadAt(p, off)
+}
+
+func (s *memoryRemoteStore) Stat(key string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	blob, ok := s.objects[key]
+	if !ok {
+		return 0, fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	return int64(len(blob)), nil
+}
+
+func (s *memoryRemoteStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryRemoteStore) has(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.objects[key]
+	return ok
+}
+
+// waitOffload triggers the background uploaders of all tables of a freezer, and
+// waits until they are done.
+func waitOffload(f *Freezer) {
+	for _, table := range f.tables {
+		if table.offloadCh == nil {
+			continue
+		}
+		done := make(chan struct{})
+		table.offloadCh <- done
+		<-done
+	}
+}
+
+// Tests that sealed data files are offloaded into the remote store, and that
+// the freezer keeps serving and modifying them transparently.
+func TestFreezerRemote(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir    = t.TempDir()
+		store  = newMemoryRemoteStore()
+		remote = &FreezerRemote{Store: store, Cache: 2}
+		values [][]byte
+	)
+	for x := 0; x < 100; x++ {
+		values = append(values, getChunk(256, x))
+	}
+	f, err := NewRemoteFreezer(dir, "", false, 2049, freezerTestTableDef, remote)
+	if err != nil {
+		t.Fatal("can't open freezer", err)
+	}
+	_, err = f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := range values {
+			if err := op.AppendRaw("test", uint64(i), values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("ModifyAncients failed:", err)
+	}
+	waitOffload(f)
+
+	// 8 items fit into a data file, so there should be 12 sealed files and a
+	// head. Only the head and the two most recent sealed ones are local.
+	checkFiles := func(local, remote []uint32) {
+		t.Helper()
+		for _, num := range local {
+			if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("test.%04d.rdat", num))); err != nil {
+				t.Errorf("data file %d not local: %v", num, err)
+			}
+		}
+		for _, num := range remote {
+			name := fmt.Sprintf("test.%04d.rdat", num)
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				t.Errorf("data file %d unexpectedly local", num)
+			}
+			if !store.has(name) {
+				t.Errorf("data file %d not remote", num)
+			}
+		}
+	}
+	checkFiles([]uint32{10, 11, 12}, []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	checkValues := func(f *Freezer, from, to int) {
+		t.Helper()
+		for i := from; i < to; i++ {
+			blob, err := f.Ancient("test", uint64(i))
+			if err != nil {
+				t.Fatalf("failed to retrieve item %d: %v", i, err)
+			}
+			if !bytes.Equal(blob, values[i]) {
+				t.Fatalf("item %d mismatch: have %x, want %x", i, blob, values[i])
+			}
+		}
+		blobs, err := f.AncientRange("test", uint64(from), uint64(to-from), 0)
+		if err != nil {
+			t.Fatalf("failed to retrieve range: %v", err)
+		}
+		for i, blob := range blobs {
+			if !bytes.Equal(blob, values[from+i]) {
+				t.Fatalf("item %d mismatch in range", from+i)
+			}
+		}
+	}
+	checkValues(f, 0, 100)
+	f.Close()
+
+	// Reopen the freezer and ensure the remote files are still served
+	f, err = NewRemoteFreezer(dir, "", false, 2049, freezerTestTableDef, remote)
+	if err != nil {
+		t.Fatal("can't reopen freezer", err)
+	}
+	checkAncientCount(t, f, "test", 100)
+	checkValues(f, 0, 100)
+
+	// Truncate the head back into an offloaded file, which must be fetched to
+	// become writable again.
+	if err := f.TruncateHead(30); err != nil {
+		t.Fatal("failed to truncate head", err)
+	}
+	checkAncientCount(t, f, "test", 30)
+	checkFiles([]uint32{3}, []uint32{0, 1, 2})
+	if store.has("test.0004.rdat") {
+		t.Error("truncated data file 4 not deleted remotely")
+	}
+	_, err = f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := 30; i < 40; i++ {
+			if err := op.AppendRaw("test", uint64(i), values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("ModifyAncients failed:", err)
+	}
+	checkValues(f, 0, 40)
+
+	// Truncate the tail and ensure the deleted files are gone remotely too
+	if err := f.TruncateTail(20); err != nil {
+		t.Fatal("failed to truncate tail", err)
+	}
+	for _, num := range []uint32{0, 1} {
+		if store.has(fmt.Sprintf("test.%04d.rdat", num)) {
+			t.Errorf("tail data file %d not deleted remotely", num)
+		}
+	}
+	checkValues(f, 20, 40)
+	f.Close()
+}
+
+// failingRemoteStore is a memoryRemoteStore whose uploads can be made to fail.
+type failingRemoteStore struct {
+	*memoryRemoteStore
+	fail bool
+}
+
+func (s *failingRemoteStore) Put(key string, r io.Reader, size int64) error {
+	s.lock.Lock()
+	fail := s.fail
+	s.lock.Unlock()
+
+	if fail {
+		return errors.New("upload failed")
+	}
+	return s.memoryRemoteStore.Put(key, r, size)
+}
+
+// Tests that sealed data files are kept locally until their upload succeeds.
+func TestFreezerRemoteFailedUpload(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir    = t.TempDir()
+		store  = &failingRemoteStore{memoryRemoteStore: newMemoryRemoteStore(), fail: true}
+		remote = &FreezerRemote{Store: store, Cache: 0}
+	)
+	f, err := NewRemoteFreezer(dir, "", false, 2049, freezerTestTableDef, remote)
+	if err != nil {
+		t.Fatal("can't open freezer", err)
+	}
+	defer f.Close()
+
+	_, err = f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := 0; i < 20; i++ {
+			if err := op.AppendRaw("test", uint64(i), getChunk(256, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("ModifyAncients failed:", err)
+	}
+	waitOffload(f)
+	for _, num := range []uint32{0, 1} {
+		name := fmt.Sprintf("test.%04d.rdat", num)
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("data file %d dropped without upload: %v", num, err)
+		}
+		if store.has(name) {
+			t.Errorf("data file %d uploaded despite failure", num)
+		}
+	}
+	// Once the store accepts uploads, the sealed files are moved over
+	store.lock.Lock()
+	store.fail = false
+	store.lock.Unlock()
+
+	waitOffload(f)
+	for _, num := range []uint32{0, 1} {
+		name := fmt.Sprintf("test.%04d.rdat", num)
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("data file %d unexpectedly local", num)
+		}
+		if !store.has(name) {
+			t.Errorf("data file %d not remote", num)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		blob, err := f.Ancient("test", uint64(i))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", i, err)
+		}
+		if !bytes.Equal(blob, getChunk(256, i)) {
+			t.Fatalf("item %d mismatch", i)
+		}
+	}
+}
+
+// Tests that repairing items of a remote table is rejected, as the sealed data
+// files holding them may only be available in the remote store.
+func TestFreezerRemoteRepair(t *testing.T) {
+	t.Parallel()
+
+	remote := &FreezerRemote{Store: newMemoryRemoteStore(), Cache: 2}
+	f, err := NewRemoteFreezer(t.TempDir(), "", false, 2049, freezerTestTableDef, remote)
+	if err != nil {
+		t.Fatal("can't open freezer", err)
+	}
+	defer f.Close()
+
+	_, err = f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := 0; i < 20; i++ {
+			if err := op.AppendRaw("test", uint64(i), getChunk(256, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("ModifyAncients failed:", err)
+	}
+	waitOffload(f)
+
+	if err := f.RepairAncient("test", 0, getChunk(256, 0)); !errors.Is(err, errRemoteRepair) {
+		t.Fatalf("repair error mismatch: have %v, want %v", err, errRemoteRepair)
+	}
+}
@@ -47,7 +47,7 @@ type ResettableFreezer struct {
 //
 // The reset function will delete directory atomically and re-create the
 // freezer from scratch.
-func NewResettableFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]bool) (*ResettableFreezer, error) {
+func NewResettableFreezer(datadir string, namespace string, readonly bool, maxTableSize uint32, tables map[string]freezerTableConfig) (*ResettableFreezer, error) {
 	if err := cleanup(datadir); err != nil {
 		return nil, err
 	}
@@ -202,6 +202,14 @@ func (f *ResettableFreezer) MigrateTable(kind string, convert convertLegacyFn) e
 	return f.freezer.MigrateTable(kind, convert)
 }
 
+// RepairAncient overwrites a corrupted item with its original content.
+func (f *ResettableFreezer) RepairAncient(kind string, number uint64, item []byte) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.freezer.RepairAncient(kind, number, item)
+}
+
 // cleanup removes the directory located in the specified path
 // has the name with deletion marker suffix.
 func cleanup(path string) error {
@@ -21,7 +21,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
@@ -44,17 +46,33 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errCorruptedItem is returned if the content of an item doesn't match the
+	// checksum stored in its index entry.
+	errCorruptedItem = errors.New("checksum mismatch")
+
+	// errRemoteRepair is returned if an item of a table keeping its sealed data
+	// files in a remote store is to be repaired.
+	errRemoteRepair = errors.New("repairing items of remote tables is not supported")
 )
 
 // indexEntry contains the number/id of the file that the data resides in, as well as the
-// offset within the file to the end of the data.
+// offset within the file to the end of the data. Tables with checksums additionally
+// store the checksum of the data ending at the offset.
 // In serialized form, the filenum is stored as uint16.
 type indexEntry struct {
-	filenum uint32 // stored as uint16 ( 2 bytes )
-	offset  uint32 // stored as uint32 ( 4 bytes )
+	filenum  uint32 // stored as uint16 ( 2 bytes )
+	offset   uint32 // stored as uint32 ( 4 bytes )
+	checksum uint32 // stored as uint32 ( 4 bytes ), only in tables with checksums
 }
 
-const indexEntrySize = 6
+const (
+	indexEntrySize         = 6  // Size of the index entries without checksum
+	checksumIndexEntrySize = 10 // Size of the index entries with checksum
+)
+
+// checksumTable is the CRC32 table used to checksum the stored items.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
 
 // unmarshalBinary deserializes binary b into the rawIndex entry.
 func (i *indexEntry) unmarshalBinary(b []byte) {
@@ -71,6 +89,17 @@ func (i *indexEntry) append(b []byte) []byte {
 	return out
 }
 
+// unmarshalChecksum deserializes the checksum of the entry from binary b, which
+// must start at the beginning of the entry.
+func (i *indexEntry) unmarshalChecksum(b []byte) {
+	i.checksum = binary.BigEndian.Uint32(b[indexEntrySize:checksumIndexEntrySize])
+}
+
+// appendChecksum adds the encoded checksum of the entry to the end of b.
+func (i *indexEntry) appendChecksum(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(b, i.checksum)
+}
+
 // bounds returns the start- and end- offsets, and the file number of where to
 // read there data item marked by the two index entries. The two entries are
 // assumed to be sequential.
@@ -85,8 +114,8 @@ func (i *indexEntry) bounds(end *indexEntry) (startOffset, endOffset, fileId uin
 }
 
 // freezerTable represents a single chained data table within the freezer (e.g. blocks).
-// It consists of a data file (snappy encoded arbitrary data blobs) and an indexEntry
-// file (uncompressed 64 bit indices into the data file).
+// It consists of a data file (snappy or zstd encoded arbitrary data blobs) and an
+// indexEntry file (uncompressed 64 bit indices into the data file).
 type freezerTable struct {
 	// WARNING: The `items` field is accessed atomically. On 32 bit platforms, only
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
@@ -102,22 +131,36 @@ type freezerTable struct {
 	itemHidden uint64
 
 	noCompression bool // if true, disables snappy compression. Note: does not work retroactively
+	zstd          bool // if true, switches to zstd compression once a dictionary is trained
+	dictFailed    bool // if true, the dictionary training failed and isn't retried
+	checksums     bool // if true, the index entries contain the checksums of the items
 	readonly      bool
 	maxFileSize   uint32 // Max file size for data-files
+	indexSize     int64  // Size of the index entries, depending on the checksums
 	name          string
 	path          string
 
-	head   *os.File            // File descriptor for the data head of the table
-	index  *os.File            // File descriptor for the indexEntry file of the table
-	meta   *os.File            // File descriptor for metadata of the table
-	files  map[uint32]*os.File // open files
-	headId uint32              // number of the currently active head file
-	tailId uint32              // number of the earliest file
+	head   *os.File               // File descriptor for the data head of the table
+	index  *os.File               // File descriptor for the indexEntry file of the table
+	meta   *os.File               // File descriptor for metadata of the table
+	codec  *zstdCodec             // Codec of the zstd compressed items, nil if there are none
+	files  map[uint32]freezerFile // open files
+	headId uint32                 // number of the currently active head file
+	tailId uint32                 // number of the earliest file
+	remote *FreezerRemote         // Remote store for sealed data files, nil if local only
+
+	offloadCh   chan chan struct{} // Notification of sealed files to upload, manual trigger in tests
+	offloadQuit chan struct{}      // Quit channel of the background uploader
+	offloadWg   sync.WaitGroup     // Tracks the background uploader
+
+	dictResult chan []byte    // Dictionary trained in the background, nil if no training was started
+	dictWg     sync.WaitGroup // Tracks the background dictionary training
 
-	headBytes  int64         // Number of bytes written to the head file
-	readMeter  metrics.Meter // Meter for measuring the effective amount of data read
-	writeMeter metrics.Meter // Meter for measuring the effective amount of data written
-	sizeGauge  metrics.Gauge // Gauge for tracking the combined size of all freezer tables
+	metadata   *freezerTableMeta // Current content of the metadata file
+	headBytes  int64             // Number of bytes written to the head file
+	readMeter  metrics.Meter     // Meter for measuring the effective amount of data read
+	writeMeter metrics.Meter     // Meter for measuring the effective amount of data written
+	sizeGauge  metrics.Gauge     // Gauge for tracking the combined size of all freezer tables
 
 	logger log.Logger   // Logger with database path and table name embedded
 	lock   sync.RWMutex // Mutex protecting the data file descriptors
@@ -132,6 +175,15 @@ func newFreezerTable(path, name string, disableSnappy, readonly bool) (*freezerT
 // non-existent. Both files are truncated to the shortest common length to ensure
 // they don't go out of sync.
 func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression, readonly bool) (*freezerTable, error) {
+	return newRemoteTable(path, name, readMeter, writeMeter, sizeGauge, maxFilesize, freezerTableConfig{noSnappy: noCompression}, readonly, nil)
+}
+
+// newRemoteTable opens a freezer table like newTable, but with the compression
+// set by the given config, and keeps the sealed data files in the given remote
+// store if it's non-nil.
+func newRemoteTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, config freezerTableConfig, readonly bool, remote *FreezerRemote) (*freezerTable, error) {
+	noCompression := config.noSnappy
+
 	// Ensure the containing directory exists and open the indexEntry file
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
@@ -171,7 +223,7 @@ func newTable(path string, name string, readMeter metrics.Meter, writeMeter metr
 	tab := &freezerTable{
 		index:         index,
 		meta:          meta,
-		files:         make(map[uint32]*os.File),
+		files:         make(map[uint32]freezerFile),
 		readMeter:     readMeter,
 		writeMeter:    writeMeter,
 		sizeGauge:     sizeGauge,
@@ -179,8 +231,11 @@ func newTable(path string, name string, readMeter metrics.Meter, writeMeter metr
 		path:          path,
 		logger:        log.New("database", path, "table", name),
 		noCompression: noCompression,
+		zstd:          config.zstd,
+		checksums:     config.checksums,
 		readonly:      readonly,
 		maxFileSize:   maxFilesize,
+		remote:        remote,
 	}
 	if err := tab.repair(); err != nil {
 		tab.Close()
@@ -194,27 +249,41 @@ func newTable(path string, name string, readMeter metrics.Meter, writeMeter metr
 	}
 	tab.sizeGauge.Inc(int64(size))
 
+	// Move the sealed data files into the remote store in the background,
+	// including the ones left over from an earlier run.
+	tab.startOffloader()
 	return tab, nil
 }
 
 // repair cross-checks the head and the index file and truncates them to
 // be in sync with each other after a potential crash / data loss.
 func (t *freezerTable) repair() error {
-	// Create a temporary offset buffer to init files with and read indexEntry into
-	buffer := make([]byte, indexEntrySize)
-
-	// If we've just created the files, initialize the index with the 0 indexEntry
+	// Checksums are only stored by tables created with them, existing tables
+	// keep the index format recorded in their metadata
 	stat, err := t.index.Stat()
 	if err != nil {
 		return err
 	}
+	if stat.Size() != 0 {
+		if t.checksums, err = storedChecksums(t.meta); err != nil {
+			return err
+		}
+	}
+	t.indexSize = indexEntrySize
+	if t.checksums {
+		t.indexSize = checksumIndexEntrySize
+	}
+	// Create a temporary offset buffer to init files with and read indexEntry into
+	buffer := make([]byte, t.indexSize)
+
+	// If we've just created the files, initialize the index with the 0 indexEntry
 	if stat.Size() == 0 {
 		if _, err := t.index.Write(buffer); err != nil {
 			return err
 		}
 	}
-	// Ensure the index is a multiple of indexEntrySize bytes
-	if overflow := stat.Size() % indexEntrySize; overflow != 0 {
+	// Ensure the index is a multiple of the index entry size
+	if overflow := stat.Size() % t.indexSize; overflow != 0 {
 		truncateFreezerFile(t.index, stat.Size()-overflow) // New file can't trigger this path
 	}
 	// Retrieve the file sizes and prepare for truncation
@@ -250,11 +319,31 @@ func (t *freezerTable) repair() error {
 	}
 	t.itemHidden = meta.VirtualTail
 
+	// Record the index format of fresh tables in their metadata
+	if meta.Checksums != t.checksums {
+		meta.Checksums = t.checksums
+		if err := writeMetadata(t.meta, meta); err != nil {
+			return err
+		}
+	}
+	t.metadata = meta
+
+	// Items compressed with zstd can only be read with the dictionary, so once
+	// the table has one, it's kept even if the table is configured for snappy.
+	if len(meta.ZstdDict) > 0 && !t.noCompression {
+		if t.codec, err = newZstdCodec(meta.ZstdDict, meta.ZstdFrom); err != nil {
+			return err
+		}
+		if !t.zstd {
+			t.logger.Info("Compressing items with existing zstd dictionary", "from", meta.ZstdFrom)
+		}
+	}
+
 	// Read the last index, use the default value in case the freezer is empty
-	if offsetsSize == indexEntrySize {
+	if offsetsSize == t.indexSize {
 		lastIndex = indexEntry{filenum: t.tailId, offset: 0}
 	} else {
-		t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
+		t.index.ReadAt(buffer, offsetsSize-t.indexSize)
 		lastIndex.unmarshalBinary(buffer)
 	}
 	if t.readonly {
@@ -284,19 +373,19 @@ func (t *freezerTable) repair() error {
 		}
 		// Truncate the index to point within the head file
 		if contentExp > contentSize {
-			t.logger.Warn("Truncating dangling indexes", "indexes", offsetsSize/indexEntrySize, "indexed", contentExp, "stored", contentSize)
-			if err := truncateFreezerFile(t.index, offsetsSize-indexEntrySize); err != nil {
+			t.logger.Warn("Truncating dangling indexes", "indexes", offsetsSize/t.indexSize, "indexed", contentExp, "stored", contentSize)
+			if err := truncateFreezerFile(t.index, offsetsSize-t.indexSize); err != nil {
 				return err
 			}
-			offsetsSize -= indexEntrySize
+			offsetsSize -= t.indexSize
 
 			// Read the new head index, use the default value in case
 			// the freezer is already empty.
 			var newLastIndex indexEntry
-			if offsetsSize == indexEntrySize {
+			if offsetsSize == t.indexSize {
 				newLastIndex = indexEntry{filenum: t.tailId, offset: 0}
 			} else {
-				t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
+				t.index.ReadAt(buffer, offsetsSize-t.indexSize)
 				newLastIndex.unmarshalBinary(buffer)
 			}
 			// We might have slipped back into an earlier head-file here
@@ -331,7 +420,7 @@ func (t *freezerTable) repair() error {
 		}
 	}
 	// Update the item and byte counters and return
-	t.items = t.itemOffset + uint64(offsetsSize/indexEntrySize-1) // last indexEntry points to the end of the data file
+	t.items = t.itemOffset + uint64(offsetsSize/t.indexSize-1) // last indexEntry points to the end of the data file
 	t.headBytes = contentSize
 	t.headId = lastIndex.filenum
 
@@ -363,7 +452,7 @@ func (t *freezerTable) preopen() (err error) {
 
 	// Open all except head in RDONLY
 	for i := t.tailId; i < t.headId; i++ {
-		if _, err = t.openFile(i, openFreezerFileForReadOnly); err != nil {
+		if err = t.openSealedFile(i); err != nil {
 			return err
 		}
 	}
@@ -404,7 +493,7 @@ func (t *freezerTable) truncateHead(items uint64) error {
 	// Truncate the index file first, the tail position is also considered
 	// when calculating the new freezer table length.
 	length := items - atomic.LoadUint64(&t.itemOffset)
-	if err := truncateFreezerFile(t.index, int64(length+1)*indexEntrySize); err != nil {
+	if err := truncateFreezerFile(t.index, int64(length+1)*t.indexSize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
@@ -413,15 +502,20 @@ func (t *freezerTable) truncateHead(items uint64) error {
 		expected = indexEntry{filenum: t.tailId, offset: 0}
 	} else {
 		buffer := make([]byte, indexEntrySize)
-		if _, err := t.index.ReadAt(buffer, int64(length*indexEntrySize)); err != nil {
+		if _, err := t.index.ReadAt(buffer, int64(length)*t.indexSize); err != nil {
 			return err
 		}
 		expected.unmarshalBinary(buffer)
 	}
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
-		// If already open for reading, force-reopen for writing
+		// If already open for reading, force-reopen for writing. Sealed files
+		// may be hard linked by backups, so the file is replaced by a copy of
+		// its retained part instead of being modified in place.
 		t.releaseFile(expected.filenum)
+		if err := t.unshareFile(expected.filenum, int64(expected.offset)); err != nil {
+			return err
+		}
 		newHead, err := t.openFile(expected.filenum, openFreezerFileForAppend)
 		if err != nil {
 			return err
@@ -470,7 +564,7 @@ func (t *freezerTable) truncateTail(items uint64) error {
 		newTailId = t.headId
 	} else {
 		offset := items - atomic.LoadUint64(&t.itemOffset)
-		if _, err := t.index.ReadAt(buffer, int64((offset+1)*indexEntrySize)); err != nil {
+		if _, err := t.index.ReadAt(buffer, int64(offset+1)*t.indexSize); err != nil {
 			return err
 		}
 		var newTail indexEntry
@@ -479,9 +573,11 @@ func (t *freezerTable) truncateTail(items uint64) error {
 	}
 	// Update the virtual tail marker and hidden these entries in table.
 	atomic.StoreUint64(&t.itemHidden, items)
-	if err := writeMetadata(t.meta, newMetadata(items)); err != nil {
+	meta := t.metadata.withTail(items)
+	if err := writeMetadata(t.meta, meta); err != nil {
 		return err
 	}
+	t.metadata = meta
 	// Hidden items still fall in the current tail file, no data file
 	// can be dropped.
 	if t.tailId == newTailId {
@@ -504,7 +600,7 @@ func (t *freezerTable) truncateTail(items uint64) error {
 		deleted    = atomic.LoadUint64(&t.itemOffset)
 	)
 	for current := items - 1; current >= deleted; current -= 1 {
-		if _, err := t.index.ReadAt(buffer, int64((current-deleted+1)*indexEntrySize)); err != nil {
+		if _, err := t.index.ReadAt(buffer, int64(current-deleted+1)*t.indexSize); err != nil {
 			return err
 		}
 		var pre indexEntry
@@ -520,12 +616,12 @@ func (t *freezerTable) truncateTail(items uint64) error {
 		return err
 	}
 	// Truncate the deleted index entries from the index file.
-	err = copyFrom(t.index.Name(), t.index.Name(), indexEntrySize*(newDeleted-deleted+1), func(f *os.File) error {
+	err = copyFrom(t.index.Name(), t.index.Name(), uint64(t.indexSize)*(newDeleted-deleted+1), func(f *os.File) error {
 		tailIndex := indexEntry{
 			filenum: newTailId,
 			offset:  uint32(newDeleted),
 		}
-		_, err := f.Write(tailIndex.append(nil))
+		_, err := f.Write(t.appendIndex(nil, &tailIndex))
 		return err
 	})
 	if err != nil {
@@ -555,6 +651,9 @@ func (t *freezerTable) truncateTail(items uint64) error {
 
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
+	t.stopOffloader()
+	t.dictWg.Wait()
+
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
@@ -580,11 +679,17 @@ func (t *freezerTable) Close() error {
 	// part of t.files, it will be closed in the loop below.
 	doClose(t.head, true, false) // sync but do not close
 	for _, f := range t.files {
-		doClose(f, false, true) // close but do not sync
+		if err := f.Close(); err != nil { // close but do not sync
+			errs = append(errs, err)
+		}
 	}
 	t.index = nil
 	t.meta = nil
 	t.head = nil
+	if t.codec != nil {
+		t.codec.close()
+		t.codec = nil
+	}
 
 	if errs != nil {
 		return fmt.Errorf("%v", errs)
@@ -592,23 +697,37 @@ func (t *freezerTable) Close() error {
 	return nil
 }
 
-// openFile assumes that the write-lock is held by the caller
-func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
-	var exist bool
-	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
+// fileName returns the name of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
+// openFile opens a data file locally, fetching it first from the remote store
+// if it was offloaded. It assumes that the write-lock is held by the caller.
+func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (*os.File, error) {
+	if f, exist := t.files[num]; exist {
+		if f, ok := f.(*os.File); ok {
+			return f, nil
 		}
-		f, err = opener(filepath.Join(t.path, name))
-		if err != nil {
-			return nil, err
+		delete(t.files, num) // Only available remotely, fetch it below
+	}
+	path := filepath.Join(t.path, t.fileName(num))
+	if t.remote != nil {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if err := t.fetchFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
 		}
-		t.files[num] = f
 	}
-	return f, err
+	f, err := opener(path)
+	if err != nil {
+		return nil, err
+	}
+	t.files[num] = f
+	return f, nil
 }
 
 // releaseFile closes a file, and removes it from the open file cache.
@@ -627,7 +746,7 @@ func (t *freezerTable) releaseFilesAfter(num uint32, remove bool) {
 			delete(t.files, fnum)
 			f.Close()
 			if remove {
-				os.Remove(f.Name())
+				t.removeFile(f)
 			}
 		}
 	}
@@ -640,7 +759,7 @@ func (t *freezerTable) releaseFilesBefore(num uint32, remove bool) {
 			delete(t.files, fnum)
 			f.Close()
 			if remove {
-				os.Remove(f.Name())
+				t.removeFile(f)
 			}
 		}
 	}
@@ -656,18 +775,18 @@ func (t *freezerTable) getIndices(from, count uint64) ([]*indexEntry, error) {
 	// Apply the table-offset
 	from = from - t.itemOffset
 	// For reading N items, we need N+1 indices.
-	buffer := make([]byte, (count+1)*indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(from*indexEntrySize)); err != nil {
+	buffer := make([]byte, (count+1)*uint64(t.indexSize))
+	if _, err := t.index.ReadAt(buffer, int64(from)*t.indexSize); err != nil {
 		return nil, err
 	}
 	var (
 		indices []*indexEntry
-		offset  int
+		offset  int64
 	)
 	for i := from; i <= from+count; i++ {
 		index := new(indexEntry)
-		index.unmarshalBinary(buffer[offset:])
-		offset += indexEntrySize
+		t.decodeIndex(buffer[offset:], index)
+		offset += t.indexSize
 		indices = append(indices, index)
 	}
 	if from == 0 {
@@ -682,6 +801,25 @@ func (t *freezerTable) getIndices(from, count uint64) ([]*indexEntry, error) {
 	return indices, nil
 }
 
+// decodeIndex deserializes the index entry at the start of b, including the
+// checksum if the table stores them.
+func (t *freezerTable) decodeIndex(b []byte, entry *indexEntry) {
+	entry.unmarshalBinary(b)
+	if t.checksums {
+		entry.unmarshalChecksum(b)
+	}
+}
+
+// appendIndex adds the encoded index entry to the end of b, including the
+// checksum if the table stores them.
+func (t *freezerTable) appendIndex(b []byte, entry *indexEntry) []byte {
+	b = entry.append(b)
+	if t.checksums {
+		b = entry.appendChecksum(b)
+	}
+	return b
+}
+
 // Retrieve looks up the data offset of an item with the given number and retrieves
 // the raw binary blob from the data file.
 func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
@@ -702,6 +840,10 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 	if err != nil {
 		return nil, err
 	}
+	t.lock.RLock()
+	codec := t.codec
+	t.lock.RUnlock()
+
 	var (
 		output     = make([][]byte, 0, count)
 		offset     int // offset for reading
@@ -711,21 +853,35 @@ func (t *freezerTable) RetrieveItems(start, count, maxBytes uint64) ([][]byte, e
 	for i, diskSize := range sizes {
 		item := diskData[offset : offset+diskSize]
 		offset += diskSize
-		decompressedSize := diskSize
+		var (
+			zstd             = codec != nil && start+uint64(i) >= codec.from
+			decompressedSize = diskSize
+		)
 		if !t.noCompression {
-			decompressedSize, _ = snappy.DecodedLen(item)
+			if zstd {
+				decompressedSize = codec.decompressedLen(item)
+			} else {
+				decompressedSize, _ = snappy.DecodedLen(item)
+			}
 		}
 		if i > 0 && uint64(outputSize+decompressedSize) > maxBytes {
 			break
 		}
-		if !t.noCompression {
+		switch {
+		case t.noCompression:
+			output = append(output, item)
+		case zstd:
+			data, err := codec.decompress(item)
+			if err != nil {
+				return nil, err
+			}
+			output = append(output, data)
+		default:
 			data, err := snappy.Decode(nil, item)
 			if err != nil {
 				return nil, err
 			}
 			output = append(output, data)
-		} else {
-			output = append(output, item)
 		}
 		outputSize += decompressedSize
 	}
@@ -826,9 +982,191 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 			break
 		}
 	}
+	// Verify the read items against their checksums, if the table stores them
+	if t.checksums {
+		var offset int
+		for i, size := range sizes {
+			if crc32.Checksum(output[offset:offset+size], checksumTable) != indices[i+1].checksum {
+				return nil, nil, fmt.Errorf("%w: table %s, item %d", errCorruptedItem, t.name, start+uint64(i))
+			}
+			offset += size
+		}
+	}
 	return output[:outputSize], sizes, nil
 }
 
+// repairItem overwrites the stored content of an item. If the given data
+// compresses to the exact size of the stored item, it's written in place and
+// must match the stored checksum if the table has them. Otherwise the rest of
+// the item's data file is rewritten. Items of tables with a remote store are
+// rejected, as their sealed data files may not be available locally.
+func (t *freezerTable) repairItem(number uint64, data []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil || t.meta == nil {
+		return errClosed
+	}
+	if t.remote != nil {
+		return errRemoteRepair
+	}
+	if !t.has(number) {
+		return errOutOfBounds
+	}
+	indices, err := t.getIndices(number, 1)
+	if err != nil {
+		return err
+	}
+	start, end, fileId := indices[0].bounds(indices[1])
+
+	var blob []byte
+	switch {
+	case t.noCompression:
+		blob = data
+	case t.codec != nil && number >= t.codec.from:
+		blob = t.codec.compress(nil, data)
+	default:
+		blob = snappy.Encode(nil, data)
+	}
+	if len(blob) != int(end-start) {
+		t.logger.Info("Rewriting data file of repaired item", "number", number, "size", len(blob), "stored", end-start)
+		return t.rewriteItem(number, fileId, start, end, blob)
+	}
+	if t.checksums && crc32.Checksum(blob, checksumTable) != indices[1].checksum {
+		return fmt.Errorf("repaired item %d of table %s doesn't match the stored checksum", number, t.name)
+	}
+	// The data files are kept open read-only (except for the head), write the
+	// item through a separate descriptor.
+	f, err := os.OpenFile(filepath.Join(t.path, t.fileName(fileId)), os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(blob, int64(start)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	t.writeMeter.Mark(int64(len(blob)))
+	return f.Close()
+}
+
+// rewriteItem replaces an item whose repaired content differs in size from the
+// stored one, rewriting the rest of its data file and shifting the index entries
+// of the items following it within the file. The data file is replaced by a
+// modified copy, so that hard links of it made by backups aren't affected. A
+// crash between replacing the data file and updating the index leaves the
+// following items of the file misaligned, to be reported by a verification.
+// It assumes that the write-lock is held by the caller.
+func (t *freezerTable) rewriteItem(number uint64, fileId, start, end uint32, blob []byte) error {
+	// Collect the index entries of the item and of the ones following it in the
+	// same data file. The entry at position n+1 marks the end of the n-th item.
+	var (
+		first   = number - t.itemOffset + 1
+		last    = atomic.LoadUint64(&t.items) - t.itemOffset
+		entries []indexEntry
+	)
+	for pos := first; pos <= last; {
+		count := last - pos + 1
+		if count > 1024 {
+			count = 1024
+		}
+		buffer := make([]byte, count*uint64(t.indexSize))
+		if _, err := t.index.ReadAt(buffer, int64(pos)*t.indexSize); err != nil {
+			return err
+		}
+		var done bool
+		for i := uint64(0); i < count && !done; i++ {
+			var entry indexEntry
+			t.decodeIndex(buffer[int64(i)*t.indexSize:], &entry)
+			if done = entry.filenum != fileId; !done {
+				entries = append(entries, entry)
+			}
+		}
+		if done {
+			break
+		}
+		pos += count
+	}
+	fileEnd := entries[len(entries)-1].offset
+
+	// Write the modified copy of the data file and replace the original with it
+	path := filepath.Join(t.path, t.fileName(fileId))
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	err = writeRewrittenFile(tmp, io.NewSectionReader(src, 0, int64(start)), blob, io.NewSectionReader(src, int64(end), int64(fileEnd-end)))
+	src.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Shift the index entries by the size difference of the item
+	delta := int64(len(blob)) - int64(end-start)
+
+	entries[0].checksum = crc32.Checksum(blob, checksumTable)
+	buffer := make([]byte, 0, int64(len(entries))*t.indexSize)
+	for i := range entries {
+		entries[i].offset = uint32(int64(entries[i].offset) + delta)
+		buffer = t.appendIndex(buffer, &entries[i])
+	}
+	if _, err := t.index.WriteAt(buffer, int64(first)*t.indexSize); err != nil {
+		return err
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	// Reopen the replaced data file, continuing to append to it if it's the head
+	t.releaseFile(fileId)
+	if fileId == t.headId {
+		if t.head, err = t.openFile(fileId, openFreezerFileForAppend); err != nil {
+			return err
+		}
+		t.headBytes += delta
+	} else if _, err := t.openFile(fileId, openFreezerFileForReadOnly); err != nil {
+		return err
+	}
+	t.sizeGauge.Inc(delta)
+	t.writeMeter.Mark(int64(len(blob)) + int64(fileEnd-end))
+	return nil
+}
+
+// writeRewrittenFile creates a new data file at path, consisting of the given
+// prefix, the replaced item and the suffix.
+func writeRewrittenFile(path string, prefix io.Reader, blob []byte, suffix io.Reader) error {
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, prefix); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := dst.Write(blob); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := io.Copy(dst, suffix); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
 // has returns an indicator whether the specified number data is still accessible
 // in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
@@ -858,6 +1196,16 @@ func (t *freezerTable) sizeNolock() (uint64, error) {
 // and a new file must be opened. The caller of this method must hold the write-lock
 // before calling this method.
 func (t *freezerTable) advanceHead() error {
+	if err := t.sealHead(); err != nil {
+		return err
+	}
+	// Move the newly sealed file into the remote store, if one's configured.
+	t.queueOffload()
+	return nil
+}
+
+// sealHead seals the current head file and opens the next one.
+func (t *freezerTable) sealHead() error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
@@ -924,18 +1272,22 @@ func (t *freezerTable) dumpIndex(w io.Writer, start, stop int64) {
 	fmt.Fprintf(w, "Version %d count %d, deleted %d, hidden %d\n", meta.Version,
 		atomic.LoadUint64(&t.items), atomic.LoadUint64(&t.itemOffset), atomic.LoadUint64(&t.itemHidden))
 
-	buf := make([]byte, indexEntrySize)
+	buf := make([]byte, t.indexSize)
 
 	fmt.Fprintf(w, "| number | fileno | offset |\n")
 	fmt.Fprintf(w, "|--------|--------|--------|\n")
 
 	for i := uint64(start); ; i++ {
-		if _, err := t.index.ReadAt(buf, int64((i+1)*indexEntrySize)); err != nil {
+		if _, err := t.index.ReadAt(buf, int64(i+1)*t.indexSize); err != nil {
 			break
 		}
 		var entry indexEntry
-		entry.unmarshalBinary(buf)
-		fmt.Fprintf(w, "|  %03d   |  %03d   |  %03d   | \n", i, entry.filenum, entry.offset)
+		t.decodeIndex(buf, &entry)
+		if t.checksums {
+			fmt.Fprintf(w, "|  %03d   |  %03d   |  %03d   | %08x\n", i, entry.filenum, entry.offset, entry.checksum)
+		} else {
+			fmt.Fprintf(w, "|  %03d   |  %03d   |  %03d   | \n", i, entry.filenum, entry.offset)
+		}
 		if stop > 0 && i >= uint64(stop) {
 			break
 		}
@@ -19,6 +19,7 @@ package rawdb
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -824,6 +825,100 @@ func TestTruncateHead(t *testing.T) {
 	})
 }
 
+// Tests that tables with checksums detect corrupted items, that the items can
+// only be repaired with their original content, and that the index format is
+// kept across tail truncations and restarts.
+func TestFreezerTableChecksums(t *testing.T) {
+	t.Parallel()
+	fn := fmt.Sprintf("checksums-%d", rand.Uint64())
+	config := freezerTableConfig{noSnappy: true, checksums: true}
+
+	// Fill a table with 10 items, 3 per data file
+	f, err := newRemoteTable(os.TempDir(), fn, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 50, config, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChunks(t, f, 10, 15)
+
+	// Flip a byte of item 4 on disk
+	indices, err := f.getIndices(4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, _, fileId := indices[0].bounds(indices[1])
+	file, err := os.OpenFile(filepath.Join(f.path, f.fileName(fileId)), os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{0xff}, int64(start)+3); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if _, err := f.Retrieve(4); !errors.Is(err, errCorruptedItem) {
+		t.Fatalf("wrong error for corrupted item: %v", err)
+	}
+	if _, err := f.RetrieveItems(3, 3, 1000); !errors.Is(err, errCorruptedItem) {
+		t.Fatalf("wrong error for range with corrupted item: %v", err)
+	}
+	// Only the original content is accepted as replacement
+	if err := f.repairItem(4, getChunk(15, 5)); err == nil {
+		t.Fatal("repaired item with wrong content")
+	}
+	if err := f.repairItem(4, getChunk(15, 4)); err != nil {
+		t.Fatal("failed to repair item:", err)
+	}
+	checkRetrieve(t, f, map[uint64][]byte{
+		3: getChunk(15, 3),
+		4: getChunk(15, 4),
+		5: getChunk(15, 5),
+	})
+	// Drop the first data file, rewriting the index
+	if err := f.truncateTail(4); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Reopening without checksums configured keeps the table's format
+	f, err = newTable(os.TempDir(), fn, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 50, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.checksums {
+		t.Fatal("table lost its checksums")
+	}
+	batch := f.newBatch()
+	for i := 10; i < 12; i++ {
+		require.NoError(t, batch.AppendRaw(uint64(i), getChunk(15, i)))
+	}
+	require.NoError(t, batch.commit())
+
+	checkRetrieveError(t, f, map[uint64]error{3: errOutOfBounds})
+	for i := 4; i < 12; i++ {
+		checkRetrieve(t, f, map[uint64][]byte{uint64(i): getChunk(15, i)})
+	}
+	f.Close()
+
+	// Tables without checksums aren't converted by enabling them
+	fn = fmt.Sprintf("nochecksums-%d", rand.Uint64())
+	f, err = newTable(os.TempDir(), fn, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 50, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChunks(t, f, 5, 15)
+	f.Close()
+
+	f, err = newRemoteTable(os.TempDir(), fn, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 50, config, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.checksums {
+		t.Fatal("checksums enabled on existing table")
+	}
+	checkRetrieve(t, f, map[uint64][]byte{0: getChunk(15, 0), 4: getChunk(15, 4)})
+}
+
 func checkRetrieve(t *testing.T, f *freezerTable, items map[uint64][]byte) {
 	t.Helper()
 
@@ -32,7 +32,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-var freezerTestTableDef = map[string]bool{"test": true}
+var freezerTestTableDef = map[string]freezerTableConfig{"test": {noSnappy: true, prunable: true}}
 
 func TestFreezerModify(t *testing.T) {
 	t.Parallel()
@@ -48,7 +48,7 @@ func TestFreezerModify(t *testing.T) {
 		valuesRLP = append(valuesRLP, iv)
 	}
 
-	tables := map[string]bool{"raw": true, "rlp": false}
+	tables := map[string]freezerTableConfig{"raw": {noSnappy: true}, "rlp": {noSnappy: false}}
 	f, _ := newFreezerForTesting(t, tables)
 	defer f.Close()
 
@@ -112,7 +112,7 @@ func TestFreezerModifyRollback(t *testing.T) {
 	f.Close()
 
 	// Reopen and check that the rolled-back data doesn't reappear.
-	tables := map[string]bool{"test": true}
+	tables := map[string]freezerTableConfig{"test": {noSnappy: true}}
 	f2, err := NewFreezer(dir, "", false, 2049, tables)
 	if err != nil {
 		t.Fatalf("can't reopen freezer after failed ModifyAncients: %v", err)
@@ -250,7 +250,7 @@ func TestFreezerConcurrentModifyTruncate(t *testing.T) {
 }
 
 func TestFreezerReadonlyValidate(t *testing.T) {
-	tables := map[string]bool{"a": true, "b": true}
+	tables := map[string]freezerTableConfig{"a": {noSnappy: true}, "b": {noSnappy: true}}
 	dir := t.TempDir()
 	// Open non-readonly freezer and fill individual tables
 	// with different amount of data.
@@ -283,7 +283,183 @@ func TestFreezerReadonlyValidate(t *testing.T) {
 	}
 }
 
-func newFreezerForTesting(t *testing.T, tables map[string]bool) (*Freezer, string) {
+func TestFreezerTruncateTailPrunable(t *testing.T) {
+	tables := map[string]freezerTableConfig{"a": {noSnappy: true, prunable: true}, "b": {noSnappy: true}}
+	f, dir := newFreezerForTesting(t, tables)
+
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := uint64(0); i < 10; i++ {
+			for kind := range tables {
+				if err := op.AppendRaw(kind, i, getChunk(32, int(i))); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, f.TruncateTail(5))
+
+	checkTail := func(f *Freezer) {
+		t.Helper()
+		if tail, _ := f.Tail(); tail != 5 {
+			t.Fatalf("wrong tail: have %d, want 5", tail)
+		}
+		for i := uint64(0); i < 10; i++ {
+			if _, err := f.Ancient("a", i); (err == nil) != (i >= 5) {
+				t.Fatalf("prunable item %d: unexpected error %v", i, err)
+			}
+			if _, err := f.Ancient("b", i); err != nil {
+				t.Fatalf("non-prunable item %d: unexpected error %v", i, err)
+			}
+		}
+	}
+	checkTail(f)
+	require.NoError(t, f.Close())
+
+	// The tail must survive both a repair and a readonly validation.
+	f, err = NewFreezer(dir, "", false, 2049, tables)
+	require.NoError(t, err)
+	checkTail(f)
+	require.NoError(t, f.Close())
+
+	f, err = NewFreezer(dir, "", true, 2049, tables)
+	require.NoError(t, err)
+	checkTail(f)
+	require.NoError(t, f.Close())
+
+	// Opening the tables with the pruned one declared non-prunable must fail.
+	_, err = NewFreezer(dir, "", false, 2049, map[string]freezerTableConfig{"a": {noSnappy: true}, "b": {noSnappy: true}})
+	if err == nil {
+		t.Fatal("expected error opening pruned table as non-prunable")
+	}
+}
+
+// Tests that the verification of a chain freezer with checksums reports the
+// corrupted items, and that they're gone once repaired.
+func TestFreezerVerifyAndRepair(t *testing.T) {
+	f, _ := newFreezerForTesting(t, checksumTableConfigs(chainFreezerTableConfigs))
+	defer f.Close()
+
+	item := func(kind string, i int) []byte {
+		return []byte(fmt.Sprintf("%s item %d", kind, i))
+	}
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := 0; i < 100; i++ {
+			for kind := range chainFreezerTableConfigs {
+				if err := op.AppendRaw(kind, uint64(i), item(kind, i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	corrupted, err := VerifyAncients(f)
+	require.NoError(t, err)
+	require.Empty(t, corrupted)
+
+	// Flip a byte of a stored receipt
+	table := f.tables[ChainFreezerReceiptTable]
+	indices, err := table.getIndices(42, 1)
+	require.NoError(t, err)
+	start, _, fileId := indices[0].bounds(indices[1])
+	file, err := os.OpenFile(path.Join(table.path, table.fileName(fileId)), os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte{0xff}, int64(start))
+	require.NoError(t, err)
+	file.Close()
+
+	corrupted, err = VerifyAncients(f)
+	require.NoError(t, err)
+	require.Len(t, corrupted, 1)
+	require.Equal(t, ChainFreezerReceiptTable, corrupted[0].Kind)
+	require.Equal(t, uint64(42), corrupted[0].Number)
+
+	// The list of corrupted items survives in the key-value store
+	db := NewMemoryDatabase()
+	WriteCorruptedAncients(db, corrupted)
+	stored := ReadCorruptedAncients(db)
+	require.Len(t, stored, 1)
+	require.Equal(t, corrupted[0].Kind, stored[0].Kind)
+	require.Equal(t, corrupted[0].Number, stored[0].Number)
+
+	require.NoError(t, f.RepairAncient(ChainFreezerReceiptTable, 42, item(ChainFreezerReceiptTable, 42)))
+	corrupted, err = VerifyAncients(f)
+	require.NoError(t, err)
+	require.Empty(t, corrupted)
+
+	WriteCorruptedAncients(db, corrupted)
+	require.Empty(t, ReadCorruptedAncients(db))
+}
+
+// Tests that repairing an item with content of a different size rewrites the
+// rest of its data file, keeping the following items and the ones in other data
+// files intact, also across a restart.
+func TestFreezerRepairResized(t *testing.T) {
+	tables := checksumTableConfigs(chainFreezerTableConfigs)
+	f, dir := newFreezerForTesting(t, tables)
+
+	items := make(map[uint64][]byte)
+	for i := uint64(0); i < 500; i++ {
+		items[i] = []byte(fmt.Sprintf("receipt item %d", i))
+	}
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := uint64(0); i < 500; i++ {
+			for kind := range tables {
+				if err := op.AppendRaw(kind, i, items[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	table := f.tables[ChainFreezerReceiptTable]
+	require.NotZero(t, table.headId, "items don't span multiple data files")
+
+	// Grow an item in a sealed data file and shrink one in the head file
+	items[42] = bytes.Repeat([]byte("grown receipt item 42"), 4)
+	require.NoError(t, f.RepairAncient(ChainFreezerReceiptTable, 42, items[42]))
+	items[498] = []byte("short")
+	require.NoError(t, f.RepairAncient(ChainFreezerReceiptTable, 498, items[498]))
+
+	check := func() {
+		t.Helper()
+		for i := uint64(0); i < 500; i++ {
+			blob, err := f.Ancient(ChainFreezerReceiptTable, i)
+			require.NoError(t, err)
+			require.Equal(t, items[i], blob, "item %d", i)
+		}
+		corrupted, err := VerifyAncients(f)
+		require.NoError(t, err)
+		require.Empty(t, corrupted)
+	}
+	check()
+
+	// Appending to the rewritten head file must keep working
+	items[500] = []byte("receipt item 500")
+	_, err = f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for kind := range tables {
+			if err := op.AppendRaw(kind, 500, items[500]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	check()
+	require.NoError(t, f.Close())
+
+	f, err = NewFreezer(dir, "", false, 2049, tables)
+	require.NoError(t, err)
+	defer f.Close()
+	check()
+}
+
+func newFreezerForTesting(t *testing.T, tables map[string]freezerTableConfig) (*Freezer, string) {
 	t.Helper()
 
 	dir := t.TempDir()
@@ -410,7 +586,7 @@ func TestRenameWindows(t *testing.T) {
 
 func TestFreezerCloseSync(t *testing.T) {
 	t.Parallel()
-	f, _ := newFreezerForTesting(t, map[string]bool{"a": true, "b": true})
+	f, _ := newFreezerForTesting(t, map[string]freezerTableConfig{"a": {noSnappy: true}, "b": {noSnappy: true}})
 	defer f.Close()
 
 	// Now, close and sync. This mimics the behaviour if the node is shut down,
@@ -72,6 +72,17 @@ var (
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
+	// txTraceTailKey tracks the oldest block whose stored traces may not have been pruned.
+	txTraceTailKey = []byte("TransactionTraceTail")
+
+	// txIndexConfigKey tracks the transaction indexing modes the indices were
+	// last maintained with.
+	txIndexConfigKey = []byte("TransactionIndexConfig")
+
+	// txIndexStaleKey flags that the transaction indices were built with other
+	// indexing modes than the configured ones, until rebuilt by reindexing.
+	txIndexStaleKey = []byte("TransactionIndexStale")
+
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
@@ -84,6 +95,13 @@ var (
 	// transitionStatusKey tracks the eth2 transition status.
 	transitionStatusKey = []byte("eth2-transition")
 
+	// databaseSizesKey tracks the live size counters of the key-value store.
+	databaseSizesKey = []byte("DatabaseSizes")
+
+	// corruptedAncientsKey tracks the ancient items found corrupted, until
+	// they're repaired.
+	corruptedAncientsKey = []byte("CorruptedAncients")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -94,6 +112,7 @@ var (
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 
 	txLookupPrefix        = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
+	txSenderPrefix        = []byte("x") // txSenderPrefix + sender + num (uint64 big endian) + index (uint32 big endian) -> transaction hash
 	bloomBitsPrefix       = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
@@ -105,6 +124,7 @@ var (
 	trieNodeStoragePrefix = []byte("O") // trieNodeStoragePrefix + accountHash + hexPath -> trie node
 
 	PreimagePrefix = []byte("secure-key-")       // PreimagePrefix + hash -> preimage
+	txTracePrefix  = []byte("trace-")            // txTracePrefix + block hash + tx index (uint32 big endian) + tracer name -> trace result
 	configPrefix   = []byte("ethereum-config-")  // config prefix for the db
 	genesisPrefix  = []byte("ethereum-genesis-") // genesis state prefix for the db
 
@@ -180,6 +200,27 @@ func txLookupKey(hash common.Hash) []byte {
 	return append(txLookupPrefix, hash.Bytes()...)
 }
 
+// txSenderKey = txSenderPrefix + sender + num (uint64 big endian) + index (uint32 big endian)
+func txSenderKey(sender common.Address, number uint64, index int) []byte {
+	key := make([]byte, 0, len(txSenderPrefix)+common.AddressLength+8+4)
+	key = append(append(key, txSenderPrefix...), sender.Bytes()...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return binary.BigEndian.AppendUint32(key, uint32(index))
+}
+
+// txTraceBlockPrefix = txTracePrefix + block hash
+func txTraceBlockPrefix(blockHash common.Hash) []byte {
+	return append(append([]byte{}, txTracePrefix...), blockHash.Bytes()...)
+}
+
+// txTraceKey = txTracePrefix + block hash + tx index (uint32 big endian) + tracer name
+func txTraceKey(blockHash common.Hash, index int, tracer string) []byte {
+	key := make([]byte, 0, len(txTracePrefix)+common.HashLength+4+len(tracer))
+	key = append(append(key, txTracePrefix...), blockHash.Bytes()...)
+	key = binary.BigEndian.AppendUint32(key, uint32(index))
+	return append(key, tracer...)
+}
+
 // accountSnapshotKey = SnapshotAccountPrefix + hash
 func accountSnapshotKey(hash common.Hash) []byte {
 	return append(SnapshotAccountPrefix, hash.Bytes()...)
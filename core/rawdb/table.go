@@ -119,6 +119,12 @@ func (t *table) MigrateTable(kind string, convert convertLegacyFn) error {
 	return t.db.MigrateTable(kind, convert)
 }
 
+// RepairAncient is a noop passthrough that just forwards the request to the
+// underlying database.
+func (t *table) RepairAncient(kind string, number uint64, item []byte) error {
+	return t.db.RepairAncient(kind, number, item)
+}
+
 // AncientDatadir returns the ancient datadir of the underlying database.
 func (t *table) AncientDatadir() (string, error) {
 	return t.db.AncientDatadir()
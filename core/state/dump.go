@@ -19,6 +19,7 @@ package state
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -123,6 +124,49 @@ func (d iterativeDump) OnRoot(root common.Hash) {
 	}{root})
 }
 
+// streamedDump is a DumpCollector-implementation which writes the dump in the
+// format of Dump, without collecting the accounts in memory.
+type streamedDump struct {
+	w     io.Writer
+	count int
+	err   error // First error encountered while writing
+}
+
+// OnRoot implements DumpCollector interface
+func (d *streamedDump) OnRoot(root common.Hash) {
+	d.write([]byte(fmt.Sprintf(`{"root":"%x","accounts":{`, root)))
+}
+
+// OnAccount implements DumpCollector interface
+func (d *streamedDump) OnAccount(addr common.Address, account DumpAccount) {
+	if d.err != nil {
+		return
+	}
+	key, err := json.Marshal(addr)
+	if err != nil {
+		d.err = err
+		return
+	}
+	value, err := json.Marshal(account)
+	if err != nil {
+		d.err = err
+		return
+	}
+	if d.count > 0 {
+		d.write([]byte{','})
+	}
+	d.write(key)
+	d.write([]byte{':'})
+	d.write(value)
+	d.count++
+}
+
+func (d *streamedDump) write(b []byte) {
+	if d.err == nil {
+		_, d.err = d.w.Write(b)
+	}
+}
+
 // DumpToCollector iterates the state according to the given options and inserts
 // the items into a collector for aggregation or serialization.
 func (s *StateDB) DumpToCollector(c DumpCollector, conf *DumpConfig) (nextKey []byte) {
@@ -225,6 +269,15 @@ func (s *StateDB) Dump(opts *DumpConfig) []byte {
 	return json
 }
 
+// StreamDump writes the state to w as a single json-object in the format of
+// RawDump, encoding the accounts one by one instead of collecting them first.
+func (s *StateDB) StreamDump(opts *DumpConfig, w io.Writer) error {
+	dump := &streamedDump{w: w}
+	s.DumpToCollector(dump, opts)
+	dump.write([]byte("}}"))
+	return dump.err
+}
+
 // IterativeDump dumps out accounts as json-objects, delimited by linebreaks on stdout
 func (s *StateDB) IterativeDump(opts *DumpConfig, output *json.Encoder) {
 	s.DumpToCollector(iterativeDump{output}, opts)
@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
@@ -62,6 +63,7 @@ type StateDB struct {
 	prefetcher *triePrefetcher
 	trie       Trie
 	hasher     crypto.KeccakState
+	logger     tracing.StateLogger
 
 	// originalRoot is the pre-state root, before any changes were made.
 	// It will be updated when the Commit is called.
@@ -158,6 +160,12 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 	return sdb, nil
 }
 
+// SetLogger sets the logger which is notified of all state modifications. The
+// logger is not inherited by copies of the state.
+func (s *StateDB) SetLogger(l tracing.StateLogger) {
+	s.logger = l
+}
+
 // StartPrefetcher initializes a new trie prefetcher to pull in nodes from the
 // state trie concurrently while the state is mutated so that when we reach the
 // commit phase, most of the needed data is already hot.
@@ -199,6 +207,10 @@ func (s *StateDB) AddLog(log *types.Log) {
 	log.Index = s.logSize
 	s.logs[s.thash] = append(s.logs[s.thash], log)
 	s.logSize++
+
+	if s.logger != nil {
+		s.logger.OnLog(log)
+	}
 }
 
 // GetLogs returns the logs matching the specified transaction hash, and annotates
@@ -391,25 +403,25 @@ func (s *StateDB) HasSuicided(addr common.Address) bool {
  */
 
 // AddBalance adds amount to the account associated with addr.
-func (s *StateDB) AddBalance(addr common.Address, amount *big.Int) {
+func (s *StateDB) AddBalance(addr common.Address, amount *big.Int, reason tracing.BalanceChangeReason) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
-		stateObject.AddBalance(amount)
+		stateObject.AddBalance(amount, reason)
 	}
 }
 
 // SubBalance subtracts amount from the account associated with addr.
-func (s *StateDB) SubBalance(addr common.Address, amount *big.Int) {
+func (s *StateDB) SubBalance(addr common.Address, amount *big.Int, reason tracing.BalanceChangeReason) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
-		stateObject.SubBalance(amount)
+		stateObject.SubBalance(amount, reason)
 	}
 }
 
 func (s *StateDB) SetBalance(addr common.Address, amount *big.Int) {
 	stateObject := s.GetOrNewStateObject(addr)
 	if stateObject != nil {
-		stateObject.SetBalance(amount)
+		stateObject.SetBalance(amount, tracing.BalanceChangeUnspecified)
 	}
 }
 
@@ -465,6 +477,9 @@ func (s *StateDB) Suicide(addr common.Address) bool {
 		prevbalance: new(big.Int).Set(stateObject.Balance()),
 	})
 	stateObject.markSuicided()
+	if s.logger != nil && stateObject.data.Balance.Sign() != 0 {
+		s.logger.OnBalanceChange(addr, stateObject.data.Balance, new(big.Int), tracing.BalanceDecreaseSelfdestruct)
+	}
 	stateObject.data.Balance = new(big.Int)
 
 	return true
@@ -798,6 +813,42 @@ func (s *StateDB) Copy() *StateDB {
 	return state
 }
 
+// CopySize returns an estimate of the memory held by a copy of the state. A copy
+// carries the accounts modified since the state was opened, along with their
+// cached storage and code, and the logs. It's meant for callers keeping many
+// copies around at once, like the tracers preparing the state of every
+// transaction of a block, to bound their memory usage.
+func (s *StateDB) CopySize() common.StorageSize {
+	const (
+		accountSize = 256 // Rough size of a copied state object
+		slotSize    = 96  // Rough size of a cached storage slot
+		logSize     = 256 // Rough size of a copied log, excluding its data
+	)
+	var size common.StorageSize
+	add := func(addr common.Address) {
+		obj, ok := s.stateObjects[addr]
+		if !ok {
+			return
+		}
+		slots := len(obj.originStorage) + len(obj.pendingStorage) + len(obj.dirtyStorage)
+		size += common.StorageSize(accountSize + slots*slotSize + len(obj.code))
+	}
+	for addr := range s.stateObjectsDirty {
+		add(addr)
+	}
+	for addr := range s.journal.dirties {
+		if _, ok := s.stateObjectsDirty[addr]; !ok {
+			add(addr)
+		}
+	}
+	for _, logs := range s.logs {
+		for _, log := range logs {
+			size += common.StorageSize(logSize + len(log.Data))
+		}
+	}
+	return size
+}
+
 // Snapshot returns an identifier for the current revision of the state.
 func (s *StateDB) Snapshot() int {
 	id := s.nextRevisionId
@@ -844,6 +895,10 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 			continue
 		}
 		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
+			// Ether sent to a selfdestructed account is destroyed along with it.
+			if obj.suicided && s.logger != nil && obj.Balance().Sign() != 0 {
+				s.logger.OnBalanceChange(obj.address, obj.Balance(), new(big.Int), tracing.BalanceDecreaseSelfdestructBurn)
+			}
 			obj.deleted = true
 
 			// We need to maintain account deletions explicitly (will remain
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	cmath "github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/params"
@@ -270,7 +271,7 @@ func (st *StateTransition) buyGas() error {
 
 	// deduct the total gas fee (regular + data) from the sender's balance
 	mgval.Add(mgval, dgval)
-	st.state.SubBalance(st.msg.From, mgval)
+	st.state.SubBalance(st.msg.From, mgval, tracing.BalanceDecreaseGasBuy)
 	return nil
 }
 
@@ -367,6 +368,7 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 			st.evm.Config.Tracer.CaptureTxEnd(st.gasRemaining)
 		}()
 	}
+	st.gasChange(0, st.gasRemaining, tracing.GasChangeTxInitialBalance)
 
 	var (
 		msg              = st.msg
@@ -383,6 +385,7 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 	if st.gasRemaining < gas {
 		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, st.gasRemaining, gas)
 	}
+	st.gasChange(st.gasRemaining, st.gasRemaining-gas, tracing.GasChangeTxIntrinsicGas)
 	st.gasRemaining -= gas
 
 	// Check clause 6
@@ -431,7 +434,7 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 	} else {
 		fee := new(big.Int).SetUint64(st.gasUsed())
 		fee.Mul(fee, effectiveTip)
-		st.state.AddBalance(st.evm.Context.Coinbase, fee)
+		st.state.AddBalance(st.evm.Context.Coinbase, fee, tracing.BalanceIncreaseRewardTransactionFee)
 	}
 
 	return &ExecutionResult{
@@ -447,17 +450,30 @@ func (st *StateTransition) refundGas(refundQuotient uint64) {
 	if refund > st.state.GetRefund() {
 		refund = st.state.GetRefund()
 	}
+	st.gasChange(st.gasRemaining, st.gasRemaining+refund, tracing.GasChangeTxRefunds)
 	st.gasRemaining += refund
 
 	// Return ETH for remaining gas, exchanged at the original rate.
 	remaining := new(big.Int).Mul(new(big.Int).SetUint64(st.gasRemaining), st.msg.GasPrice)
-	st.state.AddBalance(st.msg.From, remaining)
+	st.state.AddBalance(st.msg.From, remaining, tracing.BalanceIncreaseGasReturn)
+	st.gasChange(st.gasRemaining, 0, tracing.GasChangeTxLeftOverReturned)
 
 	// Also return remaining gas to the block gas counter so it is
 	// available for the next transaction.
 	st.gp.AddGas(st.gasRemaining)
 }
 
+// gasChange reports a change of the gas available to the transaction to the
+// tracer, if it is interested in such changes.
+func (st *StateTransition) gasChange(old, new uint64, reason tracing.GasChangeReason) {
+	if !st.evm.Config.Debug || old == new {
+		return
+	}
+	if logger, ok := st.evm.Config.Tracer.(tracing.GasLogger); ok {
+		logger.OnGasChange(old, new, reason)
+	}
+}
+
 // gasUsed returns the amount of gas used up by the state transition.
 func (st *StateTransition) gasUsed() uint64 {
 	return st.msg.GasLimit - st.gasRemaining
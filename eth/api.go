@@ -243,6 +243,27 @@ func (api *AdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// BackupDatabase creates a consistent backup of the chain database in the given
+// directory on the node's file system, which must either not exist or be empty.
+// Freezing is paused until the copy is complete.
+func (api *AdminAPI) BackupDatabase(dir string) (*rawdb.BackupManifest, error) {
+	return rawdb.Backup(api.eth.ChainDb(), dir)
+}
+
+// DatabaseSizes returns the number of entries and their total size in each data
+// category of the chain database. It requires the node to be started with size
+// tracking enabled.
+func (api *AdminAPI) DatabaseSizes() (*rawdb.DatabaseSizes, error) {
+	return rawdb.ReadDatabaseSizes(api.eth.ChainDb())
+}
+
+// RepairAncients refetches the corrupted ancient bodies and receipts found by
+// `geth db verify-ancients` from the connected peers, returning the number of
+// repaired items.
+func (api *AdminAPI) RepairAncients() (int, error) {
+	return api.eth.Downloader().RepairAncients()
+}
+
 // DebugAPI is the collection of Ethereum full node APIs for debugging the
 // protocol.
 type DebugAPI struct {
@@ -254,41 +275,46 @@ func NewDebugAPI(eth *Ethereum) *DebugAPI {
 	return &DebugAPI{eth: eth}
 }
 
-// DumpBlock retrieves the entire state of the database at a given block.
-func (api *DebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error) {
+// DumpBlock retrieves the entire state of the database at a given block. The
+// accounts are streamed to the client while the state is iterated.
+func (api *DebugAPI) DumpBlock(blockNr rpc.BlockNumber) (rpc.TypedStreamFunc[state.Dump], error) {
 	opts := &state.DumpConfig{
 		OnlyWithAddresses: true,
 		Max:               AccountRangeMaxResults, // Sanity limit over RPC
 	}
+	var stateDb *state.StateDB
 	if blockNr == rpc.PendingBlockNumber {
 		// If we're dumping the pending state, we need to request
 		// both the pending block as well as the pending state from
 		// the miner and operate on those
-		_, stateDb := api.eth.miner.Pending()
-		return stateDb.RawDump(opts), nil
-	}
-	var header *types.Header
-	if blockNr == rpc.LatestBlockNumber {
-		header = api.eth.blockchain.CurrentBlock()
-	} else if blockNr == rpc.FinalizedBlockNumber {
-		header = api.eth.blockchain.CurrentFinalBlock()
-	} else if blockNr == rpc.SafeBlockNumber {
-		header = api.eth.blockchain.CurrentSafeBlock()
+		_, stateDb = api.eth.miner.Pending()
 	} else {
-		block := api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
-		if block == nil {
-			return state.Dump{}, fmt.Errorf("block #%d not found", blockNr)
+		var header *types.Header
+		if blockNr == rpc.LatestBlockNumber {
+			header = api.eth.blockchain.CurrentBlock()
+		} else if blockNr == rpc.FinalizedBlockNumber {
+			header = api.eth.blockchain.CurrentFinalBlock()
+		} else if blockNr == rpc.SafeBlockNumber {
+			header = api.eth.blockchain.CurrentSafeBlock()
+		} else {
+			block := api.eth.blockchain.GetBlockByNumber(uint64(blockNr))
+			if block == nil {
+				return nil, fmt.Errorf("block #%d not found", blockNr)
+			}
+			header = block.Header()
+		}
+		if header == nil {
+			return nil, fmt.Errorf("block #%d not found", blockNr)
+		}
+		var err error
+		stateDb, err = api.eth.BlockChain().StateAt(header.Root)
+		if err != nil {
+			return nil, err
 		}
-		header = block.Header()
-	}
-	if header == nil {
-		return state.Dump{}, fmt.Errorf("block #%d not found", blockNr)
-	}
-	stateDb, err := api.eth.BlockChain().StateAt(header.Root)
-	if err != nil {
-		return state.Dump{}, err
 	}
-	return stateDb.RawDump(opts), nil
+	return func(w io.Writer) error {
+		return stateDb.StreamDump(opts, w)
+	}, nil
 }
 
 // Preimage is a debug API function that returns the preimage for a sha3 hash, if known.
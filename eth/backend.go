@@ -18,6 +18,7 @@
 package eth
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -43,6 +44,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/eth/protocols/snap"
+	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
@@ -191,8 +193,39 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			HistoryCutoff:       config.HistoryCutoff,
+			TxIndex: rawdb.TxIndexConfig{
+				Senders: config.TxIndexSenders,
+			},
 		}
 	)
+	if len(config.TxIndexAddresses) > 0 {
+		cacheConfig.TxIndex.Addresses = make(map[common.Address]struct{}, len(config.TxIndexAddresses))
+		for _, addr := range config.TxIndexAddresses {
+			cacheConfig.TxIndex.Addresses[addr] = struct{}{}
+		}
+	}
+	if config.VMTrace != "" {
+		var traceConfig json.RawMessage
+		if config.VMTraceJsonConfig != "" {
+			traceConfig = json.RawMessage(config.VMTraceJsonConfig)
+		}
+		tracer, err := tracers.LiveDirectory.New(config.VMTrace, traceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tracer %s: %v", config.VMTrace, err)
+		}
+		vmConfig.Tracer = tracer
+	}
+	if len(config.StoredTracers) > 0 {
+		if vmConfig.Tracer != nil {
+			return nil, errors.New("trace storage can't be combined with a live tracer")
+		}
+		logger, err := tracers.NewStoreLogger(chainDb, config.StoredTracers, config.StoredTracesRetention)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up trace storage: %v", err)
+		}
+		vmConfig.Tracer = logger
+	}
 	// Override the chain config with provided settings.
 	var overrides core.ChainOverrides
 	if config.OverrideShanghai != nil {
@@ -229,6 +262,9 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}); err != nil {
 		return nil, err
 	}
+	if corrupted := rawdb.ReadCorruptedAncients(chainDb); len(corrupted) > 0 {
+		log.Warn("Corrupted ancient items found, run admin.repairAncients() once peers are connected", "items", len(corrupted))
+	}
 
 	eth.miner = miner.New(eth, &config.Miner, eth.blockchain.Config(), eth.EventMux(), eth.engine, eth.isLocalBlock)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
@@ -0,0 +1,238 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// repairBatchSize is the number of corrupted ancient items requested from a
+// peer at once.
+const repairBatchSize = 64
+
+// errNoRepairPeers is returned if corrupted ancient items are to be repaired
+// without any connected peers to refetch them from.
+var errNoRepairPeers = errors.New("no peers to refetch corrupted ancients from")
+
+// repairFetcher retrieves the given blocks' items from a peer, returning them in
+// their storage encoding. Items not served or not matching the header are nil.
+type repairFetcher func(p *peerConnection, headers []*types.Header) ([][]byte, error)
+
+// RepairAncients refetches the corrupted ancient bodies and receipts, as recorded
+// by the last verification of the freezer, from the connected peers and overwrites
+// them. Items which can't be repaired, including the ones of tables offloaded to
+// a remote store, are kept in the list for a later attempt. It returns the number
+// of repaired items.
+func (d *Downloader) RepairAncients() (int, error) {
+	corrupted := rawdb.ReadCorruptedAncients(d.stateDB)
+	if len(corrupted) == 0 {
+		return 0, nil
+	}
+	if d.peers.Len() == 0 {
+		return 0, errNoRepairPeers
+	}
+	// Only bodies and receipts can be verified against the local headers
+	var (
+		remaining []rawdb.CorruptedAncient
+		headers   = make(map[string][]*types.Header)
+	)
+	for _, item := range corrupted {
+		var header *types.Header
+		if item.Kind == rawdb.ChainFreezerBodiesTable || item.Kind == rawdb.ChainFreezerReceiptTable {
+			header = rawdb.ReadHeader(d.stateDB, rawdb.ReadCanonicalHash(d.stateDB, item.Number), item.Number)
+		}
+		if header == nil {
+			log.Warn("Corrupted ancient item can't be refetched", "kind", item.Kind, "number", item.Number)
+			remaining = append(remaining, item)
+			continue
+		}
+		headers[item.Kind] = append(headers[item.Kind], header)
+	}
+	var repaired int
+	for kind, fetch := range map[string]repairFetcher{
+		rawdb.ChainFreezerBodiesTable:  d.fetchRepairBodies,
+		rawdb.ChainFreezerReceiptTable: d.fetchRepairReceipts,
+	} {
+		failed := d.repairAncients(kind, headers[kind], fetch)
+		repaired += len(headers[kind]) - len(failed)
+		for _, header := range failed {
+			remaining = append(remaining, rawdb.CorruptedAncient{Kind: kind, Number: header.Number.Uint64()})
+		}
+	}
+	rawdb.WriteCorruptedAncients(d.stateDB, remaining)
+	log.Info("Repaired corrupted ancients", "repaired", repaired, "remaining", len(remaining))
+	return repaired, nil
+}
+
+// repairAncients refetches the given blocks' items of a freezer table from the
+// connected peers, trying the next peer for the items one didn't serve. It
+// returns the headers of the blocks which couldn't be repaired.
+func (d *Downloader) repairAncients(kind string, headers []*types.Header, fetch repairFetcher) []*types.Header {
+	for _, p := range d.peers.AllPeers() {
+		if len(headers) == 0 {
+			break
+		}
+		if _, ok := p.peer.(*lightPeerWrapper); ok {
+			continue
+		}
+		var failed []*types.Header
+		for start := 0; start < len(headers); start += repairBatchSize {
+			end := start + repairBatchSize
+			if end > len(headers) {
+				end = len(headers)
+			}
+			batch := headers[start:end]
+
+			items, err := fetch(p, batch)
+			if err != nil {
+				p.log.Debug("Failed to refetch corrupted ancients", "kind", kind, "err", err)
+				failed = append(failed, batch...)
+				continue
+			}
+			for i, header := range batch {
+				if items[i] == nil {
+					failed = append(failed, header)
+					continue
+				}
+				if err := d.stateDB.RepairAncient(kind, header.Number.Uint64(), items[i]); err != nil {
+					log.Warn("Failed to repair ancient item", "kind", kind, "number", header.Number, "err", err)
+					failed = append(failed, header)
+					continue
+				}
+				log.Info("Repaired corrupted ancient item", "kind", kind, "number", header.Number, "peer", p.id)
+			}
+		}
+		headers = failed
+	}
+	return headers
+}
+
+// fetchRepairBodies retrieves the bodies of the given blocks from a peer,
+// returning the ones matching their headers RLP encoded for storage.
+func (d *Downloader) fetchRepairBodies(p *peerConnection, headers []*types.Header) ([][]byte, error) {
+	hashes := make([]common.Hash, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash()
+	}
+	res, err := d.fetchRepairItems(p, hashes, p.peer.RequestBodies)
+	if err != nil {
+		return nil, err
+	}
+	bodyInMeter.Mark(int64(len(*res.Res.(*eth.BlockBodiesPacket))))
+
+	var (
+		txs, uncles, withdrawals = res.Res.(*eth.BlockBodiesPacket).Unpack()
+		roots                    = res.Meta.([][]common.Hash)
+		items                    = make([][]byte, len(headers))
+	)
+	for i := 0; i < len(headers) && i < len(txs); i++ {
+		header := headers[i]
+		if roots[0][i] != header.TxHash || roots[1][i] != header.UncleHash {
+			continue
+		}
+		if (header.WithdrawalsHash == nil) != (withdrawals[i] == nil) {
+			continue
+		}
+		if header.WithdrawalsHash != nil && roots[2][i] != *header.WithdrawalsHash {
+			continue
+		}
+		blob, err := rlp.EncodeToBytes(&types.Body{Transactions: txs[i], Uncles: uncles[i], Withdrawals: withdrawals[i]})
+		if err != nil {
+			return nil, err
+		}
+		items[i] = blob
+	}
+	return items, nil
+}
+
+// fetchRepairReceipts retrieves the receipts of the given blocks from a peer,
+// returning the ones matching their headers RLP encoded for storage.
+func (d *Downloader) fetchRepairReceipts(p *peerConnection, headers []*types.Header) ([][]byte, error) {
+	hashes := make([]common.Hash, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash()
+	}
+	res, err := d.fetchRepairItems(p, hashes, p.peer.RequestReceipts)
+	if err != nil {
+		return nil, err
+	}
+	receiptInMeter.Mark(int64(len(*res.Res.(*eth.ReceiptsPacket))))
+
+	var (
+		receipts = *res.Res.(*eth.ReceiptsPacket)
+		roots    = res.Meta.([]common.Hash)
+		items    = make([][]byte, len(headers))
+	)
+	for i := 0; i < len(headers) && i < len(receipts); i++ {
+		if roots[i] != headers[i].ReceiptHash {
+			continue
+		}
+		stored := make([]*types.ReceiptForStorage, len(receipts[i]))
+		for j, receipt := range receipts[i] {
+			stored[j] = (*types.ReceiptForStorage)(receipt)
+		}
+		blob, err := rlp.EncodeToBytes(stored)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = blob
+	}
+	return items, nil
+}
+
+// fetchRepairItems is a blocking version of the peer's body or receipt request,
+// handling the interruption and timeout of the retrieval. Unlike the sync
+// fetchers it's not tied to a running sync, only to the downloader's lifetime.
+func (d *Downloader) fetchRepairItems(p *peerConnection, hashes []common.Hash, request func([]common.Hash, chan *eth.Response) (*eth.Request, error)) (*eth.Response, error) {
+	// Create the response sink and send the network request
+	resCh := make(chan *eth.Response)
+
+	req, err := request(hashes, resCh)
+	if err != nil {
+		return nil, err
+	}
+	defer req.Close()
+
+	// Wait until the response arrives, the downloader terminates or times out
+	ttl := d.peers.rates.TargetTimeout()
+
+	timeoutTimer := time.NewTimer(ttl)
+	defer timeoutTimer.Stop()
+
+	select {
+	case <-d.quitCh:
+		return nil, errCanceled
+
+	case <-timeoutTimer.C:
+		p.log.Debug("Corrupted ancients request timed out", "elapsed", ttl)
+		return nil, errTimeout
+
+	case res := <-resCh:
+		// Don't reject the packet even if it turns out to be bad, the items
+		// are checked against the headers by the caller
+		res.Done <- nil
+		return res, nil
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/golang/snappy"
+)
+
+// freezeTestChain writes the first blocks of the base test chain into the
+// ancient store of the tester, along with their receipts as served by the peer.
+func freezeTestChain(t *testing.T, tester *downloadTester, peer *downloadTesterPeer, length int) {
+	t.Helper()
+
+	blocks := testChainBase.blocks[:length]
+	receipts := make([]types.Receipts, len(blocks))
+	for i, block := range blocks {
+		receipts[i] = peer.chain.GetReceiptsByHash(block.Hash())
+	}
+	if _, err := rawdb.WriteAncientBlocks(tester.downloader.stateDB, blocks, receipts, big.NewInt(0)); err != nil {
+		t.Fatalf("failed to freeze test chain: %v", err)
+	}
+}
+
+// corruptAncient overwrites the stored bytes of an ancient item in its data file,
+// so that it fails decompression.
+func corruptAncient(t *testing.T, tester *downloadTester, kind string, number uint64) {
+	t.Helper()
+
+	item, err := tester.downloader.stateDB.Ancient(kind, number)
+	if err != nil {
+		t.Fatalf("failed to read %s item %d: %v", kind, number, err)
+	}
+	stored := snappy.Encode(nil, item)
+
+	for _, dir := range []string{tester.freezer, filepath.Join(tester.freezer, "chain")} {
+		path := filepath.Join(dir, fmt.Sprintf("%s.0000.cdat", kind))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		offset := bytes.Index(data, stored)
+		if offset < 0 {
+			t.Fatalf("%s item %d not found in data file", kind, number)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteAt(bytes.Repeat([]byte{0xff}, len(stored)), int64(offset)); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	t.Fatalf("data file of %s not found", kind)
+}
+
+// Tests that corrupted ancient bodies and receipts are refetched from a peer and
+// overwritten with their original content.
+func TestRepairAncients(t *testing.T) {
+	tester := newTester(t)
+	defer tester.terminate()
+
+	peer := tester.newPeer("peer", eth.ETH67, testChainBase.blocks[1:])
+	freezeTestChain(t, tester, peer, 64)
+
+	// Corrupt blocks containing transactions, so that their items are unique
+	db := tester.downloader.stateDB
+	body, _ := db.Ancient(rawdb.ChainFreezerBodiesTable, 23)
+	receipts, _ := db.Ancient(rawdb.ChainFreezerReceiptTable, 1)
+
+	corruptAncient(t, tester, rawdb.ChainFreezerBodiesTable, 23)
+	corruptAncient(t, tester, rawdb.ChainFreezerReceiptTable, 1)
+
+	corrupted, err := rawdb.VerifyAncients(db)
+	if err != nil {
+		t.Fatalf("failed to verify ancients: %v", err)
+	}
+	if len(corrupted) != 2 {
+		t.Fatalf("corrupted item count mismatch: have %d, want %d", len(corrupted), 2)
+	}
+	rawdb.WriteCorruptedAncients(db, corrupted)
+
+	repaired, err := tester.downloader.RepairAncients()
+	if err != nil {
+		t.Fatalf("failed to repair ancients: %v", err)
+	}
+	if repaired != 2 {
+		t.Fatalf("repaired item count mismatch: have %d, want %d", repaired, 2)
+	}
+	if remaining := rawdb.ReadCorruptedAncients(db); len(remaining) != 0 {
+		t.Fatalf("corrupted items remained: %v", remaining)
+	}
+	if corrupted, err := rawdb.VerifyAncients(db); err != nil || len(corrupted) != 0 {
+		t.Fatalf("corrupted items after repair: %v, err %v", corrupted, err)
+	}
+	if have, _ := db.Ancient(rawdb.ChainFreezerBodiesTable, 23); !bytes.Equal(have, body) {
+		t.Fatalf("repaired body mismatch: have %x, want %x", have, body)
+	}
+	if have, _ := db.Ancient(rawdb.ChainFreezerReceiptTable, 1); !bytes.Equal(have, receipts) {
+		t.Fatalf("repaired receipts mismatch: have %x, want %x", have, receipts)
+	}
+}
+
+// Tests that the corrupted items are kept for a later attempt if there are no
+// peers to refetch them from, or the peers don't serve them.
+func TestRepairAncientsUnavailable(t *testing.T) {
+	tester := newTester(t)
+	defer tester.terminate()
+
+	// Freeze the test chain with a corrupted body, but don't connect any peer
+	seeder := newTester(t)
+	defer seeder.terminate()
+	peer := seeder.newPeer("seeder", eth.ETH67, testChainBase.blocks[1:])
+	freezeTestChain(t, tester, peer, 64)
+
+	db := tester.downloader.stateDB
+	corruptAncient(t, tester, rawdb.ChainFreezerBodiesTable, 23)
+	rawdb.WriteCorruptedAncients(db, []rawdb.CorruptedAncient{{Kind: rawdb.ChainFreezerBodiesTable, Number: 23}})
+
+	if _, err := tester.downloader.RepairAncients(); err != errNoRepairPeers {
+		t.Fatalf("repair error mismatch: have %v, want %v", err, errNoRepairPeers)
+	}
+	// Connect a peer without the blocks of the corrupted items
+	tester.newPeer("empty", eth.ETH67, testChainBase.shorten(1).blocks[1:])
+	repaired, err := tester.downloader.RepairAncients()
+	if err != nil {
+		t.Fatalf("failed to repair ancients: %v", err)
+	}
+	if repaired != 0 {
+		t.Fatalf("repaired item count mismatch: have %d, want %d", repaired, 0)
+	}
+	if remaining := rawdb.ReadCorruptedAncients(db); len(remaining) != 1 || remaining[0].Number != 23 {
+		t.Fatalf("corrupted items mismatch: have %v", remaining)
+	}
+}
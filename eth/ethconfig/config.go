@@ -90,6 +90,7 @@ var Defaults = Config{
 	RPCEVMTimeout:           5 * time.Second,
 	GPO:                     FullNodeGPO,
 	RPCTxFeeCap:             1, // 1 ether
+	RPCTraceFilterRange:     100,
 }
 
 func init() {
@@ -134,6 +135,13 @@ type Config struct {
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	HistoryCutoff uint64 `toml:",omitempty"` // Block number below which ancient bodies and receipts are pruned (0 = keep all)
+
+	// Transaction indexing modes. If addresses are set, only the transactions
+	// sent from or to them are indexed by hash. The sender index allows listing
+	// the transactions sent by an account.
+	TxIndexAddresses []common.Address `toml:",omitempty"`
+	TxIndexSenders   bool             `toml:",omitempty"`
 
 	// RequiredBlocks is a set of block number -> hash mappings which must be in the
 	// canonical chain of all remote peers. Setting the option makes geth verify the
@@ -186,6 +194,19 @@ type Config struct {
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
+	// Enables a live tracer, which is invoked for every block imported into
+	// the chain. VMTraceJsonConfig is passed to the tracer as configuration.
+	VMTrace           string
+	VMTraceJsonConfig string
+
+	// Names of native tracers whose results are stored for every imported block,
+	// to be served by the trace APIs without re-execution. Trace storage takes
+	// the place of the live tracer, so it can't be combined with VMTrace.
+	StoredTracers []string `toml:",omitempty"`
+
+	// Number of recent blocks whose stored traces are kept, 0 for all blocks.
+	StoredTracesRetention uint64 `toml:",omitempty"`
+
 	// Miscellaneous options
 	DocRoot string `toml:"-"`
 
@@ -199,6 +220,10 @@ type Config struct {
 	// send-transaction variants. The unit is ether.
 	RPCTxFeeCap float64
 
+	// RPCTraceFilterRange is the maximum number of blocks trace_filter may
+	// span, 0 for no limit.
+	RPCTraceFilterRange uint64
+
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *params.TrustedCheckpoint `toml:",omitempty"`
 
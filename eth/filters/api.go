@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -212,21 +213,60 @@ func (api *FilterAPI) NewBlockFilter() rpc.ID {
 }
 
 // NewHeads send a notification each time a new (header) block is appended to the chain.
-func (api *FilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+//
+// If resumeFrom is given, the subscription continues after the block with that hash.
+// All canonical headers since its last common ancestor with the current chain are
+// delivered first. This allows clients to catch up on heads missed while they were
+// disconnected.
+func (api *FilterAPI) NewHeads(ctx context.Context, resumeFrom *common.Hash) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
 
+	var (
+		headers = make(chan *types.Header)
+		plan    *resumePlan
+	)
+	// Subscribe before computing the replay, so no heads are lost in between.
+	headersSub := api.events.SubscribeNewHeads(headers)
+	if resumeFrom != nil {
+		var err error
+		if plan, err = api.sys.newResumePlan(ctx, *resumeFrom, api.sys.backend.CurrentHeader()); err != nil {
+			headersSub.Unsubscribe()
+			return nil, err
+		}
+	}
 	rpcSub := notifier.CreateSubscription()
 
 	go func() {
-		headers := make(chan *types.Header)
-		headersSub := api.events.SubscribeNewHeads(headers)
-
+		if plan != nil {
+			queued, err := replayQueued(rpcSub.Err(), notifier.Closed(), headers, func(ctx context.Context) error {
+				for _, h := range plan.added {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					notifier.Notify(rpcSub.ID, h)
+				}
+				return nil
+			})
+			if err != nil {
+				headersSub.Unsubscribe()
+				failReplay(notifier, rpcSub, err)
+				return
+			}
+			for _, h := range queued {
+				if !plan.replayed(h.Hash()) {
+					notifier.Notify(rpcSub.ID, h)
+				}
+			}
+		}
 		for {
 			select {
 			case h := <-headers:
+				if plan != nil && plan.replayed(h.Hash()) {
+					continue
+				}
 				notifier.Notify(rpcSub.ID, h)
 			case <-rpcSub.Err():
 				headersSub.Unsubscribe()
@@ -241,31 +281,131 @@ func (api *FilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
 	return rpcSub, nil
 }
 
+// FinalizedHeads sends a notification for every block that becomes finalized,
+// in chain order. If the finalized block moves by more than 1024 blocks at once,
+// only the new finalized block is sent.
+func (api *FilterAPI) FinalizedHeads(ctx context.Context) (*rpc.Subscription, error) {
+	return api.markHeads(ctx, FinalizedBlocksSubscription)
+}
+
+// SafeHeads sends a notification for every block that becomes safe, in chain order.
+// If the safe block moves by more than 1024 blocks at once, only the new safe block
+// is sent.
+func (api *FilterAPI) SafeHeads(ctx context.Context) (*rpc.Subscription, error) {
+	return api.markHeads(ctx, SafeBlocksSubscription)
+}
+
+// markHeads creates a subscription for the blocks passed by the finalized or safe
+// block, depending on the given subscription type.
+func (api *FilterAPI) markHeads(ctx context.Context, typ Type) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	var (
+		marks    = make(chan *types.Header, markEvChanSize)
+		marksSub = api.events.subscribeMarkHeads(typ, marks)
+		follower = newMarkFollower(ctx, api.sys, typ)
+	)
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		for {
+			select {
+			case mark := <-marks:
+				plan, err := follower.advance(context.Background(), mark)
+				if err != nil {
+					log.Debug("Failed to follow chain mark", "number", mark.Number, "hash", mark.Hash(), "err", err)
+					continue
+				}
+				for _, h := range plan.added {
+					notifier.Notify(rpcSub.ID, h)
+				}
+			case <-rpcSub.Err():
+				marksSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				marksSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
-func (api *FilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+//
+// If toBlock is set to "finalized" or "safe", logs are only sent once their block
+// becomes finalized or safe. Logs of safe blocks which get reorged out afterwards
+// are sent again with the removed flag set.
+//
+// If resumeFrom is given, the subscription continues after the block with that hash.
+// Matching logs of all canonical blocks since its last common ancestor with the current
+// chain are delivered first. If the block has been reorged out since, the logs of the
+// dropped blocks are delivered before that, with the removed flag set.
+func (api *FilterAPI) Logs(ctx context.Context, crit FilterCriteria, resumeFrom *common.Hash) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
+	typ, err := markType(crit)
+	if err != nil {
+		return nil, err
+	}
+	if typ != UnknownSubscription {
+		if resumeFrom != nil {
+			return nil, errors.New("resuming is not supported for finalized or safe logs")
+		}
+		return api.markLogs(ctx, notifier, crit, typ)
+	}
 
 	var (
-		rpcSub      = notifier.CreateSubscription()
 		matchedLogs = make(chan []*types.Log)
+		plan        *resumePlan
 	)
-
 	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery(crit), matchedLogs)
 	if err != nil {
 		return nil, err
 	}
+	if resumeFrom != nil {
+		if plan, err = api.sys.newResumePlan(ctx, *resumeFrom, api.sys.backend.CurrentHeader()); err != nil {
+			logsSub.Unsubscribe()
+			return nil, err
+		}
+	}
+	rpcSub := notifier.CreateSubscription()
 
+	notifyLogs := func(logs []*types.Log) {
+		for _, log := range logs {
+			log := log
+			if plan != nil && !log.Removed && plan.replayed(log.BlockHash) {
+				continue
+			}
+			notifier.Notify(rpcSub.ID, &log)
+		}
+	}
 	go func() {
+		if plan != nil {
+			queued, err := replayQueued(rpcSub.Err(), notifier.Closed(), matchedLogs, func(ctx context.Context) error {
+				return plan.logs(ctx, api.sys, crit, func(log *types.Log) {
+					notifier.Notify(rpcSub.ID, log)
+				})
+			})
+			if err != nil {
+				logsSub.Unsubscribe()
+				failReplay(notifier, rpcSub, err)
+				return
+			}
+			for _, logs := range queued {
+				notifyLogs(logs)
+			}
+		}
 		for {
 			select {
 			case logs := <-matchedLogs:
-				for _, log := range logs {
-					log := log
-					notifier.Notify(rpcSub.ID, &log)
-				}
+				notifyLogs(logs)
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				logsSub.Unsubscribe()
 				return
@@ -279,6 +419,55 @@ func (api *FilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subsc
 	return rpcSub, nil
 }
 
+// markLogs creates a subscription for the logs of blocks passed by the finalized or
+// safe block, depending on the given subscription type.
+func (api *FilterAPI) markLogs(ctx context.Context, notifier *rpc.Notifier, crit FilterCriteria, typ Type) (*rpc.Subscription, error) {
+	var (
+		marks    = make(chan *types.Header, markEvChanSize)
+		marksSub = api.events.subscribeMarkHeads(typ, marks)
+		follower = newMarkFollower(ctx, api.sys, typ)
+	)
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		for {
+			select {
+			case mark := <-marks:
+				logs, err := api.markedLogs(follower, mark, crit)
+				if err != nil {
+					log.Debug("Failed to retrieve logs for chain mark", "number", mark.Number, "hash", mark.Hash(), "err", err)
+					continue
+				}
+				for _, log := range logs {
+					notifier.Notify(rpcSub.ID, log)
+				}
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				marksSub.Unsubscribe()
+				return
+			case <-notifier.Closed(): // connection dropped
+				marksSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// markedLogs advances the follower to the given mark and retrieves the matching logs
+// of the blocks passed.
+func (api *FilterAPI) markedLogs(follower *markFollower, mark *types.Header, crit FilterCriteria) ([]*types.Log, error) {
+	plan, err := follower.advance(context.Background(), mark)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	err = plan.logs(context.Background(), api.sys, crit, func(log *types.Log) {
+		logs = append(logs, log)
+	})
+	return logs, err
+}
+
 // FilterCriteria represents a request to create a new filter.
 // Same as ethereum.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria ethereum.FilterQuery
@@ -294,7 +483,17 @@ type FilterCriteria ethereum.FilterQuery
 // again but with the removed property set to true.
 //
 // In case "fromBlock" > "toBlock" an error is returned.
+//
+// If "toBlock" is "finalized" or "safe", logs are only returned once their block
+// becomes finalized or safe.
 func (api *FilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
+	typ, err := markType(crit)
+	if err != nil {
+		return "", err
+	}
+	if typ != UnknownSubscription {
+		return api.newMarkFilter(crit, typ), nil
+	}
 	logs := make(chan []*types.Log)
 	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery(crit), logs)
 	if err != nil {
@@ -326,8 +525,49 @@ func (api *FilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 	return logsSub.ID, nil
 }
 
+// newMarkFilter creates a log filter which collects the logs of blocks passed by the
+// finalized or safe block, depending on the given subscription type.
+func (api *FilterAPI) newMarkFilter(crit FilterCriteria, typ Type) rpc.ID {
+	var (
+		marks    = make(chan *types.Header, markEvChanSize)
+		marksSub = api.events.subscribeMarkHeads(typ, marks)
+		follower = newMarkFollower(context.Background(), api.sys, typ)
+	)
+
+	api.filtersMu.Lock()
+	api.filters[marksSub.ID] = &filter{typ: LogsSubscription, crit: crit, deadline: time.NewTimer(api.timeout), logs: make([]*types.Log, 0), s: marksSub}
+	api.filtersMu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case mark := <-marks:
+				logs, err := api.markedLogs(follower, mark, crit)
+				if err != nil {
+					log.Debug("Failed to retrieve logs for chain mark", "number", mark.Number, "hash", mark.Hash(), "err", err)
+					continue
+				}
+				api.filtersMu.Lock()
+				if f, found := api.filters[marksSub.ID]; found {
+					f.logs = append(f.logs, logs...)
+				}
+				api.filtersMu.Unlock()
+			case <-marksSub.Err():
+				api.filtersMu.Lock()
+				delete(api.filters, marksSub.ID)
+				api.filtersMu.Unlock()
+				return
+			}
+		}
+	}()
+
+	return marksSub.ID
+}
+
 // GetLogs returns logs matching the given argument that are stored within the state.
-func (api *FilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
+// The logs are streamed to the client while they are retrieved, since the result
+// can become very large.
+func (api *FilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) (rpc.ProducerStream[*types.Log], error) {
 	var filter *Filter
 	if crit.BlockHash != nil {
 		// Block filter requested, construct a single-shot filter
@@ -345,12 +585,8 @@ func (api *FilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*type
 		// Construct the range filter
 		filter = api.sys.NewRangeFilter(begin, end, crit.Addresses, crit.Topics)
 	}
-	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return returnLogs(logs), err
+	// Run the filter and stream all the logs
+	return streamLogs(ctx, filter)
 }
 
 // UninstallFilter removes the filter with the given filter id.
@@ -370,7 +606,7 @@ func (api *FilterAPI) UninstallFilter(id rpc.ID) bool {
 
 // GetFilterLogs returns the logs for the filter with the given id.
 // If the filter could not be found an empty array of logs is returned.
-func (api *FilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*types.Log, error) {
+func (api *FilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) (rpc.ProducerStream[*types.Log], error) {
 	api.filtersMu.Lock()
 	f, found := api.filters[id]
 	api.filtersMu.Unlock()
@@ -396,12 +632,8 @@ func (api *FilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*types.Lo
 		// Construct the range filter
 		filter = api.sys.NewRangeFilter(begin, end, f.crit.Addresses, f.crit.Topics)
 	}
-	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return returnLogs(logs), nil
+	// Run the filter and stream all the logs
+	return streamLogs(ctx, filter)
 }
 
 // GetFilterChanges returns the logs for the filter with the given id since
@@ -455,6 +687,24 @@ func (api *FilterAPI) GetFilterChanges(id rpc.ID) (interface{}, error) {
 	return []interface{}{}, fmt.Errorf("filter not found")
 }
 
+// streamLogs resolves the filter and returns a stream producing its logs while
+// the result is written. Invalid filters are rejected before anything is written.
+func streamLogs(ctx context.Context, filter *Filter) (rpc.ProducerStream[*types.Log], error) {
+	if err := filter.resolve(ctx); err != nil {
+		return nil, err
+	}
+	return func(yield func(*types.Log) error) error {
+		return filter.StreamLogs(ctx, func(logs []*types.Log) error {
+			for _, log := range logs {
+				if err := yield(log); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}, nil
+}
+
 // returnHashes is a helper that will return an empty hash array case the given hash array is nil,
 // otherwise the given hashes array is returned.
 func returnHashes(hashes []common.Hash) []common.Hash {
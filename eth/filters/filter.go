@@ -38,6 +38,12 @@ type Filter struct {
 	begin, end int64        // Range interval if filtering multiple blocks
 
 	matcher *bloombits.Matcher
+
+	resolved    bool          // Whether the filter has been resolved against the chain
+	header      *types.Header // Header of the block if filtering a single block
+	pending     bool          // Whether the pending logs are included in the range
+	pendingOnly bool          // Whether only the pending logs are requested
+	empty       bool          // Whether there is no chain to filter yet
 }
 
 // NewRangeFilter creates a new filter which uses a bloom filter on blocks to
@@ -95,28 +101,99 @@ func newFilter(sys *FilterSystem, addresses []common.Address, topics [][]common.
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
+	var logs []*types.Log
+	err := f.StreamLogs(ctx, func(found []*types.Log) error {
+		logs = append(logs, found...)
+		return nil
+	})
+	return logs, err
+}
+
+// StreamLogs searches the blockchain for matching log entries like Logs, but
+// passes them to yield block by block instead of collecting them. It stops at
+// the first error returned by yield.
+func (f *Filter) StreamLogs(ctx context.Context, yield func([]*types.Log) error) error {
+	if err := f.resolve(ctx); err != nil {
+		return err
+	}
 	// If we're doing singleton block filtering, execute and return
+	if f.header != nil {
+		logs, err := f.blockLogs(ctx, f.header)
+		if err != nil {
+			return err
+		}
+		return yieldLogs(logs, yield)
+	}
+	// Short-cut if all we care about is pending logs
+	if f.pendingOnly {
+		logs, err := f.pendingLogs()
+		if err != nil {
+			return err
+		}
+		return yieldLogs(logs, yield)
+	}
+	if f.empty {
+		return nil
+	}
+	// Gather all indexed logs, and finish with non indexed ones
+	var (
+		end            = uint64(f.end)
+		size, sections = f.sys.backend.BloomStatus()
+	)
+	if indexed := sections * size; indexed > uint64(f.begin) {
+		var err error
+		if indexed > end {
+			err = f.indexedLogs(ctx, end, yield)
+		} else {
+			err = f.indexedLogs(ctx, indexed-1, yield)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := f.unindexedLogs(ctx, end, yield); err != nil {
+		return err
+	}
+	if f.pending {
+		logs, err := f.pendingLogs()
+		if err != nil {
+			return err
+		}
+		return yieldLogs(logs, yield)
+	}
+	return nil
+}
+
+// resolve validates the filter criteria and resolves the block range against the
+// current chain, so that invalid filters are rejected before any logs are
+// retrieved. The filter is only resolved once.
+func (f *Filter) resolve(ctx context.Context) error {
+	if f.resolved {
+		return nil
+	}
 	if f.block != nil {
 		header, err := f.sys.backend.HeaderByHash(ctx, *f.block)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if header == nil {
-			return nil, errors.New("unknown block")
+			return errors.New("unknown block")
 		}
-		return f.blockLogs(ctx, header)
+		f.header, f.resolved = header, true
+		return nil
 	}
-	// Short-cut if all we care about is pending logs
 	if f.begin == rpc.PendingBlockNumber.Int64() {
 		if f.end != rpc.PendingBlockNumber.Int64() {
-			return nil, errors.New("invalid block range")
+			return errors.New("invalid block range")
 		}
-		return f.pendingLogs()
+		f.pendingOnly, f.resolved = true, true
+		return nil
 	}
 	// Figure out the limits of the filter range
 	header, _ := f.sys.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	if header == nil {
-		return nil, nil
+		f.empty, f.resolved = true, true
+		return nil
 	}
 	var (
 		err     error
@@ -148,56 +225,30 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		return hdr.Number.Int64(), nil
 	}
 	if f.begin, err = resolveSpecial(f.begin); err != nil {
-		return nil, err
+		return err
 	}
 	if f.end, err = resolveSpecial(f.end); err != nil {
-		return nil, err
+		return err
 	}
-	// Gather all indexed logs, and finish with non indexed ones
-	var (
-		logs           []*types.Log
-		end            = uint64(f.end)
-		size, sections = f.sys.backend.BloomStatus()
-	)
-	if indexed := sections * size; indexed > uint64(f.begin) {
-		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
-		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
-		}
-		if err != nil {
-			return logs, err
-		}
-	}
-	rest, err := f.unindexedLogs(ctx, end)
-	logs = append(logs, rest...)
-	if pending {
-		pendingLogs, err := f.pendingLogs()
-		if err != nil {
-			return nil, err
-		}
-		logs = append(logs, pendingLogs...)
-	}
-	return logs, err
+	f.pending, f.resolved = pending, true
+	return nil
 }
 
-// indexedLogs returns the logs matching the filter criteria based on the bloom
-// bits indexed available locally or via the network.
-func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+// indexedLogs passes the logs matching the filter criteria to yield, based on the
+// bloom bits indexed available locally or via the network.
+func (f *Filter) indexedLogs(ctx context.Context, end uint64, yield func([]*types.Log) error) error {
 	// Create a matcher session and request servicing from the backend
 	matches := make(chan uint64, 64)
 
 	session, err := f.matcher.Start(ctx, uint64(f.begin), end, matches)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer session.Close()
 
 	f.sys.backend.ServiceFilter(ctx, session)
 
 	// Iterate over the matches until exhausted or context closed
-	var logs []*types.Log
-
 	for {
 		select {
 		case number, ok := <-matches:
@@ -207,47 +258,57 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				if err == nil {
 					f.begin = int64(end) + 1
 				}
-				return logs, err
+				return err
 			}
 			f.begin = int64(number) + 1
 
 			// Retrieve the suggested block and pull any truly matching logs
 			header, err := f.sys.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
 			if header == nil || err != nil {
-				return logs, err
+				return err
 			}
 			found, err := f.checkMatches(ctx, header)
 			if err != nil {
-				return logs, err
+				return err
+			}
+			if err := yieldLogs(found, yield); err != nil {
+				return err
 			}
-			logs = append(logs, found...)
 
 		case <-ctx.Done():
-			return logs, ctx.Err()
+			return ctx.Err()
 		}
 	}
 }
 
-// unindexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
-	var logs []*types.Log
-
+// unindexedLogs passes the logs matching the filter criteria to yield, based on
+// raw block iteration and bloom matching.
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, yield func([]*types.Log) error) error {
 	for ; f.begin <= int64(end); f.begin++ {
 		if f.begin%10 == 0 && ctx.Err() != nil {
-			return logs, ctx.Err()
+			return ctx.Err()
 		}
 		header, err := f.sys.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
 		if header == nil || err != nil {
-			return logs, err
+			return err
 		}
 		found, err := f.blockLogs(ctx, header)
 		if err != nil {
-			return logs, err
+			return err
+		}
+		if err := yieldLogs(found, yield); err != nil {
+			return err
 		}
-		logs = append(logs, found...)
 	}
-	return logs, nil
+	return nil
+}
+
+// yieldLogs passes a non-empty set of logs to yield.
+func yieldLogs(logs []*types.Log, yield func([]*types.Log) error) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return yield(logs)
 }
 
 // blockLogs returns the logs matching the filter criteria within a single block.
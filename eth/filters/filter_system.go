@@ -71,6 +71,8 @@ type Backend interface {
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 	SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription
+	SubscribeFinalizedBlockEvent(ch chan<- core.FinalizedBlockEvent) event.Subscription
+	SubscribeSafeBlockEvent(ch chan<- core.SafeBlockEvent) event.Subscription
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
@@ -161,6 +163,10 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// FinalizedBlocksSubscription queries updates of the finalized block
+	FinalizedBlocksSubscription
+	// SafeBlocksSubscription queries updates of the safe block
+	SafeBlocksSubscription
 	// LastIndexSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -175,6 +181,9 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// markEvChanSize is the size of channel listening to FinalizedBlockEvent
+	// and SafeBlockEvent.
+	markEvChanSize = 10
 )
 
 type subscription struct {
@@ -203,15 +212,19 @@ type EventSystem struct {
 	rmLogsSub      event.Subscription // Subscription for removed log event
 	pendingLogsSub event.Subscription // Subscription for pending log event
 	chainSub       event.Subscription // Subscription for new chain event
+	finalizedSub   event.Subscription // Subscription for finalized block event
+	safeSub        event.Subscription // Subscription for safe block event
 
 	// Channels
-	install       chan *subscription         // install filter for event notification
-	uninstall     chan *subscription         // remove filter for event notification
-	txsCh         chan core.NewTxsEvent      // Channel to receive new transactions event
-	logsCh        chan []*types.Log          // Channel to receive new log event
-	pendingLogsCh chan []*types.Log          // Channel to receive new log event
-	rmLogsCh      chan core.RemovedLogsEvent // Channel to receive removed log event
-	chainCh       chan core.ChainEvent       // Channel to receive new chain event
+	install       chan *subscription            // install filter for event notification
+	uninstall     chan *subscription            // remove filter for event notification
+	txsCh         chan core.NewTxsEvent         // Channel to receive new transactions event
+	logsCh        chan []*types.Log             // Channel to receive new log event
+	pendingLogsCh chan []*types.Log             // Channel to receive new log event
+	rmLogsCh      chan core.RemovedLogsEvent    // Channel to receive removed log event
+	chainCh       chan core.ChainEvent          // Channel to receive new chain event
+	finalizedCh   chan core.FinalizedBlockEvent // Channel to receive finalized block event
+	safeCh        chan core.SafeBlockEvent      // Channel to receive safe block event
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -232,6 +245,8 @@ func NewEventSystem(sys *FilterSystem, lightMode bool) *EventSystem {
 		rmLogsCh:      make(chan core.RemovedLogsEvent, rmLogsChanSize),
 		pendingLogsCh: make(chan []*types.Log, logsChanSize),
 		chainCh:       make(chan core.ChainEvent, chainEvChanSize),
+		finalizedCh:   make(chan core.FinalizedBlockEvent, markEvChanSize),
+		safeCh:        make(chan core.SafeBlockEvent, markEvChanSize),
 	}
 
 	// Subscribe events
@@ -240,9 +255,12 @@ func NewEventSystem(sys *FilterSystem, lightMode bool) *EventSystem {
 	m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
 	m.pendingLogsSub = m.backend.SubscribePendingLogsEvent(m.pendingLogsCh)
+	m.finalizedSub = m.backend.SubscribeFinalizedBlockEvent(m.finalizedCh)
+	m.safeSub = m.backend.SubscribeSafeBlockEvent(m.safeCh)
 
 	// Make sure none of the subscriptions are empty
-	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil {
+	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil ||
+		m.finalizedSub == nil || m.safeSub == nil {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -401,6 +419,34 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 	return es.subscribe(sub)
 }
 
+// SubscribeFinalizedHeads creates a subscription that writes the header of the
+// finalized block whenever it changes. Blocks finalized along with it are not
+// reported individually.
+func (es *EventSystem) SubscribeFinalizedHeads(headers chan *types.Header) *Subscription {
+	return es.subscribeMarkHeads(FinalizedBlocksSubscription, headers)
+}
+
+// SubscribeSafeHeads creates a subscription that writes the header of the safe
+// block whenever it changes. Blocks which became safe along with it are not
+// reported individually.
+func (es *EventSystem) SubscribeSafeHeads(headers chan *types.Header) *Subscription {
+	return es.subscribeMarkHeads(SafeBlocksSubscription, headers)
+}
+
+func (es *EventSystem) subscribeMarkHeads(typ Type, headers chan *types.Header) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       typ,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		txs:       make(chan []*types.Transaction),
+		headers:   headers,
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
 // SubscribePendingTxs creates a subscription that writes transactions for
 // transactions that enter the transaction pool.
 func (es *EventSystem) SubscribePendingTxs(txs chan []*types.Transaction) *Subscription {
@@ -479,6 +525,12 @@ func (es *EventSystem) handleChainEvent(filters filterIndex, ev core.ChainEvent)
 	}
 }
 
+func (es *EventSystem) handleMarkEvent(filters filterIndex, typ Type, header *types.Header) {
+	for _, f := range filters[typ] {
+		f.headers <- header
+	}
+}
+
 func (es *EventSystem) lightFilterNewHead(newHeader *types.Header, callBack func(*types.Header, bool)) {
 	oldh := es.lastHead
 	es.lastHead = newHeader
@@ -558,6 +610,8 @@ func (es *EventSystem) eventLoop() {
 		es.rmLogsSub.Unsubscribe()
 		es.pendingLogsSub.Unsubscribe()
 		es.chainSub.Unsubscribe()
+		es.finalizedSub.Unsubscribe()
+		es.safeSub.Unsubscribe()
 	}()
 
 	index := make(filterIndex)
@@ -577,6 +631,10 @@ func (es *EventSystem) eventLoop() {
 			es.handlePendingLogs(index, ev)
 		case ev := <-es.chainCh:
 			es.handleChainEvent(index, ev)
+		case ev := <-es.finalizedCh:
+			es.handleMarkEvent(index, FinalizedBlocksSubscription, ev.Header)
+		case ev := <-es.safeCh:
+			es.handleMarkEvent(index, SafeBlocksSubscription, ev.Header)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
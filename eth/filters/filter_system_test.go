@@ -50,6 +50,8 @@ type testBackend struct {
 	rmLogsFeed      event.Feed
 	pendingLogsFeed event.Feed
 	chainFeed       event.Feed
+	finalizedFeed   event.Feed
+	safeFeed        event.Feed
 }
 
 func (b *testBackend) ChainConfig() *params.ChainConfig {
@@ -141,6 +143,14 @@ func (b *testBackend) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Su
 	return b.pendingLogsFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeFinalizedBlockEvent(ch chan<- core.FinalizedBlockEvent) event.Subscription {
+	return b.finalizedFeed.Subscribe(ch)
+}
+
+func (b *testBackend) SubscribeSafeBlockEvent(ch chan<- core.SafeBlockEvent) event.Subscription {
+	return b.safeFeed.Subscribe(ch)
+}
+
 func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return b.chainFeed.Subscribe(ch)
 }
@@ -416,6 +426,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		0: {FromBlock: big.NewInt(rpc.PendingBlockNumber.Int64()), ToBlock: big.NewInt(rpc.LatestBlockNumber.Int64())},
 		1: {FromBlock: big.NewInt(rpc.PendingBlockNumber.Int64()), ToBlock: big.NewInt(100)},
 		2: {FromBlock: big.NewInt(rpc.LatestBlockNumber.Int64()), ToBlock: big.NewInt(100)},
+		3: {FromBlock: big.NewInt(1), ToBlock: big.NewInt(rpc.FinalizedBlockNumber.Int64())},
 	}
 
 	for i, test := range testCases {
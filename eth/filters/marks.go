@@ -0,0 +1,140 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errMissingParent = errors.New("missing parent header")
+
+// markType returns the subscription type of log filters which only report logs once
+// their block becomes finalized or safe. Such filters are requested by setting the
+// toBlock criterion to "finalized" or "safe". For all other criteria, it returns
+// UnknownSubscription.
+func markType(crit FilterCriteria) (Type, error) {
+	if crit.ToBlock == nil || !crit.ToBlock.IsInt64() {
+		return UnknownSubscription, nil
+	}
+	var typ Type
+	switch rpc.BlockNumber(crit.ToBlock.Int64()) {
+	case rpc.FinalizedBlockNumber:
+		typ = FinalizedBlocksSubscription
+	case rpc.SafeBlockNumber:
+		typ = SafeBlocksSubscription
+	default:
+		return UnknownSubscription, nil
+	}
+	if crit.BlockHash != nil || (crit.FromBlock != nil && crit.FromBlock.Cmp(crit.ToBlock) != 0) {
+		return UnknownSubscription, errors.New("fromBlock must be empty or equal to toBlock when filtering for finalized or safe logs")
+	}
+	return typ, nil
+}
+
+// markFollower turns updates of the finalized or safe block into the sequence of
+// blocks which became finalized or safe since the previous update.
+type markFollower struct {
+	sys  *FilterSystem
+	last *types.Header // last block reported to the subscriber
+}
+
+// newMarkFollower creates a follower starting at the current finalized or safe block,
+// depending on the subscription type.
+func newMarkFollower(ctx context.Context, sys *FilterSystem, typ Type) *markFollower {
+	number := rpc.FinalizedBlockNumber
+	if typ == SafeBlocksSubscription {
+		number = rpc.SafeBlockNumber
+	}
+	// The mark might not be set yet, in which case the first update is reported
+	// on its own.
+	last, _ := sys.backend.HeaderByNumber(ctx, number)
+	return &markFollower{sys: sys, last: last}
+}
+
+// advance moves the follower to the given mark. The returned plan holds the blocks
+// between the previous and the new mark, oldest first. If the new mark is not a
+// descendant of the previous one, the blocks on the abandoned branch are reported
+// as removed.
+//
+// At most maxResumeBlocks blocks are walked. If the mark moved further ahead, the
+// blocks in between are reported as a skipped range instead, and a reorg deeper
+// than that is an error. In both cases the follower moves on to the new mark.
+func (f *markFollower) advance(ctx context.Context, mark *types.Header) (*resumePlan, error) {
+	if f.last == nil {
+		f.last = mark
+		return &resumePlan{added: []*types.Header{mark}}, nil
+	}
+	last := f.last
+	f.last = mark
+
+	if number := mark.Number.Uint64(); number > last.Number.Uint64()+maxResumeBlocks {
+		log.Debug("Chain mark moved too far to walk", "from", last.Number, "to", number)
+		return &resumePlan{
+			added:   []*types.Header{mark},
+			skipped: &[2]uint64{last.Number.Uint64() + 1, number - 1},
+		}, nil
+	}
+	var (
+		oldh, newh = last, mark
+		plan       = new(resumePlan)
+		err        error
+	)
+	for oldh.Hash() != newh.Hash() {
+		if len(plan.removed)+len(plan.added) > maxResumeBlocks {
+			return nil, fmt.Errorf("chain mark reorg deeper than %d blocks", maxResumeBlocks)
+		}
+		if oldh.Number.Uint64() >= newh.Number.Uint64() {
+			plan.removed = append(plan.removed, oldh)
+			if oldh, err = f.parent(ctx, oldh); err != nil {
+				return nil, err
+			}
+		}
+		if oldh.Number.Uint64() < newh.Number.Uint64() {
+			plan.added = append(plan.added, newh)
+			if newh, err = f.parent(ctx, newh); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Both lists were collected newest first.
+	reverseHeaders(plan.removed)
+	reverseHeaders(plan.added)
+	return plan, nil
+}
+
+func (f *markFollower) parent(ctx context.Context, header *types.Header) (*types.Header, error) {
+	parent, err := f.sys.backend.HeaderByHash(ctx, header.ParentHash)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, errMissingParent
+	}
+	return parent, nil
+}
+
+func reverseHeaders(headers []*types.Header) {
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+}
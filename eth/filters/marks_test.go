@@ -0,0 +1,117 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestMarkFollower(t *testing.T) {
+	var (
+		db          = rawdb.NewMemoryDatabase()
+		_, sys      = newTestFilterSystem(t, db, Config{})
+		chain, fork = newForkedTestChain(db, common.Address{})
+		ctx         = context.Background()
+	)
+	// The test backend has no safe block, so the first mark is reported alone.
+	f := newMarkFollower(ctx, sys, SafeBlocksSubscription)
+	checkPlan := func(mark *types.Block, removed, added []*types.Block) {
+		t.Helper()
+
+		plan, err := f.advance(ctx, mark.Header())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.removed) != len(removed) || len(plan.added) != len(added) {
+			t.Fatalf("wrong plan: %d removed, %d added", len(plan.removed), len(plan.added))
+		}
+		for i, block := range removed {
+			if plan.removed[i].Hash() != block.Hash() {
+				t.Errorf("removed block %d: wrong hash", i)
+			}
+		}
+		for i, block := range added {
+			if plan.added[i].Hash() != block.Hash() {
+				t.Errorf("added block %d: wrong hash", i)
+			}
+		}
+	}
+	checkPlan(chain[0], nil, chain[:1])
+	checkPlan(chain[2], nil, chain[1:3])
+	checkPlan(chain[2], nil, nil)
+	checkPlan(fork[1], nil, fork)
+	checkPlan(chain[4], fork, chain[3:5])
+
+	// Marks too far ahead are not walked, the blocks in between are skipped.
+	far := types.CopyHeader(chain[4].Header())
+	far.Number.Add(far.Number, big.NewInt(maxResumeBlocks+1))
+	plan, err := f.advance(ctx, far)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.removed) != 0 || len(plan.added) != 1 || plan.added[0] != far {
+		t.Fatalf("wrong plan: %d removed, %d added", len(plan.removed), len(plan.added))
+	}
+	if want := [2]uint64{chain[4].NumberU64() + 1, far.Number.Uint64() - 1}; plan.skipped == nil || *plan.skipped != want {
+		t.Fatalf("wrong skipped range: %v, want %v", plan.skipped, want)
+	}
+}
+
+func TestMarkLogFilter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db           = rawdb.NewMemoryDatabase()
+		backend, sys = newTestFilterSystem(t, db, Config{})
+		api          = NewFilterAPI(sys, false)
+		addr         = common.HexToAddress("0x1234")
+		chain, fork  = newForkedTestChain(db, addr)
+	)
+	id, err := api.NewFilter(FilterCriteria{
+		Addresses: []common.Address{addr},
+		ToBlock:   big.NewInt(rpc.SafeBlockNumber.Int64()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Imported blocks must not be reported before they are safe.
+	backend.logsFeed.Send([]*types.Log{{Address: addr, BlockHash: chain[5].Hash()}})
+
+	backend.safeFeed.Send(core.SafeBlockEvent{Header: fork[0].Header()})
+	backend.safeFeed.Send(core.SafeBlockEvent{Header: chain[4].Header()})
+
+	var logs []*types.Log
+	timeout := time.Now().Add(5 * time.Second)
+	for len(logs) < 4 && time.Now().Before(timeout) {
+		changes, err := api.GetFilterChanges(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, changes.([]*types.Log)...)
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkResumeLogs(t, logs, []int64{100, 100, 4, 5}, []bool{false, true, false, false})
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxResumeBlocks is the maximum number of blocks which are replayed when a
+// subscription is resumed.
+const maxResumeBlocks = 1024
+
+var (
+	errUnknownResumeBlock = errors.New("unknown resume block")
+	errSubscriptionEnded  = errors.New("subscription ended")
+)
+
+// resumePlan describes the chain segments a resumed subscription has missed.
+type resumePlan struct {
+	removed []*types.Header // blocks dropped from the canonical chain, oldest first
+	added   []*types.Header // canonical blocks after the common ancestor, oldest first
+
+	// skipped is the range of canonical blocks preceding added, which are too
+	// many to be listed one by one. It is nil if no blocks were skipped.
+	skipped *[2]uint64
+
+	seen map[common.Hash]struct{} // hashes of replayed canonical blocks
+}
+
+// newResumePlan computes the blocks a subscription has missed since it last saw the
+// block with the given hash, up to and including head. If that block has since been
+// reorged out, the blocks between it and the common ancestor with the canonical chain
+// are reported as removed.
+func (sys *FilterSystem) newResumePlan(ctx context.Context, from common.Hash, head *types.Header) (*resumePlan, error) {
+	header, err := sys.backend.HeaderByHash(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, errUnknownResumeBlock
+	}
+	plan := &resumePlan{seen: make(map[common.Hash]struct{})}
+
+	// Walk back along the chain of the last seen block until it meets the
+	// canonical chain.
+	for {
+		canon, err := sys.backend.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Int64()))
+		if err != nil {
+			return nil, err
+		}
+		if canon != nil && canon.Hash() == header.Hash() {
+			break
+		}
+		if len(plan.removed) >= maxResumeBlocks {
+			return nil, fmt.Errorf("resume block too far behind, maximum is %d blocks", maxResumeBlocks)
+		}
+		plan.removed = append([]*types.Header{header}, plan.removed...)
+		if header, err = sys.backend.HeaderByHash(ctx, header.ParentHash); err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errUnknownResumeBlock
+		}
+	}
+	// Collect the canonical blocks following the common ancestor.
+	if head.Number.Uint64() > header.Number.Uint64() {
+		missed := head.Number.Uint64() - header.Number.Uint64()
+		if missed+uint64(len(plan.removed)) > maxResumeBlocks {
+			return nil, fmt.Errorf("resume block too far behind, maximum is %d blocks", maxResumeBlocks)
+		}
+		for n := header.Number.Uint64() + 1; n <= head.Number.Uint64(); n++ {
+			canon, err := sys.backend.HeaderByNumber(ctx, rpc.BlockNumber(n))
+			if err != nil {
+				return nil, err
+			}
+			if canon == nil {
+				break // chain was rewound in the meantime
+			}
+			plan.added = append(plan.added, canon)
+			plan.seen[canon.Hash()] = struct{}{}
+		}
+	}
+	return plan, nil
+}
+
+// replayed reports whether the block with the given hash was part of the replay.
+// Live events for such blocks are duplicates and need to be dropped.
+func (p *resumePlan) replayed(hash common.Hash) bool {
+	_, ok := p.seen[hash]
+	return ok
+}
+
+// logs retrieves the logs of the replayed blocks matching the given criteria and
+// passes them to notify block by block. Logs of removed blocks are delivered first,
+// marked as removed.
+//
+// The logs of skipped blocks are retrieved with a range filter, before those of the
+// added blocks.
+func (p *resumePlan) logs(ctx context.Context, sys *FilterSystem, crit FilterCriteria, notify func(*types.Log)) error {
+	for _, header := range p.removed {
+		logs, err := sys.NewBlockFilter(header.Hash(), crit.Addresses, crit.Topics).Logs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			// Logs are shared with the cache, don't modify them.
+			removed := *log
+			removed.Removed = true
+			notify(&removed)
+		}
+	}
+	if p.skipped != nil {
+		filter := sys.NewRangeFilter(int64(p.skipped[0]), int64(p.skipped[1]), crit.Addresses, crit.Topics)
+		err := filter.StreamLogs(ctx, func(logs []*types.Log) error {
+			for _, log := range logs {
+				notify(log)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, header := range p.added {
+		logs, err := sys.NewBlockFilter(header.Hash(), crit.Addresses, crit.Topics).Logs(ctx)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			notify(log)
+		}
+	}
+	return nil
+}
+
+// replayQueued runs the replay of a resumed subscription, while queueing the live
+// events arriving in the meantime. The live channel is drained throughout, so the
+// event system is never held up by a slow replay. The replay's context is canceled
+// once the subscription ends, i.e. the client unsubscribes or the connection is
+// closed. It returns the queued events, the error the replay failed with, or
+// errSubscriptionEnded if the subscription has ended.
+func replayQueued[T any](unsubscribed <-chan error, closed <-chan interface{}, live <-chan T, replay func(ctx context.Context) error) ([]T, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- replay(ctx) }()
+
+	var queue []T
+	for {
+		select {
+		case ev := <-live:
+			queue = append(queue, ev)
+		case err := <-done:
+			if err != nil {
+				return nil, err
+			}
+			return queue, nil
+		case <-unsubscribed:
+			cancel()
+			<-done
+			return nil, errSubscriptionEnded
+		case <-closed:
+			cancel()
+			<-done
+			return nil, errSubscriptionEnded
+		}
+	}
+}
+
+// failReplay fails a resumed subscription whose replay failed, so the client can
+// subscribe again. Nothing is sent if the subscription has ended in the meantime.
+func failReplay(notifier *rpc.Notifier, sub *rpc.Subscription, err error) {
+	if err == errSubscriptionEnded {
+		return
+	}
+	log.Debug("Failed to replay missed blocks for resumed subscription", "err", err)
+	notifier.Fail(sub.ID, fmt.Errorf("failed to replay missed blocks: %w", err))
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newForkedTestChain writes a canonical chain of six blocks to db, along with a
+// two block side chain forking off after block 3. Every block emits a single log
+// from addr. Its topic is the block number on the canonical chain, and 100 plus
+// the index in the side chain for the fork.
+func newForkedTestChain(db ethdb.Database, addr common.Address) (chain, fork []*types.Block) {
+	gspec := &core.Genesis{
+		Config:  params.TestChainConfig,
+		BaseFee: big.NewInt(params.InitialBaseFee),
+	}
+	addLog := func(gen *core.BlockGen, topic common.Hash) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{topic}}}
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(gen.Number().Int64()), addr, big.NewInt(1), 1, gen.BaseFee(), nil))
+	}
+	genDb, chain, receipts := core.GenerateChainWithGenesis(gspec, ethash.NewFaker(), 6, func(i int, gen *core.BlockGen) {
+		addLog(gen, common.BigToHash(big.NewInt(int64(i+1))))
+	})
+	fork, forkReceipts := core.GenerateChain(gspec.Config, chain[2], ethash.NewFaker(), genDb, 2, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+		addLog(gen, common.BigToHash(big.NewInt(int64(i+100))))
+	})
+	gspec.MustCommit(db)
+	for i, block := range fork {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), forkReceipts[i])
+	}
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	return chain, fork
+}
+
+func TestResumePlan(t *testing.T) {
+	var (
+		db          = rawdb.NewMemoryDatabase()
+		_, sys      = newTestFilterSystem(t, db, Config{})
+		addr        = common.HexToAddress("0x1234")
+		chain, fork = newForkedTestChain(db, addr)
+
+		ctx  = context.Background()
+		head = chain[5].Header()
+		crit = FilterCriteria{Addresses: []common.Address{addr}}
+	)
+
+	// Resuming from a canonical block replays the following blocks only.
+	plan, err := sys.newResumePlan(ctx, chain[3].Hash(), head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.removed) != 0 || len(plan.added) != 2 {
+		t.Fatalf("wrong plan: %d removed, %d added", len(plan.removed), len(plan.added))
+	}
+	if !plan.replayed(chain[4].Hash()) || plan.replayed(chain[3].Hash()) {
+		t.Fatal("wrong replayed blocks")
+	}
+	logs, err := collectPlanLogs(ctx, plan, sys, crit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResumeLogs(t, logs, []int64{5, 6}, []bool{false, false})
+
+	// Resuming from a reorged-out block reports the dropped blocks first.
+	plan, err = sys.newResumePlan(ctx, fork[1].Hash(), head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.removed) != 2 || plan.removed[0].Hash() != fork[0].Hash() || plan.removed[1].Hash() != fork[1].Hash() {
+		t.Fatalf("wrong removed blocks: %v", plan.removed)
+	}
+	if len(plan.added) != 3 || plan.added[0].Hash() != chain[3].Hash() {
+		t.Fatalf("wrong added blocks: %v", plan.added)
+	}
+	logs, err = collectPlanLogs(ctx, plan, sys, crit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResumeLogs(t, logs, []int64{100, 101, 4, 5, 6}, []bool{true, true, false, false, false})
+
+	// Replayed logs are copies, the cached ones must stay untouched.
+	cached, err := sys.NewBlockFilter(fork[0].Hash(), nil, nil).Logs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 || cached[0].Removed {
+		t.Fatal("cached log modified")
+	}
+
+	// Unknown blocks can't be resumed from.
+	if _, err := sys.newResumePlan(ctx, common.Hash{0xff}, head); err != errUnknownResumeBlock {
+		t.Fatalf("wrong error for unknown block: %v", err)
+	}
+}
+
+func collectPlanLogs(ctx context.Context, plan *resumePlan, sys *FilterSystem, crit FilterCriteria) ([]*types.Log, error) {
+	var logs []*types.Log
+	err := plan.logs(ctx, sys, crit, func(log *types.Log) {
+		logs = append(logs, log)
+	})
+	return logs, err
+}
+
+func TestReplayQueued(t *testing.T) {
+	var (
+		live    = make(chan int)
+		release = make(chan struct{})
+		result  = make(chan []int)
+	)
+	// Live events must be accepted while the replay is blocked.
+	go func() {
+		queued, err := replayQueued(nil, nil, live, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+		if err != nil {
+			t.Errorf("replay failed: %v", err)
+		}
+		result <- queued
+	}()
+	for i := 0; i < 1000; i++ {
+		select {
+		case live <- i:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("live event %d blocked by replay", i)
+		}
+	}
+	close(release)
+	if queued := <-result; len(queued) != 1000 || queued[999] != 999 {
+		t.Fatalf("wrong queued events: %d", len(queued))
+	}
+
+	// Ending the subscription cancels the replay.
+	var (
+		unsubscribed = make(chan error)
+		canceled     = make(chan struct{})
+		done         = make(chan error)
+	)
+	go func() {
+		_, err := replayQueued(unsubscribed, nil, live, func(ctx context.Context) error {
+			<-ctx.Done()
+			close(canceled)
+			return ctx.Err()
+		})
+		done <- err
+	}()
+	close(unsubscribed)
+	if err := <-done; err != errSubscriptionEnded {
+		t.Fatalf("wrong error for aborted replay: %v", err)
+	}
+	select {
+	case <-canceled:
+	default:
+		t.Fatal("replay context not canceled")
+	}
+
+	// A failed replay reports its error.
+	failure := errors.New("replay failure")
+	if _, err := replayQueued(nil, nil, live, func(ctx context.Context) error { return failure }); err != failure {
+		t.Fatalf("wrong error for failed replay: %v", err)
+	}
+}
+
+func checkResumeLogs(t *testing.T, logs []*types.Log, topics []int64, removed []bool) {
+	t.Helper()
+
+	if len(logs) != len(topics) {
+		t.Fatalf("wrong number of logs: got %d, want %d", len(logs), len(topics))
+	}
+	for i, log := range logs {
+		if want := common.BigToHash(big.NewInt(topics[i])); log.Topics[0] != want {
+			t.Errorf("log %d: wrong topic %x, want %x", i, log.Topics[0], want)
+		}
+		if log.Removed != removed[i] {
+			t.Errorf("log %d: wrong removed flag %v", i, log.Removed)
+		}
+	}
+}
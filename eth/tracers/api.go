@@ -23,6 +23,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"os"
 	"runtime"
@@ -35,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/tracers/logger"
@@ -44,6 +46,7 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -67,6 +70,11 @@ const (
 	// for tracing. The creation of trace state will be paused if the unused
 	// trace states exceed this limit.
 	maximumPendingTraceStates = 128
+
+	// defaultTraceMemoryBudget is the approximate amount of memory the intermediate
+	// states of all concurrent block traces may hold at once. The creation of
+	// states is paused until tracers release enough of them.
+	defaultTraceMemoryBudget = common.StorageSize(256 * 1024 * 1024)
 )
 
 var errTxNotFound = errors.New("transaction not found")
@@ -83,6 +91,7 @@ type Backend interface {
 	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
 	GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error)
+	GetTd(ctx context.Context, hash common.Hash) *big.Int
 	RPCGasCap() uint64
 	ChainConfig() *params.ChainConfig
 	Engine() consensus.Engine
@@ -93,12 +102,23 @@ type Backend interface {
 
 // API is the collection of tracing APIs exposed over the private debugging endpoint.
 type API struct {
-	backend Backend
+	backend      Backend
+	memoryBudget common.StorageSize  // Memory the intermediate states of all block traces may hold
+	budget       *semaphore.Weighted // Unused part of the memory budget
 }
 
 // NewAPI creates a new API definition for the tracing methods of the Ethereum service.
 func NewAPI(backend Backend) *API {
-	return &API{backend: backend}
+	return newAPI(backend, defaultTraceMemoryBudget)
+}
+
+// newAPI creates a tracing API whose block traces share the given memory budget.
+func newAPI(backend Backend, memoryBudget common.StorageSize) *API {
+	return &API{
+		backend:      backend,
+		memoryBudget: memoryBudget,
+		budget:       semaphore.NewWeighted(int64(memoryBudget)),
+	}
 }
 
 type chainContext struct {
@@ -125,6 +145,29 @@ func (context *chainContext) GetHeader(hash common.Hash, number uint64) *types.H
 	return header
 }
 
+func (context *chainContext) Config() *params.ChainConfig {
+	return context.api.backend.ChainConfig()
+}
+
+func (context *chainContext) CurrentHeader() *types.Header {
+	header, _ := context.api.backend.HeaderByNumber(context.ctx, rpc.LatestBlockNumber)
+	return header
+}
+
+func (context *chainContext) GetHeaderByNumber(number uint64) *types.Header {
+	header, _ := context.api.backend.HeaderByNumber(context.ctx, rpc.BlockNumber(number))
+	return header
+}
+
+func (context *chainContext) GetHeaderByHash(hash common.Hash) *types.Header {
+	header, _ := context.api.backend.HeaderByHash(context.ctx, hash)
+	return header
+}
+
+func (context *chainContext) GetTd(hash common.Hash, number uint64) *big.Int {
+	return context.api.backend.GetTd(context.ctx, hash)
+}
+
 // chainContext constructs the context reader which is used by the evm for reading
 // the necessary chain context.
 func (api *API) chainContext(ctx context.Context) core.ChainContext {
@@ -182,6 +225,9 @@ type TraceConfig struct {
 	// Config specific to given tracer. Note struct logger
 	// config are historically embedded in main object.
 	TracerConfig json.RawMessage
+	// SystemOps appends the balance changes applied by the consensus rules
+	// outside of transactions to block traces, as a pseudo-transaction.
+	SystemOps bool
 }
 
 // TraceCallConfig is the config for traceCall API. It holds one more
@@ -203,6 +249,7 @@ type StdTraceConfig struct {
 type txTraceResult struct {
 	Result interface{} `json:"result,omitempty"` // Trace results produced by the tracer
 	Error  string      `json:"error,omitempty"`  // Trace failure produced by the tracer
+	System bool        `json:"system,omitempty"` // Whether the result is of the system operations of the block
 }
 
 // blockTraceTask represents a single block trace task when an entire chain is
@@ -227,6 +274,7 @@ type blockTraceResult struct {
 type txTraceTask struct {
 	statedb *state.StateDB // Intermediate state prepped for tracing
 	index   int            // Transaction offset in the block
+	size    int64          // Estimated memory held by statedb
 }
 
 // TraceChain returns the structured logs created during the execution of EVM
@@ -462,7 +510,7 @@ func (api *API) traceChain(start, end *types.Block, config *TraceConfig, closed
 
 // TraceBlockByNumber returns the structured logs created during the execution of
 // EVM and returns them as a JSON object.
-func (api *API) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) ([]*txTraceResult, error) {
+func (api *API) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) (rpc.SliceStream[*txTraceResult], error) {
 	block, err := api.blockByNumber(ctx, number)
 	if err != nil {
 		return nil, err
@@ -472,7 +520,7 @@ func (api *API) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber,
 
 // TraceBlockByHash returns the structured logs created during the execution of
 // EVM and returns them as a JSON object.
-func (api *API) TraceBlockByHash(ctx context.Context, hash common.Hash, config *TraceConfig) ([]*txTraceResult, error) {
+func (api *API) TraceBlockByHash(ctx context.Context, hash common.Hash, config *TraceConfig) (rpc.SliceStream[*txTraceResult], error) {
 	block, err := api.blockByHash(ctx, hash)
 	if err != nil {
 		return nil, err
@@ -482,7 +530,7 @@ func (api *API) TraceBlockByHash(ctx context.Context, hash common.Hash, config *
 
 // TraceBlock returns the structured logs created during the execution of EVM
 // and returns them as a JSON object.
-func (api *API) TraceBlock(ctx context.Context, blob hexutil.Bytes, config *TraceConfig) ([]*txTraceResult, error) {
+func (api *API) TraceBlock(ctx context.Context, blob hexutil.Bytes, config *TraceConfig) (rpc.SliceStream[*txTraceResult], error) {
 	block := new(types.Block)
 	if err := rlp.Decode(bytes.NewReader(blob), block); err != nil {
 		return nil, fmt.Errorf("could not decode block: %v", err)
@@ -492,7 +540,7 @@ func (api *API) TraceBlock(ctx context.Context, blob hexutil.Bytes, config *Trac
 
 // TraceBlockFromFile returns the structured logs created during the execution of
 // EVM and returns them as a JSON object.
-func (api *API) TraceBlockFromFile(ctx context.Context, file string, config *TraceConfig) ([]*txTraceResult, error) {
+func (api *API) TraceBlockFromFile(ctx context.Context, file string, config *TraceConfig) (rpc.SliceStream[*txTraceResult], error) {
 	blob, err := os.ReadFile(file)
 	if err != nil {
 		return nil, fmt.Errorf("could not read file: %v", err)
@@ -503,7 +551,7 @@ func (api *API) TraceBlockFromFile(ctx context.Context, file string, config *Tra
 // TraceBadBlock returns the structured logs created during the execution of
 // EVM against a block pulled from the pool of bad ones and returns them as a JSON
 // object.
-func (api *API) TraceBadBlock(ctx context.Context, hash common.Hash, config *TraceConfig) ([]*txTraceResult, error) {
+func (api *API) TraceBadBlock(ctx context.Context, hash common.Hash, config *TraceConfig) (rpc.SliceStream[*txTraceResult], error) {
 	block := rawdb.ReadBadBlock(api.backend.ChainDb(), hash)
 	if block == nil {
 		return nil, fmt.Errorf("bad block %#x not found", hash)
@@ -602,6 +650,9 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 	if block.NumberU64() == 0 {
 		return nil, errors.New("genesis is not traceable")
 	}
+	if results := api.storedBlockTraces(block, config); results != nil {
+		return results, nil
+	}
 	// Prepare base state
 	parent, err := api.blockByNumberAndHash(ctx, rpc.BlockNumber(block.NumberU64()-1), block.ParentHash())
 	if err != nil {
@@ -621,60 +672,167 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 	}
 	defer release()
 
-	// JS tracers have high overhead. In this case run a parallel
-	// process that generates states in one thread and traces txes
-	// in separate worker threads.
-	if config != nil && config.Tracer != nil && *config.Tracer != "" {
-		if isJS := DefaultDirectory.IsJS(*config.Tracer); isJS {
-			return api.traceBlockParallel(ctx, block, excessDataGas, statedb, config)
-		}
-	}
-	// Native tracers have low overhead
 	var (
-		txs       = block.Transactions()
-		blockHash = block.Hash()
-		is158     = api.backend.ChainConfig().IsEIP158(block.Number())
-		blockCtx  = core.NewEVMBlockContext(block.Header(), excessDataGas, api.chainContext(ctx), nil)
-		signer    = types.MakeSigner(api.backend.ChainConfig(), block.Number(), block.Time())
-		results   = make([]*txTraceResult, len(txs))
+		txs         = block.Transactions()
+		blockHash   = block.Hash()
+		blockCtx    = core.NewEVMBlockContext(block.Header(), excessDataGas, api.chainContext(ctx), nil)
+		chainConfig = api.backend.ChainConfig()
 	)
-	for i, tx := range txs {
-		// Generate the next state snapshot fast without tracing
-		msg, _ := core.TransactionToMessage(tx, signer, block.BaseFee())
+	// Generate the states in one thread and trace the transactions in separate
+	// worker threads, whatever the tracer.
+	results, err := api.traceBlockTxs(ctx, block, statedb, blockCtx, chainConfig, 0, len(txs)-1, func(task *txTraceTask, tx *types.Transaction, msg *core.Message) (interface{}, error) {
 		txctx := &Context{
 			BlockHash:   blockHash,
 			BlockNumber: block.Number(),
-			TxIndex:     i,
+			TxIndex:     task.index,
 			TxHash:      tx.Hash(),
 		}
-		res, err := api.traceTx(ctx, msg, txctx, blockCtx, statedb, config)
-		if err != nil {
+		return api.traceTx(ctx, msg, txctx, blockCtx, task.statedb, config)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The state generation stops before the last transaction, execute it too if
+	// the system operations need the post-block state.
+	if config != nil && config.SystemOps && len(txs) > 0 {
+		var (
+			last   = len(txs) - 1
+			signer = types.MakeSigner(chainConfig, block.Number(), block.Time())
+		)
+		msg, _ := core.TransactionToMessage(txs[last], signer, block.BaseFee())
+		statedb.SetTxContext(txs[last].Hash(), last)
+		vmenv := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, chainConfig, vm.Config{})
+		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.GasLimit).AddDataGas(params.MaxDataGasPerBlock)); err != nil {
 			return nil, err
 		}
-		results[i] = &txTraceResult{Result: res}
-		// Finalize the state so any modifications are written to the trie
-		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
-		statedb.Finalise(is158)
+		statedb.Finalise(chainConfig.IsEIP158(block.Number()))
+	}
+	if config != nil && config.SystemOps {
+		results = append(results, api.traceSystemOps(ctx, block, statedb, blockCtx, config))
 	}
 	return results, nil
 }
 
-// traceBlockParallel is for tracers that have a high overhead (read JS tracers). One thread
-// runs along and executes txes without tracing enabled to generate their prestate.
-// Worker threads take the tasks and the prestate and trace them.
-func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, excessDataGas *big.Int, statedb *state.StateDB, config *TraceConfig) ([]*txTraceResult, error) {
-	// Execute all the transaction contained within the block concurrently
+// traceSystemOps traces the balance changes of a block which happen outside of
+// the execution of its transactions as a pseudo-transaction: the data gas fees
+// burnt by the transactions, and the rewards and withdrawals credited by the
+// consensus engine. The state is expected to be the one after the transactions.
+func (api *API) traceSystemOps(ctx context.Context, block *types.Block, statedb *state.StateDB, blockCtx vm.BlockContext, config *TraceConfig) *txTraceResult {
+	if config.Tracer == nil {
+		return &txTraceResult{System: true, Error: "tracer doesn't support system operations"}
+	}
+	txctx := &Context{
+		BlockHash:   block.Hash(),
+		BlockNumber: block.Number(),
+		TxIndex:     len(block.Transactions()),
+	}
+	tracer, err := DefaultDirectory.New(*config.Tracer, txctx, config.TracerConfig)
+	if err != nil {
+		return &txTraceResult{System: true, Error: err.Error()}
+	}
+	sysTracer, ok := tracer.(SystemTracer)
+	if !ok {
+		return &txTraceResult{System: true, Error: "tracer doesn't support system operations"}
+	}
+	var (
+		chainConfig = api.backend.ChainConfig()
+		signer      = types.MakeSigner(chainConfig, block.Number(), block.Time())
+		env         = vm.NewEVM(blockCtx, vm.TxContext{GasPrice: new(big.Int)}, statedb, chainConfig, vm.Config{})
+	)
+	tracer.CaptureTxStart(0)
+	sysTracer.CaptureSystemStart(env)
+
+	// The data gas fees were burnt during the execution of the transactions
+	if chainConfig.IsCancun(block.Time()) && blockCtx.ExcessDataGas != nil {
+		price := types.GetDataGasPrice(blockCtx.ExcessDataGas)
+		for _, tx := range block.Transactions() {
+			used := types.GetDataGasUsed(len(tx.DataHashes()))
+			if used == 0 {
+				continue
+			}
+			from, err := types.Sender(signer, tx)
+			if err != nil {
+				return &txTraceResult{System: true, Error: err.Error()}
+			}
+			sysTracer.CaptureSystemOp(&SystemOp{
+				Type:  SystemOpBurn,
+				From:  &from,
+				Value: new(big.Int).Mul(price, new(big.Int).SetUint64(used)),
+			})
+		}
+	}
+	// The rules of the consensus engine are applied on top of the transactions,
+	// with every balance change reported to the tracer right before it happens.
+	statedb.SetLogger(&systemOpLogger{tracer: sysTracer})
+	api.backend.Engine().Finalize(&chainContext{api: api, ctx: ctx}, block.Header(), statedb, block.Transactions(), block.Uncles(), block.Withdrawals())
+	statedb.SetLogger(nil)
+
+	tracer.CaptureTxEnd(0)
+	res, err := tracer.GetResult()
+	if err != nil {
+		return &txTraceResult{System: true, Error: err.Error()}
+	}
+	return &txTraceResult{System: true, Result: res}
+}
+
+// systemOpLogger forwards the balance changes applied by the consensus engine
+// to a tracer as system operations.
+type systemOpLogger struct {
+	tracer SystemTracer
+}
+
+func (l *systemOpLogger) OnBalanceChange(addr common.Address, prev, cur *big.Int, reason tracing.BalanceChangeReason) {
+	op := &SystemOp{Value: new(big.Int).Sub(cur, prev), Pending: true}
+	switch reason {
+	case tracing.BalanceIncreaseRewardMineBlock:
+		op.Type = SystemOpReward
+	case tracing.BalanceIncreaseRewardMineUncle:
+		op.Type = SystemOpUncleReward
+	case tracing.BalanceIncreaseWithdrawal:
+		op.Type = SystemOpWithdrawal
+	default:
+		op.Type = SystemOpOther
+	}
+	if op.Value.Sign() < 0 {
+		op.From, op.Value = &addr, op.Value.Neg(op.Value)
+	} else {
+		op.To = &addr
+	}
+	l.tracer.CaptureSystemOp(op)
+}
+
+func (l *systemOpLogger) OnNonceChange(addr common.Address, prev, new uint64) {}
+
+func (l *systemOpLogger) OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+}
+
+func (l *systemOpLogger) OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+}
+
+func (l *systemOpLogger) OnLog(log *types.Log) {}
+
+// traceBlockTxs executes the transactions of a block up to and including the one
+// at index last on top of the parent state, and fans out the tracing of the ones
+// from index first on to a pool of workers. The state is generated once in a
+// single thread without tracing, every worker receives a copy of the state right
+// before its transaction. The copies in flight of all block traces together are
+// bounded by the memory budget of the API.
+//
+// The results are ordered by transaction, failed traces carry their error. If
+// the state generation fails, the results of the transactions traced so far are
+// returned along with the error.
+func (api *API) traceBlockTxs(ctx context.Context, block *types.Block, statedb *state.StateDB, blockCtx vm.BlockContext, chainConfig *params.ChainConfig, first, last int,
+	trace func(task *txTraceTask, tx *types.Transaction, msg *core.Message) (interface{}, error)) ([]*txTraceResult, error) {
 	var (
-		txs       = block.Transactions()
-		blockHash = block.Hash()
-		blockCtx  = core.NewEVMBlockContext(block.Header(), excessDataGas, api.chainContext(ctx), nil)
-		signer    = types.MakeSigner(api.backend.ChainConfig(), block.Number(), block.Time())
-		results   = make([]*txTraceResult, len(txs))
-		pend      sync.WaitGroup
+		txs     = block.Transactions()
+		signer  = types.MakeSigner(chainConfig, block.Number(), block.Time())
+		is158   = chainConfig.IsEIP158(block.Number())
+		results = make([]*txTraceResult, last+1)
+		pend    sync.WaitGroup
 	)
 	threads := runtime.NumCPU()
-	if threads > len(txs) {
-		threads = len(txs)
+	if threads > last-first+1 {
+		threads = last - first + 1
 	}
 	jobs := make(chan *txTraceTask, threads)
 	for th := 0; th < threads; th++ {
@@ -683,14 +841,10 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, exce
 			defer pend.Done()
 			// Fetch and execute the next transaction trace tasks
 			for task := range jobs {
-				msg, _ := core.TransactionToMessage(txs[task.index], signer, block.BaseFee())
-				txctx := &Context{
-					BlockHash:   blockHash,
-					BlockNumber: block.Number(),
-					TxIndex:     task.index,
-					TxHash:      txs[task.index].Hash(),
-				}
-				res, err := api.traceTx(ctx, msg, txctx, blockCtx, task.statedb, config)
+				tx := txs[task.index]
+				msg, _ := core.TransactionToMessage(tx, signer, block.BaseFee())
+				res, err := trace(task, tx, msg)
+				api.budget.Release(task.size)
 				if err != nil {
 					results[task.index] = &txTraceResult{Error: err.Error()}
 					continue
@@ -699,41 +853,50 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, exce
 			}
 		}()
 	}
-
 	// Feed the transactions into the tracers and return
 	var failed error
 txloop:
-	for i, tx := range txs {
-		// Send the trace task over for execution
-		task := &txTraceTask{statedb: statedb.Copy(), index: i}
-		select {
-		case <-ctx.Done():
-			failed = ctx.Err()
-			break txloop
-		case jobs <- task:
+	for i := 0; i <= last; i++ {
+		if i >= first {
+			// Wait until the state copy fits into the memory budget. A single
+			// copy is always allowed, even if it exceeds the budget on its own.
+			size := int64(statedb.CopySize())
+			if size > int64(api.memoryBudget) {
+				size = int64(api.memoryBudget)
+			}
+			if err := api.budget.Acquire(ctx, size); err != nil {
+				failed = err
+				break
+			}
+			// Send the trace task over for execution
+			task := &txTraceTask{statedb: statedb.Copy(), index: i, size: size}
+			select {
+			case <-ctx.Done():
+				api.budget.Release(size)
+				failed = ctx.Err()
+				break txloop
+			case jobs <- task:
+			}
+		}
+		if i == last {
+			break
 		}
-
 		// Generate the next state snapshot fast without tracing
-		msg, _ := core.TransactionToMessage(tx, signer, block.BaseFee())
-		statedb.SetTxContext(tx.Hash(), i)
-		vmenv := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, api.backend.ChainConfig(), vm.Config{})
+		msg, _ := core.TransactionToMessage(txs[i], signer, block.BaseFee())
+		statedb.SetTxContext(txs[i].Hash(), i)
+		vmenv := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, chainConfig, vm.Config{})
 		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.GasLimit).AddDataGas(params.MaxDataGasPerBlock)); err != nil {
 			failed = err
 			break txloop
 		}
 		// Finalize the state so any modifications are written to the trie
 		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
-		statedb.Finalise(vmenv.ChainConfig().IsEIP158(block.Number()))
+		statedb.Finalise(is158)
 	}
-
 	close(jobs)
 	pend.Wait()
 
-	// If execution failed in between, abort
-	if failed != nil {
-		return nil, failed
-	}
-	return results, nil
+	return results, failed
 }
 
 // standardTraceBlockToFile configures a new tracer which uses standard JSON output,
@@ -780,8 +943,6 @@ func (api *API) standardTraceBlockToFile(ctx context.Context, block *types.Block
 
 	// Execute transaction, either tracing all or just the requested one
 	var (
-		dumps       []string
-		signer      = types.MakeSigner(api.backend.ChainConfig(), block.Number(), block.Time())
 		chainConfig = api.backend.ChainConfig()
 		vmctx       = core.NewEVMBlockContext(block.Header(), excessDataGas, api.chainContext(ctx), nil)
 		canon       = true
@@ -795,61 +956,64 @@ func (api *API) standardTraceBlockToFile(ctx context.Context, block *types.Block
 		// Note: This copies the config, to not screw up the main config
 		chainConfig, canon = overrideConfig(chainConfig, config.Overrides)
 	}
+	// Trace either all transactions, or only the requested one
+	first, last := 0, len(block.Transactions())-1
 	for i, tx := range block.Transactions() {
-		// Prepare the transaction for un-traced execution
-		var (
-			msg, _    = core.TransactionToMessage(tx, signer, block.BaseFee())
-			txContext = core.NewEVMTxContext(msg)
-			vmConf    vm.Config
-			dump      *os.File
-			writer    *bufio.Writer
-			err       error
-		)
-		// If the transaction needs tracing, swap out the configs
-		if tx.Hash() == txHash || txHash == (common.Hash{}) {
-			// Generate a unique temporary file to dump it into
-			prefix := fmt.Sprintf("block_%#x-%d-%#x-", block.Hash().Bytes()[:4], i, tx.Hash().Bytes()[:4])
-			if !canon {
-				prefix = fmt.Sprintf("%valt-", prefix)
-			}
-			dump, err = os.CreateTemp(os.TempDir(), prefix)
-			if err != nil {
-				return nil, err
-			}
-			dumps = append(dumps, dump.Name())
-
-			// Swap out the noop logger to the standard tracer
-			writer = bufio.NewWriter(dump)
-			vmConf = vm.Config{
-				Debug:                   true,
-				Tracer:                  logger.NewJSONLogger(&logConfig, writer),
-				EnablePreimageRecording: true,
-			}
-		}
-		// Execute the transaction and flush any traces to disk
-		vmenv := vm.NewEVM(vmctx, txContext, statedb, chainConfig, vmConf)
-		statedb.SetTxContext(tx.Hash(), i)
-		_, err = core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.GasLimit).AddDataGas(params.MaxDataGasPerBlock))
-		if writer != nil {
-			writer.Flush()
+		if tx.Hash() == txHash {
+			first, last = i, i
+			break
 		}
-		if dump != nil {
-			dump.Close()
-			log.Info("Wrote standard trace", "file", dump.Name())
+	}
+	results, err := api.traceBlockTxs(ctx, block, statedb, vmctx, chainConfig, first, last, func(task *txTraceTask, tx *types.Transaction, msg *core.Message) (interface{}, error) {
+		// Generate a unique temporary file to dump it into
+		prefix := fmt.Sprintf("block_%#x-%d-%#x-", block.Hash().Bytes()[:4], task.index, tx.Hash().Bytes()[:4])
+		if !canon {
+			prefix = fmt.Sprintf("%valt-", prefix)
 		}
+		dump, err := os.CreateTemp(os.TempDir(), prefix)
 		if err != nil {
-			return dumps, err
+			return nil, err
 		}
-		// Finalize the state so any modifications are written to the trie
-		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
-		statedb.Finalise(vmenv.ChainConfig().IsEIP158(block.Number()))
-
-		// If we've traced the transaction we were looking for, abort
-		if tx.Hash() == txHash {
+		// Swap out the noop logger to the standard tracer
+		writer := bufio.NewWriter(dump)
+		vmConf := vm.Config{
+			Debug:                   true,
+			Tracer:                  logger.NewJSONLogger(&logConfig, writer),
+			EnablePreimageRecording: true,
+		}
+		// Execute the transaction and flush any traces to disk
+		vmenv := vm.NewEVM(vmctx, core.NewEVMTxContext(msg), task.statedb, chainConfig, vmConf)
+		task.statedb.SetTxContext(tx.Hash(), task.index)
+		_, err = core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.GasLimit).AddDataGas(params.MaxDataGasPerBlock))
+		writer.Flush()
+		dump.Close()
+		log.Info("Wrote standard trace", "file", dump.Name())
+
+		// The dump is reported even if the execution failed
+		return &stdTraceDump{name: dump.Name(), err: err}, nil
+	})
+	// Collect the dumps in transaction order, stopping at the first failure
+	var dumps []string
+	for _, res := range results[first:] {
+		if res == nil {
 			break
 		}
+		if res.Error != "" {
+			return dumps, errors.New(res.Error)
+		}
+		dump := res.Result.(*stdTraceDump)
+		dumps = append(dumps, dump.name)
+		if dump.err != nil {
+			return dumps, dump.err
+		}
 	}
-	return dumps, nil
+	return dumps, err
+}
+
+// stdTraceDump is the outcome of tracing a transaction into a file.
+type stdTraceDump struct {
+	name string // File the trace was written to
+	err  error  // Error the execution failed with
 }
 
 // containsTx reports whether the transaction with a certain hash
@@ -878,6 +1042,11 @@ func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *
 	if blockNumber == 0 {
 		return nil, errors.New("genesis is not traceable")
 	}
+	if name, ok := storedTracer(config); ok {
+		if trace := rawdb.ReadTxTrace(api.backend.ChainDb(), blockHash, int(index), name); trace != nil {
+			return json.RawMessage(trace), nil
+		}
+	}
 	reexec := defaultTraceReexec
 	if config != nil && config.Reexec != nil {
 		reexec = *config.Reexec
@@ -901,6 +1070,84 @@ func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *
 	return api.traceTx(ctx, msg, txctx, vmctx, statedb, config)
 }
 
+// storedBlockTraces returns the stored results of the tracer requested by config
+// for all transactions of the block, or nil if any of them is missing.
+func (api *API) storedBlockTraces(block *types.Block, config *TraceConfig) []*txTraceResult {
+	name, ok := storedTracer(config)
+	if !ok {
+		return nil
+	}
+	var (
+		db      = api.backend.ChainDb()
+		txs     = block.Transactions()
+		results = make([]*txTraceResult, len(txs))
+	)
+	for i := range txs {
+		trace := rawdb.ReadTxTrace(db, block.Hash(), i, name)
+		if trace == nil {
+			return nil
+		}
+		results[i] = &txTraceResult{Result: json.RawMessage(trace)}
+	}
+	return results
+}
+
+// BackfillTraces runs the given native tracers on all transactions of the blocks
+// in the interval [start, end] and persists their results, so that later trace
+// requests for these blocks can be served without re-executing them. It returns
+// the number of processed blocks.
+func (api *API) BackfillTraces(ctx context.Context, start, end rpc.BlockNumber, tracers []string) (hexutil.Uint64, error) {
+	logger, err := NewStoreLogger(api.backend.ChainDb(), tracers, 0)
+	if err != nil {
+		return 0, err
+	}
+	from, err := api.blockByNumber(ctx, start)
+	if err != nil {
+		return 0, err
+	}
+	to, err := api.blockByNumber(ctx, end)
+	if err != nil {
+		return 0, err
+	}
+	if from.NumberU64() > to.NumberU64() {
+		return 0, fmt.Errorf("end block (#%d) needs to come after start block (#%d)", to.NumberU64(), from.NumberU64())
+	}
+	var processed hexutil.Uint64
+	for number := from.NumberU64(); number <= to.NumberU64(); number++ {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		if number == 0 {
+			continue // genesis has no transactions to trace
+		}
+		block, err := api.blockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return processed, err
+		}
+		if err := api.backfillBlock(ctx, block, logger); err != nil {
+			return processed, fmt.Errorf("failed to trace block #%d: %w", number, err)
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// backfillBlock re-executes all transactions of the block with the given store
+// logger attached, the same way as during block import.
+func (api *API) backfillBlock(ctx context.Context, block *types.Block, logger *StoreLogger) error {
+	parent, err := api.blockByNumberAndHash(ctx, rpc.BlockNumber(block.NumberU64()-1), block.ParentHash())
+	if err != nil {
+		return err
+	}
+	statedb, release, err := api.backend.StateAtBlock(ctx, parent, defaultTraceReexec, nil, true, false)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return BackfillBlock(api.chainContext(ctx), api.backend.ChainConfig(), block, parent.Header(), statedb, logger)
+}
+
 // TraceCall lets you trace a given eth_call. It collects the structured logs
 // created during the execution of EVM if the given transaction was added on
 // top of the provided block and returns them as a JSON object.
@@ -989,6 +1236,10 @@ func (api *API) traceTx(ctx context.Context, message *core.Message, txctx *Conte
 			return nil, err
 		}
 	}
+	// Release the resources of tracers holding any, even if the trace fails
+	if closer, ok := tracer.(io.Closer); ok {
+		defer closer.Close()
+	}
 	vmenv := vm.NewEVM(vmctx, txContext, statedb, api.backend.ChainConfig(), vm.Config{Debug: true, Tracer: tracer, NoBaseFee: true})
 
 	// Define a meaningful timeout of a single transaction trace
@@ -114,6 +114,13 @@ func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber)
 	return b.chain.GetBlockByNumber(uint64(number)), nil
 }
 
+func (b *testBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
+	if header := b.chain.GetHeaderByHash(hash); header != nil {
+		return b.chain.GetTd(hash, header.Number.Uint64())
+	}
+	return nil
+}
+
 func (b *testBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
 	tx, hash, blockNumber, index := rawdb.ReadTransaction(b.chaindb, txHash)
 	return tx, hash, blockNumber, index, nil
@@ -450,6 +457,142 @@ func TestTraceBlock(t *testing.T) {
 	}
 }
 
+func TestTraceBlockMemoryBudget(t *testing.T) {
+	t.Parallel()
+
+	// Initialize test accounts
+	accounts := newAccounts(2)
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+			accounts[1].addr: {Balance: big.NewInt(params.Ether)},
+		},
+	}
+	txs := 20
+	signer := types.HomesteadSigner{}
+	backend := newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {
+		for j := 0; j < txs; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(uint64(j), accounts[1].addr, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, accounts[0].key)
+			b.AddTx(tx)
+		}
+	})
+	defer backend.chain.Stop()
+
+	want, err := NewAPI(backend).TraceBlockByNumber(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(want) != txs {
+		t.Fatalf("result count mismatch: have %d, want %d", len(want), txs)
+	}
+	// Tracing with a budget fitting a single state copy must not change the results
+	have, err := newAPI(backend, 1).TraceBlockByNumber(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatalf("failed to trace block with minimal budget: %v", err)
+	}
+	haveBlob, _ := json.Marshal(have)
+	wantBlob, _ := json.Marshal(want)
+	if string(haveBlob) != string(wantBlob) {
+		t.Errorf("result mismatch: have %s, want %s", haveBlob, wantBlob)
+	}
+}
+
+func init() {
+	DefaultDirectory.Register("systemOpRecorder", func(*Context, json.RawMessage) (Tracer, error) {
+		return new(systemOpRecorder), nil
+	}, false)
+}
+
+// systemOpRecorder is a tracer which returns the system operations it captured.
+type systemOpRecorder struct {
+	ops []*SystemOp
+}
+
+func (r *systemOpRecorder) CaptureTxStart(gasLimit uint64) {}
+func (r *systemOpRecorder) CaptureTxEnd(restGas uint64)    {}
+func (r *systemOpRecorder) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+func (r *systemOpRecorder) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+func (r *systemOpRecorder) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+func (r *systemOpRecorder) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (r *systemOpRecorder) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+func (r *systemOpRecorder) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (r *systemOpRecorder) CaptureSystemStart(env *vm.EVM) {}
+func (r *systemOpRecorder) CaptureSystemOp(op *SystemOp)   { r.ops = append(r.ops, op) }
+func (r *systemOpRecorder) Stop(err error)                 {}
+func (r *systemOpRecorder) GetResult() (json.RawMessage, error) {
+	return json.Marshal(r.ops)
+}
+
+func TestTraceBlockSystemOps(t *testing.T) {
+	t.Parallel()
+
+	// Initialize test accounts
+	accounts := newAccounts(3)
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+		},
+	}
+	signer := types.HomesteadSigner{}
+	backend := newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(accounts[2].addr)
+		tx, _ := types.SignTx(types.NewTransaction(0, accounts[1].addr, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, accounts[0].key)
+		b.AddTx(tx)
+	})
+	defer backend.chain.Stop()
+	api := NewAPI(backend)
+
+	tracer := "systemOpRecorder"
+
+	results, err := api.TraceBlockByNumber(context.Background(), 1, &TraceConfig{Tracer: &tracer, SystemOps: true})
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("result count mismatch: have %d, want 2", len(results))
+	}
+	if results[0].System || !results[1].System {
+		t.Fatalf("system flags mismatch: have %v and %v", results[0].System, results[1].System)
+	}
+	have, _ := json.Marshal(results[1].Result)
+	want, _ := json.Marshal([]*SystemOp{{
+		Type:    SystemOpReward,
+		To:      &accounts[2].addr,
+		Value:   new(big.Int).Mul(big.NewInt(2), big.NewInt(params.Ether)),
+		Pending: true,
+	}})
+	if string(have) != string(want) {
+		t.Errorf("system operations mismatch\nhave: %s\nwant: %s", have, want)
+	}
+	// Tracers without support for system operations report an error
+	results, err = api.TraceBlockByNumber(context.Background(), 1, &TraceConfig{SystemOps: true})
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(results) != 2 || results[1].Error == "" {
+		t.Errorf("expected unsupported system operations error, have %+v", results[len(results)-1])
+	}
+}
+
+func TestChainContextTd(t *testing.T) {
+	t.Parallel()
+
+	backend := newTestBackend(t, 1, &core.Genesis{Config: params.TestChainConfig}, func(i int, b *core.BlockGen) {})
+	defer backend.chain.Stop()
+
+	head := backend.chain.CurrentBlock()
+	chain := NewAPI(backend).chainContext(context.Background()).(*chainContext)
+	if have, want := chain.GetTd(head.Hash(), head.Number.Uint64()), backend.chain.GetTd(head.Hash(), head.Number.Uint64()); have == nil || have.Cmp(want) != 0 {
+		t.Errorf("total difficulty mismatch: have %v, want %v", have, want)
+	}
+}
+
 func TestTracingWithOverrides(t *testing.T) {
 	t.Parallel()
 	// Initialize test accounts
@@ -0,0 +1,170 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+func TestGasProfiler(t *testing.T) {
+	var (
+		caller = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		callee = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		failer = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+		one    = big.NewInt(1)
+		zero   = big.NewInt(0)
+	)
+	alloc := core.GenesisAlloc{
+		caller: {Balance: zero, Code: transferProgram{}.push(one).push(zero).op(vm.SSTORE).call(callee, 0).call(failer, 0).op(vm.STOP)},
+		callee: {Balance: zero, Code: transferProgram{}.push(one).push(zero).op(vm.SSTORE, vm.STOP)},
+		failer: {Balance: zero, Code: transferProgram{}.op(vm.INVALID)},
+	}
+	res, raw := traceGasProfile(t, nil, caller, alloc)
+
+	var folded string
+	if err := json.Unmarshal(raw, &folded); err != nil {
+		t.Fatalf("failed to decode profile: %v", err)
+	}
+	var (
+		total uint64
+		have  = make(map[string]uint64)
+	)
+	for _, line := range strings.Split(strings.TrimSuffix(folded, "\n"), "\n") {
+		i := strings.LastIndexByte(line, ' ')
+		gas, err := strconv.ParseUint(line[i+1:], 10, 64)
+		if err != nil {
+			t.Fatalf("invalid profile line %q: %v", line, err)
+		}
+		have[line[:i]] = gas
+		total += gas
+	}
+	if total != res.UsedGas {
+		t.Errorf("profiled gas mismatch: have %d, want %d\n%s", total, res.UsedGas, folded)
+	}
+	root := caller.Hex()
+	want := map[string]uint64{
+		"[intrinsic]":                         21000,
+		root + ";SSTORE":                      20000,
+		root + ";" + callee.Hex() + ";SSTORE": 20000,
+	}
+	for stack, gas := range want {
+		if have[stack] != gas {
+			t.Errorf("gas of %s mismatch: have %d, want %d", stack, have[stack], gas)
+		}
+	}
+	// The gas forwarded to the failing call is consumed by its only instruction
+	if have[root+";"+failer.Hex()+";INVALID"] < 100000 {
+		t.Errorf("gas of failing call missing:\n%s", folded)
+	}
+	// The pprof format contains the same frames
+	_, raw = traceGasProfile(t, json.RawMessage(`{"format":"pprof"}`), caller, alloc)
+	var blob hexutil.Bytes
+	if err := json.Unmarshal(raw, &blob); err != nil {
+		t.Fatalf("failed to decode pprof profile: %v", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatalf("invalid pprof profile: %v", err)
+	}
+	profile, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("invalid pprof profile: %v", err)
+	}
+	for _, name := range []string{"gas", "[intrinsic]", root, callee.Hex(), "SSTORE", "INVALID"} {
+		if !bytes.Contains(profile, []byte(name)) {
+			t.Errorf("pprof profile misses %q", name)
+		}
+	}
+}
+
+// traceGasProfile calls the given contract from a funded account and returns
+// the result of running the gas profiler on the transaction.
+func traceGasProfile(t *testing.T, cfg json.RawMessage, to common.Address, alloc core.GenesisAlloc) (*core.ExecutionResult, json.RawMessage) {
+	t.Helper()
+
+	privkey, err := crypto.HexToECDSA("0000000000000000deadbeef00000000000000000000000000000000deadbeef")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignNewTx(privkey, signer, &types.LegacyTx{
+		GasPrice: big.NewInt(1),
+		Gas:      500000,
+		To:       &to,
+		Value:    new(big.Int),
+	})
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: big.NewInt(1),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    common.HexToAddress("0xc0"),
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        5,
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	alloc[origin] = core.GenesisAccount{Balance: big.NewInt(500000000000000)}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+	tracer, err := tracers.DefaultDirectory.New("gasProfiler", nil, cfg)
+	if err != nil {
+		t.Fatalf("failed to create gas profiler: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	msg, err := core.TransactionToMessage(tx, signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	res, err := st.TransitionDb()
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	if res.Failed() {
+		t.Fatalf("transaction failed: %v", res.Err)
+	}
+	raw, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res, raw
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// TestStateDiffTracer checks that the state diff tracer attributes storage
+// accesses, value transfers and code deployments to the right frame and pc, and
+// reports the balance changes of the gas accounting.
+func TestStateDiffTracer(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+		reverter = common.HexToAddress("0xee")
+		coinbase = common.HexToAddress("0xc0")
+		created  = crypto.CreateAddress(contract, 1)
+		hash     = func(n int64) string { return common.BigToHash(big.NewInt(n)).Hex() }
+
+		// PUSH1 1 PUSH1 0 RETURN, deploying a single zero byte.
+		initCode = []byte{byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x00, byte(vm.RETURN)}
+	)
+	code := transferProgram{}.push(big.NewInt(5)).push(big.NewInt(1))
+	sstorePC := len(code)
+	code = code.op(vm.SSTORE).push(big.NewInt(1))
+	sloadPC := len(code)
+	code = code.op(vm.SLOAD, vm.POP).push(big.NewInt(0)).push(big.NewInt(2))
+	clearPC := len(code)
+	code = code.op(vm.SSTORE).
+		push(new(big.Int).SetBytes(common.RightPadBytes(initCode, 32))).push(big.NewInt(0)).op(vm.MSTORE).
+		push(big.NewInt(int64(len(initCode)))).push(big.NewInt(0)).push(big.NewInt(3))
+	createPC := len(code)
+	code = code.op(vm.CREATE, vm.POP).call(reverter, 0).op(vm.STOP)
+
+	revertCode := transferProgram{}.push(big.NewInt(7)).push(big.NewInt(2))
+	revertPC := len(revertCode)
+	revertCode = revertCode.op(vm.SSTORE).push(big.NewInt(0)).push(big.NewInt(0)).op(vm.REVERT)
+
+	privkey, err := crypto.HexToECDSA("0000000000000000deadbeef00000000000000000000000000000000deadbeef")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignNewTx(privkey, signer, &types.LegacyTx{
+		GasPrice: big.NewInt(1),
+		Gas:      500000,
+		To:       &contract,
+		Value:    big.NewInt(100),
+	})
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: big.NewInt(1),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    coinbase,
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        5,
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	alloc := core.GenesisAlloc{
+		contract: core.GenesisAccount{Nonce: 1, Code: code, Storage: map[common.Hash]common.Hash{common.BigToHash(big.NewInt(2)): common.BigToHash(big.NewInt(1))}},
+		reverter: core.GenesisAccount{Nonce: 1, Code: revertCode},
+		origin:   core.GenesisAccount{Balance: big.NewInt(500000000000000)},
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+	tracer, err := tracers.DefaultDirectory.New("stateDiffTracer", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create state diff tracer: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	msg, err := core.TransactionToMessage(tx, signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	res, err := st.TransitionDb()
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	if res.Failed() {
+		t.Fatalf("transaction failed: %v", res.Err)
+	}
+	raw, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	var result struct {
+		Post   map[common.Address]json.RawMessage `json:"post"`
+		Pre    map[common.Address]json.RawMessage `json:"pre"`
+		Events []json.RawMessage                  `json:"events"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	// The gas price is 1 and there is no base fee, so the fee is the gas used.
+	want := []string{
+		fmt.Sprintf(`{"type":"balance","traceAddress":[],"reason":"gasBuy","address":"%s","amount":"0x7a120"}`, hexAddr(origin)),
+		fmt.Sprintf(`{"type":"balance","traceAddress":[],"op":"CALL","address":"%s","from":"%s","amount":"0x64"}`, hexAddr(contract), hexAddr(origin)),
+		fmt.Sprintf(`{"type":"storageWrite","traceAddress":[],"pc":%d,"op":"SSTORE","address":"%s","slot":"%s","prev":"%s","value":"%s"}`, sstorePC, hexAddr(contract), hash(1), hash(0), hash(5)),
+		fmt.Sprintf(`{"type":"storageRead","traceAddress":[],"pc":%d,"op":"SLOAD","address":"%s","slot":"%s","value":"%s"}`, sloadPC, hexAddr(contract), hash(1), hash(5)),
+		fmt.Sprintf(`{"type":"storageWrite","traceAddress":[],"pc":%d,"op":"SSTORE","address":"%s","slot":"%s","prev":"%s","value":"%s"}`, clearPC, hexAddr(contract), hash(2), hash(1), hash(0)),
+		fmt.Sprintf(`{"type":"balance","traceAddress":[],"pc":%d,"op":"CREATE","address":"%s","from":"%s","amount":"0x3"}`, createPC, hexAddr(created), hexAddr(contract)),
+		fmt.Sprintf(`{"type":"code","traceAddress":[],"pc":%d,"op":"CREATE","address":"%s","code":"0x00"}`, createPC, hexAddr(created)),
+		fmt.Sprintf(`{"type":"storageWrite","traceAddress":[1],"pc":%d,"op":"SSTORE","address":"%s","slot":"%s","prev":"%s","value":"%s","reverted":true}`, revertPC, hexAddr(reverter), hash(2), hash(0), hash(7)),
+		fmt.Sprintf(`{"type":"balance","traceAddress":[],"reason":"gasReturn","address":"%s","amount":"%#x"}`, hexAddr(origin), tx.Gas()-res.UsedGas),
+		fmt.Sprintf(`{"type":"balance","traceAddress":[],"reason":"fee","address":"%s","amount":"%#x"}`, hexAddr(coinbase), res.UsedGas),
+	}
+	if len(result.Events) != len(want) {
+		t.Fatalf("wrong number of events: have %d, want %d\n%s", len(result.Events), len(want), raw)
+	}
+	for i, event := range result.Events {
+		if string(event) != want[i] {
+			t.Errorf("event %d mismatch\n have: %s\n want: %s", i, event, want[i])
+		}
+	}
+	// The diff itself is the one of the prestate tracer.
+	wantPost := fmt.Sprintf(`{"balance":"0x61","nonce":2,"storage":{"%s":"%s"}}`, hash(1), hash(5))
+	if post := string(result.Post[contract]); post != wantPost {
+		t.Errorf("post state mismatch\n have: %s\n want: %s", post, wantPost)
+	}
+	if _, ok := result.Post[reverter]; ok {
+		t.Error("reverted write included in post state")
+	}
+	// Summing up the non-reverted balance changes of the sender and the
+	// coinbase yields their post balances.
+	var (
+		sender = big.NewInt(500000000000000)
+		fee    = new(big.Int)
+	)
+	for _, event := range result.Events {
+		var e struct {
+			Type     string          `json:"type"`
+			Reason   string          `json:"reason"`
+			Address  common.Address  `json:"address"`
+			From     *common.Address `json:"from"`
+			Amount   *hexutil.Big    `json:"amount"`
+			Reverted bool            `json:"reverted"`
+		}
+		if err := json.Unmarshal(event, &e); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		if e.Type != "balance" || e.Reverted {
+			continue
+		}
+		switch {
+		case e.Reason == "gasBuy", e.From != nil && *e.From == origin:
+			sender.Sub(sender, e.Amount.ToInt())
+		case e.Address == origin:
+			sender.Add(sender, e.Amount.ToInt())
+		case e.Address == coinbase:
+			fee.Add(fee, e.Amount.ToInt())
+		}
+	}
+	if have := statedb.GetBalance(origin); have.Cmp(sender) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", have, sender)
+	}
+	if have := statedb.GetBalance(coinbase); have.Cmp(fee) != 0 {
+		t.Errorf("coinbase balance mismatch: have %v, want %v", have, fee)
+	}
+}
+
+func hexAddr(addr common.Address) string {
+	return fmt.Sprintf("%#x", addr)
+}
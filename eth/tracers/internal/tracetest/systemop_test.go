@@ -0,0 +1,102 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// traceSystemOps runs the named tracer over a pseudo-transaction of a burn by
+// sender, followed by a reward and a withdrawal credited to miner.
+func traceSystemOps(t *testing.T, tracerName string, cfg json.RawMessage, sender, miner common.Address) json.RawMessage {
+	t.Helper()
+
+	alloc := core.GenesisAlloc{
+		sender: {Balance: big.NewInt(100)},
+		miner:  {Balance: big.NewInt(10)},
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+	env := vm.NewEVM(vm.BlockContext{BlockNumber: big.NewInt(1)}, vm.TxContext{GasPrice: new(big.Int)}, statedb, params.MainnetChainConfig, vm.Config{})
+
+	tracer, err := tracers.DefaultDirectory.New(tracerName, new(tracers.Context), cfg)
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+	sysTracer, ok := tracer.(tracers.SystemTracer)
+	if !ok {
+		t.Fatalf("tracer %s doesn't support system operations", tracerName)
+	}
+	tracer.CaptureTxStart(0)
+	sysTracer.CaptureSystemStart(env)
+	sysTracer.CaptureSystemOp(&tracers.SystemOp{Type: tracers.SystemOpBurn, From: &sender, Value: big.NewInt(7)})
+	for _, op := range []*tracers.SystemOp{
+		{Type: tracers.SystemOpReward, To: &miner, Value: big.NewInt(2), Pending: true},
+		{Type: tracers.SystemOpWithdrawal, To: &miner, Value: big.NewInt(3), Pending: true},
+	} {
+		sysTracer.CaptureSystemOp(op)
+		statedb.AddBalance(*op.To, op.Value, tracing.BalanceChangeUnspecified)
+	}
+	tracer.CaptureTxEnd(0)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res
+}
+
+func TestCallTracerSystemOps(t *testing.T) {
+	var (
+		sender = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		miner  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	)
+	res := traceSystemOps(t, "callTracer", nil, sender, miner)
+
+	want := `{"from":"0x0000000000000000000000000000000000000000","gas":"0x0","gasUsed":"0x0","input":"0x","calls":[` +
+		`{"from":"0x00000000000000000000000000000000000000aa","gas":"0x0","gasUsed":"0x0","input":"0x","value":"0x7","type":"BURN"},` +
+		`{"from":"0x0000000000000000000000000000000000000000","gas":"0x0","gasUsed":"0x0","to":"0x00000000000000000000000000000000000000bb","input":"0x","value":"0x2","type":"REWARD"},` +
+		`{"from":"0x0000000000000000000000000000000000000000","gas":"0x0","gasUsed":"0x0","to":"0x00000000000000000000000000000000000000bb","input":"0x","value":"0x3","type":"WITHDRAWAL"}` +
+		`],"type":"SYSTEM"}`
+	if string(res) != want {
+		t.Errorf("trace mismatch\nhave: %s\nwant: %s", res, want)
+	}
+}
+
+func TestPrestateTracerSystemOps(t *testing.T) {
+	var (
+		sender = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		miner  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	)
+	res := traceSystemOps(t, "prestateTracer", json.RawMessage(`{"diffMode": true}`), sender, miner)
+
+	// The burn is part of the state changes of its transaction
+	want := `{"post":{"0x00000000000000000000000000000000000000bb":{"balance":"0xf"}},"pre":{"0x00000000000000000000000000000000000000bb":{"balance":"0xa"}}}`
+	if string(res) != want {
+		t.Errorf("trace mismatch\nhave: %s\nwant: %s", res, want)
+	}
+}
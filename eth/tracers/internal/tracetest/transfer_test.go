@@ -0,0 +1,215 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// transferProgram assembles EVM bytecode for the transfer tracer test.
+type transferProgram []byte
+
+func (p transferProgram) push(v *big.Int) transferProgram {
+	return append(append(p, byte(vm.PUSH32)), common.BigToHash(v).Bytes()...)
+}
+
+func (p transferProgram) pushAddr(addr common.Address) transferProgram {
+	return p.push(new(big.Int).SetBytes(addr.Bytes()))
+}
+
+func (p transferProgram) op(ops ...vm.OpCode) transferProgram {
+	for _, op := range ops {
+		p = append(p, byte(op))
+	}
+	return p
+}
+
+// mstore writes the given words to memory, starting at offset.
+func (p transferProgram) mstore(offset int64, words ...int64) transferProgram {
+	for i, w := range words {
+		p = p.push(big.NewInt(w)).push(big.NewInt(offset + int64(i)*32)).op(vm.MSTORE)
+	}
+	return p
+}
+
+// log emits a log of the given memory range with the given topics.
+func (p transferProgram) log(offset, size int64, topics ...common.Hash) transferProgram {
+	for i := len(topics) - 1; i >= 0; i-- {
+		p = p.push(topics[i].Big())
+	}
+	return p.push(big.NewInt(size)).push(big.NewInt(offset)).op(vm.LOG0 + vm.OpCode(len(topics)))
+}
+
+// call sends value to addr without any input and discards the result.
+func (p transferProgram) call(addr common.Address, value int64) transferProgram {
+	zero := big.NewInt(0)
+	return p.push(zero).push(zero).push(zero).push(zero).push(big.NewInt(value)).pushAddr(addr).op(vm.GAS, vm.CALL, vm.POP)
+}
+
+// TestTransferTracer checks that the transfer tracer decodes token transfer logs
+// and ether transfers, drops the ones of reverted frames and sums up the balance
+// changes.
+func TestTransferTracer(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+		reverter = common.HexToAddress("0xee")
+		holder   = common.HexToAddress("0xaa")
+		receiver = common.HexToAddress("0xbb")
+		payee    = common.HexToAddress("0xcc")
+		heir     = common.HexToAddress("0xdd")
+		coinbase = common.HexToAddress("0xc0")
+
+		transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+		batchTopic    = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+		holderTopic   = common.BytesToHash(holder.Bytes())
+		receiverTopic = common.BytesToHash(receiver.Bytes())
+		payeeTopic    = common.BytesToHash(payee.Bytes())
+		heirTopic     = common.BytesToHash(heir.Bytes())
+	)
+	code := transferProgram{}.
+		mstore(0, 1000).
+		log(0, 32, transferTopic, holderTopic, receiverTopic).                                  // ERC-20
+		log(0x10, 32, transferTopic, payeeTopic, heirTopic).                                    // ERC-20 reaching past the memory
+		log(0, 0, transferTopic, holderTopic, receiverTopic, common.BigToHash(big.NewInt(42))). // ERC-721
+		mstore(0x100, 0x40, 0xa0, 2, 1, 2, 2, 10, 20).
+		log(0x100, 8*32, batchTopic, holderTopic, holderTopic, receiverTopic). // ERC-1155
+		call(payee, 5).
+		call(reverter, 7).
+		pushAddr(heir).op(vm.SELFDESTRUCT)
+
+	revertCode := transferProgram{}.
+		mstore(0, 1).
+		log(0, 32, transferTopic, holderTopic, receiverTopic).
+		push(big.NewInt(0)).push(big.NewInt(0)).op(vm.REVERT)
+
+	privkey, err := crypto.HexToECDSA("0000000000000000deadbeef00000000000000000000000000000000deadbeef")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignNewTx(privkey, signer, &types.LegacyTx{
+		GasPrice: big.NewInt(1),
+		Gas:      500000,
+		To:       &contract,
+		Value:    big.NewInt(100),
+	})
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: big.NewInt(1),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    coinbase,
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        5,
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	alloc := core.GenesisAlloc{
+		contract: core.GenesisAccount{Nonce: 1, Code: code},
+		reverter: core.GenesisAccount{Nonce: 1, Code: revertCode},
+		origin:   core.GenesisAccount{Balance: big.NewInt(500000000000000)},
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+	tracer, err := tracers.DefaultDirectory.New("transferTracer", nil, json.RawMessage(`{"withFees":true}`))
+	if err != nil {
+		t.Fatalf("failed to create transfer tracer: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	msg, err := core.TransactionToMessage(tx, signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	res, err := st.TransitionDb()
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	if res.Failed() {
+		t.Fatalf("transaction failed: %v", res.Err)
+	}
+	raw, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	var result struct {
+		Transfers      []json.RawMessage                 `json:"transfers"`
+		BalanceChanges map[common.Address]map[string]any `json:"balanceChanges"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	fee := hexutil.EncodeBig(new(big.Int).SetUint64(res.UsedGas))
+	want := []string{
+		`{"type":"call","from":"0x682a80a6f560eec50d54e63cbeda1c324c5f8d1b","to":"0x00000000000000000000000000000000deadbeef","value":"0x64"}`,
+		`{"type":"erc20","token":"0x00000000000000000000000000000000deadbeef","from":"0x00000000000000000000000000000000000000aa","to":"0x00000000000000000000000000000000000000bb","value":"0x3e8"}`,
+		`{"type":"erc20","token":"0x00000000000000000000000000000000deadbeef","from":"0x00000000000000000000000000000000000000cc","to":"0x00000000000000000000000000000000000000dd","value":"0x3e800000000000000000000000000000000"}`,
+		`{"type":"erc721","token":"0x00000000000000000000000000000000deadbeef","from":"0x00000000000000000000000000000000000000aa","to":"0x00000000000000000000000000000000000000bb","tokenId":"0x2a","value":"0x1"}`,
+		`{"type":"erc1155","token":"0x00000000000000000000000000000000deadbeef","from":"0x00000000000000000000000000000000000000aa","to":"0x00000000000000000000000000000000000000bb","tokenId":"0x1","value":"0xa"}`,
+		`{"type":"erc1155","token":"0x00000000000000000000000000000000deadbeef","from":"0x00000000000000000000000000000000000000aa","to":"0x00000000000000000000000000000000000000bb","tokenId":"0x2","value":"0x14"}`,
+		`{"type":"call","from":"0x00000000000000000000000000000000deadbeef","to":"0x00000000000000000000000000000000000000cc","value":"0x5"}`,
+		`{"type":"selfdestruct","from":"0x00000000000000000000000000000000deadbeef","to":"0x00000000000000000000000000000000000000dd","value":"0x5f"}`,
+		`{"type":"fee","from":"0x682a80a6f560eec50d54e63cbeda1c324c5f8d1b","to":"0x00000000000000000000000000000000000000c0","value":"` + fee + `"}`,
+	}
+	if len(result.Transfers) != len(want) {
+		t.Fatalf("wrong number of transfers: have %d, want %d\n%s", len(result.Transfers), len(want), raw)
+	}
+	for i, tr := range result.Transfers {
+		if string(tr) != want[i] {
+			t.Errorf("transfer %d mismatch\n have: %s\n want: %s", i, tr, want[i])
+		}
+	}
+	// Check the aggregated balance changes of a few accounts. The ERC-20 amount
+	// and ERC-721 count of the test token add up.
+	changes, err := json.Marshal(map[common.Address]any{
+		origin:   result.BalanceChanges[origin],
+		contract: result.BalanceChanges[contract],
+		receiver: result.BalanceChanges[receiver],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spent := new(big.Int).SetUint64(res.UsedGas + 100)
+	wantChanges := `{"0x00000000000000000000000000000000000000bb":{"multiTokens":{"0x00000000000000000000000000000000deadbeef":{"0x1":"0xa","0x2":"0x14"}},"tokens":{"0x00000000000000000000000000000000deadbeef":"0x3e9"}},` +
+		`"0x00000000000000000000000000000000deadbeef":{"eth":"0x0"},` +
+		`"0x682a80a6f560eec50d54e63cbeda1c324c5f8d1b":{"eth":"` + hexutil.EncodeBig(spent.Neg(spent)) + `"}}`
+	if string(changes) != wantChanges {
+		t.Errorf("balance changes mismatch\n have: %s\n want: %s", changes, wantChanges)
+	}
+	if _, ok := result.BalanceChanges[reverter]; ok {
+		t.Error("reverted transfer reported in balance changes")
+	}
+}
@@ -111,6 +111,7 @@ type jsTracer struct {
 	gasLimit          uint64                // Amount of gas bought for the whole tx
 	err               error                 // Any error that should stop tracing
 	obj               *goja.Object          // Trace object
+	sandbox           *sandbox              // Resource limits of the JS code
 
 	// Methods exposed by tracer
 	result goja.Callable
@@ -143,8 +144,9 @@ func newJsTracer(code string, ctx *tracers.Context, cfg json.RawMessage) (tracer
 	// By default field names are exported to JS as is, i.e. capitalized.
 	vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
 	t := &jsTracer{
-		vm:  vm,
-		ctx: make(map[string]goja.Value),
+		vm:      vm,
+		ctx:     make(map[string]goja.Value),
+		sandbox: newSandbox(vm, defaultLimits),
 	}
 	if ctx == nil {
 		ctx = new(tracers.Context)
@@ -159,7 +161,13 @@ func newJsTracer(code string, ctx *tracers.Context, cfg json.RawMessage) (tracer
 
 	t.setTypeConverters()
 	t.setBuiltinFunctions()
-	ret, err := vm.RunString("(" + code + ")")
+	program, err := compile(code)
+	if err != nil {
+		return nil, err
+	}
+	t.sandbox.enter()
+	ret, err := vm.RunProgram(program)
+	t.sandbox.exit()
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +202,7 @@ func newJsTracer(code string, ctx *tracers.Context, cfg json.RawMessage) (tracer
 		if cfg != nil {
 			cfgStr = string(cfg)
 		}
-		if _, err := setup(obj, vm.ToValue(cfgStr)); err != nil {
+		if _, err := t.call(setup, vm.ToValue(cfgStr)); err != nil {
 			return nil, err
 		}
 	}
@@ -273,7 +281,7 @@ func (t *jsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope
 	log.refund = t.env.StateDB.GetRefund()
 	log.depth = depth
 	log.err = err
-	if _, err := t.step(t.obj, t.logValue, t.dbValue); err != nil {
+	if _, err := t.call(t.step, t.logValue, t.dbValue); err != nil {
 		t.onError("step", err)
 	}
 }
@@ -285,7 +293,7 @@ func (t *jsTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope
 	}
 	// Other log fields have been already set as part of the last CaptureState.
 	t.log.err = err
-	if _, err := t.fault(t.obj, t.logValue, t.dbValue); err != nil {
+	if _, err := t.call(t.fault, t.logValue, t.dbValue); err != nil {
 		t.onError("fault", err)
 	}
 }
@@ -317,7 +325,7 @@ func (t *jsTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Ad
 		t.frame.value = new(big.Int).SetBytes(value.Bytes())
 	}
 
-	if _, err := t.enter(t.obj, t.frameValue); err != nil {
+	if _, err := t.call(t.enter, t.frameValue); err != nil {
 		t.onError("enter", err)
 	}
 }
@@ -333,7 +341,7 @@ func (t *jsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
 	t.frameResult.output = common.CopyBytes(output)
 	t.frameResult.err = err
 
-	if _, err := t.exit(t.obj, t.frameResultValue); err != nil {
+	if _, err := t.call(t.exit, t.frameResultValue); err != nil {
 		t.onError("exit", err)
 	}
 }
@@ -341,7 +349,7 @@ func (t *jsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
 // GetResult calls the Javascript 'result' function and returns its value, or any accumulated error
 func (t *jsTracer) GetResult() (json.RawMessage, error) {
 	ctx := t.vm.ToValue(t.ctx)
-	res, err := t.result(t.obj, ctx, t.dbValue)
+	res, err := t.call(t.result, ctx, t.dbValue)
 	if err != nil {
 		return nil, wrapError("result", err)
 	}
@@ -357,6 +365,19 @@ func (t *jsTracer) Stop(err error) {
 	t.vm.Interrupt(err)
 }
 
+// call invokes a method of the tracer object within the limits of the sandbox.
+func (t *jsTracer) call(fn goja.Callable, args ...goja.Value) (goja.Value, error) {
+	t.sandbox.enter()
+	res, err := fn(t.obj, args...)
+	t.sandbox.exit()
+
+	// Stack overflows carry no message of their own
+	if _, ok := err.(*goja.StackOverflowError); ok {
+		err = fmt.Errorf("tracer exceeded call stack limit of %d", t.sandbox.limits.maxCallStackSize)
+	}
+	return res, err
+}
+
 // onError is called anytime the running JS code is interrupted
 // and returns an error. It in turn pings the EVM to cancel its
 // execution.
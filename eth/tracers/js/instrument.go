@@ -0,0 +1,429 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package js
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// stepFunc is the name of the global function the instrumented code calls
+	// on every step. It's reserved, so that tracers can't shadow it.
+	stepFunc = "__tracerStep"
+
+	// sourceName is the name of the tracer code reported in errors.
+	sourceName = "tracer"
+
+	// programCacheSize is the number of compiled tracers kept around, as the
+	// same code is usually compiled for every transaction of a block.
+	programCacheSize = 16
+)
+
+// programCache holds the recently compiled tracers by the hash of their code.
+var programCache = lru.NewCache[common.Hash, *goja.Program](programCacheSize)
+
+// compile instruments and compiles the code of a tracer, which evaluates to the
+// tracer object.
+func compile(code string) (*goja.Program, error) {
+	code = "(" + code + ")"
+
+	hash := crypto.Keccak256Hash([]byte(code))
+	if program, ok := programCache.Get(hash); ok {
+		return program, nil
+	}
+	// Compile the original code first to report syntax errors as written
+	if _, err := goja.Compile(sourceName, code, false); err != nil {
+		return nil, err
+	}
+	instrumented, err := instrument(code)
+	if err != nil {
+		return nil, err
+	}
+	program, err := goja.Compile(sourceName, instrumented, false)
+	if err != nil {
+		return nil, err
+	}
+	programCache.Add(hash, program)
+	return program, nil
+}
+
+// instrument rewrites the JS code to call the step function at the start of
+// every function body and loop iteration. An inline source map is appended, so
+// the positions reported in errors refer to the original code.
+//
+// The syntax tree doesn't retain the parentheses and semicolons around nodes,
+// so their positions are partly guessed from the code. The rewritten code is
+// parsed again and rejected unless every function and loop calls the step
+// function first, which can't be evaded by crafting the code.
+func instrument(code string) (string, error) {
+	if strings.Contains(code, stepFunc) {
+		return "", fmt.Errorf("tracer code must not use the reserved identifier %s", stepFunc)
+	}
+	program, err := parser.ParseFile(nil, "", code, 0)
+	if err != nil {
+		return "", err
+	}
+	var (
+		call  = stepFunc + "()"
+		edits []edit
+	)
+	insert := func(pos int, text string, closing bool) {
+		edits = append(edits, edit{pos: pos, text: text, closing: closing, seq: len(edits)})
+	}
+	// bounds returns the offsets of the start and the end of a statement in the
+	// code, including the enclosing parentheses and the terminating semicolon.
+	bounds := func(stmt ast.Statement) (int, int) {
+		start, end := span(stmt)
+		for start > 0 && strings.IndexByte(" \t\r\n(", code[start-1]) >= 0 {
+			start--
+		}
+		for start < len(code) && strings.IndexByte(" \t\r\n", code[start]) >= 0 {
+			start++
+		}
+		open := strings.Count(code[start:end], "(") - strings.Count(code[start:end], ")")
+		for next := end; next < len(code); next++ {
+			if c := code[next]; c == ')' && open > 0 {
+				open, end = open-1, next+1
+			} else if c == ';' {
+				return start, next + 1
+			} else if c != ' ' && c != '\t' {
+				break
+			}
+		}
+		return start, end
+	}
+	// loop instruments the body of a loop, enclosing it into a block if it's a
+	// single statement.
+	loop := func(body ast.Statement) {
+		if block, ok := body.(*ast.BlockStatement); ok {
+			insert(int(block.LeftBrace), call+";", false)
+			return
+		}
+		start, end := bounds(body)
+		insert(start, "{"+call+";", false)
+		insert(end, "}", true)
+	}
+	walkAST(reflect.ValueOf(program), make(map[uintptr]bool), func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			// Keep the directive prologue in front, e.g. "use strict"
+			pos := int(n.Body.LeftBrace)
+			for _, stmt := range n.Body.List {
+				if !isDirective(stmt) {
+					break
+				}
+				_, pos = bounds(stmt)
+			}
+			insert(pos, call+";", false)
+
+		case *ast.ArrowFunctionLiteral:
+			switch body := n.Body.(type) {
+			case *ast.BlockStatement:
+				insert(int(body.LeftBrace), call+";", false)
+			case *ast.ExpressionBody:
+				// The body is turned into a conditional, as its alternate can
+				// be any expression allowed as the body
+				start, _ := span(body.Expression)
+				if arrow := strings.LastIndex(code[:start], "=>"); arrow >= 0 {
+					insert(arrow+2, " "+call+" ? 0 :", false)
+				}
+			}
+		case *ast.ForStatement:
+			loop(n.Body)
+		case *ast.ForInStatement:
+			loop(n.Body)
+		case *ast.ForOfStatement:
+			loop(n.Body)
+		case *ast.WhileStatement:
+			loop(n.Body)
+		case *ast.DoWhileStatement:
+			loop(n.Body)
+		}
+	})
+	// Apply the edits front to back. The nodes are visited outermost first, so
+	// at the same position the inner closing texts precede the outer ones, and
+	// all closing texts precede the opening ones.
+	sort.Slice(edits, func(i, j int) bool {
+		a, b := edits[i], edits[j]
+		switch {
+		case a.pos != b.pos:
+			return a.pos < b.pos
+		case a.closing != b.closing:
+			return a.closing
+		case a.closing:
+			return a.seq > b.seq
+		default:
+			return a.seq < b.seq
+		}
+	})
+	var (
+		out    strings.Builder
+		origin = make([]int, 0, len(code)+len(edits)*len(call)) // Offset in the original code of every byte
+		last   int
+	)
+	for _, e := range edits {
+		out.WriteString(code[last:e.pos])
+		for ; last < e.pos; last++ {
+			origin = append(origin, last)
+		}
+		out.WriteString(e.text)
+		for i := 0; i < len(e.text); i++ {
+			origin = append(origin, e.pos)
+		}
+	}
+	out.WriteString(code[last:])
+	for ; last < len(code); last++ {
+		origin = append(origin, last)
+	}
+	// Make sure nothing was left out
+	if program, err = parser.ParseFile(nil, "", out.String(), 0); err != nil || !instrumented(program) {
+		return "", errors.New("tracer code could not be instrumented")
+	}
+	return out.String() + "\n//# sourceMappingURL=data:application/json;base64," + sourceMap(code, out.String(), origin), nil
+}
+
+// instrumented checks whether every function and loop in the syntax tree calls
+// the step function first.
+func instrumented(program *ast.Program) bool {
+	ok := true
+	// first checks whether the step function is called first in a block.
+	first := func(block *ast.BlockStatement, directives bool) {
+		list := block.List
+		for directives && len(list) > 0 && isDirective(list[0]) {
+			list = list[1:]
+		}
+		if len(list) == 0 {
+			ok = false
+			return
+		}
+		stmt, isExpr := list[0].(*ast.ExpressionStatement)
+		ok = ok && isExpr && isStep(stmt.Expression)
+	}
+	// loop checks whether the body of a loop is a block calling the step
+	// function first.
+	loop := func(body ast.Statement) {
+		if block, isBlock := body.(*ast.BlockStatement); isBlock {
+			first(block, false)
+		} else {
+			ok = false
+		}
+	}
+	walkAST(reflect.ValueOf(program), make(map[uintptr]bool), func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			first(n.Body, true)
+		case *ast.ArrowFunctionLiteral:
+			switch body := n.Body.(type) {
+			case *ast.BlockStatement:
+				first(body, false)
+			case *ast.ExpressionBody:
+				cond, isCond := body.Expression.(*ast.ConditionalExpression)
+				ok = ok && isCond && isStep(cond.Test)
+			}
+		case *ast.ForStatement:
+			loop(n.Body)
+		case *ast.ForInStatement:
+			loop(n.Body)
+		case *ast.ForOfStatement:
+			loop(n.Body)
+		case *ast.WhileStatement:
+			loop(n.Body)
+		case *ast.DoWhileStatement:
+			loop(n.Body)
+		}
+	})
+	return ok
+}
+
+// isDirective checks whether a statement is a directive, e.g. "use strict".
+func isDirective(stmt ast.Statement) bool {
+	expr, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	_, ok = expr.Expression.(*ast.StringLiteral)
+	return ok
+}
+
+// isStep checks whether an expression is a call of the step function.
+func isStep(expr ast.Expression) bool {
+	call, ok := expr.(*ast.CallExpression)
+	if !ok || len(call.ArgumentList) != 0 {
+		return false
+	}
+	ident, ok := call.Callee.(*ast.Identifier)
+	return ok && ident.Name == stepFunc
+}
+
+// edit is an insertion of text into the JS code.
+type edit struct {
+	pos     int    // Byte offset to insert the text at
+	text    string // Text to insert
+	closing bool   // Whether the text closes a previous insertion
+	seq     int    // Order of the insertion, outer nodes first
+}
+
+// span returns the byte offsets of the start and the end of a node in the JS
+// code. The positions goja reports for some nodes are off, e.g. postfix updates
+// start at their operator, so the span is taken over all nodes in the subtree.
+func span(node ast.Node) (int, int) {
+	start, end := -1, -1
+	walkAST(reflect.ValueOf(node), make(map[uintptr]bool), func(n ast.Node) {
+		if idx := int(n.Idx0()) - 1; idx >= 0 && (start < 0 || idx < start) {
+			start = idx
+		}
+		if idx := int(n.Idx1()) - 1; idx > end {
+			end = idx
+		}
+	})
+	return start, end
+}
+
+// astNodeType is the interface type of the nodes in the JS syntax tree.
+var astNodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// walkAST calls visit on every node of the JS syntax tree reachable from the
+// given value exactly once. Goja has no tree walker, so the node fields are
+// traversed by reflection.
+func walkAST(v reflect.Value, seen map[uintptr]bool, visit func(ast.Node)) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkAST(v.Elem(), seen, visit)
+		}
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || v.Elem().Type().PkgPath() != astNodeType.PkgPath() {
+			return
+		}
+		// Hoisted declarations are referenced twice, visit them once
+		if seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		if v.Type().Implements(astNodeType) {
+			visit(v.Interface().(ast.Node))
+		}
+		walkAST(v.Elem(), seen, visit)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			walkAST(v.Field(i), seen, visit)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkAST(v.Index(i), seen, visit)
+		}
+	}
+}
+
+// sourceMap returns the base64 encoded source map of the instrumented code. The
+// mapping lookup of goja doesn't interpolate between the mapped positions, so
+// every byte is mapped. Both the lines and the columns are one-based, which is
+// what goja looks up.
+func sourceMap(code string, instrumented string, origin []int) string {
+	var (
+		genLines, genCols = positions(instrumented)
+		srcLines, srcCols = positions(code)
+
+		mappings strings.Builder
+		line     = 1
+		prev     [3]int // Last generated column, source line and source column
+	)
+	prev[1] = 1
+	for i := range instrumented {
+		for ; line < genLines[i]; line++ {
+			mappings.WriteByte(';')
+			prev[0] = 0
+		}
+		if prev[0] != 0 {
+			mappings.WriteByte(',')
+		}
+		seg := [3]int{genCols[i], srcLines[origin[i]], srcCols[origin[i]]}
+		writeVLQ(&mappings, seg[0]-prev[0])
+		writeVLQ(&mappings, 0)
+		writeVLQ(&mappings, seg[1]-prev[1])
+		writeVLQ(&mappings, seg[2]-prev[2])
+		prev = seg
+	}
+	blob, _ := json.Marshal(map[string]interface{}{
+		"version":  3,
+		"sources":  []string{sourceName},
+		"names":    []string{},
+		"mappings": mappings.String(),
+	})
+	return base64.StdEncoding.EncodeToString(blob)
+}
+
+// positions returns the one-based line and column of every byte of the code,
+// breaking the lines the same way as goja.
+func positions(code string) ([]int, []int) {
+	lines, cols := make([]int, len(code)), make([]int, len(code))
+	line, start := 1, 0
+	for i := 0; i < len(code); i++ {
+		lines[i], cols[i] = line, i-start+1
+
+		next := -1
+		switch {
+		case code[i] == '\n':
+			next = i + 1
+		case code[i] == '\r' && (i+1 == len(code) || code[i+1] != '\n'):
+			next = i + 1
+		case strings.HasPrefix(code[i:], "\u2028") || strings.HasPrefix(code[i:], "\u2029"):
+			next = i + 3
+		}
+		if next >= 0 {
+			for i++; i < next; i++ {
+				lines[i], cols[i] = line, i-start+1
+			}
+			i--
+			line, start = line+1, next
+		}
+	}
+	return lines, cols
+}
+
+// writeVLQ writes a number in the base64 variable length encoding of source maps.
+func writeVLQ(b *strings.Builder, n int) {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+	for {
+		digit := v & 31
+		if v >>= 5; v > 0 {
+			digit |= 32
+		}
+		b.WriteByte(chars[digit])
+		if v == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package js
+
+import (
+	"fmt"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// limits bounds the resources the JS code of a tracer may consume. Goja has no
+// notion of instruction counting nor of per-runtime memory accounting, so:
+//
+//   - The code is instrumented to count steps, i.e. loop iterations and function
+//     calls, which bound the instructions executed between any two of them.
+//   - The tracer is charged with the growth of the live heap while its JS code
+//     runs, apportioned by the share of time spent running it.
+type limits struct {
+	maxCallStackSize int    // Maximum depth of nested JS function calls
+	maxSteps         uint64 // Maximum number of steps executed by the JS code per trace
+	maxMemory        int64  // Maximum growth of the live heap charged to the tracer
+}
+
+// defaultLimits are the limits applied to all JS tracers. Unlike the trace
+// timeout they can't be raised by the caller.
+var defaultLimits = limits{
+	maxCallStackSize: 10000,
+	maxSteps:         1_000_000_000,
+	maxMemory:        1024 * 1024 * 1024,
+}
+
+// sandboxPollInterval is the interval at which the memory usage of the tracer is
+// checked while it's running JS code.
+const sandboxPollInterval = 10 * time.Millisecond
+
+// heapMetrics are the runtime metrics the live heap size is read from, by order
+// of preference. The live heap as of the last GC cycle is only reported by newer
+// Go runtimes, older ones fall back to the size of all heap objects which also
+// includes the garbage not yet swept.
+var heapMetrics = []string{"/gc/heap/live:bytes", "/memory/classes/heap/objects:bytes"}
+
+// sandbox enforces the limits of a tracer while its JS code runs, interrupting
+// the runtime if they are exceeded.
+type sandbox struct {
+	vm     *goja.Runtime
+	limits limits
+	steps  uint64           // Number of steps executed by the JS code so far
+	sample []metrics.Sample // Heap size metric, nil if not available
+
+	lock   sync.Mutex
+	start  time.Time     // Start of the running JS call, zero if none is running
+	busy   time.Duration // Time spent running JS code since the last check
+	heap   uint64        // Heap size at the last check
+	last   time.Time     // Time of the last check
+	memory int64         // Heap growth charged to the tracer so far
+	timer  *time.Timer   // Watchdog checking the memory, nil while idle
+}
+
+func newSandbox(vm *goja.Runtime, limits limits) *sandbox {
+	vm.SetMaxCallStackSize(limits.maxCallStackSize)
+
+	s := &sandbox{vm: vm, limits: limits}
+	for _, name := range heapMetrics {
+		sample := []metrics.Sample{{Name: name}}
+		if metrics.Read(sample); sample[0].Value.Kind() == metrics.KindUint64 {
+			s.sample = sample
+			break
+		}
+	}
+	vm.GlobalObject().DefineDataProperty(stepFunc, vm.ToValue(s.step), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+
+	// Code generated at runtime would evade the instrumentation, disallow it
+	forbid := vm.ToValue(func(goja.FunctionCall) goja.Value {
+		panic(vm.NewTypeError("code generation from strings is disallowed in tracers"))
+	})
+	vm.Set("eval", forbid)
+	vm.Set("Function", forbid)
+	for _, fn := range []string{"(function() {})", "(function*() {})", "(async function() {})"} {
+		if val, err := vm.RunString(fn); err == nil {
+			val.ToObject(vm).Prototype().DefineDataProperty("constructor", forbid, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+		}
+	}
+	return s
+}
+
+// step is invoked by the instrumented JS code on every loop iteration and
+// function call, interrupting it once the step limit is used up.
+func (s *sandbox) step(goja.FunctionCall) goja.Value {
+	if s.steps++; s.steps > s.limits.maxSteps {
+		s.vm.Interrupt(fmt.Errorf("tracer exceeded step limit of %d", s.limits.maxSteps))
+	}
+	return goja.Undefined()
+}
+
+// enter marks the start of a JS call, and arms the watchdog if it's idle.
+func (s *sandbox) enter() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.start = time.Now()
+	if s.sample != nil && s.timer == nil {
+		metrics.Read(s.sample)
+		s.heap, s.last = s.sample[0].Value.Uint64(), s.start
+		s.timer = time.AfterFunc(sandboxPollInterval, s.check)
+	}
+}
+
+// exit marks the end of a JS call.
+func (s *sandbox) exit() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.busy += time.Since(s.start)
+	s.start = time.Time{}
+}
+
+// check is invoked periodically by the watchdog, charging the tracer with its
+// share of the heap growth since the last check and interrupting it if the
+// memory limit is exceeded. The watchdog goes idle if no JS code ran meanwhile.
+func (s *sandbox) check() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	busy := s.busy
+	if !s.start.IsZero() {
+		busy += now.Sub(s.start)
+		s.start = now
+	}
+	s.busy = 0
+
+	metrics.Read(s.sample)
+	heap := s.sample[0].Value.Uint64()
+	if elapsed := now.Sub(s.last); elapsed > 0 && busy > 0 {
+		growth := float64(int64(heap - s.heap))
+		s.memory += int64(growth * float64(busy) / float64(elapsed))
+		if s.memory < 0 {
+			s.memory = 0
+		}
+	}
+	s.heap, s.last = heap, now
+
+	if s.memory > s.limits.maxMemory {
+		s.vm.Interrupt(fmt.Errorf("tracer exceeded memory limit of %d bytes", s.limits.maxMemory))
+		s.timer = nil
+		return
+	}
+	if busy == 0 {
+		s.timer = nil
+		return
+	}
+	s.timer.Reset(sandboxPollInterval)
+}
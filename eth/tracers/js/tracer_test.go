@@ -24,6 +24,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dop251/goja"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -107,15 +108,15 @@ func TestTracer(t *testing.T) {
 		{ // tests that we don't panic on bad arguments to memory access
 			code: "{depths: [], step: function(log) { this.depths.push(log.memory.slice(-1,-2)); }, fault: function() {}, result: function() { return this.depths; }}",
 			want: ``,
-			fail: "tracer accessed out of bound memory: offset -1, end -2 at step (<eval>:1:53(13))    in server-side tracer function 'step'",
+			fail: "tracer accessed out of bound memory: offset -1, end -2 at step (tracer:1:53(16))    in server-side tracer function 'step'",
 		}, { // tests that we don't panic on bad arguments to stack peeks
 			code: "{depths: [], step: function(log) { this.depths.push(log.stack.peek(-1)); }, fault: function() {}, result: function() { return this.depths; }}",
 			want: ``,
-			fail: "tracer accessed out of bound stack: size 0, index -1 at step (<eval>:1:53(11))    in server-side tracer function 'step'",
+			fail: "tracer accessed out of bound stack: size 0, index -1 at step (tracer:1:53(14))    in server-side tracer function 'step'",
 		}, { //  tests that we don't panic on bad arguments to memory getUint
 			code: "{ depths: [], step: function(log, db) { this.depths.push(log.memory.getUint(-64));}, fault: function() {}, result: function() { return this.depths; }}",
 			want: ``,
-			fail: "tracer accessed out of bound memory: available 0, offset -64, size 32 at step (<eval>:1:58(11))    in server-side tracer function 'step'",
+			fail: "tracer accessed out of bound memory: available 0, offset -64, size 32 at step (tracer:1:58(14))    in server-side tracer function 'step'",
 		}, { // tests some general counting
 			code: "{count: 0, step: function() { this.count += 1; }, fault: function() {}, result: function() { return this.count; }}",
 			want: `3`,
@@ -150,7 +151,7 @@ func TestTracer(t *testing.T) {
 		}, {
 			code:     "{res: [], step: function(log) { if (log.op.toString() === 'STOP') { this.res.push(log.memory.slice(5, 1025 * 1024)) } }, fault: function() {}, result: function() { return this.res }}",
 			want:     "",
-			fail:     "tracer reached limit for padding memory slice: end 1049600, memorySize 32 at step (<eval>:1:83(20))    in server-side tracer function 'step'",
+			fail:     "tracer reached limit for padding memory slice: end 1049600, memorySize 32 at step (tracer:1:83(23))    in server-side tracer function 'step'",
 			contract: []byte{byte(vm.PUSH1), byte(0xff), byte(vm.PUSH1), byte(0x00), byte(vm.MSTORE8), byte(vm.STOP)},
 		},
 	} {
@@ -317,3 +318,115 @@ func TestSetup(t *testing.T) {
 		t.Errorf("tracer returned wrong result. have: %s, want: \"bar\"\n", string(have))
 	}
 }
+
+func TestStepLimit(t *testing.T) {
+	tracer, err := newJsTracer("{steps: 0, step: function() { this.steps++; }, result: function() { return this.steps; }, fault: function(){}}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.(*jsTracer).sandbox.limits.maxSteps = 3
+	if _, err = runTrace(tracer, testCtx(), params.TestChainConfig, nil); err == nil || !strings.Contains(err.Error(), "step limit") {
+		t.Errorf("Expected step limit error, got %v", err)
+	}
+}
+
+func TestStepLimitWithinCall(t *testing.T) {
+	for _, code := range []string{
+		"{step: function() { for(;;); }, result: function() { return null; }, fault: function(){}}",
+		"{step: function() { var a = 0; while(true) a++; }, result: function() { return null; }, fault: function(){}}",
+		"{step: function() { var f = x => f(x) + f(x); f(0); }, result: function() { return null; }, fault: function(){}}",
+	} {
+		tracer, err := newJsTracer(code, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracer.(*jsTracer).sandbox.limits.maxSteps = 1000
+		if _, err = runTrace(tracer, testCtx(), params.TestChainConfig, nil); err == nil || !strings.Contains(err.Error(), "step limit") {
+			t.Errorf("Expected step limit error for %s, got %v", code, err)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tracer, err := newJsTracer("{step: function() { var a = []; for(;;) a.push(new Array(1024 * 1024).fill(0)); }, result: function() { return null; }, fault: function(){}}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sandbox := tracer.(*jsTracer).sandbox
+	if sandbox.sample == nil {
+		t.Skip("heap size not available")
+	}
+	sandbox.limits.maxMemory = 64 * 1024 * 1024
+	if _, err = runTrace(tracer, testCtx(), params.TestChainConfig, nil); err == nil || !strings.Contains(err.Error(), "memory limit") {
+		t.Errorf("Expected memory limit error, got %v", err)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	tests := []struct {
+		code  string
+		want  int64
+		steps uint64
+	}{
+		{"(function() { var n = 0; for (var i = 0; i < 10; i++) n++; return n; })()", 10, 11},
+		{"(function() { var n = 0; for (var i = 0; i < 10; i++) { n++ } return n })()", 10, 11},
+		{"(function() { var n = 0; while (n < 5) n++\n return n; })()", 5, 6},
+		{"(function() { var n = 0; do n++; while (n < 3); return n; })()", 3, 4},
+		{"(function() { var n = 0; if (n == 0) for (var k in {a: 1, b: 2}) n++; else n = -1; return n; })()", 2, 3},
+		{"(function() { var n = 0; for (var v of [1, 2, 3]) n += v; return n; })()", 6, 4},
+		{"(x => y => x + y)(1)(2)", 3, 2},
+		{"(x => ({a: x}))(4).a", 4, 1},
+		{"(function() { 'use strict'; return this === undefined ? 1 : 0; })()", 1, 1},
+		{"({f() { return 7; }}).f()", 7, 1},
+	}
+	for i, tt := range tests {
+		code, err := instrument(tt.code)
+		if err != nil {
+			t.Fatalf("test %d: failed to instrument: %v", i, err)
+		}
+		vm := goja.New()
+		sandbox := newSandbox(vm, defaultLimits)
+		res, err := vm.RunString(code)
+		if err != nil {
+			t.Fatalf("test %d: failed to run %s: %v", i, code, err)
+		}
+		if have := res.ToInteger(); have != tt.want {
+			t.Errorf("test %d: result mismatch: have %d, want %d", i, have, tt.want)
+		}
+		if sandbox.steps != tt.steps {
+			t.Errorf("test %d: step count mismatch: have %d, want %d", i, sandbox.steps, tt.steps)
+		}
+	}
+	for name, code := range assetTracers {
+		if _, err := compile(code); err != nil {
+			t.Errorf("failed to instrument built-in tracer %s: %v", name, err)
+		}
+	}
+	if _, err := instrument("(function() { " + stepFunc + " = null; })"); err == nil {
+		t.Errorf("reserved identifier accepted")
+	}
+	// Code generated at runtime must be rejected, it evades the instrumentation
+	for _, code := range []string{
+		"eval('for(;;);')",
+		"Function('for(;;);')()",
+		"(function() {}).constructor('for(;;);')()",
+		"(() => 0).constructor('for(;;);')()",
+		"(async function() {}).constructor('for(;;);')()",
+	} {
+		vm := goja.New()
+		newSandbox(vm, defaultLimits)
+		if _, err := vm.RunString(code); err == nil || !strings.Contains(err.Error(), "code generation") {
+			t.Errorf("code generation %s not rejected: %v", code, err)
+		}
+	}
+}
+
+func TestCallStackLimit(t *testing.T) {
+	tracer, err := newJsTracer("{step: function() { (function f() { f(); })(); }, result: function() { return null; }, fault: function(){}}", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = runTrace(tracer, testCtx(), params.TestChainConfig, nil); err == nil || !strings.Contains(err.Error(), "call stack limit") {
+		t.Errorf("Expected call stack error, got %v", err)
+	}
+}
@@ -43,6 +43,7 @@ type callLog struct {
 
 type callFrame struct {
 	Type         vm.OpCode       `json:"-"`
+	system       string          // Type of system operation frames, which have no opcode
 	From         common.Address  `json:"from"`
 	Gas          uint64          `json:"gas"`
 	GasUsed      uint64          `json:"gasUsed"`
@@ -59,6 +60,9 @@ type callFrame struct {
 }
 
 func (f callFrame) TypeString() string {
+	if f.system != "" {
+		return f.system
+	}
 	return f.Type.String()
 }
 
@@ -224,6 +228,26 @@ func (t *callTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
 	t.callstack[size-1].Calls = append(t.callstack[size-1].Calls, call)
 }
 
+// CaptureSystemStart implements the SystemTracer interface to start tracing the
+// system operations of a block. They are reported as the calls of a top-level
+// pseudo frame of type SYSTEM.
+func (t *callTracer) CaptureSystemStart(env *vm.EVM) {
+	t.callstack[0] = callFrame{system: tracers.SystemOpOther}
+}
+
+// CaptureSystemOp implements the SystemTracer interface to trace a single
+// system operation as a call of its type.
+func (t *callTracer) CaptureSystemOp(op *tracers.SystemOp) {
+	if t.config.OnlyTopCall {
+		return
+	}
+	call := callFrame{system: op.Type, To: op.To, Value: op.Value}
+	if op.From != nil {
+		call.From = *op.From
+	}
+	t.callstack[0].Calls = append(t.callstack[0].Calls, call)
+}
+
 func (t *callTracer) CaptureTxStart(gasLimit uint64) {
 	t.gasLimit = gasLimit
 }
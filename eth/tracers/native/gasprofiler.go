@@ -0,0 +1,280 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+func init() {
+	tracers.DefaultDirectory.Register("gasProfiler", newGasProfiler, false)
+}
+
+// Output formats of the gasProfiler.
+const (
+	profileFormatFolded = "folded"
+	profileFormatPprof  = "pprof"
+)
+
+// intrinsicFrame is the pseudo frame the intrinsic gas of transactions is
+// attributed to.
+const intrinsicFrame = "[intrinsic]"
+
+// profileSample is the gas spent in a distinct call stack.
+type profileSample struct {
+	stack []string // root first, the leaf is the opcode
+	gas   uint64
+	count uint64 // number of executed instructions
+}
+
+// profileFrame is an open call frame of the gasProfiler.
+type profileFrame struct {
+	stack     []string // labels of the frame and its ancestors
+	op        string   // last instruction executed in the frame
+	pending   bool     // whether the gas of op still needs to be attributed
+	gas       uint64   // gas available before op
+	childUsed uint64   // gas used by the sub-calls of op
+	used      uint64   // gas attributed to the frame and its sub-calls so far
+}
+
+type gasProfilerConfig struct {
+	Format string `json:"format"` // Output format, either "folded" (default) or "pprof"
+}
+
+// gasProfiler aggregates the gas spent by instructions, weighted by the call
+// stack they were executed in. Every call frame is labelled by the contract
+// address and the function selector it was called with, and the instructions
+// form the leaves. The gas forwarded to sub-calls is attributed to the sub-call,
+// and the remaining gas of failing frames to their last instruction. Refunds
+// are not accounted for.
+//
+// The result is either a folded-stack profile as consumed by flamegraph tools,
+// or a gzipped pprof protobuf profile:
+//
+//	> debug.traceTransaction("0x...", {tracer: "gasProfiler"})
+//	"0x...:0xa9059cbb;SSTORE 22100\n..."
+//	> debug.traceTransaction("0x...", {tracer: "gasProfiler", tracerConfig: {format: "pprof"}})
+//	"0x1f8b..."
+//
+// The profile is accumulated over all transactions the tracer is used with.
+type gasProfiler struct {
+	noopTracer
+	config    gasProfilerConfig
+	samples   map[string]*profileSample
+	frames    []*profileFrame
+	gasLimit  uint64
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newGasProfiler returns a native go tracer which profiles the gas usage of
+// a tx, and implements vm.EVMLogger.
+func newGasProfiler(ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	var config gasProfilerConfig
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+	}
+	switch config.Format {
+	case "":
+		config.Format = profileFormatFolded
+	case profileFormatFolded, profileFormatPprof:
+	default:
+		return nil, fmt.Errorf("unknown profile format %q", config.Format)
+	}
+	return &gasProfiler{config: config, samples: make(map[string]*profileSample)}, nil
+}
+
+// CaptureTxStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *gasProfiler) CaptureTxStart(gasLimit uint64) {
+	t.gasLimit = gasLimit
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *gasProfiler) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	if t.gasLimit > gas {
+		t.add([]string{intrinsicFrame}, t.gasLimit-gas, 0)
+	}
+	t.gasLimit = 0
+	t.frames = []*profileFrame{{stack: []string{frameLabel(to, create, input)}}}
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *gasProfiler) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) != 1 {
+		return
+	}
+	t.exitFrame(t.frames[0], gasUsed)
+	t.frames = nil
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *gasProfiler) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	// Skip if tracing was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 || len(t.frames) == 0 {
+		return
+	}
+	frame := t.frames[len(t.frames)-1]
+	if frame.pending && frame.gas >= gas {
+		// The gas spent since the previous instruction minus the gas used by its
+		// sub-calls is the cost of the previous instruction itself.
+		var own uint64
+		if spent := frame.gas - gas; spent > frame.childUsed {
+			own = spent - frame.childUsed
+		}
+		t.addOp(frame, own)
+		frame.used += own
+	}
+	frame.op, frame.gas, frame.childUsed, frame.pending = op.String(), gas, 0, true
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *gasProfiler) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if len(t.frames) == 0 {
+		return
+	}
+	parent := t.frames[len(t.frames)-1]
+	stack := make([]string, len(parent.stack), len(parent.stack)+1)
+	copy(stack, parent.stack)
+	stack = append(stack, frameLabel(to, typ == vm.CREATE || typ == vm.CREATE2, input))
+	t.frames = append(t.frames, &profileFrame{stack: stack})
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *gasProfiler) CaptureExit(output []byte, gasUsed uint64, err error) {
+	size := len(t.frames)
+	if size <= 1 {
+		return
+	}
+	child, parent := t.frames[size-1], t.frames[size-2]
+	t.frames = t.frames[:size-1]
+
+	t.exitFrame(child, gasUsed)
+	parent.childUsed += gasUsed
+	parent.used += gasUsed
+}
+
+// GetResult returns the profile in the configured format, and any error arising
+// from the encoding or forceful termination (via `Stop`).
+func (t *gasProfiler) GetResult() (json.RawMessage, error) {
+	var (
+		res []byte
+		err error
+	)
+	switch t.config.Format {
+	case profileFormatPprof:
+		var profile []byte
+		if profile, err = t.pprof(); err != nil {
+			return nil, err
+		}
+		res, err = json.Marshal(hexutil.Bytes(profile))
+	default:
+		res, err = json.Marshal(t.folded())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *gasProfiler) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// exitFrame attributes the gas used by the frame which hasn't been accounted
+// for yet to its last instruction, or to the frame itself if it didn't execute
+// any code.
+func (t *gasProfiler) exitFrame(frame *profileFrame, gasUsed uint64) {
+	var rest uint64
+	if gasUsed > frame.used {
+		rest = gasUsed - frame.used
+	}
+	if frame.pending {
+		t.addOp(frame, rest)
+	} else if rest > 0 {
+		t.add(frame.stack, rest, 0)
+	}
+}
+
+func (t *gasProfiler) addOp(frame *profileFrame, gas uint64) {
+	stack := make([]string, len(frame.stack), len(frame.stack)+1)
+	copy(stack, frame.stack)
+	t.add(append(stack, frame.op), gas, 1)
+}
+
+func (t *gasProfiler) add(stack []string, gas uint64, count uint64) {
+	key := strings.Join(stack, ";")
+	sample, ok := t.samples[key]
+	if !ok {
+		sample = &profileSample{stack: stack}
+		t.samples[key] = sample
+	}
+	sample.gas += gas
+	sample.count += count
+}
+
+// sortedSamples returns the samples ordered by their stacks.
+func (t *gasProfiler) sortedSamples() []*profileSample {
+	keys := make([]string, 0, len(t.samples))
+	for key := range t.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]*profileSample, len(keys))
+	for i, key := range keys {
+		samples[i] = t.samples[key]
+	}
+	return samples
+}
+
+// folded returns the profile in the folded-stack format, one line per stack
+// with the frames separated by semicolons, followed by the gas spent.
+func (t *gasProfiler) folded() string {
+	var b strings.Builder
+	for _, sample := range t.sortedSamples() {
+		fmt.Fprintf(&b, "%s %d\n", strings.Join(sample.stack, ";"), sample.gas)
+	}
+	return b.String()
+}
+
+// frameLabel returns the name of a call frame in the profile, which is the
+// address of the contract and the function selector of the call.
+func frameLabel(to common.Address, create bool, input []byte) string {
+	switch {
+	case create:
+		return to.Hex() + ":create"
+	case len(input) >= 4:
+		return fmt.Sprintf("%s:%#x", to.Hex(), input[:4])
+	default:
+		return to.Hex()
+	}
+}
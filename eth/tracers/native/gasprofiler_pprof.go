@@ -0,0 +1,132 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+)
+
+// Field numbers of the pprof profile.proto messages used by the gasProfiler.
+const (
+	pprofProfileSampleType  = 1
+	pprofProfileSample      = 2
+	pprofProfileLocation    = 4
+	pprofProfileFunction    = 5
+	pprofProfileStringTable = 6
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationID = 1
+	pprofSampleValue      = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionID = 1
+
+	pprofFunctionID   = 1
+	pprofFunctionName = 2
+)
+
+// pprof returns the profile as a gzipped pprof protobuf message. Every frame
+// and instruction name is a function with a single location. Samples carry the
+// gas spent and the number of instructions executed.
+func (t *gasProfiler) pprof() ([]byte, error) {
+	var (
+		strings   = []string{""}
+		stringIDs = map[string]uint64{"": 0}
+		locations = make(map[string]uint64)
+		profile   []byte
+	)
+	str := func(s string) uint64 {
+		id, ok := stringIDs[s]
+		if !ok {
+			id = uint64(len(strings))
+			strings = append(strings, s)
+			stringIDs[s] = id
+		}
+		return id
+	}
+	location := func(name string) uint64 {
+		id, ok := locations[name]
+		if !ok {
+			id = uint64(len(locations) + 1)
+			locations[name] = id
+
+			var function []byte
+			function = appendVarintField(function, pprofFunctionID, id)
+			function = appendVarintField(function, pprofFunctionName, str(name))
+			profile = appendBytesField(profile, pprofProfileFunction, function)
+
+			var line, loc []byte
+			line = appendVarintField(line, pprofLineFunctionID, id)
+			loc = appendVarintField(loc, pprofLocationID, id)
+			loc = appendBytesField(loc, pprofLocationLine, line)
+			profile = appendBytesField(profile, pprofProfileLocation, loc)
+		}
+		return id
+	}
+	for _, typ := range [][2]string{{"gas", "gas"}, {"instructions", "count"}} {
+		var valueType []byte
+		valueType = appendVarintField(valueType, pprofValueTypeType, str(typ[0]))
+		valueType = appendVarintField(valueType, pprofValueTypeUnit, str(typ[1]))
+		profile = appendBytesField(profile, pprofProfileSampleType, valueType)
+	}
+	for _, s := range t.sortedSamples() {
+		// Locations are listed leaf first
+		var ids, sample []byte
+		for i := len(s.stack) - 1; i >= 0; i-- {
+			ids = binary.AppendUvarint(ids, location(s.stack[i]))
+		}
+		sample = appendBytesField(sample, pprofSampleLocationID, ids)
+
+		var values []byte
+		values = binary.AppendUvarint(values, s.gas)
+		values = binary.AppendUvarint(values, s.count)
+		sample = appendBytesField(sample, pprofSampleValue, values)
+
+		profile = appendBytesField(profile, pprofProfileSample, sample)
+	}
+	for _, s := range strings {
+		profile = appendBytesField(profile, pprofProfileStringTable, []byte(s))
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(profile); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendVarintField appends a varint encoded protobuf field.
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField appends a length-delimited protobuf field.
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -167,6 +167,27 @@ func (t *prestateTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64,
 	}
 }
 
+// CaptureSystemStart implements the SystemTracer interface to start tracing the
+// system operations of a block.
+func (t *prestateTracer) CaptureSystemStart(env *vm.EVM) {
+	t.env = env
+}
+
+// CaptureSystemOp implements the SystemTracer interface to record the state of
+// the accounts touched by system operations. Operations which are already
+// reflected by the state belong to the transactions they originate from.
+func (t *prestateTracer) CaptureSystemOp(op *tracers.SystemOp) {
+	if !op.Pending {
+		return
+	}
+	if op.From != nil {
+		t.lookupAccount(*op.From)
+	}
+	if op.To != nil {
+		t.lookupAccount(*op.To)
+	}
+}
+
 func (t *prestateTracer) CaptureTxStart(gasLimit uint64) {
 	t.gasLimit = gasLimit
 }
@@ -0,0 +1,318 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+func init() {
+	tracers.DefaultDirectory.Register("stateDiffTracer", newStateDiffTracer, false)
+}
+
+// Kinds of state events reported by the stateDiffTracer.
+const (
+	stateEventStorageRead  = "storageRead"
+	stateEventStorageWrite = "storageWrite"
+	stateEventBalance      = "balance"
+	stateEventCode         = "code"
+)
+
+// Reasons of the balance changes which aren't value transfers, but the gas
+// accounting of the transaction. The gas purchase decreases the balance of the
+// account, the others increase it.
+const (
+	balanceReasonGasBuy    = "gasBuy"
+	balanceReasonGasReturn = "gasReturn"
+	balanceReasonFee       = "fee"
+)
+
+// stateEvent is a single state access, attributed to the call frame and the
+// instruction which caused it. Events caused by the transaction itself rather
+// than by an instruction have no pc. Balance changes of the gas accounting have
+// no op either, but a reason and no counterparty.
+type stateEvent struct {
+	Type         string          `json:"type"`
+	TraceAddress []int           `json:"traceAddress"`
+	PC           *uint64         `json:"pc,omitempty"`
+	Op           string          `json:"op,omitempty"`
+	Reason       string          `json:"reason,omitempty"`
+	Address      common.Address  `json:"address"`
+	Slot         *common.Hash    `json:"slot,omitempty"`
+	Prev         *common.Hash    `json:"prev,omitempty"`
+	Value        *common.Hash    `json:"value,omitempty"`
+	From         *common.Address `json:"from,omitempty"`
+	Amount       *hexutil.Big    `json:"amount,omitempty"`
+	Code         hexutil.Bytes   `json:"code,omitempty"`
+	Reverted     bool            `json:"reverted,omitempty"`
+}
+
+// diffFrame is an open call frame of the stateDiffTracer.
+type diffFrame struct {
+	typ          vm.OpCode
+	to           common.Address
+	traceAddress []int  // position of the frame in the call tree
+	calls        int    // number of sub-calls made so far
+	pc           uint64 // pc of the last instruction executed in the frame
+	events       []int  // indices of the events recorded in this frame or its children
+}
+
+// stateDiffTracer extends the diff mode of the prestateTracer with the list of
+// storage reads and writes, balance changes and code deployments of the
+// transaction. Every event names the call frame (as a path of sub-call indices)
+// and the pc of the instruction it originates from. The balance changes cover
+// the purchase of the gas, its return and the fee as well. Events of reverted
+// frames are kept but flagged, so the non-reverted writes replayed on top of
+// the pre state yield the post state.
+//
+// Example:
+//
+//	> debug.traceTransaction("0x...", {tracer: "stateDiffTracer"})
+//	{
+//	  pre: {...},
+//	  post: {...},
+//	  events: [{type: "storageWrite", traceAddress: [0], pc: 42, op: "SSTORE", address: "0x...", slot: "0x...", prev: "0x...", value: "0x..."}, ...]
+//	}
+type stateDiffTracer struct {
+	*prestateTracer
+	frames []*diffFrame
+	events []stateEvent
+}
+
+// newStateDiffTracer returns a native go tracer which records attributed state
+// accesses of a tx, and implements vm.EVMLogger.
+func newStateDiffTracer(ctx *tracers.Context, _ json.RawMessage) (tracers.Tracer, error) {
+	pre, err := newPrestateTracer(ctx, json.RawMessage(`{"diffMode":true}`))
+	if err != nil {
+		return nil, err
+	}
+	return &stateDiffTracer{prestateTracer: pre.(*prestateTracer)}, nil
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *stateDiffTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.prestateTracer.CaptureStart(env, from, to, create, input, gas, value)
+
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+	t.frames = []*diffFrame{{typ: typ, to: to, traceAddress: []int{}}}
+
+	// The gas is bought before the value is transferred. Blob gas is paid
+	// along with it and never returned.
+	cost := new(big.Int).Mul(env.TxContext.GasPrice, new(big.Int).SetUint64(t.gasLimit))
+	if env.ChainConfig().IsCancun(env.Context.Time) && env.Context.ExcessDataGas != nil {
+		blobGas := new(big.Int).SetUint64(types.GetDataGasUsed(len(env.TxContext.DataHashes)))
+		cost.Add(cost, blobGas.Mul(blobGas, types.GetDataGasPrice(env.Context.ExcessDataGas)))
+	}
+	t.addBalanceChange(balanceReasonGasBuy, from, cost)
+	t.addTransfer(t.frames[0], t.frames[0].traceAddress, nil, typ, from, to, value)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *stateDiffTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	t.exitFrame(t.frames[0], nil, err)
+	t.frames = nil
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *stateDiffTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.prestateTracer.CaptureState(pc, op, gas, cost, scope, rData, depth, err)
+
+	// Skip if tracing was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 || len(t.frames) == 0 {
+		return
+	}
+	frame := t.frames[len(t.frames)-1]
+	frame.pc = pc
+
+	stack := scope.Stack.Data()
+	switch {
+	case op == vm.SLOAD && len(stack) >= 1:
+		var (
+			addr  = scope.Contract.Address()
+			slot  = common.Hash(stack[len(stack)-1].Bytes32())
+			value = t.env.StateDB.GetState(addr, slot)
+		)
+		t.add(frame, stateEvent{Type: stateEventStorageRead, TraceAddress: frame.traceAddress, PC: &pc, Op: op.String(), Address: addr, Slot: &slot, Value: &value})
+	case op == vm.SSTORE && len(stack) >= 2:
+		var (
+			addr  = scope.Contract.Address()
+			slot  = common.Hash(stack[len(stack)-1].Bytes32())
+			value = common.Hash(stack[len(stack)-2].Bytes32())
+			prev  = t.env.StateDB.GetState(addr, slot)
+		)
+		t.add(frame, stateEvent{Type: stateEventStorageWrite, TraceAddress: frame.traceAddress, PC: &pc, Op: op.String(), Address: addr, Slot: &slot, Prev: &prev, Value: &value})
+	}
+}
+
+// CaptureTxEnd records the gas returned to the sender, including the refunds,
+// and the fee paid to the coinbase.
+func (t *stateDiffTracer) CaptureTxEnd(restGas uint64) {
+	t.prestateTracer.CaptureTxEnd(restGas)
+	if t.env == nil {
+		return
+	}
+	var (
+		price = t.env.TxContext.GasPrice
+		tip   = new(big.Int).Set(price)
+	)
+	t.addBalanceChange(balanceReasonGasReturn, t.env.TxContext.Origin, new(big.Int).Mul(price, new(big.Int).SetUint64(restGas)))
+
+	// The fee is skipped for zero priced calls without a base fee, just as
+	// in the state transition.
+	if t.env.Config.NoBaseFee && price.Sign() == 0 {
+		return
+	}
+	if t.env.ChainConfig().IsLondon(t.env.Context.BlockNumber) {
+		tip.Sub(tip, t.env.Context.BaseFee)
+	}
+	t.addBalanceChange(balanceReasonFee, t.env.Context.Coinbase, tip.Mul(tip, new(big.Int).SetUint64(t.gasLimit-restGas)))
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *stateDiffTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if len(t.frames) == 0 {
+		return
+	}
+	parent := t.frames[len(t.frames)-1]
+	child := &diffFrame{
+		typ:          typ,
+		to:           to,
+		traceAddress: append(append([]int{}, parent.traceAddress...), parent.calls),
+	}
+	parent.calls++
+	t.frames = append(t.frames, child)
+
+	// The value moves with the sub-call, so the transfer is reverted along
+	// with it. It is attributed to the calling instruction though.
+	switch typ {
+	case vm.CALL, vm.CREATE, vm.CREATE2, vm.SELFDESTRUCT:
+		pc := parent.pc
+		t.addTransfer(child, parent.traceAddress, &pc, typ, from, to, value)
+	}
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *stateDiffTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	size := len(t.frames)
+	if size <= 1 {
+		return
+	}
+	child, parent := t.frames[size-1], t.frames[size-2]
+	t.frames = t.frames[:size-1]
+
+	t.exitFrame(child, parent, err)
+	parent.events = append(parent.events, child.events...)
+}
+
+// GetResult returns the json-encoded state diff along with the attributed state
+// events, and any error arising from the encoding or forceful termination (via
+// `Stop`).
+func (t *stateDiffTracer) GetResult() (json.RawMessage, error) {
+	events := t.events
+	if events == nil {
+		events = []stateEvent{}
+	}
+	res, err := json.Marshal(struct {
+		Post   state        `json:"post"`
+		Pre    state        `json:"pre"`
+		Events []stateEvent `json:"events"`
+	}{t.post, t.pre, events})
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// exitFrame finalizes the events of a frame which returned with the given error.
+// For successful contract creations, the deployed code is recorded. It is
+// attributed to the creating instruction of the parent frame, or to the
+// transaction if there is no parent.
+func (t *stateDiffTracer) exitFrame(frame, parent *diffFrame, err error) {
+	if err != nil {
+		for _, i := range frame.events {
+			t.events[i].Reverted = true
+		}
+		return
+	}
+	if frame.typ != vm.CREATE && frame.typ != vm.CREATE2 {
+		return
+	}
+	event := stateEvent{
+		Type:         stateEventCode,
+		TraceAddress: []int{},
+		Op:           frame.typ.String(),
+		Address:      frame.to,
+		Code:         t.env.StateDB.GetCode(frame.to),
+	}
+	if parent != nil {
+		pc := parent.pc
+		event.TraceAddress, event.PC = parent.traceAddress, &pc
+	}
+	t.add(frame, event)
+}
+
+// addTransfer records a value transfer in the given frame, attributed to the
+// instruction at pc in the frame at traceAddress.
+func (t *stateDiffTracer) addTransfer(frame *diffFrame, traceAddress []int, pc *uint64, op vm.OpCode, from, to common.Address, value *big.Int) {
+	if value == nil || value.Sign() == 0 {
+		return
+	}
+	t.add(frame, stateEvent{
+		Type:         stateEventBalance,
+		TraceAddress: traceAddress,
+		PC:           pc,
+		Op:           op.String(),
+		Address:      to,
+		From:         &from,
+		Amount:       (*hexutil.Big)(new(big.Int).Set(value)),
+	})
+}
+
+// addBalanceChange records a balance change of the gas accounting. These aren't
+// part of any call frame, so they are never reverted.
+func (t *stateDiffTracer) addBalanceChange(reason string, addr common.Address, amount *big.Int) {
+	if amount.Sign() == 0 {
+		return
+	}
+	t.events = append(t.events, stateEvent{
+		Type:         stateEventBalance,
+		TraceAddress: []int{},
+		Reason:       reason,
+		Address:      addr,
+		Amount:       (*hexutil.Big)(amount),
+	})
+}
+
+func (t *stateDiffTracer) add(frame *diffFrame, event stateEvent) {
+	frame.events = append(frame.events, len(t.events))
+	t.events = append(t.events, event)
+}
@@ -0,0 +1,434 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+func init() {
+	tracers.DefaultDirectory.Register("transferTracer", newTransferTracer, false)
+}
+
+var (
+	// Transfer(address indexed from, address indexed to, uint256 value) for ERC-20
+	// and Transfer(address indexed from, address indexed to, uint256 indexed tokenId)
+	// for ERC-721.
+	transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	// TransferSingle and TransferBatch events of ERC-1155.
+	transferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	transferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+)
+
+// Kinds of transfers reported by the transferTracer.
+const (
+	transferCall         = "call"         // ether sent along a message call
+	transferCreate       = "create"       // ether endowment of a new contract
+	transferSelfdestruct = "selfdestruct" // ether swept to the beneficiary of a selfdestruct
+	transferFee          = "fee"          // priority fee paid to the block's coinbase
+	transferBurn         = "burn"         // ether destroyed, e.g. the base fee
+	transferERC20        = "erc20"
+	transferERC721       = "erc721"
+	transferERC1155      = "erc1155"
+)
+
+// transfer is a single movement of ether or tokens between two accounts.
+type transfer struct {
+	Type    string          `json:"type"`
+	Token   *common.Address `json:"token,omitempty"`
+	From    common.Address  `json:"from"`
+	To      common.Address  `json:"to"`
+	TokenID *hexutil.Big    `json:"tokenId,omitempty"`
+	Value   *hexutil.Big    `json:"value"`
+}
+
+// balanceChange aggregates the net effect of all transfers on a single account.
+type balanceChange struct {
+	Ether       *hexutil.Big                               `json:"eth,omitempty"`
+	Tokens      map[common.Address]*hexutil.Big            `json:"tokens,omitempty"`      // ERC-20 amounts and ERC-721 counts
+	MultiTokens map[common.Address]map[string]*hexutil.Big `json:"multiTokens,omitempty"` // ERC-1155 amounts by token id
+}
+
+type transferResult struct {
+	Transfers      []transfer                        `json:"transfers"`
+	BalanceChanges map[common.Address]*balanceChange `json:"balanceChanges"`
+}
+
+type transferTracerConfig struct {
+	WithFees bool `json:"withFees"` // If true, the transaction fee is reported as well
+}
+
+// transferTracer collects the ether value transfers and the ERC-20, ERC-721 and
+// ERC-1155 token transfers of a transaction, and the resulting balance deltas of
+// every account involved. Transfers made in reverted call frames are dropped.
+//
+// Example:
+//
+//	> debug.traceTransaction("0x...", {tracer: "transferTracer", tracerConfig: {withFees: true}})
+//	{
+//	  transfers: [{type: "erc20", token: "0xa0b8...", from: "0x12...", to: "0x34...", value: "0x3e8"}, ...],
+//	  balanceChanges: {"0x12...": {tokens: {"0xa0b8...": "-0x3e8"}}, ...}
+//	}
+type transferTracer struct {
+	noopTracer
+	env       *vm.EVM
+	config    transferTracerConfig
+	from      common.Address
+	gasLimit  uint64
+	frames    [][]transfer // transfers of the currently open call frames
+	result    []transfer
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newTransferTracer returns a native go tracer which tracks ether and token
+// transfers of a tx, and implements vm.EVMLogger.
+func newTransferTracer(ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	var config transferTracerConfig
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+	}
+	return &transferTracer{config: config}, nil
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *transferTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.from = from
+
+	kind := transferCall
+	if create {
+		kind = transferCreate
+	}
+	t.frames = [][]transfer{nil}
+	t.addEther(kind, from, to, value)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *transferTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if len(t.frames) == 0 {
+		return
+	}
+	if err == nil {
+		t.result = append(t.result, t.frames[0]...)
+	}
+	t.frames = nil
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *transferTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if op < vm.LOG3 || op > vm.LOG4 || err != nil {
+		return
+	}
+	// Skip if tracing was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	// All token transfer events have at least three topics
+	var (
+		stack  = scope.Stack.Data()
+		topics = make([]common.Hash, op-vm.LOG0)
+	)
+	for i := range topics {
+		topics[i] = common.Hash(stack[len(stack)-3-i].Bytes32())
+	}
+	// The log data is captured before the memory is expanded for it, so it may
+	// reach past the current memory size
+	mStart, mSize := stack[len(stack)-1], stack[len(stack)-2]
+	var data []byte
+	if !mSize.IsZero() {
+		if !mStart.IsUint64() || !mSize.IsUint64() {
+			return
+		}
+		data = memoryCopy(scope.Memory, mStart.Uint64(), mSize.Uint64())
+	}
+	t.decodeLog(scope.Contract.Address(), topics, data)
+}
+
+// memoryCopy returns a copy of the given memory range, zero-padded where it
+// reaches past the end of the memory.
+func memoryCopy(mem *vm.Memory, offset, size uint64) []byte {
+	cpy := make([]byte, size)
+	if offset < uint64(mem.Len()) {
+		copy(cpy, mem.Data()[offset:])
+	}
+	return cpy
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *transferTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	// The frame is pushed regardless of interruption to keep CaptureExit balanced.
+	t.frames = append(t.frames, nil)
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return
+	}
+	switch typ {
+	case vm.CALL:
+		t.addEther(transferCall, from, to, value)
+	case vm.CREATE, vm.CREATE2:
+		t.addEther(transferCreate, from, to, value)
+	case vm.SELFDESTRUCT:
+		// A contract naming itself as the beneficiary destroys its balance.
+		if from == to {
+			t.addEther(transferBurn, from, common.Address{}, value)
+		} else {
+			t.addEther(transferSelfdestruct, from, to, value)
+		}
+	}
+	// Value sent via CALLCODE stays with the caller, and DELEGATECALL and
+	// STATICCALL don't move any value at all.
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *transferTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	size := len(t.frames)
+	if size <= 1 {
+		return
+	}
+	frame := t.frames[size-1]
+	t.frames = t.frames[:size-1]
+	if err == nil {
+		t.frames[size-2] = append(t.frames[size-2], frame...)
+	}
+}
+
+func (t *transferTracer) CaptureTxStart(gasLimit uint64) {
+	t.gasLimit = gasLimit
+}
+
+func (t *transferTracer) CaptureTxEnd(restGas uint64) {
+	if !t.config.WithFees || t.env == nil {
+		return
+	}
+	var (
+		gasUsed = new(big.Int).SetUint64(t.gasLimit - restGas)
+		price   = t.env.TxContext.GasPrice
+		tip     = new(big.Int).Set(price)
+	)
+	if baseFee := t.env.Context.BaseFee; baseFee != nil {
+		tip.Sub(tip, baseFee)
+		if tip.Sign() < 0 {
+			tip.SetUint64(0)
+		}
+	}
+	fee := new(big.Int).Mul(gasUsed, price)
+	tip.Mul(tip, gasUsed)
+
+	t.result = append(t.result, transfer{Type: transferFee, From: t.from, To: t.env.Context.Coinbase, Value: (*hexutil.Big)(tip)})
+	if burnt := fee.Sub(fee, tip); burnt.Sign() > 0 {
+		t.result = append(t.result, transfer{Type: transferBurn, From: t.from, Value: (*hexutil.Big)(burnt)})
+	}
+}
+
+// GetResult returns the json-encoded list of transfers and the balance changes
+// they amount to, and any error arising from the encoding or forceful termination
+// (via `Stop`).
+func (t *transferTracer) GetResult() (json.RawMessage, error) {
+	res := transferResult{
+		Transfers:      t.result,
+		BalanceChanges: make(map[common.Address]*balanceChange),
+	}
+	if res.Transfers == nil {
+		res.Transfers = []transfer{}
+	}
+	change := func(addr common.Address) *balanceChange {
+		c, ok := res.BalanceChanges[addr]
+		if !ok {
+			c = new(balanceChange)
+			res.BalanceChanges[addr] = c
+		}
+		return c
+	}
+	for _, tr := range t.result {
+		value := (*big.Int)(tr.Value)
+		switch tr.Type {
+		case transferERC20, transferERC721:
+			if tr.Type == transferERC721 {
+				value = common.Big1
+			}
+			change(tr.From).token(*tr.Token).Sub(change(tr.From).token(*tr.Token), value)
+			change(tr.To).token(*tr.Token).Add(change(tr.To).token(*tr.Token), value)
+		case transferERC1155:
+			id := hexutil.EncodeBig((*big.Int)(tr.TokenID))
+			change(tr.From).multiToken(*tr.Token, id).Sub(change(tr.From).multiToken(*tr.Token, id), value)
+			change(tr.To).multiToken(*tr.Token, id).Add(change(tr.To).multiToken(*tr.Token, id), value)
+		case transferBurn:
+			change(tr.From).ether().Sub(change(tr.From).ether(), value)
+		default:
+			change(tr.From).ether().Sub(change(tr.From).ether(), value)
+			change(tr.To).ether().Add(change(tr.To).ether(), value)
+		}
+	}
+	encoded, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return encoded, t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *transferTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// addEther records a transfer of ether in the innermost call frame.
+func (t *transferTracer) addEther(kind string, from, to common.Address, value *big.Int) {
+	if value == nil || value.Sign() == 0 {
+		return
+	}
+	t.add(transfer{Type: kind, From: from, To: to, Value: (*hexutil.Big)(new(big.Int).Set(value))})
+}
+
+func (t *transferTracer) add(tr transfer) {
+	if len(t.frames) == 0 {
+		return
+	}
+	t.frames[len(t.frames)-1] = append(t.frames[len(t.frames)-1], tr)
+}
+
+// decodeLog records the token transfers announced by a log emitted from the
+// given contract. Logs which don't match any of the standard transfer events
+// are ignored.
+func (t *transferTracer) decodeLog(token common.Address, topics []common.Hash, data []byte) {
+	switch {
+	case topics[0] == transferTopic && len(topics) == 3 && len(data) == 32:
+		t.add(transfer{
+			Type:  transferERC20,
+			Token: &token,
+			From:  common.BytesToAddress(topics[1][:]),
+			To:    common.BytesToAddress(topics[2][:]),
+			Value: (*hexutil.Big)(new(big.Int).SetBytes(data)),
+		})
+	case topics[0] == transferTopic && len(topics) == 4 && len(data) == 0:
+		t.add(transfer{
+			Type:    transferERC721,
+			Token:   &token,
+			From:    common.BytesToAddress(topics[1][:]),
+			To:      common.BytesToAddress(topics[2][:]),
+			TokenID: (*hexutil.Big)(topics[3].Big()),
+			Value:   (*hexutil.Big)(big.NewInt(1)),
+		})
+	case topics[0] == transferSingleTopic && len(topics) == 4 && len(data) == 64:
+		t.add(transfer{
+			Type:    transferERC1155,
+			Token:   &token,
+			From:    common.BytesToAddress(topics[2][:]),
+			To:      common.BytesToAddress(topics[3][:]),
+			TokenID: (*hexutil.Big)(new(big.Int).SetBytes(data[:32])),
+			Value:   (*hexutil.Big)(new(big.Int).SetBytes(data[32:])),
+		})
+	case topics[0] == transferBatchTopic && len(topics) == 4:
+		ids, values, err := decodeBatch(data)
+		if err != nil {
+			return
+		}
+		for i := range ids {
+			t.add(transfer{
+				Type:    transferERC1155,
+				Token:   &token,
+				From:    common.BytesToAddress(topics[2][:]),
+				To:      common.BytesToAddress(topics[3][:]),
+				TokenID: (*hexutil.Big)(ids[i]),
+				Value:   (*hexutil.Big)(values[i]),
+			})
+		}
+	}
+}
+
+var errMalformedBatch = errors.New("malformed TransferBatch data")
+
+// decodeBatch unpacks the ABI encoded id and value arrays of a TransferBatch event.
+func decodeBatch(data []byte) (ids, values []*big.Int, err error) {
+	if len(data) < 64 {
+		return nil, nil, errMalformedBatch
+	}
+	if ids, err = decodeUintArray(data, new(big.Int).SetBytes(data[:32])); err != nil {
+		return nil, nil, err
+	}
+	if values, err = decodeUintArray(data, new(big.Int).SetBytes(data[32:64])); err != nil {
+		return nil, nil, err
+	}
+	if len(ids) != len(values) {
+		return nil, nil, errMalformedBatch
+	}
+	return ids, values, nil
+}
+
+// decodeUintArray unpacks a uint256[] located at the given offset of data.
+func decodeUintArray(data []byte, offset *big.Int) ([]*big.Int, error) {
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data))-32 {
+		return nil, errMalformedBatch
+	}
+	start := offset.Uint64()
+	length := new(big.Int).SetBytes(data[start : start+32])
+	if !length.IsUint64() || length.Uint64() > (uint64(len(data))-start-32)/32 {
+		return nil, errMalformedBatch
+	}
+	items := make([]*big.Int, length.Uint64())
+	for i := range items {
+		pos := start + 32 + uint64(i)*32
+		items[i] = new(big.Int).SetBytes(data[pos : pos+32])
+	}
+	return items, nil
+}
+
+// ether returns the ether delta of the account.
+func (c *balanceChange) ether() *big.Int {
+	if c.Ether == nil {
+		c.Ether = new(hexutil.Big)
+	}
+	return (*big.Int)(c.Ether)
+}
+
+// token returns the delta of the given ERC-20 or ERC-721 token.
+func (c *balanceChange) token(token common.Address) *big.Int {
+	if c.Tokens == nil {
+		c.Tokens = make(map[common.Address]*hexutil.Big)
+	}
+	if c.Tokens[token] == nil {
+		c.Tokens[token] = new(hexutil.Big)
+	}
+	return (*big.Int)(c.Tokens[token])
+}
+
+// multiToken returns the delta of the given ERC-1155 token id.
+func (c *balanceChange) multiToken(token common.Address, id string) *big.Int {
+	if c.MultiTokens == nil {
+		c.MultiTokens = make(map[common.Address]map[string]*hexutil.Big)
+	}
+	if c.MultiTokens[token] == nil {
+		c.MultiTokens[token] = make(map[string]*hexutil.Big)
+	}
+	if c.MultiTokens[token][id] == nil {
+		c.MultiTokens[token][id] = new(hexutil.Big)
+	}
+	return (*big.Int)(c.MultiTokens[token][id])
+}
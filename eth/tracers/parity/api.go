@@ -0,0 +1,481 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package parity implements the Parity/OpenEthereum compatible trace_* RPC
+// namespace on top of the debug tracing API. Call traces are produced by the
+// native flatCallTracer and state diffs by the prestateTracer, so both need to
+// be registered.
+package parity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// traceTypeTrace requests the flat list of call traces.
+	traceTypeTrace = "trace"
+	// traceTypeStateDiff requests the state changes made by the transaction.
+	traceTypeStateDiff = "stateDiff"
+	// traceTypeVMTrace requests a full instruction trace, which isn't supported.
+	traceTypeVMTrace = "vmTrace"
+
+	// filterCountCacheSize is the number of blocks whose count of traces matching
+	// a filter is remembered, so that paginated filters don't re-trace the
+	// blocks before the requested page.
+	filterCountCacheSize = 4096
+)
+
+var (
+	flatCallTracer = "flatCallTracer"
+	muxTracer      = "muxTracer"
+
+	// flatCallConfig makes the flatCallTracer report errors the way Parity does.
+	flatCallConfig = json.RawMessage(`{"convertParityErrors":true}`)
+
+	errVMTraceUnsupported = errors.New("vmTrace is not supported")
+	errOpenFilterRange    = errors.New("fromBlock and toBlock are required")
+)
+
+// API is the collection of Parity compatible tracing APIs.
+type API struct {
+	backend     tracers.Backend
+	tracer      *tracers.API
+	filterRange uint64                             // Maximum number of blocks a filter may span, 0 for no limit
+	matchCounts *lru.Cache[filterCountKey, uint64] // Number of traces of a block matching a filter
+}
+
+// filterCountKey identifies the traces of a block matching the address criteria
+// of a filter.
+type filterCountKey struct {
+	block  common.Hash
+	filter common.Hash
+}
+
+// NewAPI creates a new trace API on top of the tracing API of the backend. The
+// block range of trace_filter is limited to filterRange blocks, unless it's 0.
+func NewAPI(backend tracers.Backend, filterRange uint64) *API {
+	return &API{
+		backend:     backend,
+		tracer:      tracers.NewAPI(backend),
+		filterRange: filterRange,
+		matchCounts: lru.NewCache[filterCountKey, uint64](filterCountCacheSize),
+	}
+}
+
+// APIs return the collection of RPC services the parity package offers.
+func APIs(backend tracers.Backend, filterRange uint64) []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "trace",
+			Service:   NewAPI(backend, filterRange),
+		},
+	}
+}
+
+// TraceResults is the result of replaying a transaction with a set of trace types.
+// Fields of trace types which weren't requested are null.
+type TraceResults struct {
+	Output          hexutil.Bytes     `json:"output"`
+	StateDiff       StateDiff         `json:"stateDiff"`
+	Trace           []json.RawMessage `json:"trace"`
+	VMTrace         *struct{}         `json:"vmTrace"`
+	TransactionHash *common.Hash      `json:"transactionHash,omitempty"`
+}
+
+// FilterArgs are the criteria of trace_filter. Both ends of the block range are
+// required. Empty address lists match any address. The matching traces are
+// paginated by skipping the first After of them and returning at most Count.
+type FilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// Block returns the call traces of all transactions in the given block.
+func (api *API) Block(ctx context.Context, number rpc.BlockNumber) ([]json.RawMessage, error) {
+	header, err := api.backend.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.blockFrames(ctx, header.Hash())
+}
+
+// blockFrames returns the call traces of all transactions in the block with the
+// given hash.
+func (api *API) blockFrames(ctx context.Context, hash common.Hash) ([]json.RawMessage, error) {
+	results, err := api.tracer.TraceBlockByHash(ctx, hash, &tracers.TraceConfig{Tracer: &flatCallTracer, TracerConfig: flatCallConfig})
+	if err != nil {
+		return nil, err
+	}
+	traces := []json.RawMessage{}
+	for _, res := range results {
+		if res.Error != "" {
+			return nil, errors.New(res.Error)
+		}
+		frames, err := decodeFrames(res.Result)
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, frames...)
+	}
+	return traces, nil
+}
+
+// Transaction returns the call traces of the given transaction.
+func (api *API) Transaction(ctx context.Context, hash common.Hash) ([]json.RawMessage, error) {
+	res, err := api.tracer.TraceTransaction(ctx, hash, &tracers.TraceConfig{Tracer: &flatCallTracer, TracerConfig: flatCallConfig})
+	if err != nil {
+		return nil, err
+	}
+	return decodeFrames(res)
+}
+
+// Filter returns the call traces within the given block range which match the
+// address criteria. The number of matching traces per block is cached, so the
+// blocks before the requested page are only traced on the first request.
+func (api *API) Filter(ctx context.Context, args FilterArgs) ([]json.RawMessage, error) {
+	if args.FromBlock == nil || args.ToBlock == nil {
+		return nil, errOpenFilterRange
+	}
+	from, err := api.blockNumber(ctx, *args.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := api.blockNumber(ctx, *args.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("toBlock (#%d) needs to come after fromBlock (#%d)", to, from)
+	}
+	if api.filterRange > 0 && to-from >= api.filterRange {
+		return nil, fmt.Errorf("block range too large: %d blocks, at most %d allowed", to-from+1, api.filterRange)
+	}
+	var (
+		fromAddrs = addressSet(args.FromAddress)
+		toAddrs   = addressSet(args.ToAddress)
+		filter    = filterHash(args.FromAddress, args.ToAddress)
+		traces    = []json.RawMessage{}
+		skip      uint64
+	)
+	if args.After != nil {
+		skip = *args.After
+	}
+	for number := from; number <= to; number++ {
+		if number == 0 {
+			continue // genesis is not traceable
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		header, err := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		key := filterCountKey{block: header.Hash(), filter: filter}
+		if count, ok := api.matchCounts.Get(key); ok && count <= skip {
+			skip -= count
+			continue
+		}
+		frames, err := api.blockFrames(ctx, header.Hash())
+		if err != nil {
+			return nil, err
+		}
+		matched, err := filterFrames(frames, fromAddrs, toAddrs)
+		if err != nil {
+			return nil, err
+		}
+		api.matchCounts.Add(key, uint64(len(matched)))
+
+		if skip >= uint64(len(matched)) {
+			skip -= uint64(len(matched))
+			continue
+		}
+		matched, skip = matched[skip:], 0
+		traces = append(traces, matched...)
+		if args.Count != nil && uint64(len(traces)) >= *args.Count {
+			return traces[:*args.Count], nil
+		}
+	}
+	return traces, nil
+}
+
+// filterFrames returns the call traces whose sender and recipient are in the
+// given sets.
+func filterFrames(frames []json.RawMessage, from, to map[common.Address]struct{}) ([]json.RawMessage, error) {
+	var matched []json.RawMessage
+	for _, frame := range frames {
+		var f flatFrame
+		if err := json.Unmarshal(frame, &f); err != nil {
+			return nil, err
+		}
+		if f.matches(from, to) {
+			matched = append(matched, frame)
+		}
+	}
+	return matched, nil
+}
+
+// filterHash identifies the address criteria of a filter, independently of the
+// order of the addresses.
+func filterHash(from, to []common.Address) common.Hash {
+	var blob []byte
+	for _, set := range [][]common.Address{from, to} {
+		sorted := make([]common.Address, len(set))
+		copy(sorted, set)
+		sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+		blob = append(blob, byte(len(sorted)>>8), byte(len(sorted)))
+		for _, addr := range sorted {
+			blob = append(blob, addr[:]...)
+		}
+	}
+	return crypto.Keccak256Hash(blob)
+}
+
+// ReplayBlockTransactions replays all transactions of the given block and returns
+// the requested trace types for each of them.
+func (api *API) ReplayBlockTransactions(ctx context.Context, number rpc.BlockNumber, traceTypes []string) ([]*TraceResults, error) {
+	config, err := replayConfig(traceTypes)
+	if err != nil {
+		return nil, err
+	}
+	block, err := api.backend.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	results, err := api.tracer.TraceBlockByHash(ctx, block.Hash(), config)
+	if err != nil {
+		return nil, err
+	}
+	replays := make([]*TraceResults, len(results))
+	for i, res := range results {
+		if res.Error != "" {
+			return nil, errors.New(res.Error)
+		}
+		if replays[i], err = newTraceResults(res.Result, traceTypes); err != nil {
+			return nil, err
+		}
+		hash := block.Transactions()[i].Hash()
+		replays[i].TransactionHash = &hash
+	}
+	return replays, nil
+}
+
+// ReplayTransaction replays the given transaction and returns the requested trace
+// types.
+func (api *API) ReplayTransaction(ctx context.Context, hash common.Hash, traceTypes []string) (*TraceResults, error) {
+	config, err := replayConfig(traceTypes)
+	if err != nil {
+		return nil, err
+	}
+	res, err := api.tracer.TraceTransaction(ctx, hash, config)
+	if err != nil {
+		return nil, err
+	}
+	return newTraceResults(res, traceTypes)
+}
+
+// Call executes the given call on top of the given block, latest by default, and
+// returns the requested trace types.
+func (api *API) Call(ctx context.Context, args ethapi.TransactionArgs, traceTypes []string, blockNrOrHash *rpc.BlockNumberOrHash) (*TraceResults, error) {
+	config, err := replayConfig(traceTypes)
+	if err != nil {
+		return nil, err
+	}
+	if blockNrOrHash == nil {
+		latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		blockNrOrHash = &latest
+	}
+	res, err := api.tracer.TraceCall(ctx, args, *blockNrOrHash, &tracers.TraceCallConfig{TraceConfig: *config})
+	if err != nil {
+		return nil, err
+	}
+	return newTraceResults(res, traceTypes)
+}
+
+// blockNumber resolves a block number of the filter criteria.
+func (api *API) blockNumber(ctx context.Context, number rpc.BlockNumber) (uint64, error) {
+	if number == rpc.EarliestBlockNumber {
+		return 0, nil
+	}
+	header, err := api.backend.HeaderByNumber(ctx, number)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, fmt.Errorf("block #%d not found", number)
+	}
+	return header.Number.Uint64(), nil
+}
+
+// replayConfig returns the tracing config which produces the given trace types.
+// The call traces are always collected as they carry the output of the call.
+func replayConfig(traceTypes []string) (*tracers.TraceConfig, error) {
+	mux := map[string]json.RawMessage{flatCallTracer: flatCallConfig}
+	for _, typ := range traceTypes {
+		switch typ {
+		case traceTypeTrace:
+		case traceTypeStateDiff:
+			mux["prestateTracer"] = json.RawMessage(`{"diffMode":true}`)
+		case traceTypeVMTrace:
+			return nil, errVMTraceUnsupported
+		default:
+			return nil, fmt.Errorf("invalid trace type %q", typ)
+		}
+	}
+	cfg, err := json.Marshal(mux)
+	if err != nil {
+		return nil, err
+	}
+	return &tracers.TraceConfig{Tracer: &muxTracer, TracerConfig: cfg}, nil
+}
+
+// newTraceResults assembles the replay results from the output of the mux tracer
+// configured by replayConfig.
+func newTraceResults(result interface{}, traceTypes []string) (*TraceResults, error) {
+	raw, ok := result.(json.RawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected trace result type %T", result)
+	}
+	var traces struct {
+		FlatCall json.RawMessage `json:"flatCallTracer"`
+		Prestate *prestateDiff   `json:"prestateTracer"`
+	}
+	if err := json.Unmarshal(raw, &traces); err != nil {
+		return nil, err
+	}
+	frames, err := decodeFrames(traces.FlatCall)
+	if err != nil {
+		return nil, err
+	}
+	res := new(TraceResults)
+	if len(frames) > 0 {
+		var top flatFrame
+		if err := json.Unmarshal(frames[0], &top); err != nil {
+			return nil, err
+		}
+		if top.Result != nil {
+			res.Output = top.Result.Output
+		}
+	}
+	if res.Output == nil {
+		res.Output = hexutil.Bytes{}
+	}
+	for _, typ := range traceTypes {
+		switch typ {
+		case traceTypeTrace:
+			res.Trace = frames
+		case traceTypeStateDiff:
+			if traces.Prestate != nil {
+				res.StateDiff = traces.Prestate.stateDiff()
+			}
+		}
+	}
+	return res, nil
+}
+
+// flatFrame contains the fields of a flatCallTracer frame needed for filtering.
+type flatFrame struct {
+	Type   string `json:"type"`
+	Action struct {
+		From          *common.Address `json:"from"`
+		To            *common.Address `json:"to"`
+		Address       *common.Address `json:"address"`
+		RefundAddress *common.Address `json:"refundAddress"`
+	} `json:"action"`
+	Result *struct {
+		Address *common.Address `json:"address"`
+		Output  hexutil.Bytes   `json:"output"`
+	} `json:"result"`
+}
+
+// matches reports whether the sender and the recipient of the frame are in the
+// given sets. A nil set matches anything. The sender of a selfdestruct is the
+// destructed contract, and the recipient of a contract creation is the new
+// contract.
+func (f *flatFrame) matches(from, to map[common.Address]struct{}) bool {
+	sender, recipient := f.Action.From, f.Action.To
+	switch f.Type {
+	case "create":
+		recipient = nil
+		if f.Result != nil {
+			recipient = f.Result.Address
+		}
+	case "suicide":
+		sender, recipient = f.Action.Address, f.Action.RefundAddress
+	}
+	return inSet(from, sender) && inSet(to, recipient)
+}
+
+func addressSet(addrs []common.Address) map[common.Address]struct{} {
+	if len(addrs) == 0 {
+		return nil
+	}
+	set := make(map[common.Address]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
+	}
+	return set
+}
+
+func inSet(set map[common.Address]struct{}, addr *common.Address) bool {
+	if set == nil {
+		return true
+	}
+	if addr == nil {
+		return false
+	}
+	_, ok := set[*addr]
+	return ok
+}
+
+// decodeFrames splits the flatCallTracer result into its frames.
+func decodeFrames(result interface{}) ([]json.RawMessage, error) {
+	raw, ok := result.(json.RawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected trace result type %T", result)
+	}
+	frames := []json.RawMessage{}
+	if err := json.Unmarshal(raw, &frames); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
@@ -0,0 +1,335 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type testBackend struct {
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	chaindb     ethdb.Database
+	chain       *core.BlockChain
+}
+
+func newTestBackend(t *testing.T, n int, gspec *core.Genesis, generator func(i int, b *core.BlockGen)) *testBackend {
+	backend := &testBackend{
+		chainConfig: gspec.Config,
+		engine:      ethash.NewFaker(),
+		chaindb:     rawdb.NewMemoryDatabase(),
+	}
+	_, blocks, _ := core.GenerateChainWithGenesis(gspec, backend.engine, n, generator)
+
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		TrieTimeLimit:     5 * time.Minute,
+		TrieDirtyDisabled: true, // Archive mode
+	}
+	chain, err := core.NewBlockChain(backend.chaindb, cacheConfig, gspec, nil, backend.engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	backend.chain = chain
+	t.Cleanup(chain.Stop)
+	return backend
+}
+
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.PendingBlockNumber || number == rpc.LatestBlockNumber {
+		return b.chain.CurrentHeader(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.PendingBlockNumber || number == rpc.LatestBlockNumber {
+		return b.chain.GetBlockByNumber(b.chain.CurrentBlock().Number.Uint64()), nil
+	}
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
+	if header := b.chain.GetHeaderByHash(hash); header != nil {
+		return b.chain.GetTd(hash, header.Number.Uint64())
+	}
+	return nil
+}
+
+func (b *testBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	tx, hash, blockNumber, index := rawdb.ReadTransaction(b.chaindb, txHash)
+	return tx, hash, blockNumber, index, nil
+}
+
+func (b *testBackend) RPCGasCap() uint64                { return 25000000 }
+func (b *testBackend) ChainConfig() *params.ChainConfig { return b.chainConfig }
+func (b *testBackend) Engine() consensus.Engine         { return b.engine }
+func (b *testBackend) ChainDb() ethdb.Database          { return b.chaindb }
+
+func (b *testBackend) StateAtBlock(ctx context.Context, block *types.Block, reexec uint64, base *state.StateDB, readOnly bool, preferDisk bool) (*state.StateDB, tracers.StateReleaseFunc, error) {
+	statedb, err := b.chain.StateAt(block.Root())
+	if err != nil {
+		return nil, nil, err
+	}
+	return statedb, func() {}, nil
+}
+
+func (b *testBackend) StateAtTransaction(ctx context.Context, block *types.Block, txIndex int, reexec uint64) (*core.Message, vm.BlockContext, *state.StateDB, tracers.StateReleaseFunc, error) {
+	parent := b.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, vm.BlockContext{}, nil, nil, errors.New("block not found")
+	}
+	statedb, release, err := b.StateAtBlock(ctx, parent, reexec, nil, true, false)
+	if err != nil {
+		return nil, vm.BlockContext{}, nil, nil, err
+	}
+	signer := types.MakeSigner(b.chainConfig, block.Number(), block.Time())
+	for idx, tx := range block.Transactions() {
+		msg, _ := core.TransactionToMessage(tx, signer, block.BaseFee())
+		context := core.NewEVMBlockContext(block.Header(), parent.Header().ExcessDataGas, b.chain, nil)
+		if idx == txIndex {
+			return msg, context, statedb, release, nil
+		}
+		vmenv := vm.NewEVM(context, core.NewEVMTxContext(msg), statedb, b.chainConfig, vm.Config{})
+		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
+			return nil, vm.BlockContext{}, nil, nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		statedb.Finalise(vmenv.ChainConfig().IsEIP158(block.Number()))
+	}
+	return nil, vm.BlockContext{}, nil, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, block.Hash())
+}
+
+type testFrame struct {
+	Type   string `json:"type"`
+	Action struct {
+		From common.Address `json:"from"`
+		To   common.Address `json:"to"`
+	} `json:"action"`
+	BlockNumber  uint64 `json:"blockNumber"`
+	TraceAddress []int  `json:"traceAddress"`
+}
+
+func decodeTestFrames(t *testing.T, frames []json.RawMessage) []testFrame {
+	t.Helper()
+	res := make([]testFrame, len(frames))
+	for i, frame := range frames {
+		if err := json.Unmarshal(frame, &res[i]); err != nil {
+			t.Fatalf("failed to decode frame %d: %v", i, err)
+		}
+	}
+	return res
+}
+
+func TestTraceAPI(t *testing.T) {
+	t.Parallel()
+
+	var (
+		key, _   = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		receiver = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		callee   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+		contract = common.HexToAddress("0x00000000000000000000000000000000000c0de0")
+	)
+	// The contract stores the call value in slot 0, then calls the callee.
+	code := []byte{
+		byte(vm.CALLVALUE), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0,
+		byte(vm.PUSH20),
+	}
+	code = append(code, callee.Bytes()...)
+	code = append(code, byte(vm.GAS), byte(vm.CALL), byte(vm.STOP))
+
+	genesis := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			sender:   {Balance: big.NewInt(params.Ether)},
+			contract: {Code: code, Balance: common.Big0},
+		},
+	}
+	var txs []common.Hash
+	backend := newTestBackend(t, 2, genesis, func(i int, b *core.BlockGen) {
+		signer := types.HomesteadSigner{}
+		var tx *types.Transaction
+		switch i {
+		case 0:
+			tx = types.NewTransaction(0, receiver, big.NewInt(1000), params.TxGas, b.BaseFee(), nil)
+		case 1:
+			tx = types.NewTransaction(1, contract, big.NewInt(5), 100000, b.BaseFee(), nil)
+		}
+		tx, _ = types.SignTx(tx, signer, key)
+		b.AddTx(tx)
+		txs = append(txs, tx.Hash())
+	})
+	var (
+		api = NewAPI(backend, 2)
+		ctx = context.Background()
+	)
+	// Block and transaction traces
+	frames, err := api.Block(ctx, 2)
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	block := decodeTestFrames(t, frames)
+	if len(block) != 2 || block[0].Action.To != contract || block[1].Action.From != contract || block[1].Action.To != callee {
+		t.Fatalf("unexpected block traces: %+v", block)
+	}
+	if len(block[1].TraceAddress) != 1 || block[1].BlockNumber != 2 {
+		t.Fatalf("unexpected sub-call trace: %+v", block[1])
+	}
+	frames, err = api.Transaction(ctx, txs[0])
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	if tx := decodeTestFrames(t, frames); len(tx) != 1 || tx[0].Action.From != sender || tx[0].Action.To != receiver {
+		t.Fatalf("unexpected transaction traces: %+v", tx)
+	}
+	// Filtering and pagination
+	var (
+		one, two = uint64(1), uint64(2)
+		first    = rpc.BlockNumber(1)
+		latest   = rpc.LatestBlockNumber
+		earliest = rpc.EarliestBlockNumber
+	)
+	if _, err := api.Filter(ctx, FilterArgs{FromBlock: &first}); !errors.Is(err, errOpenFilterRange) {
+		t.Fatalf("unexpected error for open range: %v", err)
+	}
+	if _, err := api.Filter(ctx, FilterArgs{FromBlock: &earliest, ToBlock: &latest}); err == nil {
+		t.Fatal("range beyond the limit accepted")
+	}
+	for i, tt := range []struct {
+		args FilterArgs
+		want []common.Address // recipients of the matched traces
+	}{
+		{FilterArgs{FromBlock: &first, ToBlock: &latest}, []common.Address{receiver, contract, callee}},
+		{FilterArgs{FromBlock: &first, ToBlock: &latest, FromAddress: []common.Address{sender}}, []common.Address{receiver, contract}},
+		{FilterArgs{FromBlock: &first, ToBlock: &latest, ToAddress: []common.Address{callee}}, []common.Address{callee}},
+		{FilterArgs{FromBlock: &first, ToBlock: &latest, FromAddress: []common.Address{sender}, ToAddress: []common.Address{callee}}, nil},
+		{FilterArgs{FromBlock: &first, ToBlock: &latest, After: &one, Count: &one}, []common.Address{contract}},
+		{FilterArgs{FromBlock: &first, ToBlock: &latest, After: &two, Count: &one}, []common.Address{callee}},
+		{FilterArgs{FromBlock: &first, ToBlock: &first, After: &two}, nil},
+	} {
+		frames, err := api.Filter(ctx, tt.args)
+		if err != nil {
+			t.Fatalf("test %d: failed to filter traces: %v", i, err)
+		}
+		have := decodeTestFrames(t, frames)
+		if len(have) != len(tt.want) {
+			t.Fatalf("test %d: trace count mismatch: have %d, want %d", i, len(have), len(tt.want))
+		}
+		for j := range have {
+			if have[j].Action.To != tt.want[j] {
+				t.Errorf("test %d, trace %d: recipient mismatch: have %x, want %x", i, j, have[j].Action.To, tt.want[j])
+			}
+		}
+	}
+	// The match counts of the traced blocks are cached for later pages.
+	block1 := backend.chain.GetHeaderByNumber(1).Hash()
+	if count, ok := api.matchCounts.Get(filterCountKey{block: block1, filter: filterHash(nil, nil)}); !ok || count != 1 {
+		t.Errorf("match count of block 1 not cached: %d", count)
+	}
+	// Replays
+	if _, err := api.ReplayTransaction(ctx, txs[1], []string{"vmTrace"}); !errors.Is(err, errVMTraceUnsupported) {
+		t.Fatalf("unexpected error for vmTrace: %v", err)
+	}
+	res, err := api.ReplayTransaction(ctx, txs[1], []string{"trace", "stateDiff"})
+	if err != nil {
+		t.Fatalf("failed to replay transaction: %v", err)
+	}
+	if len(res.Trace) != 2 {
+		t.Fatalf("unexpected replay traces: %d", len(res.Trace))
+	}
+	diff, err := json.Marshal(res.StateDiff)
+	if err != nil {
+		t.Fatalf("failed to encode state diff: %v", err)
+	}
+	var have map[common.Address]json.RawMessage
+	if err := json.Unmarshal(diff, &have); err != nil {
+		t.Fatalf("failed to decode state diff: %v", err)
+	}
+	if _, ok := have[callee]; ok {
+		t.Errorf("untouched callee in state diff")
+	}
+	want := `{"balance":{"*":{"from":"0x0","to":"0x5"}},"code":"=","nonce":"=","storage":{"0x0000000000000000000000000000000000000000000000000000000000000000":{"*":{"from":"0x0000000000000000000000000000000000000000000000000000000000000000","to":"0x0000000000000000000000000000000000000000000000000000000000000005"}}}}`
+	if string(have[contract]) != want {
+		t.Errorf("contract diff mismatch:\nhave %s\nwant %s", have[contract], want)
+	}
+	if want := `{"*":{"from":"0x1","to":"0x2"}}`; !jsonContains(t, have[sender], "nonce", want) {
+		t.Errorf("sender nonce diff mismatch: %s", have[sender])
+	}
+	// The block replay must yield the same results
+	replays, err := api.ReplayBlockTransactions(ctx, 2, []string{"stateDiff"})
+	if err != nil {
+		t.Fatalf("failed to replay block: %v", err)
+	}
+	if len(replays) != 1 || *replays[0].TransactionHash != txs[1] || replays[0].Trace != nil {
+		t.Fatalf("unexpected block replay: %+v", replays)
+	}
+	if blob, _ := json.Marshal(replays[0].StateDiff); string(blob) != string(diff) {
+		t.Errorf("block replay diff mismatch:\nhave %s\nwant %s", blob, diff)
+	}
+	// Creation of a new account
+	res, err = api.ReplayTransaction(ctx, txs[0], []string{"stateDiff"})
+	if err != nil {
+		t.Fatalf("failed to replay transaction: %v", err)
+	}
+	blob, _ := json.Marshal(res.StateDiff[receiver])
+	if want := `{"balance":{"+":"0x3e8"},"code":{"+":"0x"},"nonce":{"+":"0x0"},"storage":{}}`; string(blob) != want {
+		t.Errorf("created account diff mismatch:\nhave %s\nwant %s", blob, want)
+	}
+}
+
+func jsonContains(t *testing.T, obj json.RawMessage, field, want string) bool {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(obj, &fields); err != nil {
+		t.Fatalf("failed to decode object: %v", err)
+	}
+	return string(fields[field]) == want
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parity
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// StateDiff is the Parity representation of the state changes made by a
+// transaction.
+type StateDiff map[common.Address]*AccountDiff
+
+// AccountDiff holds the changes of a single account.
+type AccountDiff struct {
+	Balance Delta                 `json:"balance"`
+	Code    Delta                 `json:"code"`
+	Nonce   Delta                 `json:"nonce"`
+	Storage map[common.Hash]Delta `json:"storage"`
+}
+
+// Delta is the change of a single value. It is encoded as "=" if the value didn't
+// change, {"+": new} if it was created, {"-": old} if it was deleted, and
+// {"*": {"from": old, "to": new}} if it was modified.
+type Delta struct {
+	From interface{} // Value before the transaction, nil if created
+	To   interface{} // Value after the transaction, nil if deleted
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Delta) MarshalJSON() ([]byte, error) {
+	switch {
+	case d.From == nil && d.To == nil:
+		return []byte(`"="`), nil
+	case d.From == nil:
+		return json.Marshal(map[string]interface{}{"+": d.To})
+	case d.To == nil:
+		return json.Marshal(map[string]interface{}{"-": d.From})
+	}
+	from, err := json.Marshal(d.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := json.Marshal(d.To)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(from, to) {
+		return []byte(`"="`), nil
+	}
+	return json.Marshal(map[string]interface{}{"*": map[string]json.RawMessage{"from": from, "to": to}})
+}
+
+// prestateAccount is an account as reported by the prestateTracer. In diff mode,
+// post accounts only contain the modified fields.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Code    hexutil.Bytes               `json:"code"`
+	Nonce   *uint64                     `json:"nonce"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// empty reports whether the account didn't exist, as the prestateTracer also
+// reports the pre state of accounts created by the transaction.
+func (a *prestateAccount) empty() bool {
+	return a.nonce() == 0 && len(a.Code) == 0 && a.balance().ToInt().Sign() == 0
+}
+
+func (a *prestateAccount) balance() *hexutil.Big {
+	if a.Balance == nil {
+		return (*hexutil.Big)(new(big.Int))
+	}
+	return a.Balance
+}
+
+func (a *prestateAccount) nonce() hexutil.Uint64 {
+	if a.Nonce == nil {
+		return 0
+	}
+	return hexutil.Uint64(*a.Nonce)
+}
+
+func (a *prestateAccount) code() hexutil.Bytes {
+	if a.Code == nil {
+		return hexutil.Bytes{}
+	}
+	return a.Code
+}
+
+// prestateDiff is the result of the prestateTracer in diff mode. Accounts which
+// only appear in the pre state were deleted, those only in the post state or
+// with an empty pre state were created.
+type prestateDiff struct {
+	Pre  map[common.Address]*prestateAccount `json:"pre"`
+	Post map[common.Address]*prestateAccount `json:"post"`
+}
+
+// stateDiff converts the prestate diff into the Parity format.
+func (d *prestateDiff) stateDiff() StateDiff {
+	diff := make(StateDiff)
+	for addr, pre := range d.Pre {
+		post, ok := d.Post[addr]
+		if ok && pre.empty() {
+			continue
+		}
+		if !ok {
+			// The account was deleted
+			account := &AccountDiff{
+				Balance: Delta{From: pre.balance()},
+				Code:    Delta{From: pre.code()},
+				Nonce:   Delta{From: pre.nonce()},
+				Storage: make(map[common.Hash]Delta),
+			}
+			for slot, val := range pre.Storage {
+				account.Storage[slot] = Delta{From: val}
+			}
+			diff[addr] = account
+			continue
+		}
+		// The account was modified, unchanged fields are missing from post.
+		account := &AccountDiff{
+			Balance: Delta{From: pre.balance(), To: pre.balance()},
+			Code:    Delta{From: pre.code(), To: pre.code()},
+			Nonce:   Delta{From: pre.nonce(), To: pre.nonce()},
+			Storage: make(map[common.Hash]Delta),
+		}
+		if post.Balance != nil {
+			account.Balance.To = post.Balance
+		}
+		if post.Code != nil {
+			account.Code.To = post.Code
+		}
+		if post.Nonce != nil {
+			account.Nonce.To = hexutil.Uint64(*post.Nonce)
+		}
+		// Zero slots are left out on both sides.
+		for slot, val := range pre.Storage {
+			account.Storage[slot] = Delta{From: val, To: post.Storage[slot]}
+		}
+		for slot, val := range post.Storage {
+			if _, ok := pre.Storage[slot]; !ok {
+				account.Storage[slot] = Delta{From: common.Hash{}, To: val}
+			}
+		}
+		diff[addr] = account
+	}
+	for addr, post := range d.Post {
+		if pre, ok := d.Pre[addr]; ok && !pre.empty() {
+			continue
+		}
+		// The account was created
+		account := &AccountDiff{
+			Balance: Delta{To: post.balance()},
+			Code:    Delta{To: post.code()},
+			Nonce:   Delta{To: post.nonce()},
+			Storage: make(map[common.Hash]Delta),
+		}
+		for slot, val := range post.Storage {
+			account.Storage[slot] = Delta{To: val}
+		}
+		diff[addr] = account
+	}
+	return diff
+}
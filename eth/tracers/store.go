@@ -0,0 +1,277 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// maxTracePruneBlocks is the maximum number of blocks whose stored traces are
+// pruned on the import of a single block.
+const maxTracePruneBlocks = 1024
+
+// checkStoredTracers verifies that the given tracers can have their results
+// stored, which is only the case for native tracers referenced by name.
+func checkStoredTracers(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no tracers given")
+	}
+	for _, name := range names {
+		if elem, ok := DefaultDirectory.elems[name]; !ok || elem.isJS {
+			return fmt.Errorf("tracer %q can't be stored, only native tracers are supported", name)
+		}
+	}
+	return nil
+}
+
+// storedTracer returns the name of the tracer requested by config if it can be
+// served from the trace store. Stored traces are produced with the default
+// configuration of the tracer, so requests with custom options are not eligible.
+func storedTracer(config *TraceConfig) (string, bool) {
+	if config == nil || config.Tracer == nil {
+		return "", false
+	}
+	// The system operations of blocks aren't stored
+	if config.SystemOps {
+		return "", false
+	}
+	if cfg := bytes.TrimSpace(config.TracerConfig); len(cfg) > 0 && !bytes.Equal(cfg, []byte("{}")) && !bytes.Equal(cfg, []byte("null")) {
+		return "", false
+	}
+	if _, ok := DefaultDirectory.elems[*config.Tracer]; !ok {
+		return "", false
+	}
+	return *config.Tracer, true
+}
+
+// StoreLogger is a chain logger which runs a set of native tracers on every
+// transaction of imported blocks, and persists their results in the database.
+// The trace APIs serve matching requests from the stored results instead of
+// re-executing the chain. If a retention is set, the traces of the blocks which
+// fall out of it are pruned as new blocks are imported.
+type StoreLogger struct {
+	db        ethdb.Database
+	names     []string
+	retention uint64 // Number of recent blocks whose traces are kept, 0 for all
+
+	block   *types.Block  // Block being processed, nil in between blocks
+	batch   ethdb.Batch   // Results of the block being processed
+	txIndex int           // Index of the next transaction to start
+	active  []storedTrace // Tracers of the transaction being processed
+}
+
+// storedTrace is a tracer run by the StoreLogger on a single transaction.
+type storedTrace struct {
+	name string
+	Tracer
+}
+
+var _ core.BlockchainLogger = (*StoreLogger)(nil)
+
+// NewStoreLogger creates a chain logger storing the results of the given tracers
+// for the given number of recent blocks, or for all blocks if retention is 0.
+func NewStoreLogger(db ethdb.Database, names []string, retention uint64) (*StoreLogger, error) {
+	if err := checkStoredTracers(names); err != nil {
+		return nil, err
+	}
+	return &StoreLogger{db: db, names: names, retention: retention}, nil
+}
+
+// BackfillBlock re-executes all transactions of the block on top of the state
+// of its parent with the store logger attached, the same way as during block
+// import.
+func BackfillBlock(chain core.ChainContext, config *params.ChainConfig, block *types.Block, parent *types.Header, statedb *state.StateDB, logger *StoreLogger) error {
+	var (
+		is158    = config.IsEIP158(block.Number())
+		blockCtx = core.NewEVMBlockContext(block.Header(), parent.ExcessDataGas, chain, nil)
+		signer   = types.MakeSigner(config, block.Number(), block.Time())
+	)
+	logger.OnBlockStart(block, nil, nil, nil)
+	for i, tx := range block.Transactions() {
+		msg, err := core.TransactionToMessage(tx, signer, block.BaseFee())
+		if err != nil {
+			logger.OnBlockEnd(err)
+			return err
+		}
+		statedb.SetTxContext(tx.Hash(), i)
+		vmenv := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), statedb, config, vm.Config{Debug: true, Tracer: logger})
+		if _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.GasLimit).AddDataGas(params.MaxDataGasPerBlock)); err != nil {
+			logger.OnBlockEnd(err)
+			return fmt.Errorf("tracing failed: %w", err)
+		}
+		statedb.Finalise(is158)
+	}
+	logger.OnBlockEnd(nil)
+	return nil
+}
+
+func (l *StoreLogger) OnBlockStart(block *types.Block, td *big.Int, finalized, safe *types.Header) {
+	l.block = block
+	l.batch = l.db.NewBatch()
+	l.txIndex = 0
+}
+
+func (l *StoreLogger) OnBlockEnd(err error) {
+	if l.block == nil {
+		return
+	}
+	// Traces of rejected blocks are discarded.
+	if err == nil {
+		if err := l.batch.Write(); err != nil {
+			log.Crit("Failed to store transaction traces", "err", err)
+		}
+		l.prune(l.block.NumberU64())
+	}
+	l.block, l.batch, l.active = nil, nil, nil
+}
+
+// prune deletes the stored traces of the blocks which fell out of the retention
+// window with the import of the given block. If the retention shrank since the
+// last import, the backlog is pruned in chunks of maxTracePruneBlocks.
+func (l *StoreLogger) prune(number uint64) {
+	if l.retention == 0 || number < l.retention {
+		return
+	}
+	limit := number - l.retention
+	tail := limit
+	if stored := rawdb.ReadTxTraceTail(l.db); stored != nil {
+		tail = *stored
+	}
+	if tail > limit {
+		return
+	}
+	for end := tail + maxTracePruneBlocks; tail <= limit && tail < end; tail++ {
+		// Side chain headers are only kept in the key-value store, the
+		// canonical one might have been moved to the freezer already.
+		canonical := rawdb.ReadCanonicalHash(l.db, tail)
+		if canonical != (common.Hash{}) {
+			rawdb.DeleteBlockTraces(l.db, canonical)
+		}
+		for _, hash := range rawdb.ReadAllHashes(l.db, tail) {
+			if hash != canonical {
+				rawdb.DeleteBlockTraces(l.db, hash)
+			}
+		}
+	}
+	rawdb.WriteTxTraceTail(l.db, tail)
+}
+
+func (l *StoreLogger) CaptureTxStart(gasLimit uint64) {
+	if l.block == nil || l.txIndex >= len(l.block.Transactions()) {
+		return
+	}
+	ctx := &Context{
+		BlockHash:   l.block.Hash(),
+		BlockNumber: l.block.Number(),
+		TxIndex:     l.txIndex,
+		TxHash:      l.block.Transactions()[l.txIndex].Hash(),
+	}
+	l.active = make([]storedTrace, 0, len(l.names))
+	for _, name := range l.names {
+		tracer, err := DefaultDirectory.New(name, ctx, nil)
+		if err != nil {
+			log.Error("Failed to create stored tracer", "name", name, "err", err)
+			continue
+		}
+		tracer.CaptureTxStart(gasLimit)
+		l.active = append(l.active, storedTrace{name: name, Tracer: tracer})
+	}
+}
+
+func (l *StoreLogger) CaptureTxEnd(restGas uint64) {
+	if l.active == nil {
+		return
+	}
+	for _, tracer := range l.active {
+		tracer.CaptureTxEnd(restGas)
+		res, err := tracer.GetResult()
+		if err != nil {
+			log.Warn("Failed to retrieve stored trace", "block", l.block.Number(), "index", l.txIndex, "name", tracer.name, "err", err)
+			continue
+		}
+		rawdb.WriteTxTrace(l.batch, l.block.Hash(), l.txIndex, tracer.name, res)
+	}
+	l.active = nil
+	l.txIndex++
+}
+
+func (l *StoreLogger) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	for _, tracer := range l.active {
+		tracer.CaptureStart(env, from, to, create, input, gas, value)
+	}
+}
+
+func (l *StoreLogger) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	for _, tracer := range l.active {
+		tracer.CaptureEnd(output, gasUsed, err)
+	}
+}
+
+func (l *StoreLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	for _, tracer := range l.active {
+		tracer.CaptureState(pc, op, gas, cost, scope, rData, depth, err)
+	}
+}
+
+func (l *StoreLogger) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	for _, tracer := range l.active {
+		tracer.CaptureFault(pc, op, gas, cost, scope, depth, err)
+	}
+}
+
+func (l *StoreLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	for _, tracer := range l.active {
+		tracer.CaptureEnter(typ, from, to, input, gas, value)
+	}
+}
+
+func (l *StoreLogger) CaptureExit(output []byte, gasUsed uint64, err error) {
+	for _, tracer := range l.active {
+		tracer.CaptureExit(output, gasUsed, err)
+	}
+}
+
+func (l *StoreLogger) OnGenesisBlock(genesis *types.Block, alloc core.GenesisAlloc) {}
+
+func (l *StoreLogger) OnBalanceChange(addr common.Address, prev, new *big.Int, reason tracing.BalanceChangeReason) {
+}
+
+func (l *StoreLogger) OnNonceChange(addr common.Address, prev, new uint64) {}
+
+func (l *StoreLogger) OnCodeChange(addr common.Address, prevCodeHash common.Hash, prevCode []byte, codeHash common.Hash, code []byte) {
+}
+
+func (l *StoreLogger) OnStorageChange(addr common.Address, slot common.Hash, prev, new common.Hash) {
+}
+
+func (l *StoreLogger) OnLog(log *types.Log) {}
+
+func (l *StoreLogger) OnGasChange(old, new uint64, reason tracing.GasChangeReason) {}
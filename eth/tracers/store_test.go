@@ -0,0 +1,195 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// storeTestTracer is a minimal native tracer reporting the position, recipient
+// and gas usage of a transaction.
+type storeTestTracer struct {
+	ctx     *Context
+	to      common.Address
+	gasUsed uint64
+}
+
+func newStoreTestTracer(ctx *Context, _ json.RawMessage) (Tracer, error) {
+	return &storeTestTracer{ctx: ctx}, nil
+}
+
+func (t *storeTestTracer) CaptureTxStart(gasLimit uint64) {}
+func (t *storeTestTracer) CaptureTxEnd(restGas uint64)    {}
+func (t *storeTestTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.to = to
+}
+func (t *storeTestTracer) CaptureEnd(output []byte, gasUsed uint64, err error) { t.gasUsed = gasUsed }
+func (t *storeTestTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+func (t *storeTestTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+func (t *storeTestTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+func (t *storeTestTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (t *storeTestTracer) Stop(err error)                                       {}
+
+func (t *storeTestTracer) GetResult() (json.RawMessage, error) {
+	return json.RawMessage(fmt.Sprintf(`{"tx":"%x","index":%d,"to":"%x","gasUsed":%d}`, t.ctx.TxHash, t.ctx.TxIndex, t.to, t.gasUsed)), nil
+}
+
+func init() {
+	DefaultDirectory.Register("storeTestTracer", newStoreTestTracer, false)
+}
+
+func TestTraceStore(t *testing.T) {
+	t.Parallel()
+
+	var (
+		accounts = newAccounts(2)
+		genesis  = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+			},
+		}
+		signer    = types.HomesteadSigner{}
+		generator = func(i int, b *core.BlockGen) {
+			for j := 0; j < 2; j++ {
+				tx, _ := types.SignTx(types.NewTransaction(uint64(2*i+j), accounts[1].addr, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, accounts[0].key)
+				b.AddTx(tx)
+			}
+		}
+		tracer = "storeTestTracer"
+		ctx    = context.Background()
+	)
+	// Only native tracers can be stored.
+	if _, err := NewStoreLogger(rawdb.NewMemoryDatabase(), []string{"unknownTracer"}, 0); err == nil {
+		t.Fatal("store logger created for unknown tracer")
+	}
+	// Backfill the traces of a chain imported without storage.
+	backend := newTestBackend(t, 3, genesis, generator)
+	defer backend.chain.Stop()
+	api := NewAPI(backend)
+
+	processed, err := api.BackfillTraces(ctx, 1, 3, []string{tracer})
+	if err != nil {
+		t.Fatalf("failed to backfill traces: %v", err)
+	}
+	if processed != 3 {
+		t.Fatalf("wrong number of processed blocks: have %d, want 3", processed)
+	}
+	// The stored traces must match the re-executed ones. A custom tracer config
+	// bypasses the store.
+	var blocks []*types.Block
+	for number := uint64(1); number <= 3; number++ {
+		block := backend.chain.GetBlockByNumber(number)
+		blocks = append(blocks, block)
+
+		for i, tx := range block.Transactions() {
+			stored := rawdb.ReadTxTrace(backend.chaindb, block.Hash(), i, tracer)
+			if stored == nil {
+				t.Fatalf("block %d tx %d: trace not stored", number, i)
+			}
+			fresh, err := api.TraceTransaction(ctx, tx.Hash(), &TraceConfig{Tracer: &tracer, TracerConfig: json.RawMessage(`{"fresh":true}`)})
+			if err != nil {
+				t.Fatalf("block %d tx %d: failed to trace: %v", number, i, err)
+			}
+			if string(stored) != string(fresh.(json.RawMessage)) {
+				t.Errorf("block %d tx %d: stored trace mismatch\n have: %s\n want: %s", number, i, stored, fresh)
+			}
+		}
+	}
+	// Matching requests are served from the store.
+	tx := blocks[0].Transactions()[1]
+	rawdb.WriteTxTrace(backend.chaindb, blocks[0].Hash(), 1, tracer, []byte(`"stored"`))
+
+	res, err := api.TraceTransaction(ctx, tx.Hash(), &TraceConfig{Tracer: &tracer})
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	if string(res.(json.RawMessage)) != `"stored"` {
+		t.Errorf("transaction trace not served from store: %s", res)
+	}
+	results, err := api.TraceBlockByNumber(ctx, 1, &TraceConfig{Tracer: &tracer})
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(results) != 2 || string(results[1].Result.(json.RawMessage)) != `"stored"` {
+		t.Errorf("block trace not served from store")
+	}
+
+	// Importing the same chain with trace storage enabled yields the same traces.
+	db := rawdb.NewMemoryDatabase()
+	logger, err := NewStoreLogger(db, []string{tracer}, 0)
+	if err != nil {
+		t.Fatalf("failed to create store logger: %v", err)
+	}
+	chain, err := core.NewBlockChain(db, nil, genesis, nil, ethash.NewFaker(), vm.Config{Tracer: logger}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	for _, block := range blocks[1:] {
+		for i := range block.Transactions() {
+			have := rawdb.ReadTxTrace(db, block.Hash(), i, tracer)
+			want := rawdb.ReadTxTrace(backend.chaindb, block.Hash(), i, tracer)
+			if string(have) != string(want) {
+				t.Errorf("block %d tx %d: imported trace mismatch\n have: %s\n want: %s", block.NumberU64(), i, have, want)
+			}
+		}
+	}
+
+	// With a retention, the traces of older blocks are pruned during import.
+	db = rawdb.NewMemoryDatabase()
+	if logger, err = NewStoreLogger(db, []string{tracer}, 2); err != nil {
+		t.Fatalf("failed to create store logger: %v", err)
+	}
+	chain, err = core.NewBlockChain(db, nil, genesis, nil, ethash.NewFaker(), vm.Config{Tracer: logger}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	for _, block := range blocks {
+		pruned := block.NumberU64() == 1
+		for i := range block.Transactions() {
+			if have := rawdb.ReadTxTrace(db, block.Hash(), i, tracer); (have == nil) != pruned {
+				t.Errorf("block %d tx %d: trace pruned %t, want %t", block.NumberU64(), i, have == nil, pruned)
+			}
+		}
+	}
+	if tail := rawdb.ReadTxTraceTail(db); tail == nil || *tail != 2 {
+		t.Errorf("wrong trace tail: have %v, want 2", tail)
+	}
+}
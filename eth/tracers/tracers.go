@@ -20,8 +20,10 @@ package tracers
 import (
 	"encoding/json"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/vm"
 )
 
@@ -35,7 +37,8 @@ type Context struct {
 }
 
 // Tracer interface extends vm.EVMLogger and additionally
-// allows collecting the tracing result.
+// allows collecting the tracing result. Tracers holding resources beyond
+// memory also implement io.Closer, which is called once the trace is done.
 type Tracer interface {
 	vm.EVMLogger
 	GetResult() (json.RawMessage, error)
@@ -43,8 +46,41 @@ type Tracer interface {
 	Stop(err error)
 }
 
+// Types of system operations.
+const (
+	SystemOpReward      = "REWARD"       // Block reward credited to the miner
+	SystemOpUncleReward = "UNCLE_REWARD" // Reward credited to the miner of an uncle
+	SystemOpWithdrawal  = "WITHDRAWAL"   // Ether withdrawn from the beacon chain
+	SystemOpBurn        = "BURN"         // Data gas fee burnt by a transaction
+	SystemOpOther       = "SYSTEM"       // Any other balance change of the consensus rules
+)
+
+// SystemOp is a balance change applied by the consensus rules outside of the
+// execution of transactions. Issuance has no sender, burns no recipient.
+type SystemOp struct {
+	Type    string
+	From    *common.Address
+	To      *common.Address
+	Value   *big.Int
+	Pending bool // Whether the state doesn't reflect the change yet
+}
+
+// SystemTracer is implemented by tracers which are able to report system
+// operations, which are traced as a pseudo-transaction at the end of a block.
+// CaptureSystemStart is invoked after CaptureTxStart, followed by an invocation
+// of CaptureSystemOp right before each operation is applied, and CaptureTxEnd.
+type SystemTracer interface {
+	Tracer
+	CaptureSystemStart(env *vm.EVM)
+	CaptureSystemOp(op *SystemOp)
+}
+
 type ctorFn func(*Context, json.RawMessage) (Tracer, error)
 type jsCtorFn func(string, *Context, json.RawMessage) (Tracer, error)
+type wasmCtorFn func([]byte, *Context, json.RawMessage) (Tracer, error)
+
+// wasmPrefix is the hex encoded magic number WebAssembly modules start with.
+const wasmPrefix = "0x0061736d"
 
 type elem struct {
 	ctor ctorFn
@@ -55,11 +91,13 @@ type elem struct {
 var DefaultDirectory = directory{elems: make(map[string]elem)}
 
 // directory provides functionality to lookup a tracer by name
-// and a function to instantiate it. It falls back to a JS code evaluator
+// and a function to instantiate it. It falls back to a WebAssembly
+// module loader for hex encoded modules, and to a JS code evaluator
 // if no tracer of the given name exists.
 type directory struct {
-	elems  map[string]elem
-	jsEval jsCtorFn
+	elems    map[string]elem
+	jsEval   jsCtorFn
+	wasmEval wasmCtorFn
 }
 
 // Register registers a method as a lookup for tracers, meaning that
@@ -74,20 +112,34 @@ func (d *directory) RegisterJSEval(f jsCtorFn) {
 	d.jsEval = f
 }
 
+// RegisterWasmEval registers a tracer that is able to load
+// dynamic user-provided WebAssembly modules.
+func (d *directory) RegisterWasmEval(f wasmCtorFn) {
+	d.wasmEval = f
+}
+
 // New returns a new instance of a tracer, by iterating through the
-// registered lookups. Name is either name of an existing tracer
-// or an arbitrary JS code.
+// registered lookups. Name is either name of an existing tracer,
+// a hex encoded WebAssembly module or an arbitrary JS code.
 func (d *directory) New(name string, ctx *Context, cfg json.RawMessage) (Tracer, error) {
 	if elem, ok := d.elems[name]; ok {
 		return elem.ctor(ctx, cfg)
 	}
+	if d.wasmEval != nil && strings.HasPrefix(name, wasmPrefix) {
+		code, err := hexutil.Decode(name)
+		if err != nil {
+			return nil, err
+		}
+		return d.wasmEval(code, ctx, cfg)
+	}
 	// Assume JS code
 	return d.jsEval(name, ctx, cfg)
 }
 
 // IsJS will return true if the given tracer will evaluate
-// JS code. Because code evaluation has high overhead, this
-// info will be used in determining fast and slow code paths.
+// JS code or run a WebAssembly module. Because code evaluation
+// has high overhead, this info will be used in determining fast
+// and slow code paths.
 func (d *directory) IsJS(name string) bool {
 	if elem, ok := d.elems[name]; ok {
 		return elem.isJS
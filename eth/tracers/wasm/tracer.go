@@ -0,0 +1,466 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package wasm implements tracers defined by user-provided WebAssembly modules.
+//
+// A module is passed as the hex encoded binary in place of the tracer name. It
+// is run in a sandbox without access to the host system, with bounded memory
+// and number of calls per trace. A single runaway call is stopped by the trace
+// timeout of the caller. The module has to export its linear memory as "memory",
+// and the following functions:
+//
+//	alloc(size i32) -> i32          returns a buffer for the payload of the next hook
+//	result() -> i64                 returns the JSON result as ptr<<32 | len
+//
+// The hooks below are optional. Every hook taking a payload is invoked with the
+// buffer returned by alloc, which is only read by the host before the call.
+// Integers are little endian, 256 bit words big endian, and flags a single byte.
+//
+//	setup(ptr, len i32)             config: tracer config JSON
+//	capture_tx_start(gas i64)
+//	capture_tx_end(rest i64)
+//	capture_start(ptr, len i32)     from[20] to[20] create[1] gas[8] value[32] input
+//	capture_end(ptr, len i32)       gasUsed[8] failed[1] output
+//	capture_state(ptr, len i32)     pc[8] op[1] gas[8] cost[8] depth[4] failed[1] address[20] stack
+//	capture_fault(ptr, len i32)     same as capture_state
+//	capture_enter(ptr, len i32)     type[1] from[20] to[20] gas[8] value[32] input
+//	capture_exit(ptr, len i32)      gasUsed[8] failed[1] output
+//
+// The stack is a list of words, bottom first. During the hooks, the module may
+// inspect the EVM by importing the following functions from the "geth" module.
+// Addresses, slots and results are read from and written to the guest memory.
+//
+//	memory_read(offset, size, dst i32) -> i32   copies EVM memory, returns 0 if out of bounds
+//	get_balance(addr, dst i32)                  writes the balance word of an account
+//	get_state(addr, slot, dst i32)              writes a storage word of an account
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+const (
+	maxMemoryPages = 1024        // Maximum linear memory of a module, 64 MiB
+	maxSteps       = 100_000_000 // Maximum number of calls into the module per trace
+)
+
+func init() {
+	tracers.DefaultDirectory.RegisterWasmEval(newWasmTracer)
+}
+
+// wasmTracer is an implementation of the Tracer interface which invokes the
+// exported functions of a WebAssembly module on the relevant EVM hooks.
+type wasmTracer struct {
+	runtime wazero.Runtime
+	module  api.Module
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	env   *vm.EVM
+	scope *vm.ScopeContext // Scope of the current step, accessible by host functions
+
+	// Exported functions of the module, nil if not implemented
+	alloc          api.Function
+	result         api.Function
+	captureTxStart api.Function
+	captureTxEnd   api.Function
+	captureStart   api.Function
+	captureEnd     api.Function
+	captureState   api.Function
+	captureFault   api.Function
+	captureEnter   api.Function
+	captureExit    api.Function
+
+	steps    uint64 // Number of calls into the module so far
+	maxSteps uint64 // Maximum number of calls into the module
+	err      error  // Any error that should stop tracing
+
+	lock   sync.Mutex
+	reason error // Reason the module was interrupted for
+	closed bool  // Whether the runtime was released
+}
+
+// newWasmTracer compiles and instantiates a WebAssembly tracer module.
+func newWasmTracer(code []byte, ctx *tracers.Context, cfg json.RawMessage) (tracers.Tracer, error) {
+	t := &wasmTracer{maxSteps: maxSteps}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	// The compiled module is only cached by the runtime of the tracer, and
+	// released along with it
+	t.runtime = wazero.NewRuntimeWithConfig(t.ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(maxMemoryPages).
+		WithCloseOnContextDone(true))
+
+	if err := t.instantiate(code); err != nil {
+		t.Close()
+		return nil, err
+	}
+	// Pass in config
+	if setup := t.module.ExportedFunction("setup"); setup != nil {
+		if cfg == nil {
+			cfg = json.RawMessage("{}")
+		}
+		if t.call("setup", setup, cfg); t.err != nil {
+			t.Close()
+			return nil, t.err
+		}
+	}
+	return t, nil
+}
+
+// instantiate sets up the host functions and instantiates the module.
+func (t *wasmTracer) instantiate(code []byte) error {
+	host := t.runtime.NewHostModuleBuilder("geth")
+	host.NewFunctionBuilder().WithFunc(t.memoryRead).Export("memory_read")
+	host.NewFunctionBuilder().WithFunc(t.getBalance).Export("get_balance")
+	host.NewFunctionBuilder().WithFunc(t.getState).Export("get_state")
+	if _, err := host.Instantiate(t.ctx); err != nil {
+		return err
+	}
+	compiled, err := t.runtime.CompileModule(t.ctx, code)
+	if err != nil {
+		return err
+	}
+	if t.module, err = t.runtime.InstantiateModule(t.ctx, compiled, wazero.NewModuleConfig().WithName("")); err != nil {
+		return err
+	}
+	if t.module.Memory() == nil {
+		return errors.New("tracer module must export its memory")
+	}
+	if t.result = t.module.ExportedFunction("result"); t.result == nil {
+		return errors.New("tracer module must export a function result()")
+	}
+	t.alloc = t.module.ExportedFunction("alloc")
+	t.captureTxStart = t.module.ExportedFunction("capture_tx_start")
+	t.captureTxEnd = t.module.ExportedFunction("capture_tx_end")
+	t.captureStart = t.module.ExportedFunction("capture_start")
+	t.captureEnd = t.module.ExportedFunction("capture_end")
+	t.captureState = t.module.ExportedFunction("capture_state")
+	t.captureFault = t.module.ExportedFunction("capture_fault")
+	t.captureEnter = t.module.ExportedFunction("capture_enter")
+	t.captureExit = t.module.ExportedFunction("capture_exit")
+
+	if t.alloc == nil {
+		for _, fn := range []api.Function{t.captureStart, t.captureEnd, t.captureState, t.captureFault, t.captureEnter, t.captureExit, t.module.ExportedFunction("setup")} {
+			if fn != nil {
+				return errors.New("tracer module must export a function alloc()")
+			}
+		}
+	}
+	return nil
+}
+
+// CaptureTxStart implements the Tracer interface and is invoked at the beginning of
+// transaction processing.
+func (t *wasmTracer) CaptureTxStart(gasLimit uint64) {
+	if t.captureTxStart == nil || t.err != nil {
+		return
+	}
+	if _, err := t.invoke(t.captureTxStart, gasLimit); err != nil {
+		t.onError("capture_tx_start", t.interruption(err))
+	}
+}
+
+// CaptureTxEnd implements the Tracer interface and is invoked at the end of
+// transaction processing.
+func (t *wasmTracer) CaptureTxEnd(restGas uint64) {
+	if t.captureTxEnd == nil || t.err != nil {
+		return
+	}
+	if _, err := t.invoke(t.captureTxEnd, restGas); err != nil {
+		t.onError("capture_tx_end", t.interruption(err))
+	}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *wasmTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	if t.captureStart == nil || t.err != nil {
+		return
+	}
+	payload := make([]byte, 0, 81+len(input))
+	payload = append(payload, from.Bytes()...)
+	payload = append(payload, to.Bytes()...)
+	payload = append(payload, flag(create))
+	payload = binary.LittleEndian.AppendUint64(payload, gas)
+	payload = appendWord(payload, value)
+	payload = append(payload, input...)
+	t.call("capture_start", t.captureStart, payload)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *wasmTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	if t.captureEnd == nil || t.err != nil {
+		return
+	}
+	t.call("capture_end", t.captureEnd, resultPayload(output, gasUsed, err))
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *wasmTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if t.captureState == nil || t.err != nil {
+		return
+	}
+	t.scope = scope
+	t.call("capture_state", t.captureState, stepPayload(pc, op, gas, cost, scope, depth, err))
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault.
+func (t *wasmTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	if t.captureFault == nil || t.err != nil {
+		return
+	}
+	t.scope = scope
+	t.call("capture_fault", t.captureFault, stepPayload(pc, op, gas, cost, scope, depth, err))
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *wasmTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if t.captureEnter == nil || t.err != nil {
+		return
+	}
+	payload := make([]byte, 0, 81+len(input))
+	payload = append(payload, byte(typ))
+	payload = append(payload, from.Bytes()...)
+	payload = append(payload, to.Bytes()...)
+	payload = binary.LittleEndian.AppendUint64(payload, gas)
+	payload = appendWord(payload, value)
+	payload = append(payload, input...)
+	t.call("capture_enter", t.captureEnter, payload)
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *wasmTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	if t.captureExit == nil || t.err != nil {
+		return
+	}
+	t.call("capture_exit", t.captureExit, resultPayload(output, gasUsed, err))
+}
+
+// GetResult returns the JSON result of the module, and any error arising from
+// the execution or forceful termination (via `Stop`). The module is released
+// afterwards.
+func (t *wasmTracer) GetResult() (json.RawMessage, error) {
+	defer t.Close()
+
+	if t.err != nil {
+		return nil, t.err
+	}
+	ret, err := t.invoke(t.result)
+	if err != nil {
+		return nil, wrapError("result", t.interruption(err))
+	}
+	res, ok := t.module.Memory().Read(uint32(ret[0]>>32), uint32(ret[0]))
+	if !ok {
+		return nil, wrapError("result", errors.New("result out of bounds"))
+	}
+	if !json.Valid(res) {
+		return nil, wrapError("result", errors.New("result is not valid JSON"))
+	}
+	return json.RawMessage(common.CopyBytes(res)), nil
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *wasmTracer) Stop(err error) {
+	t.interrupt(err)
+}
+
+// interrupt closes the module, aborting any running and subsequent calls.
+func (t *wasmTracer) interrupt(err error) {
+	t.lock.Lock()
+	if t.reason == nil {
+		t.reason = err
+	}
+	t.lock.Unlock()
+	t.cancel()
+}
+
+// interruption returns the reason of the interruption if the module was
+// interrupted, or the error itself otherwise.
+func (t *wasmTracer) interruption(err error) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.reason != nil {
+		return t.reason
+	}
+	return err
+}
+
+// Close releases the runtime of the module. It's invoked once the module failed
+// or returned its result, and by the tracing API for traces ending without
+// either. It's safe to call multiple times.
+func (t *wasmTracer) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.cancel()
+	return t.runtime.Close(context.Background())
+}
+
+// call copies the payload into the guest memory and invokes a hook with it.
+func (t *wasmTracer) call(hook string, fn api.Function, payload []byte) {
+	ret, err := t.invoke(t.alloc, uint64(len(payload)))
+	if err == nil {
+		if !t.module.Memory().Write(uint32(ret[0]), payload) {
+			err = errors.New("payload buffer out of bounds")
+		} else {
+			_, err = t.invoke(fn, ret[0], uint64(len(payload)))
+		}
+	}
+	if err != nil {
+		t.onError(hook, t.interruption(err))
+	}
+}
+
+// invoke calls a function of the module, failing if the step limit of the
+// trace is used up.
+func (t *wasmTracer) invoke(fn api.Function, params ...uint64) ([]uint64, error) {
+	if t.steps >= t.maxSteps {
+		return nil, fmt.Errorf("tracer exceeded step limit of %d", t.maxSteps)
+	}
+	t.steps++
+	return fn.Call(t.ctx, params...)
+}
+
+// onError is called anytime the module fails. It releases the module, which
+// isn't called anymore, and in turn pings the EVM to cancel its execution.
+func (t *wasmTracer) onError(hook string, err error) {
+	t.err = wrapError(hook, err)
+	t.Close()
+	if t.env != nil {
+		t.env.Cancel()
+	}
+}
+
+func wrapError(hook string, err error) error {
+	return fmt.Errorf("%v    in server-side tracer function '%v'", err, hook)
+}
+
+// memoryRead copies a range of the memory of the current EVM frame into the
+// guest memory.
+func (t *wasmTracer) memoryRead(ctx context.Context, mod api.Module, offset, size, dst uint32) uint32 {
+	if t.scope == nil {
+		return 0
+	}
+	mem := t.scope.Memory.Data()
+	if uint64(offset)+uint64(size) > uint64(len(mem)) {
+		return 0
+	}
+	return flag32(mod.Memory().Write(dst, mem[offset:offset+size]))
+}
+
+// getBalance writes the balance of an account into the guest memory.
+func (t *wasmTracer) getBalance(ctx context.Context, mod api.Module, addr, dst uint32) {
+	if t.env == nil {
+		panic(errors.New("state accessed before execution"))
+	}
+	t.writeWord(mod, dst, t.env.StateDB.GetBalance(t.readAddress(mod, addr)))
+}
+
+// getState writes a storage slot of an account into the guest memory.
+func (t *wasmTracer) getState(ctx context.Context, mod api.Module, addr, slot, dst uint32) {
+	if t.env == nil {
+		panic(errors.New("state accessed before execution"))
+	}
+	key, ok := mod.Memory().Read(slot, common.HashLength)
+	if !ok {
+		panic(errors.New("slot out of bounds"))
+	}
+	value := t.env.StateDB.GetState(t.readAddress(mod, addr), common.BytesToHash(key))
+	if !mod.Memory().Write(dst, value.Bytes()) {
+		panic(errors.New("destination out of bounds"))
+	}
+}
+
+func (t *wasmTracer) readAddress(mod api.Module, ptr uint32) common.Address {
+	addr, ok := mod.Memory().Read(ptr, common.AddressLength)
+	if !ok {
+		panic(errors.New("address out of bounds"))
+	}
+	return common.BytesToAddress(addr)
+}
+
+func (t *wasmTracer) writeWord(mod api.Module, ptr uint32, v *big.Int) {
+	if !mod.Memory().Write(ptr, appendWord(nil, v)) {
+		panic(errors.New("destination out of bounds"))
+	}
+}
+
+// stepPayload encodes the state of the EVM before an instruction.
+func stepPayload(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) []byte {
+	stack := scope.Stack.Data()
+
+	payload := make([]byte, 0, 50+32*len(stack))
+	payload = binary.LittleEndian.AppendUint64(payload, pc)
+	payload = append(payload, byte(op))
+	payload = binary.LittleEndian.AppendUint64(payload, gas)
+	payload = binary.LittleEndian.AppendUint64(payload, cost)
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(depth))
+	payload = append(payload, flag(err != nil))
+	payload = append(payload, scope.Contract.Address().Bytes()...)
+	for _, item := range stack {
+		word := item.Bytes32()
+		payload = append(payload, word[:]...)
+	}
+	return payload
+}
+
+// resultPayload encodes the outcome of a call.
+func resultPayload(output []byte, gasUsed uint64, err error) []byte {
+	payload := make([]byte, 0, 9+len(output))
+	payload = binary.LittleEndian.AppendUint64(payload, gasUsed)
+	payload = append(payload, flag(err != nil))
+	return append(payload, output...)
+}
+
+// appendWord appends a value as a 256 bit big endian word.
+func appendWord(b []byte, v *big.Int) []byte {
+	var word [32]byte
+	if v != nil {
+		v.FillBytes(word[:])
+	}
+	return append(b, word[:]...)
+}
+
+func flag(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func flag32(b bool) uint32 {
+	return uint32(flag(b))
+}
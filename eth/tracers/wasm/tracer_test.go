@@ -0,0 +1,130 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package wasm
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// stepCounter counts the executed instructions, and returns the count as a
+// single digit:
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (global $steps (mut i32) (i32.const 0))
+//	  (func (export "alloc") (param i32) (result i32) (i32.const 1024))
+//	  (func (export "capture_state") (param i32 i32)
+//	    (global.set $steps (i32.add (global.get $steps) (i32.const 1))))
+//	  (func (export "result") (result i64)
+//	    (i32.store8 (i32.const 0) (i32.add (global.get $steps) (i32.const 48)))
+//	    (i64.const 1)))
+const stepCounter = "0x0061736d01000000010f0360017f017f60027f7f006000017e03040300010205030100010606017f0141000b072b04066d656d6f7279020005616c6c6f6300000d636170747572655f7374617465000106726573756c7400020a200305004180080b0900230041016a24000b0e004100230041306a3a000042010b"
+
+// stepLooper is the stepCounter with capture_state never returning:
+//
+//	(func (export "capture_state") (param i32 i32) (loop (br 0)))
+const stepLooper = "0x0061736d01000000010f0360017f017f60027f7f006000017e03040300010205030100010606017f0141000b072b04066d656d6f7279020005616c6c6f6300000d636170747572655f7374617465000106726573756c7400020a1e0305004180080b070003400c000b0b0e004100230041306a3a000042010b"
+
+func runTrace(t *testing.T, tracer tracers.Tracer, code []byte) (json.RawMessage, error) {
+	t.Helper()
+
+	var (
+		statedb, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		env        = vm.NewEVM(vm.BlockContext{BlockNumber: big.NewInt(1)}, vm.TxContext{GasPrice: big.NewInt(1)}, statedb, params.TestChainConfig, vm.Config{Debug: true, Tracer: tracer})
+		contract   = vm.NewContract(vm.AccountRef(common.Address{}), vm.AccountRef(common.Address{}), new(big.Int), 10000)
+	)
+	contract.Code = code
+
+	tracer.CaptureTxStart(31000)
+	tracer.CaptureStart(env, contract.Caller(), contract.Address(), false, nil, contract.Gas, contract.Value())
+	ret, err := env.Interpreter().Run(contract, nil, false)
+	tracer.CaptureEnd(ret, 10000-contract.Gas, err)
+	tracer.CaptureTxEnd(contract.Gas)
+	if err != nil {
+		return nil, err
+	}
+	return tracer.GetResult()
+}
+
+func TestTracer(t *testing.T) {
+	tracer, err := tracers.DefaultDirectory.New(stepCounter, new(tracers.Context), nil)
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+	res, err := runTrace(t, tracer, []byte{byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x1, byte(vm.STOP)})
+	if err != nil {
+		t.Fatalf("trace failed: %v", err)
+	}
+	if string(res) != "3" {
+		t.Errorf("step count mismatch: have %s, want 3", res)
+	}
+}
+
+func TestHalt(t *testing.T) {
+	tracer, err := newWasmTracer(hexutil.MustDecode(stepLooper), new(tracers.Context), nil)
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+	timeout := errors.New("stahp")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tracer.Stop(timeout)
+	}()
+	if _, err := runTrace(t, tracer, []byte{byte(vm.STOP)}); err == nil || !strings.Contains(err.Error(), "stahp") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	tracer, err := newWasmTracer(hexutil.MustDecode(stepCounter), new(tracers.Context), nil)
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+	tracer.(*wasmTracer).maxSteps = 2
+	if _, err := runTrace(t, tracer, []byte{byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x1, byte(vm.STOP)}); err == nil || !strings.Contains(err.Error(), "step limit") {
+		t.Errorf("expected step limit error, got %v", err)
+	}
+	if !tracer.(*wasmTracer).closed {
+		t.Errorf("runtime not released after failure")
+	}
+}
+
+func TestInvalidModule(t *testing.T) {
+	// Rename the export of the result function
+	code := strings.Replace(stepCounter, "06726573756c740002", "06726573756c780002", 1)
+	if _, err := newWasmTracer(hexutil.MustDecode(code), new(tracers.Context), nil); err == nil || !strings.Contains(err.Error(), "result()") {
+		t.Errorf("expected missing result error, got %v", err)
+	}
+	// Ask for more memory than allowed
+	code = strings.Replace(stepCounter, "05030100010606", "0504010081080606", 1)
+	if _, err := newWasmTracer(hexutil.MustDecode(code), new(tracers.Context), nil); err == nil {
+		t.Errorf("expected memory limit error")
+	}
+}
@@ -0,0 +1,624 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package boltdb implements the key-value database layer based on bbolt, an
+// embedded copy-on-write B+tree. Reads are served directly from a memory mapped
+// file without any compaction in the background, which suits read-heavy archive
+// workloads, at the cost of slower random writes than LSM-tree based stores.
+package boltdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// fileName is the name of the database file within the database directory.
+	fileName = "bolt.db"
+
+	// initialMmapSize is the initial size of the memory mapped region. Growing
+	// the mapping must wait for all read transactions to finish, so it should
+	// be rare while snapshots are held.
+	initialMmapSize = 1 << 30
+
+	// lockTimeout is the time to wait for the file lock of a database opened by
+	// another process.
+	lockTimeout = time.Second
+
+	// iteratorChunkItems is the maximum number of entries an iterator loads
+	// within a single read transaction.
+	iteratorChunkItems = 1024
+
+	// iteratorChunkSize is the maximum total size of the entries an iterator
+	// loads within a single read transaction.
+	iteratorChunkSize = 1024 * 1024
+
+	// metricsGatheringInterval specifies the interval to retrieve bolt database
+	// page and transaction stats to report to the user.
+	metricsGatheringInterval = 3 * time.Second
+)
+
+var (
+	// errNotFound is returned if a key is requested that is not found in the
+	// database.
+	errNotFound = errors.New("not found")
+
+	// bucketName is the name of the single bucket holding all entries.
+	bucketName = []byte("ethdb")
+)
+
+func init() {
+	ethdb.RegisterBackend("boltdb", ethdb.Backend{
+		Open: func(config ethdb.BackendConfig) (ethdb.KeyValueStore, error) {
+			db, err := New(config.Directory, config.Namespace, config.ReadOnly)
+			if err != nil {
+				return nil, err
+			}
+			return db, nil
+		},
+		Detect: func(dir string) bool {
+			_, err := os.Stat(filepath.Join(dir, fileName))
+			return err == nil
+		},
+	})
+}
+
+// Database is a persistent key-value store based on a bbolt B+tree. Apart from
+// basic data storage functionality it also supports batch writes and iterating
+// over the keyspace in binary-alphabetical order.
+type Database struct {
+	fn string   // directory for reporting
+	db *bolt.DB // Underlying bolt storage engine
+
+	diskSizeGauge  metrics.Gauge // Gauge for tracking the size of the database file
+	freePagesGauge metrics.Gauge // Gauge for tracking the number of free pages in the database file
+	readTxGauge    metrics.Gauge // Gauge for tracking the number of open read transactions
+	diskWriteMeter metrics.Meter // Meter for measuring the amount of data written
+	writeTimeMeter metrics.Meter // Meter for measuring the time spent writing pages
+	rebalanceMeter metrics.Meter // Meter for measuring the time spent rebalancing the tree
+
+	readers    map[reader]struct{} // Unreleased snapshots to roll back on close
+	readerLock sync.Mutex          // Mutex protecting the reader set
+
+	quitLock sync.Mutex      // Mutex protecting the quit channel access
+	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
+
+	log log.Logger // Contextual logger tracking the database path
+}
+
+// New returns a wrapped bolt DB object, stored in the given directory. The
+// namespace is the prefix that the metrics reporting should use for surfacing
+// internal stats.
+//
+// Bolt relies on the page cache of the operating system instead of managing its
+// own cache and file handles, so there are no such allowances to configure.
+func New(dir string, namespace string, readonly bool) (*Database, error) {
+	return newDatabase(dir, namespace, readonly, initialMmapSize)
+}
+
+// newDatabase opens the bolt database with the given initial size of the memory
+// mapped region.
+func newDatabase(dir string, namespace string, readonly bool, mmapSize int) (*Database, error) {
+	if !readonly {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	logger := log.New("database", dir)
+
+	db, err := bolt.Open(filepath.Join(dir, fileName), 0644, &bolt.Options{
+		Timeout:         lockTimeout,
+		ReadOnly:        readonly,
+		InitialMmapSize: mmapSize,
+
+		// The freelist is rebuilt on startup instead of rewriting it on every
+		// commit, and kept in a hashmap, which is much faster for large files.
+		NoFreelistSync: true,
+		FreelistType:   bolt.FreelistMapType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !readonly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bucketName)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	logger.Info("Opened bolt database", "readonly", readonly)
+
+	bdb := &Database{
+		fn:             dir,
+		db:             db,
+		log:            logger,
+		readers:        make(map[reader]struct{}),
+		quitChan:       make(chan chan error),
+		diskSizeGauge:  metrics.NewRegisteredGauge(namespace+"disk/size", nil),
+		freePagesGauge: metrics.NewRegisteredGauge(namespace+"disk/freepages", nil),
+		readTxGauge:    metrics.NewRegisteredGauge(namespace+"tx/read", nil),
+		diskWriteMeter: metrics.NewRegisteredMeter(namespace+"disk/write", nil),
+		writeTimeMeter: metrics.NewRegisteredMeter(namespace+"tx/writetime", nil),
+		rebalanceMeter: metrics.NewRegisteredMeter(namespace+"tx/rebalancetime", nil),
+	}
+	// Start up the metrics gathering and return
+	go bdb.meter(metricsGatheringInterval)
+	return bdb, nil
+}
+
+// Close stops the metrics collection, flushes any pending data to disk and closes
+// all io accesses to the underlying key-value store.
+func (d *Database) Close() error {
+	d.quitLock.Lock()
+	defer d.quitLock.Unlock()
+
+	if d.quitChan != nil {
+		errc := make(chan error)
+		d.quitChan <- errc
+		if err := <-errc; err != nil {
+			d.log.Error("Metrics collection failed", "err", err)
+		}
+		d.quitChan = nil
+	}
+	// Closing the database waits for all read transactions to finish, so roll
+	// back the ones held by snapshots that were never released.
+	d.readerLock.Lock()
+	readers := d.readers
+	d.readers = make(map[reader]struct{})
+	d.readerLock.Unlock()
+
+	for r := range readers {
+		r.Release()
+	}
+	return d.db.Close()
+}
+
+// reader is a snapshot holding a read transaction until released.
+type reader interface {
+	Release()
+}
+
+// track registers a reader to be released when the database is closed.
+func (d *Database) track(r reader) {
+	d.readerLock.Lock()
+	defer d.readerLock.Unlock()
+
+	d.readers[r] = struct{}{}
+}
+
+// untrack removes a released reader from the set of open ones.
+func (d *Database) untrack(r reader) {
+	d.readerLock.Lock()
+	defer d.readerLock.Unlock()
+
+	delete(d.readers, r)
+}
+
+// lookup retrieves the value stored under the key within a transaction. The
+// returned slice is only valid for the lifetime of the transaction.
+//
+// Bolt returns nil for both missing keys and empty values, so the cursor is
+// used to tell them apart.
+func lookup(tx *bolt.Tx, key []byte) ([]byte, bool) {
+	bucket := tx.Bucket(bucketName)
+	if bucket == nil {
+		return nil, false // Read-only database never written to
+	}
+	k, v := bucket.Cursor().Seek(key)
+	if k == nil || !bytes.Equal(k, key) {
+		return nil, false
+	}
+	return v, true
+}
+
+// get retrieves a copy of the value stored under the key within a transaction.
+func get(tx *bolt.Tx, key []byte) ([]byte, error) {
+	v, ok := lookup(tx, key)
+	if !ok {
+		return nil, errNotFound
+	}
+	return common.CopyBytes(v), nil
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (d *Database) Has(key []byte) (bool, error) {
+	var ok bool
+	err := d.db.View(func(tx *bolt.Tx) error {
+		_, ok = lookup(tx, key)
+		return nil
+	})
+	return ok, err
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (d *Database) Get(key []byte) ([]byte, error) {
+	var (
+		dat []byte
+		err error
+	)
+	if verr := d.db.View(func(tx *bolt.Tx) error {
+		dat, err = get(tx, key)
+		return nil
+	}); verr != nil {
+		return nil, verr
+	}
+	return dat, err
+}
+
+// Put inserts the given value into the key-value store.
+func (d *Database) Put(key []byte, value []byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put(key, nonNil(value))
+	})
+}
+
+// Delete removes the key from the key-value store.
+func (d *Database) Delete(key []byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete(key)
+	})
+}
+
+// nonNil converts a nil value into an empty one, as bolt rejects nil values.
+func nonNil(value []byte) []byte {
+	if value == nil {
+		return []byte{}
+	}
+	return value
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (d *Database) NewBatch() ethdb.Batch {
+	return &batch{db: d.db}
+}
+
+// NewBatchWithSize creates a write-only database batch with pre-allocated buffer.
+func (d *Database) NewBatchWithSize(size int) ethdb.Batch {
+	return &batch{db: d.db, writes: make([]keyvalue, 0, size)}
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset
+// of database content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+//
+// The iterator loads the entries in chunks, each within a short-lived read
+// transaction, to avoid blocking the growth of the database file for the
+// lifetime of the iterator. Callers often write batches while iterating, which
+// would otherwise wait forever for the database file to be remapped. Unlike a
+// snapshot, the iterator may thus observe the writes made to the not yet loaded
+// part of its range while iterating.
+func (d *Database) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	return &iterator{
+		db:     d.db,
+		prefix: common.CopyBytes(prefix),
+		next:   append(append([]byte{}, prefix...), start...),
+		index:  -1,
+	}
+}
+
+// snapshot wraps a bolt read transaction for implementing the Snapshot interface.
+type snapshot struct {
+	db   *Database
+	tx   *bolt.Tx
+	lock sync.Mutex // Read transactions are not safe for concurrent use
+}
+
+// NewSnapshot creates a database snapshot based on the current state.
+// The created snapshot will not be affected by all following mutations
+// happened on the database.
+// Note don't forget to release the snapshot once it's used up, otherwise the
+// pages freed in the meantime can't be reused and the file can't be remapped.
+func (d *Database) NewSnapshot() (ethdb.Snapshot, error) {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{db: d, tx: tx}
+	d.track(snap)
+	return snap, nil
+}
+
+// Has retrieves if a key is present in the snapshot backing by a key-value
+// data store.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	if snap.tx == nil {
+		return false, bolt.ErrTxClosed
+	}
+	_, ok := lookup(snap.tx, key)
+	return ok, nil
+}
+
+// Get retrieves the given key if it's present in the snapshot backing by
+// key-value data store.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	if snap.tx == nil {
+		return nil, bolt.ErrTxClosed
+	}
+	return get(snap.tx, key)
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (snap *snapshot) Release() {
+	snap.lock.Lock()
+	defer snap.lock.Unlock()
+
+	if snap.tx != nil {
+		snap.tx.Rollback()
+		snap.tx = nil
+		snap.db.untrack(snap)
+	}
+}
+
+// Stat returns a particular internal stat of the database.
+func (d *Database) Stat(property string) (string, error) {
+	stats := d.db.Stats()
+	return fmt.Sprintf("Free pages: %d\nPending pages: %d\nFree allocation: %d\nOpen read transactions: %d\n",
+		stats.FreePageN, stats.PendingPageN, stats.FreeAlloc, stats.OpenTxN), nil
+}
+
+// Compact is a no-op for bolt: deleted and overwritten entries don't linger in
+// the B+tree, and the pages freed by them are reused by later writes. Shrinking
+// the database file requires copying it offline.
+func (d *Database) Compact(start []byte, limit []byte) error {
+	return nil
+}
+
+// Checkpoint creates a consistent copy of the database in the given directory.
+func (d *Database) Checkpoint(dir string) error {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	return d.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(filepath.Join(dir, fileName), 0644)
+	})
+}
+
+// Path returns the path to the database directory.
+func (d *Database) Path() string {
+	return d.fn
+}
+
+// meter periodically retrieves internal bolt counters and reports them to
+// the metrics subsystem.
+func (d *Database) meter(refresh time.Duration) {
+	var errc chan error
+	timer := time.NewTimer(refresh)
+	defer timer.Stop()
+
+	// Iterate ad infinitum and collect the stats
+	prev := d.db.Stats()
+	for errc == nil {
+		var (
+			stats = d.db.Stats()
+			diff  = stats.Sub(&prev)
+			size  int64
+		)
+		prev = stats
+
+		d.db.View(func(tx *bolt.Tx) error {
+			size = tx.Size()
+			return nil
+		})
+		d.diskSizeGauge.Update(size)
+		d.freePagesGauge.Update(int64(stats.FreePageN))
+		d.readTxGauge.Update(int64(stats.OpenTxN))
+		d.diskWriteMeter.Mark(int64(diff.TxStats.Write) * int64(d.db.Info().PageSize))
+		d.writeTimeMeter.Mark(int64(diff.TxStats.WriteTime))
+		d.rebalanceMeter.Mark(int64(diff.TxStats.RebalanceTime))
+
+		// Sleep a bit, then repeat the stats collection
+		select {
+		case errc = <-d.quitChan:
+			// Quit requesting, stop hammering the database
+		case <-timer.C:
+			timer.Reset(refresh)
+			// Timeout, gather a new set of stats
+		}
+	}
+	errc <- nil
+}
+
+// keyvalue is a key-value tuple tagged with a deletion field to allow creating
+// database write batches.
+type keyvalue struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch is a write-only batch that commits changes to its host database
+// when Write is called. A batch cannot be used concurrently.
+type batch struct {
+	db     *bolt.DB
+	writes []keyvalue
+	size   int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), common.CopyBytes(value), false})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+// Delete inserts the a key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.writes = append(b.writes, keyvalue{common.CopyBytes(key), nil, true})
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to disk within a single transaction.
+func (b *batch) Write() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		for _, kv := range b.writes {
+			var err error
+			if kv.delete {
+				err = bucket.Delete(kv.key)
+			} else {
+				err = bucket.Put(kv.key, nonNil(kv.value))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.writes = b.writes[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	for _, kv := range b.writes {
+		if kv.delete {
+			if err := w.Delete(kv.key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(kv.key, kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterator walks a range of the database, loading the entries in chunks.
+type iterator struct {
+	db     *bolt.DB
+	prefix []byte // Prefix all iterated keys must share
+	next   []byte // Key to continue loading from
+	done   bool   // Whether the range is exhausted
+
+	keys   [][]byte
+	values [][]byte
+	index  int // Position within the loaded chunk
+	err    error
+}
+
+// load retrieves the next chunk of entries from the database, re-seeking the
+// key after the last loaded one in a fresh read transaction.
+func (it *iterator) load() {
+	it.keys, it.values, it.index = it.keys[:0], it.values[:0], 0
+
+	it.err = it.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket == nil {
+			it.done = true
+			return nil
+		}
+		var (
+			cursor = bucket.Cursor()
+			size   int
+		)
+		for k, v := cursor.Seek(it.next); ; k, v = cursor.Next() {
+			if k == nil || !bytes.HasPrefix(k, it.prefix) {
+				it.done = true
+				return nil
+			}
+			if len(it.keys) >= iteratorChunkItems || size >= iteratorChunkSize {
+				it.next = common.CopyBytes(k)
+				return nil
+			}
+			it.keys = append(it.keys, common.CopyBytes(k))
+			it.values = append(it.values, common.CopyBytes(v))
+			size += len(k) + len(v)
+		}
+	})
+	if it.err != nil {
+		it.done = true
+	}
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *iterator) Next() bool {
+	if it.index+1 < len(it.keys) {
+		it.index++
+		return true
+	}
+	if it.done {
+		it.keys, it.values, it.index = nil, nil, 0
+		return false
+	}
+	it.load()
+	return len(it.keys) > 0
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs
+// is not considered to be an error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done. The caller
+// should not modify the contents of the returned slice, and its contents may
+// change on the next call to Next.
+func (it *iterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.index]
+}
+
+// Value returns the value of the current key/value pair, or nil if done. The
+// caller should not modify the contents of the returned slice, and its contents
+// may change on the next call to Next.
+func (it *iterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.values) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (it *iterator) Release() {
+	it.keys, it.values, it.done = nil, nil, true
+}
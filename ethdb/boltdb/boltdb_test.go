@@ -0,0 +1,221 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package boltdb
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/dbtest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltDB(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() ethdb.KeyValueStore {
+			db, err := New(t.TempDir(), "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return db
+		})
+	})
+}
+
+// Tests that iterators crossing the boundaries of the loaded chunks see every
+// entry exactly once, in order.
+func TestBoltDBChunkedIterator(t *testing.T) {
+	db, err := New(t.TempDir(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	batch := db.NewBatch()
+	for i := 0; i < 3*iteratorChunkItems+1; i++ {
+		batch.Put([]byte(fmt.Sprintf("a-%05d", i)), []byte{byte(i)})
+		batch.Put([]byte(fmt.Sprintf("b-%05d", i)), []byte{byte(i)})
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	it := db.NewIterator([]byte("a-"), []byte("00010"))
+	defer it.Release()
+
+	n := 10
+	for ; it.Next(); n++ {
+		if want := []byte(fmt.Sprintf("a-%05d", n)); !bytes.Equal(it.Key(), want) {
+			t.Fatalf("key %d mismatch: have %s, want %s", n, it.Key(), want)
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3*iteratorChunkItems+1 {
+		t.Fatalf("item count mismatch: have %d, want %d", n, 3*iteratorChunkItems+1)
+	}
+}
+
+// Tests that writing batches while iterating doesn't deadlock once the database
+// file outgrows its initial memory mapping, which must wait for all open read
+// transactions to finish.
+func TestBoltDBIteratorGrowth(t *testing.T) {
+	const mmapSize = 1 << 20
+
+	db, err := newDatabase(t.TempDir(), "", false, mmapSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2*iteratorChunkItems; i++ {
+		db.Put([]byte(fmt.Sprintf("a-%05d", i)), []byte{byte(i)})
+	}
+	done := make(chan error)
+	go func() {
+		it := db.NewIterator([]byte("a-"), nil)
+		defer it.Release()
+
+		var (
+			batch = db.NewBatch()
+			value = make([]byte, 1024)
+			n     int
+		)
+		for ; it.Next(); n++ {
+			batch.Put([]byte(fmt.Sprintf("b-%05d", n)), value)
+			if batch.ValueSize() >= 64*1024 {
+				if err := batch.Write(); err != nil {
+					done <- err
+					return
+				}
+				batch.Reset()
+			}
+		}
+		if err := batch.Write(); err != nil {
+			done <- err
+			return
+		}
+		if n != 2*iteratorChunkItems {
+			done <- fmt.Errorf("item count mismatch: have %d, want %d", n, 2*iteratorChunkItems)
+			return
+		}
+		done <- it.Error()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("writes blocked by open iterator")
+	}
+	var size int64
+	db.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	if size <= mmapSize {
+		t.Fatalf("database file didn't outgrow the initial mapping: size %d", size)
+	}
+}
+
+// Tests that unreleased snapshots don't block closing the database.
+func TestBoltDBUnreleasedSnapshot(t *testing.T) {
+	db, err := New(t.TempDir(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("key"), []byte("value"))
+
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- db.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close blocked by unreleased snapshot")
+	}
+	if _, err := snap.Get([]byte("key")); err == nil {
+		t.Fatal("released snapshot still readable")
+	}
+}
+
+func TestBoltDBCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(filepath.Join(dir, "db"), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("val-%04d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Checkpoint(filepath.Join(dir, "checkpoint")); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	// Modifications after the checkpoint must not be visible in it
+	if err := db.Put([]byte("key-1000"), []byte("val-1000")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Checkpoint(filepath.Join(dir, "checkpoint")); err == nil {
+		t.Fatal("checkpoint into existing directory succeeded")
+	}
+	cp, err := New(filepath.Join(dir, "checkpoint"), "", true)
+	if err != nil {
+		t.Fatalf("failed to open checkpoint: %v", err)
+	}
+	defer cp.Close()
+
+	it := cp.NewIterator(nil, nil)
+	defer it.Release()
+
+	var n int
+	for ; it.Next(); n++ {
+		if want := []byte(fmt.Sprintf("key-%04d", n)); !bytes.Equal(it.Key(), want) {
+			t.Fatalf("key %d mismatch: have %s, want %s", n, it.Key(), want)
+		}
+		if want := []byte(fmt.Sprintf("val-%04d", n)); !bytes.Equal(it.Value(), want) {
+			t.Fatalf("value %d mismatch: have %s, want %s", n, it.Value(), want)
+		}
+	}
+	if n != 1000 {
+		t.Fatalf("item count mismatch: have %d, want %d", n, 1000)
+	}
+}
+
+func BenchmarkBoltDB(b *testing.B) {
+	dbtest.BenchDatabaseSuite(b, func() ethdb.KeyValueStore {
+		db, err := New(b.TempDir(), "", false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return db
+	})
+}
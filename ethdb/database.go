@@ -55,6 +55,15 @@ type Compacter interface {
 	Compact(start []byte, limit []byte) error
 }
 
+// Checkpointer wraps the Checkpoint method of a backing data store. It's an
+// optional interface, only implemented by the persistent data stores.
+type Checkpointer interface {
+	// Checkpoint creates a consistent point-in-time copy of the data store in the
+	// given directory, which must not exist yet. Immutable files may be hard
+	// linked instead of copied where the file system supports it.
+	Checkpoint(dir string) error
+}
+
 // KeyValueStore contains all the methods required to allow handling different
 // key-value data stores backing the high level database.
 type KeyValueStore interface {
@@ -89,6 +98,8 @@ type AncientReaderOp interface {
 
 	// Tail returns the number of first stored item in the freezer.
 	// This number can also be interpreted as the total deleted item numbers.
+	// Only the prunable categories of the store are affected by the tail,
+	// the others retain all items.
 	Tail() (uint64, error)
 
 	// AncientSize returns the ancient size of the specified category.
@@ -115,11 +126,11 @@ type AncientWriter interface {
 	// After the truncation, the latest item can be accessed it item_n-1(start from 0).
 	TruncateHead(n uint64) error
 
-	// TruncateTail discards the first n ancient data from the ancient store. The already
-	// deleted items are ignored. After the truncation, the earliest item can be accessed
-	// is item_n(start from 0). The deleted items may not be removed from the ancient store
-	// immediately, but only when the accumulated deleted data reach the threshold then
-	// will be removed all together.
+	// TruncateTail discards the first n ancient data from the prunable categories of
+	// the ancient store. The already deleted items are ignored. After the truncation,
+	// the earliest item can be accessed is item_n(start from 0). The deleted items may
+	// not be removed from the ancient store immediately, but only when the accumulated
+	// deleted data reach the threshold then will be removed all together.
 	TruncateTail(n uint64) error
 
 	// Sync flushes all in-memory ancient store data to disk.
@@ -129,6 +140,11 @@ type AncientWriter interface {
 	// The second argument is a function that takes a raw entry and returns it
 	// in the newest format.
 	MigrateTable(string, func([]byte) ([]byte, error)) error
+
+	// RepairAncient overwrites a corrupted item of the given kind with its
+	// original content, rewriting the following items of its data file if the
+	// content is stored in a different number of bytes than the corrupted item.
+	RepairAncient(kind string, number uint64, item []byte) error
 }
 
 // AncientWriteOp is given to the function argument of ModifyAncients.
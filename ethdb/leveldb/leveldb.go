@@ -22,6 +22,8 @@ package leveldb
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -56,6 +58,26 @@ const (
 	metricsGatheringInterval = 3 * time.Second
 )
 
+func init() {
+	ethdb.RegisterBackend("leveldb", ethdb.Backend{
+		Open: func(config ethdb.BackendConfig) (ethdb.KeyValueStore, error) {
+			db, err := New(config.Directory, config.Cache, config.Handles, config.Namespace, config.ReadOnly)
+			if err != nil {
+				return nil, err
+			}
+			return db, nil
+		},
+		Detect: func(dir string) bool {
+			// Pebble shares the CURRENT file, but also maintains OPTIONS files
+			if _, err := os.Stat(filepath.Join(dir, "CURRENT")); err != nil {
+				return false
+			}
+			matches, err := filepath.Glob(filepath.Join(dir, "OPTIONS*"))
+			return err == nil && len(matches) == 0
+		},
+	})
+}
+
 // Database is a persistent key-value store. Apart from basic data storage
 // functionality it also supports batch writes and iterating over the keyspace in
 // binary-alphabetical order.
@@ -259,6 +281,45 @@ func (db *Database) Compact(start []byte, limit []byte) error {
 	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
 }
 
+// Checkpoint creates a consistent copy of the database in the given directory.
+// LevelDB has no native support for checkpoints, so the content of a snapshot
+// is copied into a freshly created database.
+func (db *Database) Checkpoint(dir string) error {
+	snap, err := db.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	cp, err := leveldb.OpenFile(dir, &opt.Options{ErrorIfExist: true})
+	if err != nil {
+		return err
+	}
+	it := snap.NewIterator(nil, nil)
+	defer it.Release()
+
+	batch := new(leveldb.Batch)
+	for it.Next() {
+		batch.Put(it.Key(), it.Value())
+		if len(batch.Dump()) >= ethdb.IdealBatchSize {
+			if err := cp.Write(batch, nil); err != nil {
+				cp.Close()
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		cp.Close()
+		return err
+	}
+	if err := cp.Write(batch, nil); err != nil {
+		cp.Close()
+		return err
+	}
+	return cp.Close()
+}
+
 // Path returns the path to the database directory.
 func (db *Database) Path() string {
 	return db.fn
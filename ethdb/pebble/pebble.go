@@ -22,6 +22,8 @@ package pebble
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -49,6 +51,26 @@ const (
 	metricsGatheringInterval = 3 * time.Second
 )
 
+func init() {
+	ethdb.RegisterBackend("pebble", ethdb.Backend{
+		Open: func(config ethdb.BackendConfig) (ethdb.KeyValueStore, error) {
+			db, err := New(config.Directory, config.Cache, config.Handles, config.Namespace, config.ReadOnly)
+			if err != nil {
+				return nil, err
+			}
+			return db, nil
+		},
+		Detect: func(dir string) bool {
+			// Leveldb shares the CURRENT file, but doesn't maintain OPTIONS files
+			if _, err := os.Stat(filepath.Join(dir, "CURRENT")); err != nil {
+				return false
+			}
+			matches, err := filepath.Glob(filepath.Join(dir, "OPTIONS*"))
+			return err == nil && len(matches) > 0
+		},
+	})
+}
+
 // Database is a persistent key-value store based on the pebble storage engine.
 // Apart from basic data storage functionality it also supports batch writes and
 // iterating over the keyspace in binary-alphabetical order.
@@ -376,6 +398,12 @@ func (d *Database) Compact(start []byte, limit []byte) error {
 	return d.db.Compact(start, limit, true) // Parallelization is preferred
 }
 
+// Checkpoint creates a consistent copy of the database in the given directory,
+// hard linking the immutable sstables where the file system supports it.
+func (d *Database) Checkpoint(dir string) error {
+	return d.db.Checkpoint(dir, pebble.WithFlushedWAL())
+}
+
 // Path returns the path to the database directory.
 func (d *Database) Path() string {
 	return d.fn
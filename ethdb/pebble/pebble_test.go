@@ -19,6 +19,9 @@
 package pebble
 
 import (
+	"bytes"
+	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/cockroachdb/pebble"
@@ -43,6 +46,52 @@ func TestPebbleDB(t *testing.T) {
 	})
 }
 
+func TestPebbleDBCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(filepath.Join(dir, "db"), 16, 16, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("val-%04d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Checkpoint(filepath.Join(dir, "checkpoint")); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	// Modifications after the checkpoint must not be visible in it
+	if err := db.Put([]byte("key-1000"), []byte("val-1000")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Checkpoint(filepath.Join(dir, "checkpoint")); err == nil {
+		t.Fatal("checkpoint into existing directory succeeded")
+	}
+	cp, err := New(filepath.Join(dir, "checkpoint"), 16, 16, "", true)
+	if err != nil {
+		t.Fatalf("failed to open checkpoint: %v", err)
+	}
+	defer cp.Close()
+
+	it := cp.NewIterator(nil, nil)
+	defer it.Release()
+
+	var n int
+	for ; it.Next(); n++ {
+		if want := []byte(fmt.Sprintf("key-%04d", n)); !bytes.Equal(it.Key(), want) {
+			t.Fatalf("key %d mismatch: have %s, want %s", n, it.Key(), want)
+		}
+		if want := []byte(fmt.Sprintf("val-%04d", n)); !bytes.Equal(it.Value(), want) {
+			t.Fatalf("value %d mismatch: have %s, want %s", n, it.Value(), want)
+		}
+	}
+	if n != 1000 {
+		t.Fatalf("item count mismatch: have %d, want %d", n, 1000)
+	}
+}
+
 func BenchmarkPebbleDB(b *testing.B) {
 	dbtest.BenchDatabaseSuite(b, func() ethdb.KeyValueStore {
 		db, err := pebble.Open("", &pebble.Options{
@@ -0,0 +1,100 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BackendConfig contains the options to open a persistent key-value store with.
+type BackendConfig struct {
+	Directory string // Directory of the data store
+	Cache     int    // Capacity of the data caching in megabytes
+	Handles   int    // Number of files to be open simultaneously
+	Namespace string // Prefix of the metrics reported by the data store
+	ReadOnly  bool   // Whether to open the data store in read-only mode
+}
+
+// Backend is a persistent key-value store implementation, selectable by name
+// when opening a database.
+type Backend struct {
+	// Open opens the data store in the configured directory, creating it if it
+	// doesn't exist yet and the store isn't opened in read-only mode.
+	Open func(config BackendConfig) (KeyValueStore, error)
+
+	// Detect reports whether the directory contains a data store created by
+	// the backend. It must not match the data stores of other backends.
+	Detect func(dir string) bool
+}
+
+var (
+	backends     = make(map[string]Backend)
+	backendsLock sync.RWMutex
+)
+
+// RegisterBackend makes a key-value store implementation available by the given
+// name. It's meant to be called from the init function of the implementing
+// package, and panics if the name is already taken or the backend is incomplete.
+func RegisterBackend(name string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+
+	if backend.Open == nil || backend.Detect == nil {
+		panic(fmt.Sprintf("ethdb: incomplete backend %q", name))
+	}
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("ethdb: backend %q registered twice", name))
+	}
+	backends[name] = backend
+}
+
+// LookupBackend returns the key-value store implementation registered with the
+// given name, if any.
+func LookupBackend(name string) (Backend, bool) {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+
+	backend, ok := backends[name]
+	return backend, ok
+}
+
+// Backends returns the sorted names of the registered key-value store
+// implementations.
+func Backends() []string {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectBackend returns the name of the backend that created the data store in
+// the given directory, or the empty string if none of them claims it.
+func DetectBackend(dir string) string {
+	for _, name := range Backends() {
+		if backend, _ := LookupBackend(name); backend.Detect(dir) {
+			return name
+		}
+	}
+	return ""
+}
@@ -15,28 +15,42 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 // Package remotedb implements the key-value database layer based on a remote geth
-// node. Under the hood, it utilises the `debug_dbGet` method to implement a
-// read-only database.
-// There really are no guarantees in this database, since the local geth does not
-// exclusive access, but it can be used for basic diagnostics of a remote node.
+// node. Under the hood, it utilises the `debug_db*` methods to read the chain
+// database of the running node: single key reads, paginated iterators and
+// snapshots are all served remotely. Single key writes and atomic write batches
+// use the `database_*` methods, which the node only serves over IPC unless the
+// "database" namespace is explicitly enabled on the other endpoints.
+//
+// There really are no guarantees in this database beyond the ones of the remote
+// one, since the local geth does not have exclusive access, but it can be used
+// for diagnostics and analysis of a live node without stopping it. The ancient
+// store is only readable.
 package remotedb
 
 import (
+	"errors"
+
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
-// Database is a key-value lookup for a remote database via debug_dbGet.
+// iteratorPageSize is the number of items retrieved by an iterator at once.
+const iteratorPageSize = 1024
+
+// errNotSupported is returned for the operations which can't be performed on a
+// remote database, such as modifying the ancient store.
+var errNotSupported = errors.New("not supported by remote database")
+
+// Database is a key-value store backed by the database of a remote node.
 type Database struct {
 	remote *rpc.Client
 }
 
 func (db *Database) Has(key []byte) (bool, error) {
-	if _, err := db.Get(key); err != nil {
-		return false, nil
-	}
-	return true, nil
+	var has bool
+	err := db.remote.Call(&has, "debug_dbHas", hexutil.Bytes(key))
+	return has, err
 }
 
 func (db *Database) Get(key []byte) ([]byte, error) {
@@ -65,7 +79,16 @@ func (db *Database) Ancient(kind string, number uint64) ([]byte, error) {
 }
 
 func (db *Database) AncientRange(kind string, start, count, maxBytes uint64) ([][]byte, error) {
-	panic("not supported")
+	var resp []hexutil.Bytes
+	err := db.remote.Call(&resp, "debug_dbAncientRange", kind, start, count, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	blobs := make([][]byte, len(resp))
+	for i, blob := range resp {
+		blobs[i] = blob
+	}
+	return blobs, nil
 }
 
 func (db *Database) Ancients() (uint64, error) {
@@ -75,11 +98,15 @@ func (db *Database) Ancients() (uint64, error) {
 }
 
 func (db *Database) Tail() (uint64, error) {
-	panic("not supported")
+	var resp uint64
+	err := db.remote.Call(&resp, "debug_dbAncientTail")
+	return resp, err
 }
 
 func (db *Database) AncientSize(kind string) (uint64, error) {
-	panic("not supported")
+	var resp uint64
+	err := db.remote.Call(&resp, "debug_dbAncientSize", kind)
+	return resp, err
 }
 
 func (db *Database) ReadAncients(fn func(op ethdb.AncientReaderOp) error) (err error) {
@@ -87,23 +114,23 @@ func (db *Database) ReadAncients(fn func(op ethdb.AncientReaderOp) error) (err e
 }
 
 func (db *Database) Put(key []byte, value []byte) error {
-	panic("not supported")
+	return db.remote.Call(nil, "database_put", hexutil.Bytes(key), hexutil.Bytes(value))
 }
 
 func (db *Database) Delete(key []byte) error {
-	panic("not supported")
+	return db.remote.Call(nil, "database_delete", hexutil.Bytes(key))
 }
 
 func (db *Database) ModifyAncients(f func(ethdb.AncientWriteOp) error) (int64, error) {
-	panic("not supported")
+	return 0, errNotSupported
 }
 
 func (db *Database) TruncateHead(n uint64) error {
-	panic("not supported")
+	return errNotSupported
 }
 
 func (db *Database) TruncateTail(n uint64) error {
-	panic("not supported")
+	return errNotSupported
 }
 
 func (db *Database) Sync() error {
@@ -111,35 +138,50 @@ func (db *Database) Sync() error {
 }
 
 func (db *Database) MigrateTable(s string, f func([]byte) ([]byte, error)) error {
-	panic("not supported")
+	return errNotSupported
+}
+
+func (db *Database) RepairAncient(kind string, number uint64, item []byte) error {
+	return errNotSupported
 }
 
 func (db *Database) NewBatch() ethdb.Batch {
-	panic("not supported")
+	return &batch{db: db}
 }
 
 func (db *Database) NewBatchWithSize(size int) ethdb.Batch {
-	panic("not supported")
+	return &batch{db: db}
 }
 
 func (db *Database) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
-	panic("not supported")
+	it := &iterator{db: db}
+	it.err = db.remote.Call(&it.id, "debug_dbNewIterator", hexutil.Bytes(prefix), hexutil.Bytes(start))
+	if it.err != nil {
+		it.done = true
+	}
+	return it
 }
 
 func (db *Database) Stat(property string) (string, error) {
-	panic("not supported")
+	var resp string
+	err := db.remote.Call(&resp, "debug_dbStat", property)
+	return resp, err
 }
 
 func (db *Database) AncientDatadir() (string, error) {
-	panic("not supported")
+	return "", errNotSupported
 }
 
 func (db *Database) Compact(start []byte, limit []byte) error {
-	return nil
+	return db.remote.Call(nil, "database_compact", hexutil.Bytes(start), hexutil.Bytes(limit))
 }
 
 func (db *Database) NewSnapshot() (ethdb.Snapshot, error) {
-	panic("not supported")
+	snap := &snapshot{db: db}
+	if err := db.remote.Call(&snap.id, "debug_dbNewSnapshot"); err != nil {
+		return nil, err
+	}
+	return snap, nil
 }
 
 func (db *Database) Close() error {
@@ -152,3 +194,175 @@ func New(client *rpc.Client) ethdb.Database {
 		remote: client,
 	}
 }
+
+// batchOp is a single operation of a write batch, in the format expected by
+// database_write.
+type batchOp struct {
+	Key    hexutil.Bytes `json:"key"`
+	Value  hexutil.Bytes `json:"value,omitempty"`
+	Delete bool          `json:"delete,omitempty"`
+}
+
+// batch is a write-only batch that accumulates changes locally and commits
+// them atomically to the remote database when Write is called.
+type batch struct {
+	db   *Database
+	ops  []batchOp
+	size int
+}
+
+// Put inserts the given value into the batch for later committing.
+func (b *batch) Put(key, value []byte) error {
+	b.ops = append(b.ops, batchOp{Key: append([]byte{}, key...), Value: append([]byte{}, value...)})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+// Delete inserts the key removal into the batch for later committing.
+func (b *batch) Delete(key []byte) error {
+	b.ops = append(b.ops, batchOp{Key: append([]byte{}, key...), Delete: true})
+	b.size += len(key)
+	return nil
+}
+
+// ValueSize retrieves the amount of data queued up for writing.
+func (b *batch) ValueSize() int {
+	return b.size
+}
+
+// Write flushes any accumulated data to the remote database.
+func (b *batch) Write() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	return b.db.remote.Call(nil, "database_write", b.ops)
+}
+
+// Reset resets the batch for reuse.
+func (b *batch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+// Replay replays the batch contents.
+func (b *batch) Replay(w ethdb.KeyValueWriter) error {
+	for _, op := range b.ops {
+		if op.Delete {
+			if err := w.Delete(op.Key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Put(op.Key, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iteratorPage is a page of key-value pairs, in the format returned by
+// debug_dbIteratorNext.
+type iteratorPage struct {
+	Keys   []hexutil.Bytes `json:"keys"`
+	Values []hexutil.Bytes `json:"values"`
+	Done   bool            `json:"done"`
+}
+
+// iterator is an iterator over a remote database, retrieving the key-value
+// pairs in pages.
+type iterator struct {
+	db   *Database
+	id   hexutil.Uint64
+	page iteratorPage
+	pos  int
+	done bool // Whether the remote iterator is exhausted and released
+	err  error
+}
+
+// Next moves the iterator to the next key/value pair. It returns whether the
+// iterator is exhausted.
+func (it *iterator) Next() bool {
+	if it.pos+1 < len(it.page.Keys) {
+		it.pos++
+		return true
+	}
+	if it.done {
+		it.page, it.pos = iteratorPage{}, 0
+		return false
+	}
+	var page iteratorPage
+	if err := it.db.remote.Call(&page, "debug_dbIteratorNext", it.id, iteratorPageSize); err != nil {
+		it.err, it.done = err, true
+		it.page, it.pos = iteratorPage{}, 0
+		return false
+	}
+	if len(page.Keys) != len(page.Values) {
+		it.err = errors.New("invalid iterator page")
+		it.Release()
+		return false
+	}
+	it.page, it.pos, it.done = page, 0, page.Done
+	return len(page.Keys) > 0
+}
+
+// Error returns any accumulated error. Exhausting all the key/value pairs
+// is not considered to be an error.
+func (it *iterator) Error() error {
+	return it.err
+}
+
+// Key returns the key of the current key/value pair, or nil if done.
+func (it *iterator) Key() []byte {
+	if it.pos >= len(it.page.Keys) {
+		return nil
+	}
+	return it.page.Keys[it.pos]
+}
+
+// Value returns the value of the current key/value pair, or nil if done.
+func (it *iterator) Value() []byte {
+	if it.pos >= len(it.page.Values) {
+		return nil
+	}
+	return it.page.Values[it.pos]
+}
+
+// Release releases the remote iterator, unless it's already exhausted.
+func (it *iterator) Release() {
+	if !it.done {
+		it.done = true
+		it.db.remote.Call(nil, "debug_dbReleaseIterator", it.id)
+	}
+	it.page, it.pos = iteratorPage{}, 0
+}
+
+// snapshot is a snapshot of the remote database state.
+type snapshot struct {
+	db       *Database
+	id       hexutil.Uint64
+	released bool
+}
+
+// Has retrieves if a key is present in the snapshot.
+func (snap *snapshot) Has(key []byte) (bool, error) {
+	var has bool
+	err := snap.db.remote.Call(&has, "debug_dbSnapshotHas", snap.id, hexutil.Bytes(key))
+	return has, err
+}
+
+// Get retrieves the given key if it's present in the snapshot.
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	var resp hexutil.Bytes
+	if err := snap.db.remote.Call(&resp, "debug_dbSnapshotGet", snap.id, hexutil.Bytes(key)); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Release releases the remote snapshot.
+func (snap *snapshot) Release() {
+	if !snap.released {
+		snap.released = true
+		snap.db.remote.Call(nil, "debug_dbReleaseSnapshot", snap.id)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package remotedb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/dbtest"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBackend is an API backend only providing a chain database.
+type testBackend struct {
+	ethapi.Backend
+	db ethdb.Database
+}
+
+func (b *testBackend) ChainDb() ethdb.Database { return b.db }
+
+// newTestDatabase creates a remote database connected to an in-process RPC
+// server, which serves the given database of a node.
+func newTestDatabase(t *testing.T, db ethdb.Database) ethdb.Database {
+	backend := &testBackend{db: db}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", ethapi.NewDebugAPI(backend)); err != nil {
+		t.Fatalf("failed to register debug api: %v", err)
+	}
+	if err := server.RegisterName("database", ethapi.NewDatabaseAPI(backend)); err != nil {
+		t.Fatalf("failed to register database api: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	remote := New(rpc.DialInProc(server))
+	t.Cleanup(func() { remote.Close() })
+	return remote
+}
+
+// Tests that the remote database conforms to the key-value store semantics.
+func TestDatabaseSuite(t *testing.T) {
+	dbtest.TestDatabaseSuite(t, func() ethdb.KeyValueStore {
+		return newTestDatabase(t, rawdb.NewMemoryDatabase())
+	})
+}
+
+// Tests that the writes of the remote database round-trip into the database of
+// the node, and that the node's content is read back remotely.
+func TestRoundTrip(t *testing.T) {
+	var (
+		local  = rawdb.NewMemoryDatabase()
+		remote = newTestDatabase(t, local)
+	)
+	if err := remote.Put([]byte("remote"), []byte{0x01}); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if have, err := local.Get([]byte("remote")); err != nil || !bytes.Equal(have, []byte{0x01}) {
+		t.Fatalf("remote write not stored: have %x, err %v", have, err)
+	}
+	if err := local.Put([]byte("local"), []byte{0x02}); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if have, err := remote.Get([]byte("local")); err != nil || !bytes.Equal(have, []byte{0x02}) {
+		t.Fatalf("local write not served: have %x, err %v", have, err)
+	}
+	batch := remote.NewBatch()
+	batch.Delete([]byte("local"))
+	batch.Put([]byte("batch"), []byte{0x03})
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	if has, _ := local.Has([]byte("local")); has {
+		t.Fatalf("remote batch delete not applied")
+	}
+	if have, err := local.Get([]byte("batch")); err != nil || !bytes.Equal(have, []byte{0x03}) {
+		t.Fatalf("remote batch write not stored: have %x, err %v", have, err)
+	}
+}
+
+// Tests that remote iterators spanning multiple pages are served completely.
+func TestIteratorPaging(t *testing.T) {
+	db := newTestDatabase(t, rawdb.NewMemoryDatabase())
+
+	batch := db.NewBatch()
+	for i := 0; i < 3000; i++ {
+		batch.Put([]byte{'k', byte(i >> 8), byte(i)}, []byte{byte(i)})
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	it := db.NewIterator([]byte{'k'}, []byte{0x01})
+	defer it.Release()
+
+	count := 256
+	for it.Next() {
+		if want := []byte{'k', byte(count >> 8), byte(count)}; !bytes.Equal(it.Key(), want) {
+			t.Fatalf("key mismatch: have %x, want %x", it.Key(), want)
+		}
+		count++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if count != 3000 {
+		t.Fatalf("iterated item count mismatch: have %d, want %d", count-256, 3000-256)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package s3 implements an object store client for S3-compatible services,
+// which the ancient freezer can offload its sealed data files into.
+//
+// Only the handful of operations needed by the freezer are supported: uploading,
+// ranged downloading, stat-ing and deleting objects. Requests are signed with
+// AWS Signature Version 4 and buckets are addressed path-style, which is what
+// most self-hosted S3 implementations expect.
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// unsignedPayload is the payload hash used for requests whose body is not
+// included in the signature, so that large uploads can be streamed.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// emptyPayload is the SHA256 hash of an empty request body.
+const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Config contains the settings of an S3-compatible object store.
+type Config struct {
+	Endpoint     string // Service endpoint, e.g. https://s3.eu-west-1.amazonaws.com
+	Bucket       string // Name of the bucket holding the objects
+	Prefix       string // Key prefix prepended to every object name
+	Region       string // Region to sign requests for
+	AccessKey    string // Access key ID of the credentials
+	SecretKey    string // Secret access key of the credentials
+	SessionToken string // Optional session token of temporary credentials
+}
+
+// ParseURL parses a path-style bucket URL of the form
+// scheme://host[:port]/bucket[/prefix] into a Config. The credentials and the
+// region are left empty.
+func ParseURL(rawurl string) (Config, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Config{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Config{}, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return Config{}, errors.New("missing bucket name")
+	}
+	bucket, prefix, _ := strings.Cut(path, "/")
+	return Config{
+		Endpoint: u.Scheme + "://" + u.Host,
+		Bucket:   bucket,
+		Prefix:   prefix,
+	}, nil
+}
+
+// ConfigFromEnv fills the unset credentials and region of a Config from the
+// standard AWS environment variables.
+func ConfigFromEnv(config Config) Config {
+	fill := func(field *string, keys ...string) {
+		for _, key := range keys {
+			if *field == "" {
+				*field = os.Getenv(key)
+			}
+		}
+	}
+	fill(&config.AccessKey, "AWS_ACCESS_KEY_ID")
+	fill(&config.SecretKey, "AWS_SECRET_ACCESS_KEY")
+	fill(&config.SessionToken, "AWS_SESSION_TOKEN")
+	fill(&config.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+	return config
+}
+
+// Store is a client of a single bucket of an S3-compatible object store.
+type Store struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	region   string
+	creds    aws.Credentials
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+// New creates a client for the bucket described by the given config.
+func New(config Config) (*Store, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("missing bucket name")
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &Store{
+		endpoint: endpoint,
+		bucket:   config.Bucket,
+		prefix:   prefix,
+		region:   region,
+		creds: aws.Credentials{
+			AccessKeyID:     config.AccessKey,
+			SecretAccessKey: config.SecretKey,
+			SessionToken:    config.SessionToken,
+		},
+		signer: v4.NewSigner(),
+		client: &http.Client{},
+	}, nil
+}
+
+// Put uploads an object of the given size, replacing any existing one.
+func (s *Store) Put(key string, r io.Reader, size int64) error {
+	body := io.ReadCloser(http.NoBody)
+	if size > 0 {
+		body = io.NopCloser(io.LimitReader(r, size))
+	}
+	req, err := s.newRequest(http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	res, err := s.do(req, unsignedPayload)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return responseError(key, res)
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes of the object starting at byte offset off. It
+// returns io.EOF if fewer bytes are available.
+func (s *Store) ReadAt(key string, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req, err := s.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The range was ignored, skip to the requested offset
+		if _, err := io.CopyN(io.Discard, res.Body, off); err != nil {
+			return 0, io.EOF
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	default:
+		return 0, responseError(key, res)
+	}
+	n, err := io.ReadFull(res.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Stat returns the size of an object. If the object doesn't exist, the
+// returned error wraps fs.ErrNotExist.
+func (s *Store) Stat(key string) (int64, error) {
+	req, err := s.newRequest(http.MethodHead, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, responseError(key, res)
+	}
+	if res.ContentLength < 0 {
+		return 0, fmt.Errorf("object %s: missing content length", key)
+	}
+	return res.ContentLength, nil
+}
+
+// Delete removes an object. Deleting a non-existent object is not an error.
+func (s *Store) Delete(key string) error {
+	req, err := s.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, emptyPayload)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return responseError(key, res)
+	}
+}
+
+// newRequest creates a request for the object with the given key.
+func (s *Store) newRequest(method string, key string, body io.ReadCloser) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.bucket + "/" + s.prefix + key
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// do signs and sends a request.
+func (s *Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if err := s.signer.SignHTTP(context.Background(), s.creds, req, payloadHash, "s3", s.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+// responseError converts an unsuccessful response into an error.
+func responseError(key string, res *http.Response) error {
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("object %s: %w", key, fs.ErrNotExist)
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("object %s: %s: %s", key, res.Status, strings.TrimSpace(string(body)))
+}
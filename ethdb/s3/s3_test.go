@@ -0,0 +1,186 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+var _ rawdb.RemoteStore = (*Store)(nil)
+
+// fakeServer is a minimal stand-in for an S3-compatible service, supporting
+// path-style object uploads, ranged downloads, stat-ing and deletion.
+type fakeServer struct {
+	objects map[string][]byte
+	lock    sync.Mutex
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "MissingContentSHA256", http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		blob, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.objects[r.URL.Path] = blob
+
+	case http.MethodGet, http.MethodHead:
+		blob, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestStore(t *testing.T) (*Store, *fakeServer) {
+	fake := &fakeServer{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	config, err := ParseURL(server.URL + "/bucket/mainnet/ancient")
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+	config.AccessKey, config.SecretKey = "access", "secret"
+	store, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	return store, fake
+}
+
+func TestStore(t *testing.T) {
+	store, fake := newTestStore(t)
+
+	blob := make([]byte, 1000)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	if err := store.Put("bodies.0000.cdat", bytes.NewReader(blob), int64(len(blob))); err != nil {
+		t.Fatalf("failed to put object: %v", err)
+	}
+	if _, ok := fake.objects["/bucket/mainnet/ancient/bodies.0000.cdat"]; !ok {
+		t.Fatalf("object not stored under prefixed path, have %v", fake.objects)
+	}
+	size, err := store.Stat("bodies.0000.cdat")
+	if err != nil {
+		t.Fatalf("failed to stat object: %v", err)
+	}
+	if size != int64(len(blob)) {
+		t.Fatalf("size mismatch: have %d, want %d", size, len(blob))
+	}
+	// Read a few ranges, including one overflowing the object
+	for _, tt := range []struct {
+		off, length int
+		err         error
+	}{
+		{0, 10, nil},
+		{500, 200, nil},
+		{990, 10, nil},
+		{995, 10, io.EOF},
+		{1000, 10, io.EOF},
+	} {
+		buf := make([]byte, tt.length)
+		n, err := store.ReadAt("bodies.0000.cdat", buf, int64(tt.off))
+		if err != tt.err {
+			t.Errorf("range %d+%d: error mismatch: have %v, want %v", tt.off, tt.length, err, tt.err)
+		}
+		end := tt.off + tt.length
+		if end > len(blob) {
+			end = len(blob)
+		}
+		if !bytes.Equal(buf[:n], blob[tt.off:end]) {
+			t.Errorf("range %d+%d: data mismatch: have %x", tt.off, tt.length, buf[:n])
+		}
+	}
+	if err := store.Delete("bodies.0000.cdat"); err != nil {
+		t.Fatalf("failed to delete object: %v", err)
+	}
+	if _, err := store.Stat("bodies.0000.cdat"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("deleted object stat error mismatch: have %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := store.ReadAt("bodies.0000.cdat", make([]byte, 1), 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("deleted object read error mismatch: have %v, want %v", err, fs.ErrNotExist)
+	}
+	if err := store.Delete("bodies.0000.cdat"); err != nil {
+		t.Fatalf("failed to delete missing object: %v", err)
+	}
+}
+
+func TestStoreAccessDenied(t *testing.T) {
+	store, _ := newTestStore(t)
+	store.creds.AccessKeyID = "intruder"
+
+	err := store.Put("bodies.0000.cdat", bytes.NewReader([]byte{1}), 1)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	for _, tt := range []struct {
+		url    string
+		config Config
+		err    bool
+	}{
+		{url: "https://s3.amazonaws.com/bucket", config: Config{Endpoint: "https://s3.amazonaws.com", Bucket: "bucket"}},
+		{url: "http://localhost:9000/bucket/a/b/", config: Config{Endpoint: "http://localhost:9000", Bucket: "bucket", Prefix: "a/b"}},
+		{url: "https://s3.amazonaws.com/", err: true},
+		{url: "s3://bucket/prefix", err: true},
+	} {
+		config, err := ParseURL(tt.url)
+		if tt.err != (err != nil) {
+			t.Errorf("%s: error mismatch: have %v", tt.url, err)
+			continue
+		}
+		if config != tt.config {
+			t.Errorf("%s: config mismatch: have %+v, want %+v", tt.url, config, tt.config)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// memFile is an in-memory era1 file.
+type memFile struct {
+	*bytes.Reader
+}
+
+func (f *memFile) Close() error { return nil }
+
+// makeChain creates a chain of n blocks starting at the given number, each with
+// a single transaction and receipt.
+func makeChain(start uint64, n int) ([]*types.Block, []types.Receipts, []*big.Int) {
+	var (
+		blocks   []*types.Block
+		receipts []types.Receipts
+		tds      []*big.Int
+		parent   common.Hash
+		td       = big.NewInt(int64(start))
+	)
+	for i := 0; i < n; i++ {
+		number := start + uint64(i)
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     new(big.Int).SetUint64(number),
+			Difficulty: big.NewInt(int64(number) + 1),
+			GasLimit:   8_000_000,
+		}
+		tx := types.NewTransaction(number, common.Address{0xaa}, big.NewInt(1), 21000, big.NewInt(1), nil)
+		receipt := &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000,
+			Logs:              []*types.Log{{Address: common.Address{0xbb}, Data: []byte{byte(i)}}},
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+		block := types.NewBlock(header, []*types.Transaction{tx}, nil, []*types.Receipt{receipt}, trie.NewStackTrie(nil))
+		td = new(big.Int).Add(td, header.Difficulty)
+
+		blocks = append(blocks, block)
+		receipts = append(receipts, types.Receipts{receipt})
+		tds = append(tds, td)
+		parent = block.Hash()
+	}
+	return blocks, receipts, tds
+}
+
+func buildEra(t *testing.T, blocks []*types.Block, receipts []types.Receipts, tds []*big.Int) ([]byte, common.Hash) {
+	t.Helper()
+
+	var (
+		buf = new(bytes.Buffer)
+		b   = NewBuilder(buf)
+	)
+	for i, block := range blocks {
+		if err := b.Add(block, receipts[i], tds[i]); err != nil {
+			t.Fatalf("error adding block %d: %v", block.NumberU64(), err)
+		}
+	}
+	root, err := b.Finalize()
+	if err != nil {
+		t.Fatalf("error finalizing era: %v", err)
+	}
+	return buf.Bytes(), root
+}
+
+func TestEra1Builder(t *testing.T) {
+	blocks, receipts, tds := makeChain(128, 16)
+	data, root := buildEra(t, blocks, receipts, tds)
+
+	e, err := From(&memFile{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("failed to open era: %v", err)
+	}
+	if e.Start() != 128 || e.Count() != 16 {
+		t.Fatalf("metadata mismatch: have start %d count %d, want 128 and 16", e.Start(), e.Count())
+	}
+	if have, err := e.Accumulator(); err != nil || have != root {
+		t.Fatalf("accumulator mismatch: have %x (%v), want %x", have, err, root)
+	}
+	if want, err := ComputeAccumulator(blockHashes(blocks), tds); err != nil || want != root {
+		t.Fatalf("accumulator mismatch: have %x, want %x (%v)", root, want, err)
+	}
+	if td, err := e.InitialTD(); err != nil || td.Cmp(big.NewInt(128)) != 0 {
+		t.Fatalf("initial total difficulty mismatch: have %v (%v), want 128", td, err)
+	}
+	// Random access by number.
+	for _, want := range blocks {
+		have, err := e.GetBlockByNumber(want.NumberU64())
+		if err != nil {
+			t.Fatalf("error reading block %d: %v", want.NumberU64(), err)
+		}
+		if have.Hash() != want.Hash() {
+			t.Fatalf("block %d hash mismatch: have %x, want %x", want.NumberU64(), have.Hash(), want.Hash())
+		}
+	}
+	if _, err := e.GetBlockByNumber(144); err == nil {
+		t.Fatalf("expected out-of-bounds error")
+	}
+	// Sequential iteration.
+	it, err := NewIterator(e)
+	if err != nil {
+		t.Fatalf("failed to create iterator: %v", err)
+	}
+	for i := 0; it.Next(); i++ {
+		if err := it.Error(); err != nil {
+			t.Fatalf("iterator error: %v", err)
+		}
+		block, rs, err := it.BlockAndReceipts()
+		if err != nil {
+			t.Fatalf("error reading block %d: %v", it.Number(), err)
+		}
+		if block.Hash() != blocks[i].Hash() {
+			t.Fatalf("block %d hash mismatch", it.Number())
+		}
+		if have, want := types.DeriveSha(rs, trie.NewStackTrie(nil)), blocks[i].ReceiptHash(); have != want {
+			t.Fatalf("block %d receipts mismatch", it.Number())
+		}
+		if td, err := it.TotalDifficulty(); err != nil || td.Cmp(tds[i]) != 0 {
+			t.Fatalf("block %d total difficulty mismatch: have %v (%v), want %v", it.Number(), td, err, tds[i])
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iterator error: %v", err)
+	}
+	if have, err := Verify(e); err != nil || have != root {
+		t.Fatalf("verification failed: %x %v", have, err)
+	}
+}
+
+func TestEra1BuilderErrors(t *testing.T) {
+	blocks, receipts, tds := makeChain(0, 3)
+
+	b := NewBuilder(new(bytes.Buffer))
+	if _, err := b.Finalize(); err == nil {
+		t.Fatalf("expected error finalizing empty builder")
+	}
+	if err := b.Add(blocks[0], receipts[0], tds[0]); err != nil {
+		t.Fatalf("error adding block: %v", err)
+	}
+	if err := b.Add(blocks[2], receipts[2], tds[2]); err == nil || !strings.Contains(err.Error(), "non-contiguous") {
+		t.Fatalf("expected non-contiguous error, got %v", err)
+	}
+}
+
+func TestEra1VerifyCorruption(t *testing.T) {
+	blocks, receipts, tds := makeChain(0, 8)
+
+	tests := []struct {
+		name   string
+		mutate func()
+		err    string
+	}{
+		{
+			name:   "total difficulty",
+			mutate: func() { tds[5] = new(big.Int).Add(tds[5], common.Big1) },
+			err:    "total difficulty mismatch",
+		},
+		{
+			name:   "receipts",
+			mutate: func() { receipts[3] = types.Receipts{{Status: types.ReceiptStatusFailed}} },
+			err:    "receipt root mismatch",
+		},
+		{
+			name: "chain",
+			mutate: func() {
+				blocks[4] = blocks[4].WithSeal(&types.Header{Number: blocks[4].Number(), Difficulty: blocks[4].Difficulty()})
+			},
+			err: "not a child",
+		},
+	}
+	for _, tt := range tests {
+		blocks, receipts, tds = makeChain(0, 8)
+		tt.mutate()
+
+		data, _ := buildEra(t, blocks, receipts, tds)
+		e, err := From(&memFile{bytes.NewReader(data)})
+		if err != nil {
+			t.Fatalf("%s: failed to open era: %v", tt.name, err)
+		}
+		if _, err := Verify(e); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.err, err)
+		}
+	}
+	// Tamper with the stored accumulator root, which precedes the block index.
+	blocks, receipts, tds = makeChain(0, 8)
+	data, _ := buildEra(t, blocks, receipts, tds)
+	data[len(data)-(8+16+8*len(blocks))-32] ^= 0xff
+
+	e, err := From(&memFile{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("failed to open era: %v", err)
+	}
+	if _, err := Verify(e); err == nil || !strings.Contains(err.Error(), "accumulator mismatch") {
+		t.Errorf("expected accumulator mismatch, got %v", err)
+	}
+}
+
+func TestComputeAccumulator(t *testing.T) {
+	// The root of an empty list is the root of the empty tree with the zero
+	// length mixed in.
+	var (
+		zero [32]byte
+		node = zero
+	)
+	for i := 0; i < accumulatorDepth; i++ {
+		node = sha256.Sum256(append(node[:], node[:]...))
+	}
+	want := sha256.Sum256(append(node[:], zero[:]...))
+	if have, err := ComputeAccumulator(nil, nil); err != nil || have != want {
+		t.Fatalf("empty accumulator mismatch: have %x (%v), want %x", have, err, want)
+	}
+	// A single record is the leftmost leaf of the tree.
+	var (
+		hash = common.Hash{0x01}
+		td   [32]byte
+	)
+	binary.LittleEndian.PutUint64(td[:], 42)
+	node = sha256.Sum256(append(hash.Bytes(), td[:]...))
+	for i := 0; i < accumulatorDepth; i++ {
+		node = sha256.Sum256(append(node[:], zeroHashes[i][:]...))
+	}
+	var length [32]byte
+	length[0] = 1
+	want = sha256.Sum256(append(node[:], length[:]...))
+	if have, err := ComputeAccumulator([]common.Hash{hash}, []*big.Int{big.NewInt(42)}); err != nil || have != want {
+		t.Fatalf("single record accumulator mismatch: have %x (%v), want %x", have, err, want)
+	}
+	if _, err := ComputeAccumulator(make([]common.Hash, MaxEra1Size+1), make([]*big.Int, MaxEra1Size+1)); err == nil {
+		t.Fatalf("expected error for oversized accumulator")
+	}
+}
+
+func blockHashes(blocks []*types.Block) []common.Hash {
+	hashes := make([]common.Hash, len(blocks))
+	for i, block := range blocks {
+		hashes[i] = block.Hash()
+	}
+	return hashes
+}
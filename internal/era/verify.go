@@ -0,0 +1,104 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Verify checks the internal consistency of an Era1 archive and returns its
+// accumulator root. The blocks must form a chain, their bodies and receipts must
+// match the roots committed to by their headers, the total difficulties must
+// accumulate the block difficulties, and the accumulator root stored in the
+// archive must commit to the resulting header records.
+//
+// Note, the accumulator root itself is only as trustworthy as its source: the
+// caller is expected to compare it against a known list of roots.
+func Verify(e *Era) (common.Hash, error) {
+	it, err := NewIterator(e)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	td, err := e.InitialTD()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("error reading initial total difficulty: %w", err)
+	}
+	var (
+		parent common.Hash
+		hashes = make([]common.Hash, 0, e.Count())
+		tds    = make([]*big.Int, 0, e.Count())
+	)
+	for it.Next() {
+		if err := it.Error(); err != nil {
+			return common.Hash{}, err
+		}
+		number := it.Number()
+		block, receipts, err := it.BlockAndReceipts()
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("error reading block %d: %w", number, err)
+		}
+		if block.NumberU64() != number {
+			return common.Hash{}, fmt.Errorf("block number mismatch: have %d, want %d", block.NumberU64(), number)
+		}
+		if len(hashes) > 0 && block.ParentHash() != parent {
+			return common.Hash{}, fmt.Errorf("block %d not a child of %x", number, parent)
+		}
+		if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != block.TxHash() {
+			return common.Hash{}, fmt.Errorf("block %d transaction root mismatch: have %x, want %x", number, hash, block.TxHash())
+		}
+		if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+			return common.Hash{}, fmt.Errorf("block %d uncle hash mismatch: have %x, want %x", number, hash, block.UncleHash())
+		}
+		if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != block.ReceiptHash() {
+			return common.Hash{}, fmt.Errorf("block %d receipt root mismatch: have %x, want %x", number, hash, block.ReceiptHash())
+		}
+		have, err := it.TotalDifficulty()
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("error reading total difficulty of block %d: %w", number, err)
+		}
+		td = new(big.Int).Add(td, block.Difficulty())
+		if have.Cmp(td) != 0 {
+			return common.Hash{}, fmt.Errorf("block %d total difficulty mismatch: have %v, want %v", number, have, td)
+		}
+		parent = block.Hash()
+		hashes = append(hashes, parent)
+		tds = append(tds, td)
+	}
+	if err := it.Error(); err != nil {
+		return common.Hash{}, err
+	}
+	if uint64(len(hashes)) != e.Count() {
+		return common.Hash{}, fmt.Errorf("block count mismatch: have %d, want %d", len(hashes), e.Count())
+	}
+	want, err := ComputeAccumulator(hashes, tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	have, err := e.Accumulator()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("error reading accumulator: %w", err)
+	}
+	if have != want {
+		return common.Hash{}, fmt.Errorf("accumulator mismatch: have %x, want %x", have, want)
+	}
+	return want, nil
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -1616,6 +1617,47 @@ func (s *TransactionAPI) GetTransactionByHash(ctx context.Context, hash common.H
 	return nil, nil
 }
 
+// maxSenderTransactions is the maximum number of transactions returned by
+// GetTransactionsBySender in a single call.
+const maxSenderTransactions = 1000
+
+// GetTransactionsBySender returns the canonical transactions sent by the given
+// account, starting at the given block. It requires the sender index to be
+// enabled on the node.
+func (s *TransactionAPI) GetTransactionsBySender(ctx context.Context, address common.Address, fromBlock hexutil.Uint64, limit hexutil.Uint) ([]*RPCTransaction, error) {
+	if config := rawdb.ReadTxIndexConfig(s.b.ChainDb()); config == nil || !config.Senders {
+		return nil, errors.New("transaction sender index is not enabled")
+	}
+	if rawdb.ReadTxIndexStale(s.b.ChainDb()) {
+		return nil, errors.New("transaction indexing mode changed, sender index unavailable until 'geth db reindex-txs' completes")
+	}
+	if limit == 0 || limit > maxSenderTransactions {
+		limit = maxSenderTransactions
+	}
+	var (
+		entries = rawdb.ReadTxSenderEntries(s.b.ChainDb(), address, uint64(fromBlock), int(limit))
+		txs     = make([]*RPCTransaction, 0, len(entries))
+		block   *types.Block
+	)
+	for _, entry := range entries {
+		if block == nil || block.NumberU64() != entry.BlockNumber {
+			var err error
+			if block, err = s.b.BlockByNumber(ctx, rpc.BlockNumber(entry.BlockNumber)); err != nil {
+				return nil, err
+			}
+			if block == nil {
+				break
+			}
+		}
+		// Entries of reorged blocks may linger, skip those not on the canonical chain
+		if entry.Index >= uint64(len(block.Transactions())) || block.Transactions()[entry.Index].Hash() != entry.Hash {
+			continue
+		}
+		txs = append(txs, newRPCTransactionFromBlockIndex(block, entry.Index, s.b.ChainConfig()))
+	}
+	return txs, nil
+}
+
 // GetRawTransactionByHash returns the bytes of the transaction for the given hash.
 func (s *TransactionAPI) GetRawTransactionByHash(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
 	// Retrieve a finalized transaction, or a pooled otherwise
@@ -1638,7 +1680,11 @@ func (s *TransactionAPI) GetTransactionReceipt(ctx context.Context, hash common.
 	tx, blockHash, blockNumber, index, err := s.b.GetTransaction(ctx, hash)
 	if err != nil {
 		// When the transaction doesn't exist, the RPC method should return JSON null
-		// as per specification.
+		// as per specification, unless its history has been pruned.
+		var pruned *HistoryPrunedError
+		if errors.As(err, &pruned) {
+			return nil, err
+		}
 		return nil, nil
 	}
 
@@ -1940,12 +1986,13 @@ func (s *TransactionAPI) Resend(ctx context.Context, sendArgs TransactionArgs, g
 // DebugAPI is the collection of Ethereum APIs exposed over the debugging
 // namespace.
 type DebugAPI struct {
-	b Backend
+	b       Backend
+	handles *dbHandles // Iterators and snapshots opened by remote database clients
 }
 
 // NewDebugAPI creates a new instance of DebugAPI.
 func NewDebugAPI(b Backend) *DebugAPI {
-	return &DebugAPI{b: b}
+	return &DebugAPI{b: b, handles: newDbHandles()}
 }
 
 // GetRawHeader retrieves the RLP encoding for a single header.
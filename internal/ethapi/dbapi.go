@@ -17,10 +17,144 @@
 package ethapi
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const (
+	// dbHandleTimeout is the time after which an unused iterator or snapshot
+	// is released, in case its client went away without releasing it. Open
+	// handles pin the database content, so they are expired in the background.
+	dbHandleTimeout = time.Minute
+
+	// maxDbHandles is the maximum number of iterators and snapshots which can
+	// be open at the same time.
+	maxDbHandles = 128
+
+	// maxDbIteratorItems and maxDbIteratorBytes limit the number of items and
+	// their cumulative size returned by a single DbIteratorNext call.
+	maxDbIteratorItems = 10000
+	maxDbIteratorBytes = 4 * 1024 * 1024
 )
 
+var errUnknownDbHandle = errors.New("unknown or expired handle")
+
+// dbHandle is an iterator or snapshot opened by a remote database client.
+type dbHandle struct {
+	iterator ethdb.Iterator
+	snapshot ethdb.Snapshot
+	used     time.Time
+}
+
+// release releases the resources of the iterator or snapshot.
+func (h *dbHandle) release() {
+	if h.iterator != nil {
+		h.iterator.Release()
+	}
+	if h.snapshot != nil {
+		h.snapshot.Release()
+	}
+}
+
+// dbHandles tracks the iterators and snapshots opened by remote database
+// clients. The lock also serializes all accesses to them.
+type dbHandles struct {
+	handles map[hexutil.Uint64]*dbHandle
+	next    hexutil.Uint64
+	expiry  *time.Timer // Releases the idle handles, nil if there are none
+	lock    sync.Mutex
+}
+
+func newDbHandles() *dbHandles {
+	return &dbHandles{handles: make(map[hexutil.Uint64]*dbHandle)}
+}
+
+// add registers a new handle, releasing the expired ones first.
+func (h *dbHandles) add(handle *dbHandle) (hexutil.Uint64, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.expireLocked()
+	if len(h.handles) >= maxDbHandles {
+		handle.release()
+		return 0, fmt.Errorf("too many open handles (max %d)", maxDbHandles)
+	}
+	h.next++
+	handle.used = time.Now()
+	h.handles[h.next] = handle
+	if h.expiry == nil {
+		h.expiry = time.AfterFunc(dbHandleTimeout, h.expire)
+	}
+	return h.next, nil
+}
+
+// expire releases the handles which haven't been used within the timeout.
+func (h *dbHandles) expire() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.expireLocked()
+}
+
+// expireLocked releases the idle handles and schedules the next expiry for the
+// least recently used remaining one. It assumes the lock is held.
+func (h *dbHandles) expireLocked() {
+	var (
+		now    = time.Now()
+		oldest time.Time
+	)
+	for id, handle := range h.handles {
+		if now.Sub(handle.used) >= dbHandleTimeout {
+			handle.release()
+			delete(h.handles, id)
+			continue
+		}
+		if oldest.IsZero() || handle.used.Before(oldest) {
+			oldest = handle.used
+		}
+	}
+	if h.expiry != nil {
+		h.expiry.Stop()
+		h.expiry = nil
+	}
+	if !oldest.IsZero() {
+		h.expiry = time.AfterFunc(dbHandleTimeout-now.Sub(oldest), h.expire)
+	}
+}
+
+// use runs fn on the handle with the given id while holding the lock.
+func (h *dbHandles) use(id hexutil.Uint64, fn func(*dbHandle) error) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	handle, ok := h.handles[id]
+	if !ok {
+		return errUnknownDbHandle
+	}
+	handle.used = time.Now()
+	return fn(handle)
+}
+
+// remove releases and drops the handle with the given id.
+func (h *dbHandles) remove(id hexutil.Uint64) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	handle, ok := h.handles[id]
+	if !ok {
+		return errUnknownDbHandle
+	}
+	handle.release()
+	delete(h.handles, id)
+	return nil
+}
+
 // DbGet returns the raw value of a key stored in the database.
 func (api *DebugAPI) DbGet(key string) (hexutil.Bytes, error) {
 	blob, err := common.ParseHexOrString(key)
@@ -30,14 +164,197 @@ func (api *DebugAPI) DbGet(key string) (hexutil.Bytes, error) {
 	return api.b.ChainDb().Get(blob)
 }
 
+// DbHas returns whether a key is stored in the database.
+func (api *DebugAPI) DbHas(key hexutil.Bytes) (bool, error) {
+	return api.b.ChainDb().Has(key)
+}
+
+// DbNewIterator opens an iterator over the database content with a particular
+// key prefix, starting at a particular key. The returned handle must be passed
+// to DbIteratorNext to retrieve the items, and released with DbReleaseIterator
+// unless the iterator is exhausted.
+func (api *DebugAPI) DbNewIterator(prefix hexutil.Bytes, start hexutil.Bytes) (hexutil.Uint64, error) {
+	return api.handles.add(&dbHandle{iterator: api.b.ChainDb().NewIterator(prefix, start)})
+}
+
+// DbIteratorResult is a page of key-value pairs retrieved from an iterator.
+type DbIteratorResult struct {
+	Keys   []hexutil.Bytes `json:"keys"`
+	Values []hexutil.Bytes `json:"values"`
+	Done   bool            `json:"done"`
+}
+
+// DbIteratorNext retrieves the next page of at most count key-value pairs from
+// an iterator. Once the iterator is exhausted, it's released automatically.
+func (api *DebugAPI) DbIteratorNext(id hexutil.Uint64, count int) (*DbIteratorResult, error) {
+	if count <= 0 || count > maxDbIteratorItems {
+		count = maxDbIteratorItems
+	}
+	var (
+		result = &DbIteratorResult{Keys: []hexutil.Bytes{}, Values: []hexutil.Bytes{}}
+		size   int
+	)
+	err := api.handles.use(id, func(h *dbHandle) error {
+		if h.iterator == nil {
+			return errUnknownDbHandle
+		}
+		for len(result.Keys) < count && size < maxDbIteratorBytes {
+			if !h.iterator.Next() {
+				result.Done = true
+				return h.iterator.Error()
+			}
+			key, value := common.CopyBytes(h.iterator.Key()), common.CopyBytes(h.iterator.Value())
+			result.Keys = append(result.Keys, key)
+			result.Values = append(result.Values, value)
+			size += len(key) + len(value)
+		}
+		return nil
+	})
+	if result.Done || err != nil {
+		api.handles.remove(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DbReleaseIterator releases an iterator opened with DbNewIterator.
+func (api *DebugAPI) DbReleaseIterator(id hexutil.Uint64) error {
+	return api.handles.remove(id)
+}
+
+// DbNewSnapshot creates a snapshot of the current database state. The returned
+// handle must be released with DbReleaseSnapshot.
+func (api *DebugAPI) DbNewSnapshot() (hexutil.Uint64, error) {
+	snap, err := api.b.ChainDb().NewSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	return api.handles.add(&dbHandle{snapshot: snap})
+}
+
+// DbSnapshotHas returns whether a key is present in a snapshot.
+func (api *DebugAPI) DbSnapshotHas(id hexutil.Uint64, key hexutil.Bytes) (bool, error) {
+	var has bool
+	err := api.handles.use(id, func(h *dbHandle) (err error) {
+		if h.snapshot == nil {
+			return errUnknownDbHandle
+		}
+		has, err = h.snapshot.Has(key)
+		return err
+	})
+	return has, err
+}
+
+// DbSnapshotGet retrieves the value of a key from a snapshot.
+func (api *DebugAPI) DbSnapshotGet(id hexutil.Uint64, key hexutil.Bytes) (hexutil.Bytes, error) {
+	var value []byte
+	err := api.handles.use(id, func(h *dbHandle) (err error) {
+		if h.snapshot == nil {
+			return errUnknownDbHandle
+		}
+		value, err = h.snapshot.Get(key)
+		return err
+	})
+	return value, err
+}
+
+// DbReleaseSnapshot releases a snapshot created with DbNewSnapshot.
+func (api *DebugAPI) DbReleaseSnapshot(id hexutil.Uint64) error {
+	return api.handles.remove(id)
+}
+
+// DbStat returns a particular internal stat of the database.
+func (api *DebugAPI) DbStat(property string) (string, error) {
+	return api.b.ChainDb().Stat(property)
+}
+
 // DbAncient retrieves an ancient binary blob from the append-only immutable files.
 // It is a mapping to the `AncientReaderOp.Ancient` method
 func (api *DebugAPI) DbAncient(kind string, number uint64) (hexutil.Bytes, error) {
 	return api.b.ChainDb().Ancient(kind, number)
 }
 
+// DbAncientRange retrieves multiple ancient binary blobs in a row.
+// It is a mapping to the `AncientReaderOp.AncientRange` method
+func (api *DebugAPI) DbAncientRange(kind string, start, count, maxBytes uint64) ([]hexutil.Bytes, error) {
+	blobs, err := api.b.ChainDb().AncientRange(kind, start, count, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]hexutil.Bytes, len(blobs))
+	for i, blob := range blobs {
+		result[i] = blob
+	}
+	return result, nil
+}
+
 // DbAncients returns the ancient item numbers in the ancient store.
 // It is a mapping to the `AncientReaderOp.Ancients` method
 func (api *DebugAPI) DbAncients() (uint64, error) {
 	return api.b.ChainDb().Ancients()
 }
+
+// DbAncientTail returns the number of the first stored item in the ancient store.
+// It is a mapping to the `AncientReaderOp.Tail` method
+func (api *DebugAPI) DbAncientTail() (uint64, error) {
+	return api.b.ChainDb().Tail()
+}
+
+// DbAncientSize returns the ancient size of the specified category.
+// It is a mapping to the `AncientReaderOp.AncientSize` method
+func (api *DebugAPI) DbAncientSize(kind string) (uint64, error) {
+	return api.b.ChainDb().AncientSize(kind)
+}
+
+// DatabaseAPI offers the methods modifying the chain database of the node. They
+// are served in the "database" namespace, which isn't enabled on the HTTP and
+// WebSocket endpoints unless explicitly requested.
+type DatabaseAPI struct {
+	b Backend
+}
+
+// NewDatabaseAPI creates a new instance of DatabaseAPI.
+func NewDatabaseAPI(b Backend) *DatabaseAPI {
+	return &DatabaseAPI{b: b}
+}
+
+// Put stores a key-value pair in the database.
+func (api *DatabaseAPI) Put(key hexutil.Bytes, value hexutil.Bytes) error {
+	return api.b.ChainDb().Put(key, value)
+}
+
+// Delete removes a key from the database.
+func (api *DatabaseAPI) Delete(key hexutil.Bytes) error {
+	return api.b.ChainDb().Delete(key)
+}
+
+// DbBatchOp is a single operation of a database write batch.
+type DbBatchOp struct {
+	Key    hexutil.Bytes `json:"key"`
+	Value  hexutil.Bytes `json:"value,omitempty"`
+	Delete bool          `json:"delete,omitempty"`
+}
+
+// Write atomically applies a batch of operations to the database.
+func (api *DatabaseAPI) Write(ops []DbBatchOp) error {
+	batch := api.b.ChainDb().NewBatch()
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			err = batch.Delete(op.Key)
+		} else {
+			err = batch.Put(op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// Compact flattens the underlying data store for the given key range.
+func (api *DatabaseAPI) Compact(start hexutil.Bytes, limit hexutil.Bytes) error {
+	return api.b.ChainDb().Compact(start, limit)
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// dbTestBackend is a backend only providing a chain database.
+type dbTestBackend struct {
+	Backend
+	db ethdb.Database
+}
+
+func (b *dbTestBackend) ChainDb() ethdb.Database { return b.db }
+
+// Tests that iterator handles are paged through completely, and released once
+// exhausted.
+func TestDbIteratorHandles(t *testing.T) {
+	var (
+		db  = rawdb.NewMemoryDatabase()
+		api = NewDebugAPI(&dbTestBackend{db: db})
+	)
+	for i := 0; i < 3000; i++ {
+		db.Put([]byte{'k', byte(i >> 8), byte(i)}, []byte{byte(i)})
+	}
+	id, err := api.DbNewIterator([]byte{'k'}, []byte{0x01})
+	if err != nil {
+		t.Fatalf("failed to open iterator: %v", err)
+	}
+	count := 256
+	for {
+		page, err := api.DbIteratorNext(id, 1000)
+		if err != nil {
+			t.Fatalf("failed to retrieve page: %v", err)
+		}
+		for _, key := range page.Keys {
+			if want := []byte{'k', byte(count >> 8), byte(count)}; string(key) != string(want) {
+				t.Fatalf("key mismatch: have %x, want %x", key, want)
+			}
+			count++
+		}
+		if page.Done {
+			break
+		}
+	}
+	if count != 3000 {
+		t.Fatalf("iterated item count mismatch: have %d, want %d", count-256, 3000-256)
+	}
+	if len(api.handles.handles) != 0 {
+		t.Fatalf("handles not released: %d", len(api.handles.handles))
+	}
+	// Released handles must not be accessible anymore
+	if id, err = api.DbNewIterator(nil, nil); err != nil {
+		t.Fatalf("failed to open iterator: %v", err)
+	}
+	if err := api.DbReleaseIterator(id); err != nil {
+		t.Fatalf("failed to release iterator: %v", err)
+	}
+	if _, err := api.DbIteratorNext(id, 1); !errors.Is(err, errUnknownDbHandle) {
+		t.Fatalf("released iterator error mismatch: have %v, want %v", err, errUnknownDbHandle)
+	}
+}
+
+// Tests that idle handles are released in the background.
+func TestDbHandleExpiry(t *testing.T) {
+	api := NewDebugAPI(&dbTestBackend{db: rawdb.NewMemoryDatabase()})
+
+	idle, err := api.DbNewSnapshot()
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	active, err := api.DbNewSnapshot()
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	api.handles.lock.Lock()
+	if api.handles.expiry == nil {
+		t.Fatalf("no expiry scheduled for open handles")
+	}
+	api.handles.handles[idle].used = time.Now().Add(-dbHandleTimeout)
+	api.handles.lock.Unlock()
+
+	api.handles.expire()
+	if _, err := api.DbSnapshotHas(idle, []byte("key")); !errors.Is(err, errUnknownDbHandle) {
+		t.Fatalf("idle snapshot error mismatch: have %v, want %v", err, errUnknownDbHandle)
+	}
+	if _, err := api.DbSnapshotHas(active, []byte("key")); err != nil {
+		t.Fatalf("active snapshot expired: %v", err)
+	}
+	api.handles.lock.Lock()
+	defer api.handles.lock.Unlock()
+	if api.handles.expiry == nil {
+		t.Fatalf("no expiry scheduled for the remaining handle")
+	}
+}
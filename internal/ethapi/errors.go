@@ -0,0 +1,36 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import "fmt"
+
+// HistoryPrunedError is returned by backends when the requested block bodies,
+// receipts or logs have been pruned from the local database. The headers of
+// pruned blocks are still available.
+type HistoryPrunedError struct {
+	Cutoff uint64 // Number of the first block whose history is available
+}
+
+func (e *HistoryPrunedError) Error() string {
+	return fmt.Sprintf("history pruned: bodies and receipts before block #%d are unavailable", e.Cutoff)
+}
+
+// ErrorCode returns the JSON error code for pruned history, after EIP-4444
+// which specifies the expiry of historical data.
+func (e *HistoryPrunedError) ErrorCode() int {
+	return 4444
+}
@@ -338,6 +338,12 @@ func (b *backendMock) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 func (b *backendMock) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription {
 	return nil
 }
+func (b *backendMock) SubscribeFinalizedBlockEvent(ch chan<- core.FinalizedBlockEvent) event.Subscription {
+	return nil
+}
+func (b *backendMock) SubscribeSafeBlockEvent(ch chan<- core.SafeBlockEvent) event.Subscription {
+	return nil
+}
 func (b *backendMock) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
 	return nil
 }
@@ -268,6 +268,24 @@ func (b *LesApiBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEven
 	return b.eth.blockchain.SubscribeRemovedLogsEvent(ch)
 }
 
+// SubscribeFinalizedBlockEvent returns a subscription which never fires, the light
+// client doesn't track the finalized block.
+func (b *LesApiBackend) SubscribeFinalizedBlockEvent(ch chan<- core.FinalizedBlockEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// SubscribeSafeBlockEvent returns a subscription which never fires, the light
+// client doesn't track the safe block.
+func (b *LesApiBackend) SubscribeSafeBlockEvent(ch chan<- core.SafeBlockEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
 func (b *LesApiBackend) SyncProgress() ethereum.SyncProgress {
 	return b.eth.Downloader().Progress()
 }
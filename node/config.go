@@ -23,8 +23,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -175,6 +177,21 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// H2CHost is the host interface on which to start the RPC server carrying
+	// connections over cleartext HTTP/2 streams. If this field is empty, no HTTP/2
+	// endpoint will be started. Streams are subject to the HTTPCors and
+	// HTTPVirtualHosts checks of the HTTP endpoint.
+	H2CHost string
+
+	// H2CPort is the TCP port number on which to start the HTTP/2 stream RPC server.
+	// The default zero value is valid and will pick a port number randomly.
+	H2CPort int `toml:",omitempty"`
+
+	// H2CModules is a list of API modules to expose via the HTTP/2 stream RPC
+	// interface. If the module list is empty, all RPC API endpoints designated
+	// public will be exposed.
+	H2CModules []string
+
 	// GraphQLCors is the Cross-Origin Resource Sharing header to send to requesting
 	// clients. Please be aware that CORS is a browser enforced security, it's fully
 	// useless for custom HTTP clients.
@@ -204,6 +221,26 @@ type Config struct {
 	EnablePersonal bool `toml:"-"`
 
 	DBEngine string `toml:",omitempty"`
+
+	// AncientRemote, if set, offloads the sealed data files of the ancient
+	// chain store into a remote object store.
+	AncientRemote *rawdb.FreezerRemote `toml:"-"`
+
+	// DatabaseSizeTracking enables maintaining live size counters of the data
+	// categories in the chain database, exported as metrics and via RPC.
+	DatabaseSizeTracking bool `toml:",omitempty"`
+
+	// DatabaseSizeRescan is the interval of walking the chain database again to
+	// correct the drift of the live size counters. Zero disables rescanning.
+	DatabaseSizeRescan time.Duration `toml:",omitempty"`
+
+	// AncientCompression is the compression of the ancient chain data, either
+	// snappy (default) or zstd with dictionaries trained per table.
+	AncientCompression string `toml:",omitempty"`
+
+	// AncientChecksums enables checksumming the items of newly created ancient
+	// chain tables, so that corrupted items are detected when read.
+	AncientChecksums bool `toml:",omitempty"`
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
@@ -281,10 +318,19 @@ func DefaultWSEndpoint() string {
 	return config.WSEndpoint()
 }
 
+// H2CEndpoint resolves the HTTP/2 stream endpoint based on the configured host
+// interface and port parameters.
+func (c *Config) H2CEndpoint() string {
+	if c.H2CHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.H2CHost, c.H2CPort)
+}
+
 // ExtRPCEnabled returns the indicator whether node enables the external
-// RPC(http, ws or graphql).
+// RPC(http, ws, h2c or graphql).
 func (c *Config) ExtRPCEnabled() bool {
-	return c.HTTPHost != "" || c.WSHost != ""
+	return c.HTTPHost != "" || c.WSHost != "" || c.H2CHost != ""
 }
 
 // NodeName returns the devp2p node identifier.
@@ -36,6 +36,8 @@ const (
 	DefaultGraphQLPort = 8547        // Default TCP port for the GraphQL server
 	DefaultAuthHost    = "localhost" // Default host interface for the authenticated apis
 	DefaultAuthPort    = 8551        // Default port for the authenticated apis
+	DefaultH2CHost     = "localhost" // Default host interface for the HTTP/2 stream RPC server
+	DefaultH2CPort     = 8548        // Default TCP port for the HTTP/2 stream RPC server
 )
 
 var (
@@ -58,6 +60,8 @@ var DefaultConfig = Config{
 	HTTPTimeouts:        rpc.DefaultHTTPTimeouts,
 	WSPort:              DefaultWSPort,
 	WSModules:           []string{"net", "web3"},
+	H2CPort:             DefaultH2CPort,
+	H2CModules:          []string{"net", "web3"},
 	GraphQLVirtualHosts: []string{"localhost"},
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
@@ -62,6 +62,7 @@ type Node struct {
 	httpAuth      *httpServer //
 	wsAuth        *httpServer //
 	ipc           *ipcServer  // Stores information about the ipc http server
+	h2c           *h2cServer  // Serves RPC connections over HTTP/2 streams
 	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
 
 	databases map[*closeTrackingDB]struct{} // All open databases
@@ -152,6 +153,15 @@ func New(conf *Config) (*Node, error) {
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
 	node.wsAuth = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
 	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
+	node.h2c = newH2CServer(node.log, conf.H2CEndpoint())
+
+	// Report the program version in the RPC service descriptions.
+	node.inprocHandler.SetVersion(conf.Version)
+	for _, srv := range []*httpServer{node.http, node.httpAuth, node.ws, node.wsAuth} {
+		srv.version = conf.Version
+	}
+	node.ipc.version = conf.Version
+	node.h2c.version = conf.Version
 
 	return node, nil
 }
@@ -482,6 +492,16 @@ func (n *Node) startRPC() error {
 			return err
 		}
 	}
+	// Configure HTTP/2 streams.
+	if n.h2c.endpoint != "" {
+		if err := n.h2c.start(openAPIs, httpConfig{
+			CorsAllowedOrigins: n.config.HTTPCors,
+			Vhosts:             n.config.HTTPVirtualHosts,
+			Modules:            n.config.H2CModules,
+		}); err != nil {
+			return err
+		}
+	}
 	// Configure authenticated API
 	if len(openAPIs) != len(allAPIs) {
 		jwtSecret, err := n.obtainJWTSecret(n.config.JWTSecret)
@@ -518,6 +538,7 @@ func (n *Node) stopRPC() {
 	n.httpAuth.stop()
 	n.wsAuth.stop()
 	n.ipc.stop()
+	n.h2c.stop()
 	n.stopInProc()
 }
 
@@ -675,6 +696,11 @@ func (n *Node) WSEndpoint() string {
 	return "ws://" + n.ws.listenAddr() + n.ws.wsConfig.prefix
 }
 
+// H2CEndpoint returns the URL of the HTTP/2 stream RPC server.
+func (n *Node) H2CEndpoint() string {
+	return "h2c://" + n.h2c.listenAddr()
+}
+
 // HTTPAuthEndpoint returns the URL of the authenticated HTTP server.
 func (n *Node) HTTPAuthEndpoint() string {
 	return "http://" + n.httpAuth.listenAddr()
@@ -742,13 +768,18 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, ancient
 		db = rawdb.NewMemoryDatabase()
 	} else {
 		db, err = rawdb.Open(rawdb.OpenOptions{
-			Type:              n.config.DBEngine,
-			Directory:         n.ResolvePath(name),
-			AncientsDirectory: n.ResolveAncient(name, ancient),
-			Namespace:         namespace,
-			Cache:             cache,
-			Handles:           handles,
-			ReadOnly:          readonly,
+			Type:               n.config.DBEngine,
+			Directory:          n.ResolvePath(name),
+			AncientsDirectory:  n.ResolveAncient(name, ancient),
+			AncientRemote:      n.config.AncientRemote,
+			SizeTracking:       n.config.DatabaseSizeTracking,
+			SizeRescan:         n.config.DatabaseSizeRescan,
+			AncientCompression: n.config.AncientCompression,
+			AncientChecksums:   n.config.AncientChecksums,
+			Namespace:          namespace,
+			Cache:              cache,
+			Handles:            handles,
+			ReadOnly:           readonly,
 		})
 	}
 
@@ -789,6 +820,16 @@ func (db *closeTrackingDB) Close() error {
 	return db.Database.Close()
 }
 
+// Backup implements rawdb.Backupper, forwarding to the wrapped database.
+func (db *closeTrackingDB) Backup(dir string) (*rawdb.BackupManifest, error) {
+	return rawdb.Backup(db.Database, dir)
+}
+
+// DatabaseSizes implements rawdb.SizeReporter, forwarding to the wrapped database.
+func (db *closeTrackingDB) DatabaseSizes() (*rawdb.DatabaseSizes, error) {
+	return rawdb.ReadDatabaseSizes(db.Database)
+}
+
 // wrapDatabase ensures the database will be auto-closed when Node is closed.
 func (n *Node) wrapDatabase(db ethdb.Database) ethdb.Database {
 	wrapper := &closeTrackingDB{db, n}
@@ -479,6 +479,42 @@ func TestWebsocketHTTPOnSeparatePort_WSRequest(t *testing.T) {
 	}
 }
 
+func TestNodeH2C(t *testing.T) {
+	conf := &Config{
+		H2CHost:          "127.0.0.1",
+		HTTPVirtualHosts: []string{"example.com"},
+		Version:          "1.2.3",
+	}
+	node, err := New(conf)
+	if err != nil {
+		t.Fatalf("could not create a new node: %v", err)
+	}
+	if err := node.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	defer node.Close()
+
+	// Requests to the IP address are always allowed.
+	client, err := rpc.Dial(node.H2CEndpoint())
+	if err != nil {
+		t.Fatalf("can't dial h2c endpoint: %v", err)
+	}
+	defer client.Close()
+
+	var doc rpc.OpenRPCDocument
+	if err := client.Call(&doc, "rpc_discover"); err != nil {
+		t.Fatalf("h2c request failed: %v", err)
+	}
+	if doc.Info.Version != "1.2.3" {
+		t.Errorf("wrong API version: %q", doc.Info.Version)
+	}
+	// Requests to other host names are subject to the virtual host checks.
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(node.H2CEndpoint(), "h2c://"))
+	if _, err := rpc.Dial("h2c://localhost:" + port); err == nil {
+		t.Fatal("h2c stream accepted for disallowed virtual host")
+	}
+}
+
 type rpcPrefixTest struct {
 	httpPrefix, wsPrefix string
 	// These lists paths on which JSON-RPC should be served / not served.
@@ -60,6 +60,7 @@ type rpcHandler struct {
 type httpServer struct {
 	log      log.Logger
 	timeouts rpc.HTTPTimeouts
+	version  string        // API version reported by the RPC servers
 	mux      http.ServeMux // registered handlers go here
 
 	mu       sync.Mutex
@@ -297,6 +298,7 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig) error {
 
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
+	srv.SetVersion(h.version)
 	if err := RegisterApis(apis, config.Modules, srv); err != nil {
 		return err
 	}
@@ -328,6 +330,7 @@ func (h *httpServer) enableWS(apis []rpc.API, config wsConfig) error {
 	}
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
+	srv.SetVersion(h.version)
 	if err := RegisterApis(apis, config.Modules, srv); err != nil {
 		return err
 	}
@@ -388,6 +391,18 @@ func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, jwtSe
 	return newGzipHandler(handler)
 }
 
+// NewH2CHandlerStack returns a wrapped handler for HTTP/2 streams. It applies the
+// same checks as the HTTP handler stack, but doesn't compress responses, which
+// would hold back messages written to the stream.
+func NewH2CHandlerStack(srv http.Handler, cors []string, vhosts []string, jwtSecret []byte) http.Handler {
+	handler := newCorsHandler(srv, cors)
+	handler = newVHostHandler(vhosts, handler)
+	if len(jwtSecret) != 0 {
+		handler = newJWTHandler(jwtSecret, handler)
+	}
+	return handler
+}
+
 // NewWSHandlerStack returns a wrapped ws-related handler.
 func NewWSHandlerStack(srv http.Handler, jwtSecret []byte) http.Handler {
 	if len(jwtSecret) != 0 {
@@ -571,6 +586,7 @@ func newGzipHandler(next http.Handler) http.Handler {
 type ipcServer struct {
 	log      log.Logger
 	endpoint string
+	version  string // API version reported by the RPC server
 
 	mu       sync.Mutex
 	listener net.Listener
@@ -594,6 +610,7 @@ func (is *ipcServer) start(apis []rpc.API) error {
 		is.log.Warn("IPC opening failed", "url", is.endpoint, "error", err)
 		return err
 	}
+	srv.SetVersion(is.version)
 	is.log.Info("IPC endpoint opened", "url", is.endpoint)
 	is.listener, is.srv = listener, srv
 	return nil
@@ -613,6 +630,73 @@ func (is *ipcServer) stop() error {
 	return err
 }
 
+// h2cServer serves JSON-RPC connections over cleartext HTTP/2 streams.
+type h2cServer struct {
+	log      log.Logger
+	endpoint string
+	version  string // API version reported by the RPC server
+
+	mu       sync.Mutex
+	listener net.Listener
+	srv      *rpc.Server
+}
+
+func newH2CServer(log log.Logger, endpoint string) *h2cServer {
+	return &h2cServer{log: log, endpoint: endpoint}
+}
+
+// start registers the APIs and starts accepting HTTP/2 connections. Streams are
+// subject to the same access checks as requests to the HTTP server.
+func (hs *h2cServer) start(apis []rpc.API, config httpConfig) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.listener != nil {
+		return nil // already running
+	}
+	srv := rpc.NewServer()
+	srv.SetVersion(hs.version)
+	if err := RegisterApis(apis, config.Modules, srv); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", hs.endpoint)
+	if err != nil {
+		srv.Stop()
+		return err
+	}
+	handler := NewH2CHandlerStack(srv.HTTP2StreamHandler(), config.CorsAllowedOrigins, config.Vhosts, config.jwtSecret)
+	go rpc.ServeH2C(listener, handler)
+
+	hs.log.Info("HTTP/2 server started", "endpoint", "h2c://"+listener.Addr().String())
+	hs.listener, hs.srv = listener, srv
+	return nil
+}
+
+// listenAddr returns the listening address of the server.
+func (hs *h2cServer) listenAddr() string {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.listener == nil {
+		return ""
+	}
+	return hs.listener.Addr().String()
+}
+
+func (hs *h2cServer) stop() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.listener == nil {
+		return nil // not running
+	}
+	err := hs.listener.Close()
+	hs.srv.Stop()
+	hs.listener, hs.srv = nil, nil
+	hs.log.Info("HTTP/2 server stopped", "endpoint", hs.endpoint)
+	return err
+}
+
 // RegisterApis checks the given modules' availability, generates an allowlist based on the allowed modules,
 // and then registers all of the APIs exposed by the services.
 func RegisterApis(apis []rpc.API, modules []string, srv *rpc.Server) error {
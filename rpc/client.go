@@ -28,6 +28,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -44,6 +45,8 @@ const (
 	// Timeouts
 	defaultDialTimeout = 10 * time.Second // used if context has no deadline
 	subscribeTimeout   = 5 * time.Second  // overall timeout eth_subscribe, rpc_modules calls
+
+	resubscribeBackoffMax = 10 * time.Second // maximum wait between resubscribe attempts
 )
 
 const (
@@ -153,9 +156,9 @@ func (op *requestOp) wait(ctx context.Context, c *Client) (*jsonrpcMessage, erro
 
 // Dial creates a new client for the given URL.
 //
-// The currently supported URL schemes are "http", "https", "ws" and "wss". If rawurl is a
-// file name with no URL scheme, a local socket connection is established using UNIX
-// domain sockets on supported platforms and named pipes on Windows.
+// The currently supported URL schemes are "http", "https", "ws", "wss" and "h2c". If
+// rawurl is a file name with no URL scheme, a local socket connection is established
+// using UNIX domain sockets on supported platforms and named pipes on Windows.
 //
 // If you want to further configure the transport, use DialOptions instead of this
 // function.
@@ -203,6 +206,12 @@ func DialOptions(ctx context.Context, rawurl string, options ...ClientOption) (*
 			return nil, err
 		}
 		reconnect = rc
+	case "h2c":
+		rc, err := newClientTransportH2C(rawurl, cfg)
+		if err != nil {
+			return nil, err
+		}
+		reconnect = rc
 	case "stdio":
 		reconnect = newClientTransportIO(os.Stdin, os.Stdout)
 	case "":
@@ -495,6 +504,40 @@ func (c *Client) Subscribe(ctx context.Context, namespace string, channel interf
 	return op.sub, nil
 }
 
+// SubscribeResumable is like Subscribe, but the subscription is re-established
+// automatically when it fails, e.g. because the connection to the server was lost or
+// the server failed the subscription. The client redials the server as needed, backing
+// off between failed attempts.
+//
+// Before every attempt to subscribe, args is called to obtain the arguments of the
+// subscribe call. This can be used to resume the subscription from the last
+// notification received, by passing a cursor such as the hash of the last block seen.
+// Note that args is not called on the goroutine receiving notifications.
+//
+// The Err channel of the returned subscription is closed when Unsubscribe is called or
+// the client is closed. Errors which lead to the subscription being re-established are
+// not reported.
+func (c *Client) SubscribeResumable(ctx context.Context, namespace string, channel interface{}, args func() []interface{}) (event.Subscription, error) {
+	initial, err := c.Subscribe(ctx, namespace, channel, args()...)
+	if err != nil {
+		return nil, err
+	}
+	return event.ResubscribeErr(resubscribeBackoffMax, func(ctx context.Context, err error) (event.Subscription, error) {
+		if initial != nil {
+			sub := initial
+			initial = nil
+			return sub, nil
+		}
+		log.Debug("Resubscribing to RPC subscription", "namespace", namespace, "err", err)
+		sub, err := c.Subscribe(ctx, namespace, channel, args()...)
+		if errors.Is(err, ErrClientQuit) {
+			// The client is gone, end the subscription.
+			return event.NewSubscription(func(<-chan struct{}) error { return nil }), nil
+		}
+		return sub, err
+	}), nil
+}
+
 func (c *Client) newMessage(method string, paramsIn ...interface{}) (*jsonrpcMessage, error) {
 	msg := &jsonrpcMessage{Version: vsn, ID: c.nextID(), Method: method}
 	if paramsIn != nil { // prevent sending "params":null
@@ -30,6 +30,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -383,7 +384,136 @@ func TestClientSubscribe(t *testing.T) {
 	}
 }
 
+// This checks that a subscription failed by the server reports the error on Err, both
+// when it fails before and after activation.
+func TestClientSubscriptionFail(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	for _, n := range []int{0, 3} {
+		nc := make(chan int, n)
+		sub, err := client.Subscribe(context.Background(), "nftest", nc, "failingSubscription", n, 0)
+		if err != nil {
+			t.Fatal("can't subscribe:", err)
+		}
+		select {
+		case err := <-sub.Err():
+			if err == nil || err.Error() != "subscription failed" {
+				t.Fatalf("wrong error for %d notifications: %v", n, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("subscription with %d notifications not failed", n)
+		}
+		sub.Unsubscribe()
+	}
+}
+
 // In this test, the connection drops while Subscribe is waiting for a response.
+// trackingListener records accepted connections, so tests can break them.
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, c)
+		l.mu.Unlock()
+	}
+	return c, err
+}
+
+func (l *trackingListener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range l.conns {
+		c.Close()
+	}
+	l.conns = nil
+}
+
+func TestClientSubscribeResumable(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := &trackingListener{Listener: l}
+	defer tl.Close()
+	go server.ServeListener(tl)
+
+	client, err := newClient(context.Background(), func(ctx context.Context) (ServerCodec, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		return NewCodec(conn), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var (
+		nc    = make(chan int)
+		next  int32
+		calls int32
+		count = 3
+	)
+	args := func() []interface{} {
+		atomic.AddInt32(&calls, 1)
+		return []interface{}{"someSubscription", count, int(atomic.LoadInt32(&next))}
+	}
+	sub, err := client.SubscribeResumable(context.Background(), "nftest", nc, args)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	defer sub.Unsubscribe()
+
+	receive := func(want int) {
+		t.Helper()
+		select {
+		case val := <-nc:
+			if val != want {
+				t.Fatalf("value mismatch: got %d, want %d", val, want)
+			}
+			atomic.StoreInt32(&next, int32(val+1))
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for value %d", want)
+		}
+	}
+	for i := 0; i < count; i++ {
+		receive(i)
+	}
+	// Break the connection. The subscription should be re-established,
+	// resuming from the last value received.
+	tl.closeConns()
+	for i := count; i < 2*count; i++ {
+		receive(i)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("wrong number of subscribe attempts: %d", n)
+	}
+
+	sub.Unsubscribe()
+	select {
+	case err := <-sub.Err():
+		if err != nil {
+			t.Fatalf("unexpected error after unsubscribe: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed after unsubscribe")
+	}
+}
+
 func TestClientSubscribeClose(t *testing.T) {
 	server := newTestServer()
 	service := &notificationTestService{
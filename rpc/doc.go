@@ -74,6 +74,24 @@ An example server which uses the JSON codec:
 	 l, _ := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: "/tmp/calculator.sock"})
 	 server.ServeListener(l)
 
+# Streamed Results
+
+Results are normally encoded to JSON in memory before they are sent. Methods that return
+very large results can avoid this by returning a value that implements the Stream
+interface. The server writes the JSON encoding of such a result directly to the
+connection. SliceStream can be used for lists that should be encoded one element at a
+time, and ProducerStream for lists whose elements are produced while the result is
+written, so that the list is never held in memory as a whole:
+
+	func (s *ChainService) Logs(from, to uint64) (rpc.ProducerStream[*types.Log], error)
+
+Any other result can be written by a StreamFunc, or a TypedStreamFunc which also
+declares the type of the result for service discovery.
+
+Since a partially written result cannot be turned into an error response, the server
+closes the connection if writing a streamed result fails. This also applies to streamed
+results within batch requests, which are written directly like any other.
+
 # Subscriptions
 
 The package also supports the publish subscribe pattern through the use of subscriptions.
@@ -376,9 +376,17 @@ func (h *handler) handleSubscriptionResult(msg *jsonrpcMessage) {
 		h.log.Debug("Dropping invalid subscription message")
 		return
 	}
-	if h.clientSubs[result.ID] != nil {
-		h.clientSubs[result.ID].deliver(result.Result)
+	sub := h.clientSubs[result.ID]
+	if sub == nil {
+		return
+	}
+	// A failed subscription has already been ended by the server.
+	if result.Error != nil {
+		delete(h.clientSubs, result.ID)
+		sub.close(result.Error)
+		return
 	}
+	sub.deliver(result.Result)
 }
 
 // handleResponse processes method call responses.
@@ -531,6 +539,18 @@ func (h *handler) unsubscribe(ctx context.Context, id ID) (bool, error) {
 	return true, nil
 }
 
+// endSubscription removes a subscription failed by the server, unless the client
+// unsubscribed from it in the meantime.
+func (h *handler) endSubscription(s *Subscription) {
+	h.subLock.Lock()
+	defer h.subLock.Unlock()
+
+	if h.serverSubs[s.ID] == s {
+		close(s.err)
+		delete(h.serverSubs, s.ID)
+	}
+}
+
 type idForLog struct{ json.RawMessage }
 
 func (id idForLog) String() string {
@@ -294,7 +294,11 @@ func newHTTPServerConn(r *http.Request, w http.ResponseWriter) ServerCodec {
 	dec := json.NewDecoder(conn)
 	dec.UseNumber()
 
-	return NewFuncCodec(conn, encoder, dec.Decode)
+	codec := NewFuncCodec(conn, encoder, dec.Decode).(*jsonCodec)
+	codec.stream = func() (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	}
+	return codec
 }
 
 // Close does nothing and always returns nil.
@@ -0,0 +1,358 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"golang.org/x/net/http2"
+)
+
+// The HTTP/2 transport carries a full-duplex JSON-RPC connection on a single HTTP/2
+// stream. The client opens the stream with a POST request and keeps the request body
+// open for sending messages, while the server writes responses and notifications to
+// the response body. Many such connections can be multiplexed over one TCP
+// connection, and each of them is subject to HTTP/2 flow control.
+//
+// Only cleartext HTTP/2 with prior knowledge (h2c) is supported by the dialer.
+
+const http2StreamContentType = "application/json"
+
+var errHTTP2Required = errors.New("HTTP/2 required")
+
+// HTTP2StreamHandler returns a handler that serves a JSON-RPC connection on every
+// HTTP/2 request stream it receives. Unlike the regular HTTP handler, connections
+// support subscriptions and stay open until either side closes the stream.
+//
+// The handler must be served by an HTTP/2 server which does not impose read or write
+// timeouts on streams, otherwise long-lived connections are cut off.
+func (s *Server) HTTP2StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, errHTTP2Required.Error(), http.StatusHTTPVersionNotSupported)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		// Send the response header right away, so the client can start
+		// using the connection.
+		w.Header().Set("content-type", http2StreamContentType)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		conn := &http2ServerConn{body: r.Body, w: w, flusher: flusher}
+		codec := newHTTP2Codec(conn, r.RemoteAddr, r)
+		s.ServeCodec(codec, 0)
+	})
+}
+
+// ServeH2C accepts connections on l and serves cleartext HTTP/2 on them, passing the
+// request streams to handler. The handler is usually a server's HTTP2StreamHandler,
+// wrapped in any access checks. No timeouts are applied to the streams. When the
+// listener is closed, all accepted connections are closed as well.
+func ServeH2C(l net.Listener, handler http.Handler) error {
+	var (
+		srv   = new(http2.Server)
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+	)
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for conn := range conns {
+			conn.Close()
+		}
+	}()
+	for {
+		conn, err := l.Accept()
+		if netutil.IsTemporaryError(err) {
+			log.Warn("RPC accept error", "err", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		log.Trace("Accepted HTTP/2 RPC connection", "conn", conn.RemoteAddr())
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		go func() {
+			srv.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// DialH2C creates a new RPC client that communicates with a JSON-RPC server over a
+// cleartext HTTP/2 stream. The endpoint is an URL with scheme "h2c", e.g.
+// "h2c://localhost:8547".
+//
+// The context is used for the initial connection establishment. It does not
+// affect subsequent interactions with the client.
+func DialH2C(ctx context.Context, endpoint string) (*Client, error) {
+	connect, err := newClientTransportH2C(endpoint, new(clientConfig))
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, connect)
+}
+
+func newClientTransportH2C(endpoint string, cfg *clientConfig) (reconnectFunc, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "h2c" {
+		return nil, errors.New("unsupported HTTP/2 endpoint scheme " + u.Scheme)
+	}
+	u.Scheme = "http"
+	dialURL := u.String()
+
+	// The transport is shared among reconnects, so a new stream can reuse
+	// the TCP connection if it is still alive.
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	connect := func(ctx context.Context) (ServerCodec, error) {
+		// The stream outlives the dial context, it is canceled when the
+		// connection is closed.
+		streamCtx, cancel := context.WithCancel(context.Background())
+		pr, pw := io.Pipe()
+		req, err := http.NewRequestWithContext(streamCtx, http.MethodPost, dialURL, pr)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		req.Header.Set("content-type", http2StreamContentType)
+		for key, values := range cfg.httpHeaders {
+			req.Header[key] = values
+		}
+		if cfg.httpAuth != nil {
+			if err := cfg.httpAuth(req.Header); err != nil {
+				cancel()
+				return nil, err
+			}
+		}
+		// Abort the request if the dial context is canceled before the
+		// server has accepted the stream.
+		accepted := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancel()
+			case <-accepted:
+			}
+		}()
+		resp, err := transport.RoundTrip(req)
+		close(accepted)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			cancel()
+			return nil, HTTPError{Status: resp.Status, StatusCode: resp.StatusCode}
+		}
+		conn := &http2ClientConn{body: resp.Body, pw: pw, cancel: cancel}
+		return newHTTP2Codec(conn, u.Host, nil), nil
+	}
+	return connect, nil
+}
+
+// http2Codec is a JSON codec running on an HTTP/2 stream.
+type http2Codec struct {
+	*jsonCodec
+	info PeerInfo
+}
+
+func newHTTP2Codec(conn Conn, remote string, r *http.Request) ServerCodec {
+	codec := &http2Codec{
+		jsonCodec: NewCodec(conn).(*jsonCodec),
+		info:      PeerInfo{Transport: "http2", RemoteAddr: remote},
+	}
+	codec.remote = remote
+	if r != nil {
+		codec.info.HTTP.Version = r.Proto
+		codec.info.HTTP.Host = r.Host
+		codec.info.HTTP.Origin = r.Header.Get("Origin")
+		codec.info.HTTP.UserAgent = r.Header.Get("User-Agent")
+	}
+	return codec
+}
+
+func (c *http2Codec) peerInfo() PeerInfo {
+	return c.info
+}
+
+// http2ServerConn is the server end of a JSON-RPC connection over an HTTP/2 stream.
+type http2ServerConn struct {
+	body    io.ReadCloser
+	w       io.Writer
+	flusher http.Flusher
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *http2ServerConn) Read(p []byte) (int, error) {
+	return c.body.Read(p)
+}
+
+// Write sends p to the client immediately. It fails once the handler has returned,
+// since the response writer must not be used after that.
+func (c *http2ServerConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	n, err := c.w.Write(p)
+	if err == nil {
+		c.flusher.Flush()
+	}
+	return n, err
+}
+
+func (c *http2ServerConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	return c.body.Close()
+}
+
+// SetWriteDeadline does nothing and always returns nil. Write timeouts are
+// managed by the HTTP/2 server.
+func (c *http2ServerConn) SetWriteDeadline(time.Time) error { return nil }
+
+// http2ClientConn is the client end of a JSON-RPC connection over an HTTP/2 stream.
+type http2ClientConn struct {
+	body   io.ReadCloser
+	pw     *io.PipeWriter
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	deadline *time.Timer // fires when the write deadline passes
+	gen      uint64      // generation of the deadline, to ignore stale timers
+	expired  bool        // whether the write deadline has passed
+	writing  bool        // whether a write is in progress
+}
+
+func (c *http2ClientConn) Read(p []byte) (int, error) {
+	return c.body.Read(p)
+}
+
+// Write sends p on the request body. It blocks while the stream is flow controlled,
+// until the data is sent or the write deadline passes.
+func (c *http2ClientConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.expired {
+		c.mu.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	c.writing = true
+	c.mu.Unlock()
+
+	n, err := c.pw.Write(p)
+
+	c.mu.Lock()
+	c.writing = false
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *http2ClientConn) Close() error {
+	c.mu.Lock()
+	if c.deadline != nil {
+		c.deadline.Stop()
+	}
+	c.mu.Unlock()
+
+	c.pw.Close()
+	c.body.Close()
+	c.cancel()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for writes to the stream. If the deadline
+// passes while a write is blocked, the stream is canceled, since a partially
+// written message can't be recovered from. Later writes fail until the deadline
+// is extended.
+func (c *http2ClientConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.deadline != nil {
+		c.deadline.Stop()
+		c.deadline = nil
+	}
+	c.gen++
+	c.expired = false
+	if t.IsZero() {
+		return nil
+	}
+	timeout := time.Until(t)
+	if timeout <= 0 {
+		c.expired = true
+		return nil
+	}
+	gen := c.gen
+	c.deadline = time.AfterFunc(timeout, func() { c.expire(gen) })
+	return nil
+}
+
+// expire is called when the write deadline of the given generation passes.
+func (c *http2ClientConn) expire(gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return // deadline was changed in the meantime
+	}
+	c.expired = true
+	if c.writing {
+		c.pw.CloseWithError(os.ErrDeadlineExceeded)
+		c.cancel()
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func h2cTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	server := newTestServer()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeH2C(l, server.HTTP2StreamHandler())
+	t.Cleanup(func() {
+		l.Close()
+		server.Stop()
+	})
+	return server, "h2c://" + l.Addr().String()
+}
+
+func TestHTTP2Call(t *testing.T) {
+	t.Parallel()
+
+	_, url := h2cTestServer(t)
+	client, err := Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (echoResult{"hello", 10, &echoArgs{"world"}}); !reflect.DeepEqual(result, want) {
+		t.Fatalf("wrong result: %+v", result)
+	}
+
+	var info PeerInfo
+	if err := client.Call(&info, "test_peerInfo"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Transport != "http2" || info.HTTP.Version != "HTTP/2.0" {
+		t.Fatalf("wrong peer info: %+v", info)
+	}
+}
+
+func TestHTTP2Subscription(t *testing.T) {
+	t.Parallel()
+
+	_, url := h2cTestServer(t)
+	client, err := DialH2C(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	nc := make(chan int)
+	count := 10
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "someSubscription", count, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case val := <-nc:
+			if val != i {
+				t.Fatalf("value mismatch: got %d, want %d", val, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification %d not received", i)
+		}
+	}
+	sub.Unsubscribe()
+}
+
+// This test checks that many clients can share one TCP connection through a
+// single HTTP/2 transport.
+func TestHTTP2ConcurrentStreams(t *testing.T) {
+	t.Parallel()
+
+	_, url := h2cTestServer(t)
+	connect, err := newClientTransportH2C(url, new(clientConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		client, err := newClient(context.Background(), connect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var result echoResult
+			for j := 0; j < 20; j++ {
+				if err := client.Call(&result, "test_echo", "x", i*100+j, nil); err != nil {
+					t.Error(err)
+					return
+				}
+				if result.Int != i*100+j {
+					t.Errorf("wrong result: %+v", result)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestHTTP2StreamHandlerRejectsHTTP1(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(server.HTTP2StreamHandler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Fatalf("wrong status code: %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP2ClientWriteDeadline(t *testing.T) {
+	t.Parallel()
+
+	var (
+		pr, pw   = io.Pipe()
+		canceled = make(chan struct{})
+		conn     = &http2ClientConn{
+			body:   io.NopCloser(strings.NewReader("")),
+			pw:     pw,
+			cancel: func() { close(canceled) },
+		}
+	)
+	// A passed deadline fails writes without touching the stream, until the
+	// deadline is extended.
+	conn.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := conn.Write([]byte("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("wrong error for expired deadline: %v", err)
+	}
+	conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	go io.ReadFull(pr, make([]byte, 1))
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatalf("write failed after extending deadline: %v", err)
+	}
+	// A write blocked past the deadline cancels the stream.
+	conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := conn.Write([]byte("blocked")); err == nil {
+		t.Fatal("blocked write succeeded")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not canceled")
+	}
+}
@@ -44,6 +44,7 @@ var null = json.RawMessage("null")
 type subscriptionResult struct {
 	ID     string          `json:"subscription"`
 	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jsonError      `json:"error,omitempty"` // set if the subscription failed
 }
 
 // A value of this type can a JSON-RPC request, notification, successful response or
@@ -55,6 +56,8 @@ type jsonrpcMessage struct {
 	Params  json.RawMessage `json:"params,omitempty"`
 	Error   *jsonError      `json:"error,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
+
+	stream Stream // result to be written directly to the connection
 }
 
 func (msg *jsonrpcMessage) isNotification() bool {
@@ -102,6 +105,9 @@ func (msg *jsonrpcMessage) errorResponse(err error) *jsonrpcMessage {
 }
 
 func (msg *jsonrpcMessage) response(result interface{}) *jsonrpcMessage {
+	if s, ok := result.(Stream); ok {
+		return &jsonrpcMessage{Version: vsn, ID: msg.ID, stream: s}
+	}
 	enc, err := json.Marshal(result)
 	if err != nil {
 		return msg.errorResponse(&internalServerError{errcodeMarshalError, err.Error()})
@@ -173,11 +179,14 @@ type jsonCodec struct {
 	decode  decodeFunc       // decoder to allow multiple transports
 	encMu   sync.Mutex       // guards the encoder
 	encode  encodeFunc       // encoder to allow multiple transports
+	stream  streamFunc       // opens a writer for streamed results, optional
 	conn    deadlineCloser
 }
 
 type encodeFunc = func(v interface{}, isErrorResponse bool) error
 
+type streamFunc = func() (io.WriteCloser, error)
+
 type decodeFunc = func(v interface{}) error
 
 // NewFuncCodec creates a codec which uses the given functions to read and write. If conn
@@ -206,7 +215,11 @@ func NewCodec(conn Conn) ServerCodec {
 	encode := func(v interface{}, isErrorResponse bool) error {
 		return enc.Encode(v)
 	}
-	return NewFuncCodec(conn, encode, dec.Decode)
+	codec := NewFuncCodec(conn, encode, dec.Decode).(*jsonCodec)
+	codec.stream = func() (io.WriteCloser, error) {
+		return nopWriteCloser{conn}, nil
+	}
+	return codec
 }
 
 func (c *jsonCodec) peerInfo() PeerInfo {
@@ -245,9 +258,56 @@ func (c *jsonCodec) writeJSON(ctx context.Context, v interface{}, isErrorRespons
 		deadline = time.Now().Add(defaultWriteTimeout)
 	}
 	c.conn.SetWriteDeadline(deadline)
+
+	switch msg := v.(type) {
+	case *jsonrpcMessage:
+		if msg.stream == nil {
+			break
+		}
+		if c.stream == nil {
+			// The transport doesn't provide direct access to the connection,
+			// fall back to encoding the result in memory.
+			return c.encode(msg.materialize(), isErrorResponse)
+		}
+		return c.writeStream(ctx, func(w io.Writer) error { return streamedResponse(w, msg) })
+
+	case []*jsonrpcMessage:
+		if !hasStream(msg) {
+			break
+		}
+		if c.stream == nil {
+			for i := range msg {
+				msg[i] = msg[i].materialize()
+			}
+			return c.encode(msg, isErrorResponse)
+		}
+		return c.writeStream(ctx, func(w io.Writer) error { return streamedBatch(w, msg) })
+	}
 	return c.encode(v, isErrorResponse)
 }
 
+// writeStream writes a response containing streamed results. Since a partially
+// written response cannot be recovered from, the connection is closed if
+// writing fails.
+func (c *jsonCodec) writeStream(ctx context.Context, write func(io.Writer) error) error {
+	w, err := c.stream()
+	if err != nil {
+		return err
+	}
+	var out io.Writer = w
+	if _, ok := ctx.Deadline(); !ok {
+		out = &deadlineWriter{w: w, conn: c.conn, timeout: defaultWriteTimeout}
+	}
+	err = write(out)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.close()
+	}
+	return err
+}
+
 func (c *jsonCodec) close() {
 	c.closer.Do(func() {
 		close(c.closeCh)
@@ -255,6 +315,11 @@ func (c *jsonCodec) close() {
 	})
 }
 
+// nopWriteCloser adds a no-op Close method to a writer.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
 // Closed returns a channel which will be closed when Close is called
 func (c *jsonCodec) closed() <-chan interface{} {
 	return c.closeCh
@@ -0,0 +1,423 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	openRPCVersion = "1.2.6"
+
+	// discoverMethod is the method name mandated by the OpenRPC specification for
+	// service discovery. It is served as an alias of rpc_discover.
+	discoverMethod = "rpc.discover"
+
+	// unknownVersion is reported as the API version if the server's version
+	// has not been set.
+	unknownVersion = "unknown"
+)
+
+// OpenRPCDocument is a service description in the OpenRPC format, as returned by
+// the rpc_discover method. See https://spec.open-rpc.org for the specification.
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []*OpenRPCMethod  `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+// OpenRPCInfo contains metadata about the API.
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenRPCMethod describes a single RPC method.
+//
+// Subscriptions are described through the <namespace>_subscribe method of their
+// namespace. The names of the available subscriptions and their parameters are
+// listed in the x-subscriptions extension field of that method.
+type OpenRPCMethod struct {
+	Name           string                                 `json:"name"`
+	Params         []*OpenRPCContentDescriptor            `json:"params"`
+	Result         *OpenRPCContentDescriptor              `json:"result,omitempty"`
+	ParamStructure string                                 `json:"paramStructure,omitempty"`
+	Subscriptions  map[string][]*OpenRPCContentDescriptor `json:"x-subscriptions,omitempty"`
+}
+
+// OpenRPCContentDescriptor describes a method parameter or result.
+//
+// Go does not retain the names of method parameters, so parameters are named after
+// their type where possible. Their position is given in the x-position extension
+// field, since all parameters are passed by position.
+type OpenRPCContentDescriptor struct {
+	Name     string         `json:"name"`
+	Position *int           `json:"x-position,omitempty"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenRPCSchema `json:"schema"`
+}
+
+// OpenRPCComponents holds the schemas of named types, which are referenced from
+// method descriptions.
+type OpenRPCComponents struct {
+	Schemas map[string]*OpenRPCSchema `json:"schemas"`
+}
+
+// OpenRPCSchema is the subset of JSON Schema which is used to describe the types of
+// parameters and results. Schemas are derived from the Go types of the registered
+// methods. Types with custom JSON encoding are described as opaque values, titled
+// with their type name, unless their schema is known.
+type OpenRPCSchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Title                string                    `json:"title,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *OpenRPCSchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenRPCSchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *OpenRPCSchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*OpenRPCSchema          `json:"oneOf,omitempty"`
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+	hexQuantityPattern = "^0x(0|[1-9a-fA-F][0-9a-fA-F]*)$"
+	hexQuantitySchema  = &OpenRPCSchema{Type: "string", Pattern: hexQuantityPattern}
+	blockNumberSchema  = &OpenRPCSchema{
+		Title: "BlockNumber",
+		OneOf: []*OpenRPCSchema{
+			hexQuantitySchema,
+			{Type: "string", Enum: []string{"earliest", "latest", "pending", "safe", "finalized"}},
+		},
+	}
+	hashSchema = &OpenRPCSchema{Title: "Hash", Type: "string", Pattern: "^0x[0-9a-fA-F]{64}$"}
+
+	// knownSchemas contains the schemas of commonly used types with custom JSON
+	// encoding, which cannot be derived through reflection.
+	knownSchemas = map[reflect.Type]*OpenRPCSchema{
+		reflect.TypeOf(common.Hash{}):     hashSchema,
+		reflect.TypeOf(common.Address{}):  {Title: "Address", Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$"},
+		reflect.TypeOf(hexutil.Bytes{}):   {Title: "Bytes", Type: "string", Pattern: "^0x([0-9a-fA-F]{2})*$"},
+		reflect.TypeOf(hexutil.Big{}):     hexQuantitySchema,
+		reflect.TypeOf(hexutil.Uint64(0)): hexQuantitySchema,
+		reflect.TypeOf(hexutil.Uint(0)):   hexQuantitySchema,
+		reflect.TypeOf(big.Int{}):         {Title: "BigInt"}, // opaque, encoded as decimal number
+		reflect.TypeOf(BlockNumber(0)):    blockNumberSchema,
+		reflect.TypeOf(BlockNumberOrHash{}): {
+			Title: "BlockNumberOrHash",
+			OneOf: []*OpenRPCSchema{
+				blockNumberSchema,
+				hashSchema,
+				{
+					Type: "object",
+					Properties: map[string]*OpenRPCSchema{
+						"blockNumber":      blockNumberSchema,
+						"blockHash":        hashSchema,
+						"requireCanonical": {Type: "boolean"},
+					},
+				},
+			},
+		},
+		reflect.TypeOf(ID("")): {Title: "SubscriptionID", Type: "string"},
+	}
+
+	invalidSchemaName = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+// Discover returns an OpenRPC document describing all methods and subscriptions
+// offered by the server.
+func (s *RPCService) Discover() *OpenRPCDocument {
+	s.server.mutex.Lock()
+	version := s.server.version
+	s.server.mutex.Unlock()
+	if version == "" {
+		version = unknownVersion
+	}
+
+	s.server.services.mu.Lock()
+	defer s.server.services.mu.Unlock()
+
+	g := &schemaGenerator{schemas: make(map[string]*OpenRPCSchema)}
+	doc := &OpenRPCDocument{
+		OpenRPC:    openRPCVersion,
+		Info:       OpenRPCInfo{Title: "JSON-RPC API", Version: version},
+		Components: OpenRPCComponents{Schemas: g.schemas},
+	}
+	for namespace, svc := range s.server.services.services {
+		for name, cb := range svc.callbacks {
+			method := namespace + serviceMethodSeparator + name
+			if strings.HasSuffix(method, subscribeMethodSuffix) || strings.HasSuffix(method, unsubscribeMethodSuffix) {
+				continue // shadowed by the built-in subscription handling
+			}
+			doc.Methods = append(doc.Methods, g.method(method, cb))
+		}
+		if len(svc.subscriptions) > 0 {
+			doc.Methods = append(doc.Methods, g.subscribeMethod(namespace, svc.subscriptions))
+			doc.Methods = append(doc.Methods, g.unsubscribeMethod(namespace))
+		}
+	}
+	sort.Slice(doc.Methods, func(i, j int) bool {
+		return doc.Methods[i].Name < doc.Methods[j].Name
+	})
+	return doc
+}
+
+// schemaGenerator derives JSON schemas from Go types. Schemas of named struct types
+// are collected in schemas and referenced by name.
+type schemaGenerator struct {
+	schemas map[string]*OpenRPCSchema
+	names   map[reflect.Type]string
+}
+
+// method describes a regular RPC method.
+func (g *schemaGenerator) method(name string, cb *callback) *OpenRPCMethod {
+	m := &OpenRPCMethod{
+		Name:           name,
+		Params:         g.params(cb.argTypes),
+		ParamStructure: "by-position",
+	}
+	fntype := cb.fn.Type()
+	if fntype.NumOut() > 0 && cb.errPos != 0 {
+		m.Result = &OpenRPCContentDescriptor{Name: "result", Schema: g.schema(fntype.Out(0))}
+	} else {
+		m.Result = &OpenRPCContentDescriptor{Name: "result", Schema: &OpenRPCSchema{Type: "null"}}
+	}
+	return m
+}
+
+// subscribeMethod describes the subscribe method of a namespace.
+func (g *schemaGenerator) subscribeMethod(namespace string, subs map[string]*callback) *OpenRPCMethod {
+	m := &OpenRPCMethod{
+		Name:           namespace + subscribeMethodSuffix,
+		ParamStructure: "by-position",
+		Result:         &OpenRPCContentDescriptor{Name: "subscriptionID", Schema: g.schema(reflect.TypeOf(ID("")))},
+		Subscriptions:  make(map[string][]*OpenRPCContentDescriptor),
+	}
+	nameSchema := &OpenRPCSchema{Type: "string"}
+	for name, cb := range subs {
+		nameSchema.Enum = append(nameSchema.Enum, name)
+		m.Subscriptions[name] = g.params(cb.argTypes)
+	}
+	sort.Strings(nameSchema.Enum)
+	m.Params = []*OpenRPCContentDescriptor{{Name: "subscription", Required: true, Schema: nameSchema}}
+	return m
+}
+
+// unsubscribeMethod describes the unsubscribe method of a namespace.
+func (g *schemaGenerator) unsubscribeMethod(namespace string) *OpenRPCMethod {
+	return &OpenRPCMethod{
+		Name:           namespace + unsubscribeMethodSuffix,
+		ParamStructure: "by-position",
+		Params: []*OpenRPCContentDescriptor{
+			{Name: "subscriptionID", Required: true, Schema: g.schema(reflect.TypeOf(ID("")))},
+		},
+		Result: &OpenRPCContentDescriptor{Name: "result", Schema: &OpenRPCSchema{Type: "boolean"}},
+	}
+}
+
+// params describes positional method parameters. Go does not retain parameter
+// names, so they are named after their type, or by position if the type is unnamed
+// or used more than once. Trailing pointer arguments may be omitted by the caller
+// and are therefore not required.
+func (g *schemaGenerator) params(types []reflect.Type) []*OpenRPCContentDescriptor {
+	var (
+		params   = make([]*OpenRPCContentDescriptor, len(types))
+		names    = make([]string, len(types))
+		used     = make(map[string]int)
+		optional = true
+	)
+	for i, t := range types {
+		names[i] = paramName(t)
+		used[names[i]]++
+	}
+	for i := len(types) - 1; i >= 0; i-- {
+		if types[i].Kind() != reflect.Ptr {
+			optional = false
+		}
+		name := names[i]
+		if name == "" || used[name] > 1 {
+			name = fmt.Sprintf("param%d", i+1)
+		}
+		position := i
+		params[i] = &OpenRPCContentDescriptor{
+			Name:     name,
+			Position: &position,
+			Required: !optional,
+			Schema:   g.schema(types[i]),
+		}
+	}
+	return params
+}
+
+// paramName derives a parameter name from the name of its type, e.g. blockNumber
+// for a BlockNumber. It returns the empty string for unnamed and builtin types,
+// whose names don't describe the parameter.
+func paramName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Name() == "" || t.PkgPath() == "" || t == reflect.TypeOf(big.Int{}) {
+		return ""
+	}
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i] // generic type arguments
+	}
+	// Lower-case the leading upper-case run, e.g. ID -> id, TxArgs -> txArgs.
+	n := 0
+	for n < len(name) && name[n] >= 'A' && name[n] <= 'Z' {
+		n++
+	}
+	if n > 1 && n < len(name) {
+		n-- // keep the start of the next word
+	}
+	return strings.ToLower(name[:n]) + name[n:]
+}
+
+// schema returns the JSON schema of a Go type.
+func (g *schemaGenerator) schema(t reflect.Type) *OpenRPCSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s, ok := knownSchemas[t]; ok {
+		return s
+	}
+	// Streamed results are described by the type they encode, if known.
+	if s, ok := reflect.Zero(t).Interface().(typedStream); ok {
+		return g.schema(s.resultType())
+	}
+	// Types with custom encoding can't be described through their fields. JSON
+	// encoding takes precedence over text encoding.
+	if implementsAny(t, jsonMarshalerType, jsonUnmarshalerType) {
+		return &OpenRPCSchema{Title: t.Name()}
+	}
+	if implementsAny(t, textMarshalerType, textUnmarshalerType) {
+		return &OpenRPCSchema{Title: t.Name(), Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenRPCSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &OpenRPCSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &OpenRPCSchema{Type: "number"}
+	case reflect.String:
+		return &OpenRPCSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &OpenRPCSchema{Type: "string"} // base64
+		}
+		return &OpenRPCSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenRPCSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.ref(t)
+	}
+	// Interfaces and types with opaque custom encoding can be anything.
+	return &OpenRPCSchema{}
+}
+
+// ref returns a reference to the schema of a named struct type, generating the
+// schema on first use.
+func (g *schemaGenerator) ref(t reflect.Type) *OpenRPCSchema {
+	if g.names == nil {
+		g.names = make(map[reflect.Type]string)
+	}
+	name, ok := g.names[t]
+	if !ok {
+		name = invalidSchemaName.ReplaceAllString(t.String(), "_")
+		for i := 2; g.schemas[name] != nil; i++ {
+			name = fmt.Sprintf("%s_%d", invalidSchemaName.ReplaceAllString(t.String(), "_"), i)
+		}
+		g.names[t] = name
+		// Reserve the name before descending into fields, so recursive
+		// types terminate.
+		g.schemas[name] = new(OpenRPCSchema)
+		*g.schemas[name] = *g.structSchema(t)
+		g.schemas[name].Title = t.Name()
+	}
+	return &OpenRPCSchema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema describes the JSON object encoding of a struct type.
+func (g *schemaGenerator) structSchema(t reflect.Type) *OpenRPCSchema {
+	s := &OpenRPCSchema{Type: "object", Properties: make(map[string]*OpenRPCSchema)}
+	g.addFields(s, t)
+	return s
+}
+
+func (g *schemaGenerator) addFields(s *OpenRPCSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		// Untagged embedded structs are inlined into the parent object.
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		s.Properties[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// implementsAny reports whether t or *t implements any of the given interfaces.
+func implementsAny(t reflect.Type, ifaces ...reflect.Type) bool {
+	for _, iface := range ifaces {
+		if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func findMethod(doc *OpenRPCDocument, name string) *OpenRPCMethod {
+	for _, m := range doc.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func TestDiscover(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	// Both the OpenRPC method name and the regular one must work.
+	var doc, doc2 OpenRPCDocument
+	if err := client.Call(&doc, "rpc.discover"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(&doc2, "rpc_discover"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc, doc2) {
+		t.Fatal("rpc.discover and rpc_discover results differ")
+	}
+	if doc.OpenRPC != openRPCVersion {
+		t.Errorf("wrong openrpc version: %q", doc.OpenRPC)
+	}
+	if doc.Info.Version != unknownVersion {
+		t.Errorf("wrong API version: %q", doc.Info.Version)
+	}
+	for i := 1; i < len(doc.Methods); i++ {
+		if doc.Methods[i-1].Name >= doc.Methods[i].Name {
+			t.Fatalf("methods not sorted: %q >= %q", doc.Methods[i-1].Name, doc.Methods[i].Name)
+		}
+	}
+
+	// Check a regular method with optional trailing argument.
+	echo := findMethod(&doc, "test_echo")
+	if echo == nil {
+		t.Fatal("test_echo missing")
+	}
+	if len(echo.Params) != 3 {
+		t.Fatalf("wrong number of params for test_echo: %d", len(echo.Params))
+	}
+	if !echo.Params[0].Required || !echo.Params[1].Required || echo.Params[2].Required {
+		t.Error("wrong required flags for test_echo params")
+	}
+	if echo.Params[0].Schema.Type != "string" || echo.Params[1].Schema.Type != "integer" {
+		t.Error("wrong param schemas for test_echo")
+	}
+	for i, name := range []string{"param1", "param2", "echoArgs"} {
+		if echo.Params[i].Name != name || echo.Params[i].Position == nil || *echo.Params[i].Position != i {
+			t.Errorf("wrong name or position of test_echo param %d: %q", i, echo.Params[i].Name)
+		}
+	}
+	ref := echo.Result.Schema.Ref
+	if ref != "#/components/schemas/rpc.echoResult" {
+		t.Fatalf("wrong result schema ref: %q", ref)
+	}
+	result := doc.Components.Schemas["rpc.echoResult"]
+	if result == nil || result.Type != "object" {
+		t.Fatalf("missing result schema: %+v", result)
+	}
+	if result.Properties["Args"].Ref != "#/components/schemas/rpc.echoArgs" {
+		t.Errorf("wrong schema for nested struct: %+v", result.Properties["Args"])
+	}
+
+	// Methods without results or returning only an error have a null result.
+	if m := findMethod(&doc, "test_noArgsRets"); m == nil || m.Result.Schema.Type != "null" {
+		t.Errorf("wrong result for test_noArgsRets: %+v", m)
+	}
+
+	// Check subscriptions.
+	sub := findMethod(&doc, "nftest_subscribe")
+	if sub == nil {
+		t.Fatal("nftest_subscribe missing")
+	}
+	wantNames := []string{"failingSubscription", "hangSubscription", "someSubscription"}
+	if !reflect.DeepEqual(sub.Params[0].Schema.Enum, wantNames) {
+		t.Errorf("wrong subscription names: %v", sub.Params[0].Schema.Enum)
+	}
+	if len(sub.Subscriptions["someSubscription"]) != 2 {
+		t.Errorf("wrong params for someSubscription: %+v", sub.Subscriptions["someSubscription"])
+	}
+	if findMethod(&doc, "nftest_unsubscribe") == nil {
+		t.Error("nftest_unsubscribe missing")
+	}
+	if findMethod(&doc, "rpc_subscribe") != nil {
+		t.Error("rpc_subscribe listed for namespace without subscriptions")
+	}
+}
+
+func TestDiscoverVersion(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	server.SetVersion("1.2.3-test")
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	var doc OpenRPCDocument
+	if err := client.Call(&doc, "rpc.discover"); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info.Version != "1.2.3-test" {
+		t.Errorf("wrong API version: %q", doc.Info.Version)
+	}
+}
+
+func TestParamName(t *testing.T) {
+	tests := []struct {
+		typ  reflect.Type
+		want string
+	}{
+		{reflect.TypeOf(BlockNumber(0)), "blockNumber"},
+		{reflect.TypeOf(&BlockNumberOrHash{}), "blockNumberOrHash"},
+		{reflect.TypeOf(ID("")), "id"},
+		{reflect.TypeOf(common.Address{}), "address"},
+		{reflect.TypeOf(""), ""},
+		{reflect.TypeOf([]common.Hash{}), ""},
+		{reflect.TypeOf(new(big.Int)), ""},
+	}
+	for _, test := range tests {
+		if have := paramName(test.typ); have != test.want {
+			t.Errorf("wrong name for %v: have %q, want %q", test.typ, have, test.want)
+		}
+	}
+}
+
+// opaqueStruct has a custom JSON encoding unrelated to its fields.
+type opaqueStruct struct {
+	inner int
+}
+
+func (s opaqueStruct) MarshalJSON() ([]byte, error) { return json.Marshal(s.inner) }
+
+// textStruct is encoded as a JSON string through its text encoding.
+type textStruct struct {
+	Field int
+}
+
+func (s textStruct) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+type schemaTestStruct struct {
+	Hash     common.Hash       `json:"hash"`
+	Number   *hexutil.Big      `json:"number,omitempty"`
+	Data     hexutil.Bytes     `json:"data"`
+	Raw      []byte            `json:"raw"`
+	Map      map[string]uint64 `json:"map"`
+	Any      interface{}       `json:"any"`
+	Skipped  int               `json:"-"`
+	Self     *schemaTestStruct `json:"self,omitempty"`
+	Big      *big.Int          `json:"big"`
+	Opaque   opaqueStruct      `json:"opaque"`
+	Text     textStruct        `json:"text"`
+	internal int
+	schemaTestEmbedded
+}
+
+type schemaTestEmbedded struct {
+	Embedded bool `json:"embedded"`
+}
+
+func TestSchemaGenerator(t *testing.T) {
+	g := &schemaGenerator{schemas: make(map[string]*OpenRPCSchema)}
+	ref := g.schema(reflect.TypeOf(&schemaTestStruct{}))
+	if ref.Ref != "#/components/schemas/rpc.schemaTestStruct" {
+		t.Fatalf("wrong ref: %q", ref.Ref)
+	}
+	s := g.schemas["rpc.schemaTestStruct"]
+	enc, _ := json.Marshal(s)
+
+	want := map[string]*OpenRPCSchema{
+		"hash":     knownSchemas[reflect.TypeOf(common.Hash{})],
+		"number":   hexQuantitySchema,
+		"data":     knownSchemas[reflect.TypeOf(hexutil.Bytes{})],
+		"raw":      {Type: "string"},
+		"map":      {Type: "object", AdditionalProperties: &OpenRPCSchema{Type: "integer"}},
+		"any":      {},
+		"self":     {Ref: "#/components/schemas/rpc.schemaTestStruct"},
+		"big":      {Title: "BigInt"},
+		"opaque":   {Title: "opaqueStruct"},
+		"text":     {Title: "textStruct", Type: "string"},
+		"embedded": {Type: "boolean"},
+	}
+	if !reflect.DeepEqual(s.Properties, want) {
+		t.Fatalf("wrong properties: %s", enc)
+	}
+	wantRequired := []string{"hash", "data", "raw", "map", "any", "big", "opaque", "text", "embedded"}
+	if !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Fatalf("wrong required properties: %v", s.Required)
+	}
+}
+
+func TestStreamSchemas(t *testing.T) {
+	tests := []struct {
+		typ  reflect.Type
+		want *OpenRPCSchema
+	}{
+		{reflect.TypeOf(ProducerStream[common.Hash](nil)), &OpenRPCSchema{Type: "array", Items: hashSchema}},
+		{reflect.TypeOf(SliceStream[uint64](nil)), &OpenRPCSchema{Type: "array", Items: &OpenRPCSchema{Type: "integer"}}},
+		{reflect.TypeOf(TypedStreamFunc[echoResult](nil)), &OpenRPCSchema{Ref: "#/components/schemas/rpc.echoResult"}},
+		{reflect.TypeOf(StreamFunc(nil)), &OpenRPCSchema{}},
+	}
+	for _, test := range tests {
+		g := &schemaGenerator{schemas: make(map[string]*OpenRPCSchema)}
+		if have := g.schema(test.typ); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("wrong schema for %v: have %+v, want %+v", test.typ, have, test.want)
+		}
+	}
+}
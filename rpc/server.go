@@ -46,9 +46,10 @@ type Server struct {
 	services serviceRegistry
 	idgen    func() ID
 
-	mutex  sync.Mutex
-	codecs map[ServerCodec]struct{}
-	run    int32
+	mutex   sync.Mutex
+	codecs  map[ServerCodec]struct{}
+	run     int32
+	version string // version of the served API, reported by rpc_discover
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -65,6 +66,15 @@ func NewServer() *Server {
 	return server
 }
 
+// SetVersion sets the version of the served API, which is reported in the service
+// description returned by rpc_discover.
+func (s *Server) SetVersion(version string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.version = version
+}
+
 // RegisterName creates a service for the given receiver type under the given name. When no
 // methods on the given receiver match the criteria to be either a RPC method or a
 // subscription an error is returned. Otherwise a new service is created and added to the
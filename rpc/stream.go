@@ -0,0 +1,237 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Stream is implemented by method results which write their JSON encoding directly
+// to the connection instead of being marshaled into memory as a whole. This is meant
+// for methods producing very large results, such as full block traces.
+//
+// Once the server has started writing a streamed result, errors can no longer be
+// reported to the caller as a JSON-RPC error response. If StreamJSON fails, the
+// connection is closed. Implementations should therefore perform any work that can
+// fail before the Stream is returned from the method.
+type Stream interface {
+	// StreamJSON writes the JSON encoding of the result to w.
+	StreamJSON(w io.Writer) error
+}
+
+// StreamFunc is an adapter to allow the use of ordinary functions as a Stream.
+type StreamFunc func(w io.Writer) error
+
+// StreamJSON implements Stream.
+func (f StreamFunc) StreamJSON(w io.Writer) error {
+	return f(w)
+}
+
+// TypedStreamFunc is like StreamFunc, but declares the type whose JSON encoding
+// the function writes, so that the result can be described in service discovery.
+type TypedStreamFunc[T any] func(w io.Writer) error
+
+// StreamJSON implements Stream.
+func (f TypedStreamFunc[T]) StreamJSON(w io.Writer) error {
+	return f(w)
+}
+
+// resultType implements typedStream.
+func (f TypedStreamFunc[T]) resultType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// typedStream is implemented by the streams which know the type of their result.
+type typedStream interface {
+	// resultType returns the type whose JSON encoding is written by the stream.
+	resultType() reflect.Type
+}
+
+// SliceStream is a list of results that is streamed as a JSON array, encoding one
+// element at a time. When it is not written by the RPC server, it behaves like an
+// ordinary slice and marshals the same way.
+type SliceStream[T any] []T
+
+// StreamJSON implements Stream.
+func (s SliceStream[T]) StreamJSON(w io.Writer) error {
+	if s == nil {
+		_, err := w.Write(null)
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('[')
+	for i := range s {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		enc, err := json.Marshal(s[i])
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(enc); err != nil {
+			return err
+		}
+	}
+	bw.WriteByte(']')
+	return bw.Flush()
+}
+
+// ProducerStream is a list of results that is produced element by element while it
+// is written, so that the list is never held in memory as a whole. The function
+// must pass the elements to yield in order, and return the error if yield fails.
+// When it is not written by the RPC server, it marshals like an ordinary slice.
+type ProducerStream[T any] func(yield func(T) error) error
+
+// StreamJSON implements Stream.
+func (p ProducerStream[T]) StreamJSON(w io.Writer) error {
+	if p == nil {
+		_, err := w.Write(null)
+		return err
+	}
+	var (
+		bw    = bufio.NewWriter(w)
+		first = true
+	)
+	bw.WriteByte('[')
+	err := p(func(item T) error {
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		enc, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(enc)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteByte(']')
+	return bw.Flush()
+}
+
+// resultType implements typedStream.
+func (p ProducerStream[T]) resultType() reflect.Type {
+	return reflect.TypeOf([]T(nil))
+}
+
+// MarshalJSON encodes the produced list in memory.
+func (p ProducerStream[T]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.StreamJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// streamedResponse writes the response envelope of msg, with the result produced by
+// its stream, to w.
+func streamedResponse(w io.Writer, msg *jsonrpcMessage) error {
+	bw := bufio.NewWriter(w)
+	if err := writeStreamedMessage(bw, msg); err != nil {
+		return err
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// streamedBatch writes a batch response to w, writing the streamed results of
+// its messages directly instead of encoding them in memory.
+func streamedBatch(w io.Writer, msgs []*jsonrpcMessage) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('[')
+	for i, msg := range msgs {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		if msg.stream != nil {
+			if err := writeStreamedMessage(bw, msg); err != nil {
+				return err
+			}
+			continue
+		}
+		enc, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		bw.Write(enc)
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+// writeStreamedMessage writes the envelope of msg, with the result produced by its
+// stream, to w.
+func writeStreamedMessage(w *bufio.Writer, msg *jsonrpcMessage) error {
+	id := msg.ID
+	if id == nil {
+		id = null
+	}
+	w.WriteString(`{"jsonrpc":"` + vsn + `","id":`)
+	w.Write(id)
+	w.WriteString(`,"result":`)
+	if err := msg.stream.StreamJSON(w); err != nil {
+		return err
+	}
+	return w.WriteByte('}')
+}
+
+// hasStream reports whether any of the messages has a streamed result.
+func hasStream(msgs []*jsonrpcMessage) bool {
+	for _, msg := range msgs {
+		if msg.stream != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// materialize encodes the stream of msg into its Result field. It is used where the
+// result cannot be written to the connection directly, i.e. by transports without
+// access to the connection writer.
+func (msg *jsonrpcMessage) materialize() *jsonrpcMessage {
+	if msg == nil || msg.stream == nil {
+		return msg
+	}
+	var buf bytes.Buffer
+	if err := msg.stream.StreamJSON(&buf); err != nil {
+		return msg.errorResponse(&internalServerError{errcodeMarshalError, err.Error()})
+	}
+	msg.Result, msg.stream = buf.Bytes(), nil
+	return msg
+}
+
+// deadlineWriter extends the write deadline of the connection before every write.
+// Streamed results can take arbitrarily long to be written in full, so a deadline
+// covering the whole response would cut off large results.
+type deadlineWriter struct {
+	w       io.Writer
+	conn    deadlineCloser
+	timeout time.Duration
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	dw.conn.SetWriteDeadline(time.Now().Add(dw.timeout))
+	return dw.w.Write(p)
+}
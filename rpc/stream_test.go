@@ -0,0 +1,253 @@
+// Copyright 2023 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type streamTestService struct{}
+
+func (s *streamTestService) Slice(n int) SliceStream[echoResult] {
+	res := make(SliceStream[echoResult], n)
+	for i := range res {
+		res[i] = echoResult{String: "x", Int: i}
+	}
+	return res
+}
+
+func (s *streamTestService) NilSlice() SliceStream[int] {
+	return nil
+}
+
+func (s *streamTestService) Producer(n int) ProducerStream[echoResult] {
+	return func(yield func(echoResult) error) error {
+		for i := 0; i < n; i++ {
+			if err := yield(echoResult{String: "p", Int: i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (s *streamTestService) Func() Stream {
+	return StreamFunc(func(w io.Writer) error {
+		_, err := io.WriteString(w, `{"chunked":true}`)
+		return err
+	})
+}
+
+func (s *streamTestService) Fail() Stream {
+	return StreamFunc(func(w io.Writer) error {
+		io.WriteString(w, `[1,2,`)
+		return errors.New("stream failed")
+	})
+}
+
+func newStreamTestServer() *Server {
+	server := newTestServer()
+	if err := server.RegisterName("stream", new(streamTestService)); err != nil {
+		panic(err)
+	}
+	return server
+}
+
+func TestStreamedResults(t *testing.T) {
+	t.Parallel()
+
+	for _, transport := range []string{"inproc", "http", "ws"} {
+		transport := transport
+		t.Run(transport, func(t *testing.T) {
+			t.Parallel()
+
+			server := newStreamTestServer()
+			defer server.Stop()
+
+			var client *Client
+			if transport == "inproc" {
+				client = DialInProc(server)
+			} else {
+				var hs interface{ Close() }
+				client, hs = httpTestClient(server, transport, nil)
+				defer hs.Close()
+			}
+			defer client.Close()
+
+			var slice []echoResult
+			if err := client.Call(&slice, "stream_slice", 1000); err != nil {
+				t.Fatal(err)
+			}
+			if len(slice) != 1000 {
+				t.Fatalf("wrong result length: got %d, want %d", len(slice), 1000)
+			}
+			for i, res := range slice {
+				if res.String != "x" || res.Int != i {
+					t.Fatalf("wrong result %d: %+v", i, res)
+				}
+			}
+			var raw json.RawMessage
+			if err := client.Call(&raw, "stream_slice", 0); err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != "[]" {
+				t.Fatalf("wrong result for empty slice: %s", raw)
+			}
+			if err := client.Call(&raw, "stream_nilSlice"); err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != "null" {
+				t.Fatalf("wrong result for nil slice: %s", raw)
+			}
+			var produced []echoResult
+			if err := client.Call(&produced, "stream_producer", 1000); err != nil {
+				t.Fatal(err)
+			}
+			if len(produced) != 1000 || produced[999].String != "p" || produced[999].Int != 999 {
+				t.Fatalf("wrong produced result: %d items", len(produced))
+			}
+			if err := client.Call(&raw, "stream_producer", 0); err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != "[]" {
+				t.Fatalf("wrong result for empty producer: %s", raw)
+			}
+			var chunked map[string]bool
+			if err := client.Call(&chunked, "stream_func"); err != nil {
+				t.Fatal(err)
+			}
+			if !chunked["chunked"] {
+				t.Fatalf("wrong result for stream func: %v", chunked)
+			}
+		})
+	}
+}
+
+func TestStreamedResultsInBatch(t *testing.T) {
+	t.Parallel()
+
+	server := newStreamTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	batch := []BatchElem{
+		{Method: "stream_slice", Args: []interface{}{3}, Result: new([]echoResult)},
+		{Method: "stream_producer", Args: []interface{}{2}, Result: new([]echoResult)},
+		{Method: "test_echo", Args: []interface{}{"hello", 10, &echoArgs{"world"}}, Result: new(echoResult)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	want := []echoResult{{"x", 0, nil}, {"x", 1, nil}, {"x", 2, nil}}
+	if !reflect.DeepEqual(*batch[0].Result.(*[]echoResult), want) {
+		t.Errorf("wrong streamed result in batch: %+v", *batch[0].Result.(*[]echoResult))
+	}
+	if batch[0].Error != nil {
+		t.Errorf("unexpected error for streamed result: %v", batch[0].Error)
+	}
+	want = []echoResult{{"p", 0, nil}, {"p", 1, nil}}
+	if !reflect.DeepEqual(*batch[1].Result.(*[]echoResult), want) {
+		t.Errorf("wrong produced result in batch: %+v", *batch[1].Result.(*[]echoResult))
+	}
+	if batch[1].Error != nil {
+		t.Errorf("unexpected error for produced result: %v", batch[1].Error)
+	}
+	if batch[2].Error != nil {
+		t.Errorf("unexpected error for regular call: %v", batch[2].Error)
+	}
+}
+
+func TestStreamedResultFailure(t *testing.T) {
+	t.Parallel()
+
+	for name, req := range map[string]string{
+		"single": `{"jsonrpc":"2.0","id":1,"method":"stream_fail"}`,
+		"batch":  `[{"jsonrpc":"2.0","id":1,"method":"stream_slice","params":[2]},{"jsonrpc":"2.0","id":2,"method":"stream_fail"}]`,
+	} {
+		server := newStreamTestServer()
+		defer server.Stop()
+
+		clientConn, serverConn := net.Pipe()
+		defer clientConn.Close()
+		go server.ServeCodec(NewCodec(serverConn), 0)
+
+		// The partially written response can't be recovered from, so the
+		// server must drop the connection without sending a full response.
+		clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.WriteString(clientConn, req); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := io.ReadAll(clientConn)
+		if err != nil {
+			t.Fatalf("%s: expected connection to be closed, got %v", name, err)
+		}
+		if json.Valid(resp) {
+			t.Fatalf("%s: unexpected complete response: %s", name, resp)
+		}
+	}
+}
+
+func TestSliceStreamMarshal(t *testing.T) {
+	t.Parallel()
+
+	s := SliceStream[echoResult]{{"a", 1, nil}, {"b", 2, &echoArgs{"c"}}}
+	want, err := json.Marshal([]echoResult(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != string(want) {
+		t.Fatalf("wrong encoding: have %s, want %s", have, want)
+	}
+}
+
+func TestProducerStreamMarshal(t *testing.T) {
+	t.Parallel()
+
+	var p ProducerStream[int] = func(yield func(int) error) error {
+		for i := 1; i <= 3; i++ {
+			if err := yield(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	have, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != "[1,2,3]" {
+		t.Fatalf("wrong encoding: have %s, want [1,2,3]", have)
+	}
+	have, err = json.Marshal(ProducerStream[int](nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != "null" {
+		t.Fatalf("wrong encoding of nil producer: %s", have)
+	}
+}
@@ -97,6 +97,7 @@ type Notifier struct {
 	mu           sync.Mutex
 	sub          *Subscription
 	buffer       []json.RawMessage
+	failure      *jsonError // error the subscription failed with before activation
 	callReturned bool
 	activated    bool
 }
@@ -135,12 +136,35 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 		panic("Notify with wrong ID")
 	}
 	if n.activated {
-		return n.send(n.sub, enc)
+		return n.send(&subscriptionResult{ID: string(id), Result: enc})
 	}
 	n.buffer = append(n.buffer, enc)
 	return nil
 }
 
+// Fail ends the subscription with the given error, which is sent to the client
+// after any pending notifications. This allows the client to tell a subscription
+// which can't be served any further apart from one it unsubscribed from, and to
+// subscribe again if it wishes so.
+func (n *Notifier) Fail(id ID, err error) error {
+	n.mu.Lock()
+	if n.sub == nil {
+		panic("can't Fail before subscription is created")
+	} else if n.sub.ID != id {
+		panic("Fail with wrong ID")
+	}
+	if !n.activated {
+		n.failure = errorMessage(err).Error
+		n.mu.Unlock()
+		return nil
+	}
+	err = n.send(&subscriptionResult{ID: string(id), Error: errorMessage(err).Error})
+	n.mu.Unlock()
+
+	n.h.endSubscription(n.sub)
+	return err
+}
+
 // Closed returns a channel that is closed when the RPC connection is closed.
 // Deprecated: use subscription error channel
 func (n *Notifier) Closed() <-chan interface{} {
@@ -161,19 +185,27 @@ func (n *Notifier) takeSubscription() *Subscription {
 // the subscription ID is sent to the client.
 func (n *Notifier) activate() error {
 	n.mu.Lock()
-	defer n.mu.Unlock()
 
 	for _, data := range n.buffer {
-		if err := n.send(n.sub, data); err != nil {
+		if err := n.send(&subscriptionResult{ID: string(n.sub.ID), Result: data}); err != nil {
+			n.mu.Unlock()
 			return err
 		}
 	}
 	n.activated = true
-	return nil
+	if n.failure == nil {
+		n.mu.Unlock()
+		return nil
+	}
+	err := n.send(&subscriptionResult{ID: string(n.sub.ID), Error: n.failure})
+	n.mu.Unlock()
+
+	n.h.endSubscription(n.sub)
+	return err
 }
 
-func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
-	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Result: data})
+func (n *Notifier) send(result *subscriptionResult) error {
+	params, _ := json.Marshal(result)
 	ctx := context.Background()
 
 	msg := &jsonrpcMessage{
@@ -192,7 +224,8 @@ type Subscription struct {
 	err       chan error // closed on unsubscribe
 }
 
-// Err returns a channel that is closed when the client send an unsubscribe request.
+// Err returns a channel that is closed when the client send an unsubscribe request,
+// or the subscription was failed by the server.
 func (s *Subscription) Err() <-chan error {
 	return s.err
 }
@@ -280,7 +313,8 @@ func (sub *ClientSubscription) deliver(result json.RawMessage) (ok bool) {
 	}
 }
 
-// close is called by the client's message dispatcher when the connection is closed.
+// close is called by the client's message dispatcher when the connection is closed,
+// or the server failed the subscription.
 func (sub *ClientSubscription) close(err error) {
 	select {
 	case sub.quit <- err:
@@ -218,6 +218,29 @@ func (s *notificationTestService) HangSubscription(ctx context.Context, val int)
 	return subscription, nil
 }
 
+// FailingSubscription sends n notifications, then fails the subscription. If n is
+// zero, the subscription fails before it is activated.
+func (s *notificationTestService) FailingSubscription(ctx context.Context, n, val int) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	if n == 0 {
+		notifier.Fail(subscription.ID, errors.New("subscription failed"))
+		return subscription, nil
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := notifier.Notify(subscription.ID, val+i); err != nil {
+				return
+			}
+		}
+		notifier.Fail(subscription.ID, errors.New("subscription failed"))
+	}()
+	return subscription, nil
+}
+
 // largeRespService generates arbitrary-size JSON responses.
 type largeRespService struct {
 	length int
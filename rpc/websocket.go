@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -291,8 +292,12 @@ func newWebsocketCodec(conn *websocket.Conn, host string, req http.Header) Serve
 	encode := func(v interface{}, isErrorResponse bool) error {
 		return conn.WriteJSON(v)
 	}
+	codec := NewFuncCodec(conn, encode, conn.ReadJSON).(*jsonCodec)
+	codec.stream = func() (io.WriteCloser, error) {
+		return conn.NextWriter(websocket.TextMessage)
+	}
 	wc := &websocketCodec{
-		jsonCodec: NewFuncCodec(conn, encode, conn.ReadJSON).(*jsonCodec),
+		jsonCodec: codec,
 		conn:      conn,
 		pingReset: make(chan struct{}, 1),
 		info: PeerInfo{